@@ -2,9 +2,12 @@ package triangle
 
 import (
 	"bytes"
+	"context"
 	"image"
 	_ "image/png"
 	"io/ioutil"
+	"math/rand"
+	"runtime"
 	"testing"
 )
 
@@ -22,6 +25,9 @@ func BenchmarkDraw(b *testing.B) {
 		BlurRadius:      2,
 		SobelThreshold:  10,
 		PointsThreshold: 20,
+		PointRate:       0.075,
+		BlurFactor:      1,
+		EdgeFactor:      6,
 		StrokeWidth:     0,
 		Wireframe:       0,
 	}
@@ -35,3 +41,123 @@ func BenchmarkDraw(b *testing.B) {
 		}
 	}
 }
+
+// benchmarkProcessor returns the processor used by the pipeline benchmarks.
+func benchmarkProcessor() Processor {
+	return Processor{
+		MaxPoints:       2500,
+		BlurRadius:      2,
+		SobelThreshold:  10,
+		PointsThreshold: 20,
+		PointRate:       0.075,
+		BlurFactor:      1,
+		EdgeFactor:      6,
+	}
+}
+
+// BenchmarkGenTriangles and BenchmarkTriangulator compare the allocations of the
+// pipeline allocating new buffers for every image with the one reusing them.
+func BenchmarkGenTriangles(b *testing.B) {
+	img := newTestImage(1280, 720)
+	proc := benchmarkProcessor()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := genTriangles(context.Background(), img, proc); err != nil {
+			b.Fatalf("Failed generating the triangles: %v", err)
+		}
+	}
+}
+
+func BenchmarkTriangulator(b *testing.B) {
+	img := newTestImage(1280, 720)
+	tr := &Triangulator{Processor: benchmarkProcessor()}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := tr.Process(img); err != nil {
+			b.Fatalf("Failed generating the triangles: %v", err)
+		}
+	}
+}
+
+// newEdgeImage returns a 4K image filled with a pattern resembling an edge map.
+func newEdgeImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 3840, 2160))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i] = uint8((i / 4) % 251)
+		img.Pix[i+3] = 255
+	}
+	return img
+}
+
+func benchmarkStackBlur(b *testing.B, workers int) {
+	img := newEdgeImage()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		StackBlurParallel(img, 10, 1, workers)
+	}
+}
+
+func BenchmarkStackBlur_Serial(b *testing.B) {
+	benchmarkStackBlur(b, 1)
+}
+
+func BenchmarkStackBlur_Parallel(b *testing.B) {
+	benchmarkStackBlur(b, runtime.NumCPU())
+}
+
+func benchmarkGetPoints(b *testing.B, workers int) {
+	img := newEdgeImage()
+	proc := &Processor{
+		PointRate: 0.075,
+		Workers:   workers,
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		proc.GetPoints(img, 20, 2500)
+	}
+}
+
+func BenchmarkGetPoints_Serial(b *testing.B) {
+	benchmarkGetPoints(b, 1)
+}
+
+func BenchmarkGetPoints_Parallel(b *testing.B) {
+	benchmarkGetPoints(b, runtime.NumCPU())
+}
+
+func benchmarkDrawTriangles(b *testing.B, workers int) {
+	src := newEdgeImage()
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// The same 5000 points are triangulated in advance, so only the rendering of the triangles is measured.
+	rng := rand.New(rand.NewSource(1))
+	pts := make([]Point, 5000)
+	for i := range pts {
+		pts[i] = Point{X: rng.Float64() * float64(w), Y: rng.Float64() * float64(h)}
+	}
+	img, triangles, _, err := new(scratch).triangulatePoints(context.Background(), src, benchmarkProcessor(), pts)
+	if err != nil {
+		b.Fatalf("Failed generating the triangles: %v", err)
+	}
+	im := &Image{Processor: Processor{StrokeWidth: 1, Workers: workers}}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		im.drawTriangles(dst, img, nil, triangles, 1, 1)
+	}
+}
+
+func BenchmarkDrawTriangles_Serial(b *testing.B) {
+	benchmarkDrawTriangles(b, 1)
+}
+
+func BenchmarkDrawTriangles_Parallel(b *testing.B) {
+	benchmarkDrawTriangles(b, runtime.NumCPU())
+}
@@ -0,0 +1,122 @@
+package triangle
+
+import (
+	"image"
+	"math"
+)
+
+// tan22 and tan67 are the tangents of the angles separating the four gradient directions
+// considered by the non-maximum suppression.
+const (
+	tan22 = 0.41421356
+	tan67 = 2.41421356
+)
+
+// CannyFilter detects the image edges using the Canny edge detector, which results in thin,
+// single pixel wide contours. The pixels having a gradient magnitude above the high threshold
+// are considered edges, together with the ones above the low threshold connected to them.
+// See https://en.wikipedia.org/wiki/Canny_edge_detector
+func CannyFilter(img *image.NRGBA, low, high float64) *image.NRGBA {
+	return new(scratch).cannyFilter(img, low, high, NoEdgeBias)
+}
+
+// cannyFilter is like CannyFilter, but it stores the intermediate results in the scratch buffers.
+// The gradient magnitudes are weighted according to the edge bias, weakening the edges not favored by it.
+func (s *scratch) cannyFilter(img *image.NRGBA, low, high float64, bias int) *image.NRGBA {
+	dx, dy := img.Bounds().Dx(), img.Bounds().Dy()
+	wx, wy := edgeBiasWeights(bias)
+
+	s.edges = reuseImage(s.edges, img.Bounds())
+	s.data = getImageData(s.data, img)
+	s.gradients = reuseSlice(s.gradients, dx*dy)
+	s.directions = reuseSlice(s.directions, dx*dy)
+	dst, data, gradients, directions := s.edges, s.data, s.gradients, s.directions
+
+	// Compute the gradient magnitude and its direction rounded to one of the horizontal,
+	// vertical and the two diagonal directions. The border pixels are not considered edges.
+	for i := range gradients {
+		gradients[i], directions[i] = 0, 0
+	}
+	for y := 1; y < dy-1; y++ {
+		for x := 1; x < dx-1; x++ {
+			i := y*dx + x
+			gx, gy := gradient(data, dx, i-dx-1, kernelX, kernelY)
+			gradients[i] = float32(Min(math.Sqrt(float64(gx*gx)*wx*wx+float64(gy*gy)*wy*wy), 255))
+
+			ax, ay := math.Abs(float64(gx)), math.Abs(float64(gy))
+			switch {
+			case ay <= ax*tan22:
+				directions[i] = 0
+			case ay >= ax*tan67:
+				directions[i] = 1
+			case (gx > 0) == (gy > 0):
+				directions[i] = 2
+			default:
+				directions[i] = 3
+			}
+		}
+	}
+
+	// Offsets of the two neighbors along the gradient direction.
+	offsets := [4]int{1, dx, dx + 1, dx - 1}
+
+	// Suppress the pixels which are not a local maximum along the gradient direction,
+	// then mark the strong edges and push them to the stack for the hysteresis tracking.
+	s.stack = s.stack[:0]
+	for i := range dst.Pix {
+		dst.Pix[i] = 0
+	}
+	for y := 1; y < dy-1; y++ {
+		for x := 1; x < dx-1; x++ {
+			i := y*dx + x
+			g := gradients[i]
+			if g < float32(high) || g == 0 {
+				continue
+			}
+			if s.isLocalMax(i, offsets[directions[i]]) {
+				setEdge(dst, i)
+				s.stack = append(s.stack, i)
+			}
+		}
+	}
+
+	// Extend the strong edges with the connected weak edges, being above the low threshold.
+	for len(s.stack) > 0 {
+		i := s.stack[len(s.stack)-1]
+		s.stack = s.stack[:len(s.stack)-1]
+
+		for _, n := range [8]int{i - dx - 1, i - dx, i - dx + 1, i - 1, i + 1, i + dx - 1, i + dx, i + dx + 1} {
+			x, y := n%dx, n/dx
+			if x < 1 || x >= dx-1 || y < 1 || y >= dy-1 || dst.Pix[n*4+3] != 0 {
+				continue
+			}
+			if g := gradients[n]; g >= float32(low) && g > 0 && s.isLocalMax(n, offsets[directions[n]]) {
+				setEdge(dst, n)
+				s.stack = append(s.stack, n)
+			}
+		}
+	}
+
+	// The non edge pixels are opaque black, like in the case of the other edge detectors.
+	for i := 3; i < len(dst.Pix); i += 4 {
+		dst.Pix[i] = 255
+	}
+	return dst
+}
+
+// isLocalMax reports whether the gradient magnitude of the i-th pixel is the local maximum
+// compared to its neighbors at the provided offset. The ties are resolved in favor of
+// the first neighbor, so the contours along plateaus remain one pixel wide.
+func (s *scratch) isLocalMax(i, offset int) bool {
+	g := s.gradients[i]
+	return g > s.gradients[i-offset] && g >= s.gradients[i+offset]
+}
+
+// setEdge marks the i-th pixel of the image as an edge. The alpha channel is used for
+// tracking the visited pixels and it's set to opaque at the end of the edge detection.
+func setEdge(img *image.NRGBA, i int) {
+	img.Pix[i*4] = 255
+	img.Pix[i*4+1] = 255
+	img.Pix[i*4+2] = 255
+	img.Pix[i*4+3] = 1
+}
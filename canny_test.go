@@ -0,0 +1,50 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// newGradientImage returns an image with a smooth vertical step between a dark and a bright region.
+func newGradientImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(255 / (1 + math.Exp(-float64(x-w/2)/3)))
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+// countEdges returns the number of edge pixels of the edge detector output.
+func countEdges(img *image.NRGBA) int {
+	var n int
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i] > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCannyFilter(t *testing.T) {
+	w, h := 100, 50
+	img := newGradientImage(w, h)
+
+	sobel := countEdges(SobelFilter(img, 20))
+	canny := countEdges(CannyFilter(img, 20, 50))
+
+	if canny == 0 {
+		t.Fatal("expected the Canny edge detector to find the edges")
+	}
+	if canny >= sobel {
+		t.Errorf("expected Canny to be sparser than Sobel, got %d and %d edge pixels", canny, sobel)
+	}
+	// The step is detected as a single pixel wide line, except the border rows.
+	if canny > h-2 {
+		t.Errorf("expected at most %d edge pixels, got %d", h-2, canny)
+	}
+}
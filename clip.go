@@ -0,0 +1,90 @@
+package triangle
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+
+	"github.com/fogleman/gg"
+)
+
+const (
+	// NoClip - renders the output without clipping it
+	NoClip = iota
+	// CircleClip - clips the output to a circle centered on the image, leaving the corners transparent
+	CircleClip
+	// RoundedRectClip - clips the output to a rectangle having rounded corners
+	RoundedRectClip
+)
+
+// clipRadius returns the radius of the clip shape fitting the width x height rectangle. When the ClipRadius option is
+// not defined, the circle is the largest one fitting the rectangle, while the corner radius is a tenth of its shorter side.
+func (p Processor) clipRadius(width, height float64) float64 {
+	if p.ClipRadius > 0 {
+		return p.ClipRadius
+	}
+	if p.ClipShape == RoundedRectClip {
+		return math.Min(width, height) / 10
+	}
+	return math.Min(width, height) / 2
+}
+
+// clipMask returns the coverage of the clip shape on the width x height output, in the alpha channel of the returned image.
+func (p Processor) clipMask(width, height int) *image.RGBA {
+	w, h := float64(width), float64(height)
+	r := p.clipRadius(w, h)
+
+	dc := gg.NewContext(width, height)
+	switch p.ClipShape {
+	case CircleClip:
+		dc.DrawCircle(w/2, h/2, r)
+	case RoundedRectClip:
+		dc.DrawRoundedRectangle(0, 0, w, h, r)
+	}
+	dc.SetRGBA(0, 0, 0, 1)
+	dc.Fill()
+	return dc.Image().(*image.RGBA)
+}
+
+// clipImage clips the image to the clip shape, making the pixels outside of it transparent.
+// The image is alpha-premultiplied, so all the channels are scaled by the coverage of the shape.
+func (p Processor) clipImage(img *image.RGBA) {
+	mask := p.clipMask(img.Rect.Dx(), img.Rect.Dy())
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := uint32(mask.Pix[i+3])
+		for c := i; c < i+4; c++ {
+			img.Pix[c] = uint8((uint32(img.Pix[c])*a + 127) / 255)
+		}
+	}
+}
+
+// clipImage64 is like clipImage, but it clips the image having 16 bits per channel.
+func (p Processor) clipImage64(img *image.RGBA64) {
+	mask := p.clipMask(img.Rect.Dx(), img.Rect.Dy())
+	for i := 0; i < len(img.Pix); i += 2 {
+		a := uint32(mask.Pix[(i/8)*4+3])
+		v := (uint32(img.Pix[i])<<8 | uint32(img.Pix[i+1])) * a / 255
+		img.Pix[i], img.Pix[i+1] = uint8(v>>8), uint8(v)
+	}
+}
+
+// clipElement returns the SVG element of the clip shape in the coordinates of the SVG view box,
+// or an empty string in case the output is not clipped.
+func (svg *SVG) clipElement() string {
+	if svg.ClipShape == NoClip {
+		return ""
+	}
+	// The clip radius is defined in the output pixels, so it's scaled to the view box.
+	w, h := float64(svg.ViewBoxWidth), float64(svg.ViewBoxHeight)
+	scale := math.Min(w/float64(Max(svg.Width, 1)), h/float64(Max(svg.Height, 1)))
+	r := svg.clipRadius(float64(svg.Width), float64(svg.Height)) * scale
+
+	num := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if svg.ClipShape == CircleClip {
+		return fmt.Sprintf(`<circle cx="%s" cy="%s" r="%s"/>`, num(w/2), num(h/2), num(r))
+	}
+	return fmt.Sprintf(`<rect width="%s" height="%s" rx="%s"/>`, num(w), num(h), num(r))
+}
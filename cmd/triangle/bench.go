@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/esimov/triangle/v2"
+	"github.com/esimov/triangle/v2/utils"
+)
+
+// benchCommand is the name of the subcommand sweeping the processing parameters.
+const benchCommand = "bench"
+
+// benchResult holds the outcome of a single run of the parameter sweep.
+type benchResult struct {
+	maxPoints      int
+	blurRadius     int
+	sobelThreshold int
+	stats          triangle.Stats
+	// rmse is the root mean square error of the output against the source, computed only on request.
+	rmse float64
+}
+
+// bench triangulates the source image with every combination of the swept MaxPoints, BlurRadius and
+// SobelThreshold values, writing the processing time and the number of the generated triangles as a table to w.
+func bench(ctx context.Context, args []string, w io.Writer) error {
+	flags := flag.NewFlagSet(benchCommand, flag.ContinueOnError)
+	var (
+		source     = flags.String("in", "", "Source image")
+		maxPoints  = flags.String("pts", "1000,2500,5000", "Comma separated list of the maximum number of points")
+		blurRadius = flags.String("bl", "1,2,4", "Comma separated list of the blur radii")
+		sobel      = flags.String("so", "5,10,20", "Comma separated list of the Sobel filter thresholds")
+		metric     = flags.Bool("rmse", false, "Compute the root mean square error of the output against the source image")
+		configPath = flags.String("config", "", "JSON file defining the processing profile the swept values are applied to")
+		threads    = flags.Int("tw", defaultProcessor().Workers, "Number of workers used by the parallelizable processing stages")
+	)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: triangle %s -in <source> [options]\n", benchCommand)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	points, err := parseInts("pts", *maxPoints)
+	if err != nil {
+		return err
+	}
+	blurs, err := parseInts("bl", *blurRadius)
+	if err != nil {
+		return err
+	}
+	sobels, err := parseInts("so", *sobel)
+	if err != nil {
+		return err
+	}
+
+	// The swept values are applied over the defaults of the command line flags.
+	d := defaultProcessor()
+	p := &d
+	p.Workers = *threads
+	// The source image of the profile is used only in case it's not provided explicitly.
+	if *configPath != "" {
+		cfg := utils.Config{In: *source, Processor: *p}
+		if err := utils.ReadConfig(*configPath, &cfg); err != nil {
+			return err
+		}
+		if *source == "" {
+			*source = cfg.In
+		}
+		*p = cfg.Processor
+	}
+	if *source == "" || *source == pipeName {
+		flags.Usage()
+		return errors.New("the source image file is missing")
+	}
+
+	f, err := os.Open(*source)
+	if err != nil {
+		return fmt.Errorf("unable to open the source file: %w", err)
+	}
+	defer f.Close()
+
+	src, err := (&triangle.Image{}).DecodeImage(f)
+	if err != nil {
+		return err
+	}
+
+	results, err := runBench(ctx, src, *p, points, blurs, sobels, *metric)
+	if err != nil {
+		return err
+	}
+	return writeBench(w, results, *metric)
+}
+
+// runBench triangulates the source image with every combination of the parameter values, in the order
+// of the MaxPoints, BlurRadius and SobelThreshold values.
+func runBench(
+	ctx context.Context,
+	src image.Image,
+	proc triangle.Processor,
+	points, blurs, sobels []int,
+	metric bool,
+) ([]benchResult, error) {
+	var ref *image.NRGBA
+	if metric {
+		ref = triangle.ImgToNRGBA(src)
+		// The output is compared pixel by pixel, so it's rendered at the size of the source.
+		proc.OutputWidth, proc.OutputHeight = 0, 0
+	}
+
+	results := make([]benchResult, 0, len(points)*len(blurs)*len(sobels))
+	for _, pts := range points {
+		for _, bl := range blurs {
+			for _, so := range sobels {
+				p := proc
+				p.MaxPoints, p.BlurRadius, p.SobelThreshold = pts, bl, so
+				p.Stats = new(triangle.Stats)
+				if err := p.Validate(); err != nil {
+					return nil, err
+				}
+
+				img, _, _, err := (&triangle.Image{Processor: p}).DrawContext(ctx, src, p, func() {})
+				if err != nil {
+					return nil, err
+				}
+				res := benchResult{
+					maxPoints:      pts,
+					blurRadius:     bl,
+					sobelThreshold: so,
+					stats:          *p.Stats,
+				}
+				if metric {
+					res.rmse = rmse(ref, triangle.ImgToNRGBA(img))
+				}
+				results = append(results, res)
+			}
+		}
+	}
+	return results, nil
+}
+
+// writeBench writes the results of the parameter sweep as a table, one row for each run.
+func writeBench(w io.Writer, results []benchResult, metric bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	header := "PTS\tBL\tSO\tTIME\tPOINTS\tTRIANGLES\t"
+	if metric {
+		header += "RMSE\t"
+	}
+	fmt.Fprintln(tw, header)
+	for _, r := range results {
+		row := fmt.Sprintf("%d\t%d\t%d\t%v\t%d\t%d\t",
+			r.maxPoints, r.blurRadius, r.sobelThreshold,
+			r.stats.Total.Round(time.Millisecond), r.stats.Points, r.stats.Triangles,
+		)
+		if metric {
+			row += fmt.Sprintf("%.2f\t", r.rmse)
+		}
+		fmt.Fprintln(tw, row)
+	}
+	return tw.Flush()
+}
+
+// parseInts parses the comma separated list of non-negative integers of the named flag.
+func parseInts(name, s string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid -%s value: %q", name, field)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// rmse returns the root mean square error of the color channels of the output against the source image,
+// in the [0, 255] range. The images are compared over their common area.
+func rmse(src, out *image.NRGBA) float64 {
+	b := src.Bounds().Intersect(out.Bounds())
+	if b.Empty() {
+		return 0
+	}
+
+	var sum float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c1, c2 := src.NRGBAAt(x, y), out.NRGBAAt(x, y)
+			for _, d := range []float64{
+				float64(c1.R) - float64(c2.R),
+				float64(c1.G) - float64(c2.G),
+				float64(c1.B) - float64(c2.B),
+			} {
+				sum += d * d
+			}
+		}
+	}
+	return math.Sqrt(sum / float64(3*b.Dx()*b.Dy()))
+}
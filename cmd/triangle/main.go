@@ -1,29 +1,32 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"image"
-	"image/jpeg"
-	"image/png"
 	"io"
-	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
-	"text/template"
 	"time"
 
 	"github.com/esimov/triangle/v2"
 	"github.com/esimov/triangle/v2/utils"
-	"golang.org/x/image/bmp"
 	"golang.org/x/term"
 )
 
@@ -37,18 +40,20 @@ const helperBanner = `
 // pipeName is the file name that indicates stdin/stdout is being used.
 const pipeName = "-"
 
-// The default http address used for accessing the generated SVG file in case of -web flag is used.
-const httpAddress = "http://localhost:8080"
+// httpHost is the host the generated SVG file is served on in case of -web flag is used.
+const httpHost = "localhost"
+
+// shutdownTimeout is the time the HTTP server waits for the active connections on shutdown.
+const shutdownTimeout = 5 * time.Second
 
 // maxWorkers sets the maximum number of concurrently running workers.
 const maxWorkers = 20
 
 // result holds the relevant information about the triangulation process and the generated image.
 type result struct {
-	path      string
-	triangles []triangle.Triangle
-	points    []triangle.Point
-	err       error
+	path  string
+	stats triangle.Stats
+	err   error
 }
 
 type MessageType int
@@ -71,33 +76,157 @@ var (
 // version indicates the current build version.
 var version string
 
+// versionInfo returns the build version, the Go version and the platform the binary was built for. In case the
+// version is not set at build time, the version of the module the binary was installed from is used.
+func versionInfo() string {
+	v := version
+	if v == "" {
+		v = "devel"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+	}
+	return fmt.Sprintf("triangle %s %s %s/%s", v, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// defaultProcessor returns the processor defined by the default values of the command line flags,
+// which is shared by the bench subcommand too.
+func defaultProcessor() triangle.Processor {
+	return triangle.Processor{
+		BlurRadius:         2,
+		BlurPasses:         1,
+		SobelThreshold:     10,
+		CannyLowThreshold:  20,
+		CannyHighThreshold: 50,
+		PointsThreshold:    10,
+		PointRate:          0.075,
+		BlurFactor:         1,
+		EdgeFactor:         6,
+		MaxPoints:          2500,
+		PointRadius:        2,
+		StrokeWidth:        1,
+		Workers:            runtime.NumCPU(),
+		Quality:            100,
+		Frames:             10,
+		CellSize:           20,
+	}
+}
+
 func main() {
+	// The bench subcommand has its own set of flags.
+	if len(os.Args) > 1 && os.Args[1] == benchCommand {
+		if err := bench(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			log.Fatalf(decorateText(err.Error(), ErrorMessage))
+		}
+		return
+	}
+
+	// The default values of the processor flags.
+	d := defaultProcessor()
+
 	var (
 		// Command line flags
 		source          = flag.String("in", pipeName, "Source image")
 		destination     = flag.String("out", pipeName, "Destination image")
-		blurRadius      = flag.Int("bl", 2, "Blur radius")
-		sobelThreshold  = flag.Int("so", 10, "Sobel filter threshold")
-		pointsThreshold = flag.Int("pth", 10, "Points threshold")
-		pointRate       = flag.Float64("pr", 0.075, "Point rate")
-		blurFactor      = flag.Int("bf", 1, "Blur factor")
-		edgeFactor      = flag.Int("ef", 6, "Edge factor")
-		maxPoints       = flag.Int("pts", 2500, "Maximum number of points")
+		blurRadius      = flag.Int("bl", d.BlurRadius, "Blur radius")
+		blurType        = flag.Int("blt", 0, "Blur type (0: stack blur, 1: gaussian blur)")
+		blurPasses      = flag.Int("blp", d.BlurPasses, "Number of stack blur passes")
+		sobelThreshold  = flag.Int("so", d.SobelThreshold, "Sobel filter threshold")
+		autoThreshold   = flag.Bool("auto", false, "Compute the Sobel filter threshold from the image statistics")
+		edgeDetector    = flag.Int("edge", 0, "Edge detection operator (0: sobel, 1: scharr, 2: prewitt, 3: canny)")
+		colorEdges      = flag.Bool("ce", false, "Detect the edges on the color channels instead of the luminance")
+		edgeBias        = flag.Int("eb", 0, "Favored edge direction (0: none, 1: horizontal, 2: vertical)")
+		cannyLow        = flag.Int("cl", d.CannyLowThreshold, "Canny edge detector low threshold")
+		cannyHigh       = flag.Int("ch", d.CannyHighThreshold, "Canny edge detector high threshold")
+		pointsThreshold = flag.Int("pth", d.PointsThreshold, "Points threshold")
+		pointRate       = flag.Float64("pr", d.PointRate, "Point rate")
+		blurFactor      = flag.Int("bf", d.BlurFactor, "Blur factor")
+		edgeFactor      = flag.Int("ef", d.EdgeFactor, "Edge factor")
+		maxPoints       = flag.Int("pts", d.MaxPoints, "Maximum number of points")
+		pointsPerMP     = flag.Int("ppm", 0, "Maximum number of points per megapixel, replacing the -pts value (0 to use -pts)")
+		minPointDist    = flag.Int("mpd", 0, "Minimum distance in pixels between the sampled points (0 for no constraint)")
+		coarsening      = flag.Float64("coarsen", 0, "Favor the points of the high detail regions over the background, in the [0, 1] range")
+		pointSelection  = flag.Int("sel", 0, "Point selection (0: random, 1: farthest point, 2: top gradient)")
+		maxDimension    = flag.Int("maxdim", 0, "Downscale the images having a larger side before sampling the points (0 for no limit)")
+		lowMemory       = flag.Bool("lowmem", false, "Keep only a random sample of the edge pixels while scanning, bounding the memory use")
+		colorSampling   = flag.Int("cs", 0, "Color sampling (0: centroid, 1: average, 2: dominant)")
+		fillMode        = flag.Int("fill", 0, "Fill mode of the triangles (0: source color, 1: facet index, 2: facet normal)")
+		gammaCorrect    = flag.Bool("gamma", false, "Average and interpolate the colors in linear light")
+		shading         = flag.Int("shade", 0, "Shading of the triangles (0: flat, 1: smooth)")
+		showPoints      = flag.Bool("dots", false, "Draw a dot at every point over the triangles")
+		pointRadius     = flag.Float64("dr", d.PointRadius, "Radius of the dots drawn at the points")
+		traceContours   = flag.Bool("trace", false, "Draw the strongest edges as lines over the triangles")
 		wireframe       = flag.Int("wf", 0, "Wireframe mode (0: without stroke, 1: with stroke, 2: stroke only)")
 		noise           = flag.Int("nf", 0, "Noise factor")
-		strokeWidth     = flag.Float64("st", 1, "Stroke width")
+		noiseChromatic  = flag.Bool("nc", false, "Apply a different noise to every color channel, resulting in a chromatic grain")
+		noiseSeed       = flag.Int64("ns", 0, "Seed of the noise pattern")
+		strokeWidth     = flag.Float64("st", d.StrokeWidth, "Stroke width")
 		isStrokeSolid   = flag.Bool("sl", false, "Use solid stroke color (yes/no)")
+		solidStroke     = flag.String("slc", "", "Solid stroke color (specified as hex value), replacing the black color of -sl")
+		strokeColor     = flag.String("sc", "", "Stroke color (specified as hex value)")
+		darkenStroke    = flag.Bool("sd", false, "Use the darkened fill color as stroke color")
+		strokeOpacity   = flag.Float64("sa", 0, "Stroke opacity in the [0, 1] range (0 for the default faint stroke)")
 		grayscale       = flag.Bool("gr", false, "Output in grayscale mode")
+		luminanceMode   = flag.Int("lum", 0, "Luminance mode (0: rec. 601, 1: rec. 709, 2: linear)")
+		ignoreTransp    = flag.Bool("it", false, "Ignore the transparent pixels on edge points extraction")
 		showInBrowser   = flag.Bool("web", false, "Open the SVG file in the web browser")
+		port            = flag.Int("port", 8080, "Port of the web server used by the -web flag")
+		compact         = flag.Bool("compact", false, "Group the SVG triangles by color to reduce the file size")
+		mergeTolerance  = flag.Float64("merge", 0, "Merge the adjacent SVG triangles of similar colors into convex polygons, within this color distance")
+		precision       = flag.Int("prec", 0, "Number of decimals of the SVG node coordinates")
+		plotterMode     = flag.Bool("plotter", false, "Render only the unique triangle edges without fill in the SVG and PDF output")
+		embedPreview    = flag.Bool("preview", false, "Embed a low resolution preview and the processing options into the SVG output")
 		bgColor         = flag.String("bg", "", "Background color (specified as hex value)")
+		outputWidth     = flag.Int("ow", 0, "Output width (0: source image width)")
+		outputHeight    = flag.Int("oh", 0, "Output height (0: source image height)")
+		output16Bit     = flag.Bool("16bit", false, "Render the output at 16 bits per channel (PNG)")
 		workers         = flag.Int("cw", runtime.NumCPU(), "Number of concurrently workers")
+		threads         = flag.Int("tw", d.Workers, "Number of workers used by the parallelizable processing stages")
+		quality         = flag.Int("q", d.Quality, "Output image quality (1-100) of the JPEG and WebP encoders")
+		frames          = flag.Int("frames", d.Frames, "Number of frames of the animated GIF output")
+		relaxPasses     = flag.Int("relax", 0, "Number of Lloyd's relaxation passes evening out the triangle sizes")
+		overlay         = flag.Float64("ov", 0, "Opacity of the triangles blended over the source image (0 to render only the triangles)")
+		clipShape       = flag.Int("clip", 0, "Clip the output to a shape (0: no clip, 1: circle, 2: rounded rectangle)")
+		clipRadius      = flag.Float64("cr", 0, "Radius of the clip circle or of the rounded corners, in pixels (0 to fit the image)")
+		samplingMethod  = flag.Int("sm", 0, "Point sampling method (0: along the edges, 1: uniform grid)")
+		tessellation    = flag.Int("tess", 0, "Tessellation (0: delaunay, 1: hexagonal grid, 2: triangular grid)")
+		cellSize        = flag.Int("cell", d.CellSize, "Size of the cells of the grid tessellations, in pixels")
+		posterizeLevels = flag.Int("post", 0, "Number of levels every color channel is reduced to (0 to keep the sampled colors)")
+		paletteSize     = flag.Int("pal", 0, "Number of colors the fill colors are reduced to (0 to keep the sampled colors)")
+		voronoi         = flag.Bool("voronoi", false, "Render the Voronoi diagram of the triangulation (raster output only)")
+		minArea         = flag.Float64("minarea", 0, "Minimum area of the triangles, the smaller ones being dropped")
+		region          = flag.String("region", "", "Triangulate only a region of the image (specified as x0,y0,x1,y1)")
+		padToSquare     = flag.Bool("pad", false, "Pad the image to a square, keeping its aspect ratio")
+		padColor        = flag.String("padc", "", "Color of the padding added by the -pad flag (specified as hex value)")
+		rotate          = flag.Int("rot", 0, "Rotate the image clockwise before the triangulation (0, 90, 180 or 270 degrees)")
+		flipH           = flag.Bool("fh", false, "Flip the image horizontally before the triangulation")
+		flipV           = flag.Bool("fv", false, "Flip the image vertically before the triangulation")
+		maskPath        = flag.String("mask", "", "Grayscale image defining the density of the points")
+		pointsPath      = flag.String("points", "", "CSV or JSON file of x,y points triangulated in place of the detected ones")
+		configPath      = flag.String("config", "", "JSON file defining a processing profile, overridden by the explicit flags")
+		statsFormat     = flag.String("stats", "", "Write the processing statistics to stdout, or to stderr when piping the output (json)")
+		recursive       = flag.Bool("r", false, "Process the images of the subdirectories too, preserving the directory structure")
+		format          = flag.String("format", "", "Output format of the images processed from a directory (e.g. svg, png, jpg)")
+		debugDir        = flag.String("debug-dir", "", "Directory the intermediate results of the pipeline are written to")
+		showFidelity    = flag.Bool("fidelity", false, "Print the PSNR and SSIM of the output against the source image (PNG or JPEG output)")
+		dryRun          = flag.Bool("dry-run", false, "Triangulate the images without rendering and writing them, reporting only the counts")
+		alsoSVG         = flag.Bool("also-svg", false, "Write an SVG of the same triangulation next to the raster output, having the same base name")
+		showVersion     = flag.Bool("version", false, "Print the version, the Go version and the platform of the build")
 
 		// File related variables
 		fs  os.FileInfo
 		err error
 
 		flagsCheck bool
+
+		// webSVG holds the generated SVG file served in case of -web flag is used.
+		webSVG []byte
 	)
+	// The long form of the -r flag sets the same variable.
+	flag.BoolVar(recursive, "recursive", false, "Same as -r")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, fmt.Sprintf(helperBanner, version))
@@ -105,21 +234,119 @@ func main() {
 	}
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(versionInfo())
+		return
+	}
+
 	p := &triangle.Processor{
-		BlurRadius:      *blurRadius,
-		SobelThreshold:  *sobelThreshold,
-		PointsThreshold: *pointsThreshold,
-		PointRate:       *pointRate,
-		BlurFactor:      *blurFactor,
-		EdgeFactor:      *edgeFactor,
-		MaxPoints:       *maxPoints,
-		Wireframe:       *wireframe,
-		Noise:           *noise,
-		StrokeWidth:     *strokeWidth,
-		IsStrokeSolid:   *isStrokeSolid,
-		Grayscale:       *grayscale,
-		ShowInBrowser:   *showInBrowser,
-		BgColor:         *bgColor,
+		BlurRadius:           *blurRadius,
+		BlurType:             *blurType,
+		BlurPasses:           *blurPasses,
+		SobelThreshold:       *sobelThreshold,
+		AutoThreshold:        *autoThreshold,
+		EdgeDetector:         *edgeDetector,
+		ColorEdges:           *colorEdges,
+		EdgeBias:             *edgeBias,
+		CannyLowThreshold:    *cannyLow,
+		CannyHighThreshold:   *cannyHigh,
+		PointsThreshold:      *pointsThreshold,
+		PointRate:            *pointRate,
+		BlurFactor:           *blurFactor,
+		EdgeFactor:           *edgeFactor,
+		MaxPoints:            *maxPoints,
+		PointsPerMegapixel:   *pointsPerMP,
+		MinPointDistance:     *minPointDist,
+		BackgroundCoarsening: *coarsening,
+		PointSelection:       *pointSelection,
+		MaxDimension:         *maxDimension,
+		LowMemory:            *lowMemory,
+		ColorSampling:        *colorSampling,
+		FillMode:             *fillMode,
+		GammaCorrect:         *gammaCorrect,
+		Shading:              *shading,
+		ShowPoints:           *showPoints,
+		PointRadius:          *pointRadius,
+		TraceContours:        *traceContours,
+		Wireframe:            *wireframe,
+		Noise:                *noise,
+		NoiseChromatic:       *noiseChromatic,
+		NoiseSeed:            *noiseSeed,
+		StrokeWidth:          *strokeWidth,
+		IsStrokeSolid:        *isStrokeSolid,
+		SolidStrokeColor:     *solidStroke,
+		StrokeColor:          *strokeColor,
+		DarkenStroke:         *darkenStroke,
+		StrokeOpacity:        *strokeOpacity,
+		Grayscale:            *grayscale,
+		LuminanceMode:        *luminanceMode,
+		IgnoreTransparent:    *ignoreTransp,
+		ShowInBrowser:        *showInBrowser,
+		Compact:              *compact,
+		MergeTolerance:       *mergeTolerance,
+		PlotterMode:          *plotterMode,
+		EmbedPreview:         *embedPreview,
+		Precision:            *precision,
+		BgColor:              *bgColor,
+		OutputWidth:          *outputWidth,
+		OutputHeight:         *outputHeight,
+		Output16Bit:          *output16Bit,
+		Workers:              *threads,
+		Quality:              *quality,
+		Frames:               *frames,
+		RelaxationPasses:     *relaxPasses,
+		MinTriangleArea:      *minArea,
+		PaletteSize:          *paletteSize,
+		Posterize:            *posterizeLevels,
+		SamplingMethod:       *samplingMethod,
+		Tessellation:         *tessellation,
+		CellSize:             *cellSize,
+		Overlay:              *overlay,
+		ClipShape:            *clipShape,
+		ClipRadius:           *clipRadius,
+		Voronoi:              *voronoi,
+		PadToSquare:          *padToSquare,
+		PadColor:             *padColor,
+		Rotate:               *rotate,
+		FlipH:                *flipH,
+		FlipV:                *flipV,
+	}
+	if *configPath != "" {
+		if err := applyConfig(*configPath, p, source, destination); err != nil {
+			showProcessStatus(*destination, triangle.Stats{}, err)
+		}
+	}
+	if *region != "" {
+		rect, err := parseRegion(*region)
+		if err != nil {
+			showProcessStatus(*destination, triangle.Stats{}, err)
+		}
+		p.Region = rect
+	}
+	if *maskPath != "" {
+		mask, err := loadMask(*maskPath)
+		if err != nil {
+			showProcessStatus(*destination, triangle.Stats{}, err)
+		}
+		p.Mask = mask
+	}
+	if *pointsPath != "" {
+		points, err := loadPoints(*pointsPath)
+		if err != nil {
+			showProcessStatus(*destination, triangle.Stats{}, err)
+		}
+		p.Points = points
+	}
+	if err := p.Validate(); err != nil {
+		showProcessStatus(*destination, triangle.Stats{}, err)
+	}
+	switch *statsFormat {
+	case "":
+	case "json":
+		// The processor allocates new statistics for each image, this one only marks them as requested.
+		p.Stats = new(triangle.Stats)
+	default:
+		showProcessStatus(*destination, triangle.Stats{}, fmt.Errorf("unsupported statistics format: %v", *statsFormat))
 	}
 
 	spinnerText := fmt.Sprintf("%s %s",
@@ -129,14 +356,23 @@ func main() {
 	spinner = utils.NewSpinner(spinnerText, time.Millisecond*200, true)
 
 	// Supported input image file types.
-	supportedExt := []string{".jpg", ".jpeg", ".png", ".bmp"}
+	supportedExt := []string{".jpg", ".jpeg", ".png", ".bmp", ".gif"}
 
 	// Supported output image file types.
-	destExts := []string{".jpg", ".jpeg", ".png", ".svg"}
+	destExts := []string{".jpg", ".jpeg", ".png", ".webp", ".gif", ".ppm", ".pgm", ".svg", ".pdf", ".json", ".csv"}
+
+	// The output types the SVG can be written next to, the animated GIF being rendered frame by frame.
+	rasterExts := []string{".jpg", ".jpeg", ".png", ".webp", ".bmp", ".ppm", ".pgm"}
 
 	// Check if source path is a local image or URL.
 	if utils.IsValidUrl(*source) {
-		src, err := utils.DownloadImage(*source)
+		src, err := utils.DownloadImage(*source, utils.DownloadOptions{})
+		if err != nil {
+			log.Fatalf(
+				decorateText("Failed to download the source image: %v", ErrorMessage),
+				decorateText(err.Error(), DefaultMessage),
+			)
+		}
 		defer src.Close()
 		defer os.Remove(src.Name())
 
@@ -169,6 +405,11 @@ func main() {
 			)
 		}
 	}
+	// The intermediate results are written along with the output, which is not rendered in case of a dry run.
+	if *dryRun && *debugDir != "" {
+		log.Fatalf(decorateText("The -dry-run flag doesn't render the images, so it can't be combined with -debug-dir", ErrorMessage))
+	}
+
 	// start counting the execution time.
 	start := time.Now()
 
@@ -176,9 +417,21 @@ func main() {
 	case mode.IsDir():
 		var wg sync.WaitGroup
 
-		// Read destination file or directory.
+		// The output format is the same as the source image format, unless it's forced for every image.
+		var destExt string
+		if *format != "" {
+			destExt = "." + strings.TrimPrefix(strings.ToLower(*format), ".")
+			if !inSlice(destExt, destExts) {
+				log.Fatalf(decorateText(fmt.Sprintf("File type not supported: %v", *format), ErrorMessage))
+			}
+			if *alsoSVG && !inSlice(destExt, rasterExts) {
+				log.Fatalf(decorateText("The -also-svg flag requires a raster output format, other than GIF", ErrorMessage))
+			}
+		}
+
+		// Read destination file or directory, which is not needed in case of a dry run.
 		_, err := os.Stat(*destination)
-		if err != nil {
+		if err != nil && !*dryRun {
 			err = os.Mkdir(*destination, 0755)
 			if err != nil {
 				log.Fatalf(
@@ -195,16 +448,22 @@ func main() {
 
 		// Process recursively the image files from the specified directory concurrently.
 		ch := make(chan result)
-		done := make(chan interface{})
-		defer close(done)
-
-		paths, errc := walkDir(done, *source, supportedExt)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The GIF images keep their format, unless another one is forced, so they're skipped
+		// in case the SVG is written next to the raster outputs.
+		srcExts := supportedExt
+		if *alsoSVG && destExt == "" {
+			srcExts = []string{".jpg", ".jpeg", ".png", ".bmp"}
+		}
+		paths, errc := walkDir(ctx, *source, *destination, srcExts, *recursive)
 
 		wg.Add(*workers)
 		for i := 0; i < *workers; i++ {
 			go func() {
 				defer wg.Done()
-				consumer(done, paths, *destination, p, ch)
+				consumer(ctx, paths, *source, *destination, destExt, *debugDir, *dryRun, *alsoSVG, p, ch)
 			}()
 		}
 
@@ -216,7 +475,11 @@ func main() {
 
 		// Consume the channel values.
 		for res := range ch {
-			showProcessStatus(res.path, res.triangles, res.points, res.err)
+			if *dryRun && res.err == nil {
+				showDryRunStatus(res.path, res.stats)
+				continue
+			}
+			showProcessStatus(res.path, res.stats, res.err)
 		}
 
 		if err := <-errc; err != nil {
@@ -229,30 +492,77 @@ func main() {
 			log.Fatalf(decorateText(fmt.Sprintf("File type not supported: %v", ext), ErrorMessage))
 		}
 
-		triangles, points, err := processor(*source, *destination, p, func() {
-			if p.ShowInBrowser {
-				svg, err := os.OpenFile(*destination, os.O_CREATE|os.O_RDWR, 0755)
-				if err != nil {
-					log.Fatalf("Unable to open the destination file: %v", err)
-				}
+		// The output format of a single image is defined by the destination extension.
+		if *format != "" && "."+strings.TrimPrefix(strings.ToLower(*format), ".") != ext {
+			log.Fatalf(decorateText("The -format flag applies only to a directory, the output format of a single image is defined by the destination extension", ErrorMessage))
+		}
 
-				b, err := ioutil.ReadAll(svg)
-				if err != nil {
-					log.Fatalf("Unable to read the SVG file: %v", err)
-				}
-				fmt.Fprintf(os.Stderr, "\n\tYou can access the generated image under the following url: %s ", decorateText(httpAddress, SuccessMessage))
+		if p.ShowInBrowser && (ext != ".svg" || *destination == pipeName) {
+			log.Fatalf(decorateText("The -web flag requires an SVG destination file", ErrorMessage))
+		}
 
-				handler := func(w http.ResponseWriter, r *http.Request) {
-					w.Header().Set("Content-Type", "image/svg+xml")
-					w.Write(b)
-				}
-				http.HandleFunc("/", handler)
-				log.Fatal(http.ListenAndServe(strings.TrimPrefix(httpAddress, "http://"), nil))
+		// The output is compared to the source after it's written, so both of them have to be readable files.
+		if *showFidelity && (*source == pipeName || !inSlice(ext, []string{".png", ".jpg", ".jpeg"})) {
+			log.Fatalf(decorateText("The -fidelity flag requires a source file and a PNG or JPEG destination file", ErrorMessage))
+		}
+		// The fidelity is measured pixel by pixel, so the output must keep the size of the source.
+		if *showFidelity && (p.OutputWidth != 0 || p.OutputHeight != 0) {
+			log.Fatalf(decorateText("The -fidelity flag can't be combined with -ow or -oh, since the output must have the size of the source", ErrorMessage))
+		}
+
+		if *dryRun && (p.ShowInBrowser || *showFidelity) {
+			log.Fatalf(decorateText("The -dry-run flag doesn't write the output, so it can't be combined with -web or -fidelity", ErrorMessage))
+		}
+
+		// The SVG is named after the raster output, so it can't be written next to the standard output.
+		var svgOut string
+		if *alsoSVG && !*dryRun {
+			if *destination == pipeName || !inSlice(ext, rasterExts) {
+				log.Fatalf(decorateText("The -also-svg flag requires a raster destination file, other than GIF", ErrorMessage))
 			}
+			svgOut = strings.TrimSuffix(*destination, filepath.Ext(*destination)) + ".svg"
+		}
+
+		// The SVG served in case of -web flag is used is kept in memory while it's written.
+		var (
+			webBuf bytes.Buffer
+			web    io.Writer
+		)
+		if p.ShowInBrowser {
+			web = &webBuf
+		}
+		// The progress is shown next to the spinner only for a single image, since the spinner is shared
+		// by the images of a directory processed concurrently.
+		ctx := triangle.WithProgress(context.Background(), func(stage string, fraction float64) {
+			spinner.SetSuffix(fmt.Sprintf("%s %d%%", stage, int(fraction*100)))
 		})
+		stats, err := processor(ctx, *source, *destination, svgOut, *debugDir, *dryRun, web, p, func() {})
 		flagsCheck = true
 
-		showProcessStatus(*destination, triangles, points, err)
+		if *dryRun && err == nil {
+			showDryRunStatus(*source, stats)
+		} else {
+			showProcessStatus(*destination, stats, err)
+		}
+
+		if *showFidelity {
+			in := *source
+			if utils.IsValidUrl(in) {
+				in = imgurl.Name()
+			}
+			psnr, ssim, err := fidelity(in, *destination)
+			if err != nil {
+				log.Fatalf(decorateText(fmt.Sprintf("Unable to compute the fidelity: %v", err), ErrorMessage))
+			}
+			fmt.Fprintf(os.Stderr, "Fidelity: PSNR %s, SSIM %s\n\n",
+				decorateText(fmt.Sprintf("%.2f dB", psnr), SuccessMessage),
+				decorateText(fmt.Sprintf("%.4f", ssim), SuccessMessage),
+			)
+		}
+
+		if p.ShowInBrowser && err == nil {
+			webSVG = webBuf.Bytes()
+		}
 	}
 
 	procTime := time.Since(start)
@@ -261,16 +571,172 @@ func main() {
 	}
 
 	fmt.Fprintf(os.Stderr, "Execution time: %s\n", decorateText(fmt.Sprintf("%s", utils.FormatTime(procTime)), SuccessMessage))
+
+	if webSVG != nil {
+		if err := serveSVG(fmt.Sprintf("%s:%d", httpHost, *port), webSVG); err != nil {
+			log.Fatalf(
+				decorateText("Unable to serve the SVG file: %v", ErrorMessage),
+				decorateText(err.Error(), DefaultMessage),
+			)
+		}
+	}
+}
+
+// serveSVG serves the SVG contents on the provided address and opens it in the web browser.
+// The server runs until the CTRL-C signal is received, when it's gracefully shut down.
+func serveSVG(addr string, b []byte) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: svgHandler(b)}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+
+	url := "http://" + addr
+	fmt.Fprintf(os.Stderr, "\n\tYou can access the generated image under the following url: %s\n", decorateText(url, SuccessMessage))
+	if err := utils.OpenBrowser(url); err != nil {
+		fmt.Fprintf(os.Stderr, "\t%s\n", decorateText(fmt.Sprintf("Unable to open the web browser: %v", err), ErrorMessage))
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// svgHandler responds with the SVG contents held in memory.
+func svgHandler(b []byte) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(b)
+	})
+	return mux
+}
+
+// configFlags maps the command line flags to the processor fields they define.
+var configFlags = map[string]string{
+	"bl":      "BlurRadius",
+	"blt":     "BlurType",
+	"blp":     "BlurPasses",
+	"so":      "SobelThreshold",
+	"auto":    "AutoThreshold",
+	"edge":    "EdgeDetector",
+	"ce":      "ColorEdges",
+	"eb":      "EdgeBias",
+	"cl":      "CannyLowThreshold",
+	"ch":      "CannyHighThreshold",
+	"pth":     "PointsThreshold",
+	"pr":      "PointRate",
+	"bf":      "BlurFactor",
+	"ef":      "EdgeFactor",
+	"pts":     "MaxPoints",
+	"ppm":     "PointsPerMegapixel",
+	"mpd":     "MinPointDistance",
+	"coarsen": "BackgroundCoarsening",
+	"sel":     "PointSelection",
+	"maxdim":  "MaxDimension",
+	"lowmem":  "LowMemory",
+	"cs":      "ColorSampling",
+	"fill":    "FillMode",
+	"gamma":   "GammaCorrect",
+	"shade":   "Shading",
+	"dots":    "ShowPoints",
+	"dr":      "PointRadius",
+	"trace":   "TraceContours",
+	"wf":      "Wireframe",
+	"nf":      "Noise",
+	"nc":      "NoiseChromatic",
+	"ns":      "NoiseSeed",
+	"st":      "StrokeWidth",
+	"sl":      "IsStrokeSolid",
+	"slc":     "SolidStrokeColor",
+	"sc":      "StrokeColor",
+	"sd":      "DarkenStroke",
+	"sa":      "StrokeOpacity",
+	"gr":      "Grayscale",
+	"lum":     "LuminanceMode",
+	"it":      "IgnoreTransparent",
+	"web":     "ShowInBrowser",
+	"compact": "Compact",
+	"merge":   "MergeTolerance",
+	"plotter": "PlotterMode",
+	"preview": "EmbedPreview",
+	"prec":    "Precision",
+	"bg":      "BgColor",
+	"ow":      "OutputWidth",
+	"oh":      "OutputHeight",
+	"16bit":   "Output16Bit",
+	"tw":      "Workers",
+	"q":       "Quality",
+	"frames":  "Frames",
+	"relax":   "RelaxationPasses",
+	"minarea": "MinTriangleArea",
+	"pal":     "PaletteSize",
+	"post":    "Posterize",
+	"sm":      "SamplingMethod",
+	"tess":    "Tessellation",
+	"cell":    "CellSize",
+	"ov":      "Overlay",
+	"clip":    "ClipShape",
+	"cr":      "ClipRadius",
+	"voronoi": "Voronoi",
+	"pad":     "PadToSquare",
+	"padc":    "PadColor",
+	"rot":     "Rotate",
+	"fh":      "FlipH",
+	"fv":      "FlipV",
+}
+
+// applyConfig reads the processing profile over the processor options and the source and destination
+// paths defined by the flags, then it restores the values of the flags set explicitly on the command line,
+// so they override the profile values, while the profile values override the flag defaults.
+func applyConfig(path string, proc *triangle.Processor, source, destination *string) error {
+	cfg := utils.Config{In: *source, Out: *destination, Processor: *proc}
+	if err := utils.ReadConfig(path, &cfg); err != nil {
+		return err
+	}
+
+	flags := reflect.ValueOf(proc).Elem()
+	profile := reflect.ValueOf(&cfg.Processor).Elem()
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "in":
+			cfg.In = *source
+		case "out":
+			cfg.Out = *destination
+		}
+		if field, ok := configFlags[f.Name]; ok {
+			profile.FieldByName(field).Set(flags.FieldByName(field))
+		}
+	})
+	*proc, *source, *destination = cfg.Processor, cfg.In, cfg.Out
+	return nil
 }
 
-// walkDir starts a goroutine to walk the specified directory tree
+// walkDir starts a goroutine to walk the specified directory
 // and send the path of each regular file on the string channel.
+// The subdirectories are walked only in recursive mode, except the destination directory.
 // It sends the result of the walk on the error channel.
-// It terminates in case done channel is closed.
+// It terminates in case the context is cancelled.
 func walkDir(
-	done <-chan interface{},
-	src string,
+	ctx context.Context,
+	src, dest string,
 	inputExt []string,
+	recursive bool,
 ) (<-chan string, <-chan error) {
 	pathChan := make(chan string)
 	errChan := make(chan error, 1)
@@ -284,6 +750,13 @@ func walkDir(
 			if err != nil {
 				return err
 			}
+			if info.IsDir() && path != src {
+				// The generated images are not processed again in case they are saved under the source directory.
+				if !recursive || filepath.Clean(path) == filepath.Clean(dest) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 			if !info.Mode().IsRegular() {
 				return nil
 			}
@@ -298,7 +771,7 @@ func walkDir(
 			}
 			if isFileSupported {
 				select {
-				case <-done:
+				case <-ctx.Done():
 					return errors.New("directory walk cancelled")
 				case pathChan <- path:
 				}
@@ -313,55 +786,118 @@ func walkDir(
 // calls the triangulator processor against the source image
 // then sends the results on a new channel.
 func consumer(
-	done <-chan interface{},
+	ctx context.Context,
 	paths <-chan string,
-	dest string,
+	src, dest, ext, debugDir string,
+	dryRun, alsoSVG bool,
 	proc *triangle.Processor,
 	res chan<- result,
 ) {
 	for path := range paths {
-		dest := filepath.Join(dest, filepath.Base(path))
-		triangles, points, err := processor(path, dest, proc, func() {})
+		var stats triangle.Stats
+		// The destination directories are not created in case of a dry run.
+		var err error
+		if dryRun {
+			stats, err = processor(ctx, path, "", "", "", true, nil, proc, func() {})
+		} else {
+			stats, err = process(ctx, path, src, dest, ext, debugDir, alsoSVG, proc)
+		}
 
 		select {
-		case <-done:
+		case <-ctx.Done():
 			return
 		case res <- result{
-			path:      path,
-			triangles: triangles,
-			points:    points,
-			err:       err,
+			path:  path,
+			stats: stats,
+			err:   err,
 		}:
 		}
 	}
 }
 
-// processor triangulates the source image and returns the number
-// of triangles, points and the error in case if exists.
-func processor(in, out string, proc *triangle.Processor, fn triangle.Fn) (
-	[]triangle.Triangle,
-	[]triangle.Point,
-	error,
-) {
-	var (
-		img image.Image
+// process triangulates the image found under the src directory, writing the output and the debug files
+// to the same relative path under the dest and debugDir directories. In case alsoSVG is true, the SVG output
+// of the same triangulation is written next to the output, having the same base name.
+func process(ctx context.Context, path, src, dest, ext, debugDir string, alsoSVG bool, proc *triangle.Processor) (triangle.Stats, error) {
+	dest, err := destPath(src, dest, path, ext)
+	if err != nil {
+		return triangle.Stats{}, err
+	}
+	var svgOut string
+	if alsoSVG {
+		svgOut = strings.TrimSuffix(dest, filepath.Ext(dest)) + ".svg"
+	}
+	// Every image has its own debug directory, named after the image.
+	var debug string
+	if debugDir != "" {
+		debug, err = destPath(src, debugDir, path, "")
+		if err != nil {
+			return triangle.Stats{}, err
+		}
+		debug = strings.TrimSuffix(debug, filepath.Ext(debug))
+	}
+	return processor(ctx, path, dest, svgOut, debug, false, nil, proc, func() {})
+}
 
-		// Triangle related variables
-		triangles []triangle.Triangle
-		points    []triangle.Point
-		err       error
-	)
+// destPath returns the destination path of the source image found under the src directory,
+// preserving its relative path under the dest directory and creating its parent directories.
+// In case the extension is defined, it replaces the extension of the source image.
+func destPath(src, dest, path, ext string) (string, error) {
+	rel, err := filepath.Rel(src, path)
+	if err != nil {
+		return "", err
+	}
+	if ext != "" {
+		rel = strings.TrimSuffix(rel, filepath.Ext(rel)) + ext
+	}
+	dest = filepath.Join(dest, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// processor triangulates the source image and returns the processing statistics,
+// like the number of triangles and points, and the error in case if exists.
+// In case the debug directory is defined, the intermediate results of the pipeline are written into it.
+// In case svgOut is defined, the SVG output of the same triangulation is written to it too.
+// In case web is not nil, the output is copied to it while it's written.
+func processor(ctx context.Context, in, out, svgOut, debugDir string, dryRun bool, web io.Writer, proc *triangle.Processor, fn triangle.Fn) (triangle.Stats, error) {
+	// The images processed concurrently have their own statistics, written out only in case they were requested.
+	p := *proc
+	p.Stats = new(triangle.Stats)
+
+	if dryRun {
+		if err := triangulate(ctx, in, &p); err != nil {
+			return triangle.Stats{}, err
+		}
+		if proc.Stats != nil {
+			if err := writeStats(os.Stdout, in, p.Stats); err != nil {
+				return triangle.Stats{}, err
+			}
+		}
+		return *p.Stats, nil
+	}
 
 	input, output, err := pathToFile(in, out, proc)
 	if err != nil {
-		return nil, nil, err
+		return triangle.Stats{}, err
 	}
 	defer input.(*os.File).Close()
 	defer output.(*os.File).Close()
+	if web != nil {
+		output = io.MultiWriter(output, web)
+	}
+
+	// The intermediate results are written by the same run generating the output.
+	if debugDir != "" {
+		ctx = triangle.WithDebug(ctx, debugDir)
+	}
 
 	// Capture CTRL-C signal and restore the cursor visibility back.
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalChan)
 	go func() {
 		<-signalChan
 		func() {
@@ -371,67 +907,27 @@ func processor(in, out string, proc *triangle.Processor, fn triangle.Fn) (
 	}()
 
 	// Start the progress indicator.
+	spinner.SetSuffix("")
 	spinner.Start()
 
-	if filepath.Ext(out) == ".svg" {
-		const SVGTemplate = `<?xml version="1.0" ?>
-	<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN"
-	  "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd">
-	<svg width="{{.Width}}px" height="{{.Height}}px" viewBox="0 0 {{.Width}} {{.Height}}"
-	     xmlns="http://www.w3.org/2000/svg" version="1.1">
-	  <title>{{.Title}}</title>
-	  <desc>{{.Description}}</desc>
-	  <!-- Points -->
-	  <g stroke-linecap="{{.StrokeLineCap}}" stroke-width="{{.StrokeWidth}}">
-	    {{range .Lines}}
-		<path
-			fill="rgba({{.FillColor.R}},{{.FillColor.G}},{{.FillColor.B}},{{.FillColor.A}})"
-	   		stroke="rgba({{.StrokeColor.R}},{{.StrokeColor.G}},{{.StrokeColor.B}},{{.StrokeColor.A}})"
-			d="M{{.P0.X}},{{.P0.Y}} L{{.P1.X}},{{.P1.Y}} L{{.P2.X}},{{.P2.Y}} L{{.P3.X}},{{.P3.Y}}"
-		/>
-	    {{end}}</g>
-	</svg>`
-
-		svg := &triangle.SVG{
-			Title:         "Image triangulator",
-			Lines:         []triangle.Line{},
-			Description:   "Convert images to computer generated art using delaunay triangulation.",
-			StrokeWidth:   proc.StrokeWidth,
-			StrokeLineCap: "round", //butt, round, square
-			Processor:     *proc,
-		}
-		src, err := svg.DecodeImage(input)
-		if err != nil {
-			return nil, nil, err
-		}
-		_, triangles, points, err = draw(svg, src, proc, fn)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		tmpl := template.Must(template.New("svg").Parse(SVGTemplate))
-		if err := tmpl.Execute(output, svg); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
-		}
-	} else {
-		tri := &triangle.Image{
-			Processor: *proc,
-		}
-		src, err := tri.DecodeImage(input)
+	if svgOut != "" {
+		svg, err := os.Create(svgOut)
 		if err != nil {
-			return nil, nil, err
+			return triangle.Stats{}, fmt.Errorf("unable to create the SVG file: %w", err)
 		}
-		img, triangles, points, err = draw(tri, src, proc, fn)
-		if err != nil {
-			return nil, nil, err
+		err = triangle.RunWithSVG(ctx, input, output, svg, filepath.Ext(out), &p)
+		if cerr := svg.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("unable to write the SVG file: %w", cerr)
 		}
-
-		err = encodeImage(img, output.(*os.File))
+		// The partially written SVG file is not left behind.
 		if err != nil {
-			return nil, nil, err
+			os.Remove(svgOut)
+			return triangle.Stats{}, err
 		}
+	} else if err := triangle.RunContext(ctx, input, output, filepath.Ext(out), &p); err != nil {
+		return triangle.Stats{}, err
 	}
+	fn()
 
 	stopMsg := fmt.Sprintf("%s %s",
 		decorateText("▲ TRIANGLE", TriangleMessage),
@@ -441,66 +937,53 @@ func processor(in, out string, proc *triangle.Processor, fn triangle.Fn) (
 	// Stop the progress indicator.
 	spinner.Stop()
 
-	return triangles, points, err
+	// The statistics are written to stdout, unless it's used for the output image.
+	if proc.Stats != nil {
+		w := os.Stdout
+		if out == pipeName {
+			w = os.Stderr
+		}
+		if err := writeStats(w, in, p.Stats); err != nil {
+			return triangle.Stats{}, err
+		}
+	}
+	return *p.Stats, nil
 }
 
-// draw calls the generic Draw function on each struct which implements this function.
-func draw(drawer triangle.Drawer, src image.Image, proc *triangle.Processor, fn triangle.Fn) (
-	image.Image,
-	[]triangle.Triangle,
-	[]triangle.Point,
-	error,
-) {
-	return drawer.Draw(src, *proc, fn)
-}
+// triangulate generates the triangles of the source image without rendering them, populating the statistics
+// of the processor. No output file is written.
+func triangulate(ctx context.Context, in string, p *triangle.Processor) error {
+	input, err := openSource(in)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
 
-// encodeImage encodes the generated triangles into an image file type.
-func encodeImage(img image.Image, output *os.File) error {
-	ext := strings.ToLower(filepath.Ext(output.Name()))
-	switch ext {
-	case "", ".jpg", ".jpeg":
-		if err := jpeg.Encode(output, img, &jpeg.Options{Quality: 100}); err != nil {
-			return err
-		}
-	case ".png":
-		if err := png.Encode(output, img); err != nil {
-			return err
-		}
-	case ".bmp":
-		if err := bmp.Encode(output, img); err != nil {
-			return err
-		}
-	default:
-		return errors.New("unsupported image format")
+	img, err := (&triangle.Image{}).DecodeImage(input)
+	if err != nil {
+		return err
 	}
-	return nil
+	_, _, _, err = (&triangle.Triangulator{Processor: *p}).ProcessContext(ctx, img)
+	return err
+}
+
+// writeStats writes the processing statistics of the source image as a single line JSON object.
+func writeStats(w io.Writer, path string, stats *triangle.Stats) error {
+	return json.NewEncoder(w).Encode(struct {
+		Path string `json:"path"`
+		*triangle.Stats
+	}{path, stats})
 }
 
 // pathToFile converts the source and destination paths to readable and writable files.
 func pathToFile(in, out string, proc *triangle.Processor) (io.Reader, io.Writer, error) {
 	var (
-		src io.Reader
 		dst io.Writer
 		err error
 	)
-	// Check if the source path is a local image or URL.
-	if utils.IsValidUrl(in) {
-		src = imgurl
-	} else {
-		// Check if the source is a pipe name or a regular file.
-		if in == pipeName {
-			if term.IsTerminal(int(os.Stdin.Fd())) {
-				return nil, nil, errors.New("`-` should be used with a pipe for stdin")
-			}
-			src = os.Stdin
-		} else {
-			src, err = os.Open(in)
-			if err != nil {
-				return nil, nil, errors.New(
-					fmt.Sprintf("unable to open the source file: %v", err),
-				)
-			}
-		}
+	src, err := openSource(in)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Check if the destination is a pipe name or a regular file.
@@ -520,11 +1003,66 @@ func pathToFile(in, out string, proc *triangle.Processor) (io.Reader, io.Writer,
 	return src, dst, nil
 }
 
+// fidelity returns the peak signal-to-noise ratio and the structural similarity of the output image file
+// against the source image file.
+func fidelity(in, out string) (psnr float64, ssim float64, err error) {
+	decode := func(path string) (image.Image, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return (&triangle.Image{}).DecodeImage(f)
+	}
+
+	src, err := decode(in)
+	if err != nil {
+		return 0, 0, err
+	}
+	dst, err := decode(out)
+	if err != nil {
+		return 0, 0, err
+	}
+	return triangle.Fidelity(src, dst)
+}
+
+// openSource opens the source image, which is either a downloaded image, the stdin or a regular file.
+func openSource(in string) (*os.File, error) {
+	// Check if the source path is a local image or URL.
+	if utils.IsValidUrl(in) {
+		return imgurl, nil
+	}
+	// Check if the source is a pipe name or a regular file.
+	if in == pipeName {
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, errors.New("`-` should be used with a pipe for stdin")
+		}
+		return os.Stdin, nil
+	}
+	src, err := os.Open(in)
+	if err != nil {
+		return nil, errors.New(
+			fmt.Sprintf("unable to open the source file: %v", err),
+		)
+	}
+	return src, nil
+}
+
+// showDryRunStatus displays the number of the candidates, points and triangles of the source image of a dry run.
+func showDryRunStatus(fname string, stats triangle.Stats) {
+	fmt.Fprintf(os.Stderr, "%s: %s%d %scandidates → %s%d %spoints → %s%d %striangles\n",
+		decorateText(filepath.Base(fname), DefaultMessage),
+		utils.SuccessColor, stats.Candidates, utils.DefaultColor,
+		utils.SuccessColor, stats.Points, utils.DefaultColor,
+		utils.SuccessColor, stats.Triangles, utils.DefaultColor,
+	)
+}
+
 // showProcessStatus displays the relavant information about the triangulation process.
 func showProcessStatus(
 	fname string,
-	triangles []triangle.Triangle,
-	points []triangle.Point,
+	stats triangle.Stats,
 	err error,
 ) {
 	if err != nil {
@@ -534,8 +1072,11 @@ func showProcessStatus(
 		)
 		os.Exit(0)
 	} else {
-		fmt.Fprintf(os.Stderr, fmt.Sprintf("\nTotal number of %s%d %striangles generated out of %s%d %vpoints\n",
-			utils.SuccessColor, len(triangles), utils.DefaultColor, utils.SuccessColor, len(points), utils.DefaultColor),
+		// The number of edge candidates tells whether the points are limited by the threshold or by the maximum number of points.
+		fmt.Fprintf(os.Stderr, fmt.Sprintf("\nGenerated %s%d %scandidates → %s%d %spoints → %s%d %striangles\n",
+			utils.SuccessColor, stats.Candidates, utils.DefaultColor,
+			utils.SuccessColor, stats.Points, utils.DefaultColor,
+			utils.SuccessColor, stats.Triangles, utils.DefaultColor),
 		)
 		if fname != pipeName {
 			fmt.Fprintf(os.Stderr, fmt.Sprintf("Saved as: %s %s%s\n\n",
@@ -547,6 +1088,95 @@ func showProcessStatus(
 	}
 }
 
+// loadMask decodes the image file and converts it to grayscale.
+func loadMask(path string) (*image.Gray, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the mask image: %w", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the mask image: %w", err)
+	}
+
+	b := img.Bounds()
+	mask := image.NewGray(b.Sub(b.Min))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			mask.Set(x-b.Min.X, y-b.Min.Y, img.At(x, y))
+		}
+	}
+	return mask, nil
+}
+
+// loadPoints reads the points from the JSON file, holding an array of [x, y] pairs or of {"x": x, "y": y} objects,
+// or otherwise from the CSV file having the x and y coordinates in its first two columns, after an optional header.
+func loadPoints(path string) ([]triangle.Point, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the points file: %w", err)
+	}
+
+	points := []triangle.Point{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var pairs [][2]float64
+		if err := json.Unmarshal(b, &pairs); err == nil {
+			for _, pt := range pairs {
+				points = append(points, triangle.Point{X: pt[0], Y: pt[1]})
+			}
+			return points, nil
+		}
+		if err := json.Unmarshal(b, &points); err != nil {
+			return nil, fmt.Errorf("unable to decode the points file: %w", err)
+		}
+		return points, nil
+	}
+
+	r := csv.NewReader(bytes.NewReader(b))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the points file: %w", err)
+	}
+	for i, rec := range records {
+		if len(rec) < 2 {
+			return nil, fmt.Errorf("line %d of the points file: expected the x,y coordinates, got %q", i+1, strings.Join(rec, ","))
+		}
+		x, errX := strconv.ParseFloat(rec[0], 64)
+		y, errY := strconv.ParseFloat(rec[1], 64)
+		if errX != nil || errY != nil {
+			// The first line may hold the column names.
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d of the points file: invalid coordinates %q", i+1, strings.Join(rec, ","))
+		}
+		points = append(points, triangle.Point{X: x, Y: y})
+	}
+	return points, nil
+}
+
+// parseRegion parses the rectangle defined by the comma separated x0,y0,x1,y1 coordinates.
+func parseRegion(s string) (image.Rectangle, error) {
+	coords := strings.Split(s, ",")
+	if len(coords) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid region %q, expected the x0,y0,x1,y1 format", s)
+	}
+
+	var values [4]int
+	for i, c := range coords {
+		v, err := strconv.Atoi(strings.TrimSpace(c))
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("invalid region %q: %w", s, err)
+		}
+		values[i] = v
+	}
+	return image.Rect(values[0], values[1], values[2], values[3]), nil
+}
+
 // inSlice checks if the item exists in the slice.
 func inSlice(item string, slice []string) bool {
 	for _, it := range slice {
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esimov/triangle/v2"
+	"github.com/esimov/triangle/v2/utils"
+	"golang.org/x/image/bmp"
+)
+
+func TestWalkDir_Recursive(t *testing.T) {
+	// The images generated in the destination directory under the source one are not processed again.
+	src := t.TempDir()
+	dest := filepath.Join(src, "out")
+	for _, name := range []string{"a.png", "notes.txt", "sub/b.jpg", "sub/deep/c.png", "out/a.png"} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(recursive bool) []string {
+		paths, errc := walkDir(context.Background(), src, dest, []string{".png", ".jpg"}, recursive)
+
+		var outputs []string
+		for path := range paths {
+			out, err := destPath(src, dest, path, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := os.Stat(filepath.Dir(out)); err != nil {
+				t.Errorf("expected the destination directory of %s to be created: %v", out, err)
+			}
+			rel, _ := filepath.Rel(dest, out)
+			outputs = append(outputs, filepath.ToSlash(rel))
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sort.Strings(outputs)
+		return outputs
+	}
+
+	if got := strings.Join(walk(false), ","); got != "a.png" {
+		t.Errorf("expected only the top level image, got %s", got)
+	}
+	if got := strings.Join(walk(true), ","); got != "a.png,sub/b.jpg,sub/deep/c.png" {
+		t.Errorf("expected the destination to mirror the source tree, got %s", got)
+	}
+}
+
+func TestDestPath_Format(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a.png", "b.PNG", "sub/c.png"} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, errc := walkDir(context.Background(), src, dest, []string{".png"}, true)
+	var outputs []string
+	for path := range paths {
+		out, err := destPath(src, dest, path, ".svg")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rel, _ := filepath.Rel(dest, out)
+		outputs = append(outputs, filepath.ToSlash(rel))
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(outputs)
+	if got := strings.Join(outputs, ","); got != "a.svg,b.svg,sub/c.svg" {
+		t.Errorf("expected the SVG outputs, got %s", got)
+	}
+}
+
+// setTestSpinner replaces the package spinner with a non-animated one, restoring it when the test ends.
+func setTestSpinner(t *testing.T) {
+	t.Helper()
+	s := spinner
+	spinner = utils.NewSpinner("", time.Millisecond, false)
+	t.Cleanup(func() { spinner = s })
+}
+
+func TestProcessor_StdinBMP(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			src.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8((x ^ y) * 4), A: 255})
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	go func() {
+		defer w.Close()
+		bmp.Encode(w, src)
+	}()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	setTestSpinner(t)
+	out := filepath.Join(t.TempDir(), "out.png")
+	proc := &triangle.Processor{
+		BlurRadius:      2,
+		BlurPasses:      1,
+		SobelThreshold:  10,
+		PointsThreshold: 10,
+		PointRate:       0.075,
+		BlurFactor:      1,
+		EdgeFactor:      6,
+		MaxPoints:       500,
+		StrokeWidth:     1,
+	}
+	stats, err := processor(context.Background(), pipeName, out, "", "", false, nil, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Triangles == 0 {
+		t.Error("expected the triangles to be generated")
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 48 {
+		t.Errorf("expected a 64x48 image, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestProcessor_DryRun(t *testing.T) {
+	src := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8((x ^ y) * 4), A: 255})
+		}
+	}
+	in := filepath.Join(src, "in.png")
+	f, err := os.Create(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	setTestSpinner(t)
+	proc := &triangle.Processor{
+		BlurRadius:      2,
+		BlurPasses:      1,
+		SobelThreshold:  10,
+		PointsThreshold: 10,
+		PointRate:       0.075,
+		BlurFactor:      1,
+		EdgeFactor:      6,
+		MaxPoints:       500,
+		StrokeWidth:     1,
+	}
+	out := filepath.Join(t.TempDir(), "out.png")
+	stats, err := processor(context.Background(), in, out, "", "", true, nil, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Points == 0 || stats.Triangles == 0 {
+		t.Error("expected the points and the triangles to be counted")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("expected no output file to be written, got: %v", err)
+	}
+
+	// The destination directories are not created when processing a directory either.
+	dest := filepath.Join(t.TempDir(), "out")
+	paths := make(chan string, 1)
+	paths <- in
+	close(paths)
+	res := make(chan result, 1)
+	consumer(context.Background(), paths, src, dest, "", "", true, false, proc, res)
+	if r := <-res; r.err != nil || r.stats.Triangles == 0 {
+		t.Errorf("expected the triangles to be counted, got %+v", r)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("expected no destination directory to be created, got: %v", err)
+	}
+}
+
+func TestProcessor_Points(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 5), B: 128, A: 255})
+		}
+	}
+	in := filepath.Join(dir, "in.png")
+	f, err := os.Create(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	csvPath := filepath.Join(dir, "pts.csv")
+	if err := os.WriteFile(csvPath, []byte("x,y\n10,10\n50,12\n30,24\n14,38\n52,40\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jsonPath := filepath.Join(dir, "pts.json")
+	if err := os.WriteFile(jsonPath, []byte(`[[10,10],[50,12],[30,24],[14,38],[52,40]]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	setTestSpinner(t)
+	for _, path := range []string{csvPath, jsonPath} {
+		points, err := loadPoints(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(points) != 5 {
+			t.Fatalf("%s: expected 5 points, got %v", path, points)
+		}
+
+		// The points are triangulated together with the corners of the image, 4 of the 9 nodes being on the hull.
+		proc := &triangle.Processor{
+			BlurRadius:      2,
+			SobelThreshold:  10,
+			PointsThreshold: 10,
+			PointRate:       0.075,
+			BlurFactor:      1,
+			EdgeFactor:      6,
+			MaxPoints:       500,
+			StrokeWidth:     1,
+			Points:          points,
+		}
+		stats, err := processor(context.Background(), in, filepath.Join(dir, "out.png"), "", "", false, nil, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.Points != 5 || stats.Triangles != 2*9-4-2 {
+			t.Errorf("%s: expected 5 points and 12 triangles, got %d points and %d triangles", path, stats.Points, stats.Triangles)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.csv")
+	if err := os.WriteFile(bad, []byte("1,2\n3,x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPoints(bad); err == nil {
+		t.Error("expected an error for the invalid coordinates")
+	}
+}
+
+func TestProcessor_AlsoSVG(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8((x ^ y) * 4), A: 255})
+		}
+	}
+	in := filepath.Join(dir, "in.png")
+	f, err := os.Create(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	setTestSpinner(t)
+	proc := &triangle.Processor{
+		BlurRadius:      2,
+		SobelThreshold:  10,
+		PointsThreshold: 10,
+		PointRate:       0.075,
+		BlurFactor:      1,
+		EdgeFactor:      6,
+		MaxPoints:       500,
+		StrokeWidth:     1,
+	}
+	out, svgOut := filepath.Join(dir, "art.png"), filepath.Join(dir, "art.svg")
+	stats, err := processor(context.Background(), in, out, svgOut, "", false, nil, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f, err = os.Open(out)
+	if err != nil {
+		t.Fatalf("expected the raster output to be written: %v", err)
+	}
+	defer f.Close()
+	if cfg, err := png.DecodeConfig(f); err != nil || cfg.Width != 64 || cfg.Height != 48 {
+		t.Errorf("expected a 64x48 PNG output, got %+v: %v", cfg, err)
+	}
+
+	// The SVG holds a path element for each triangle of the single triangulation.
+	b, err := os.ReadFile(svgOut)
+	if err != nil {
+		t.Fatalf("expected the SVG output to be written: %v", err)
+	}
+	if paths := strings.Count(string(b), "<path"); stats.Triangles == 0 || paths != stats.Triangles {
+		t.Errorf("expected %d path elements, got %d", stats.Triangles, paths)
+	}
+
+	// No SVG file is left behind in case the source can't be triangulated.
+	bad := filepath.Join(dir, "bad.png")
+	if err := os.WriteFile(bad, []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	badSVG := filepath.Join(dir, "bad.svg")
+	if _, err := processor(context.Background(), bad, filepath.Join(dir, "bad-art.png"), badSVG, "", false, nil, proc, func() {}); err == nil {
+		t.Fatal("expected an error for the invalid source")
+	}
+	if _, err := os.Stat(badSVG); !os.IsNotExist(err) {
+		t.Errorf("expected the SVG file to be removed, got %v", err)
+	}
+}
+
+func TestProcessor_Web(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.png")
+	f, err := os.Create(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8((x ^ y) * 4), A: 255})
+		}
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	setTestSpinner(t)
+	proc := &triangle.Processor{
+		BlurRadius:      2,
+		SobelThreshold:  10,
+		PointsThreshold: 10,
+		PointRate:       0.075,
+		BlurFactor:      1,
+		EdgeFactor:      6,
+		MaxPoints:       500,
+		StrokeWidth:     1,
+		ShowInBrowser:   true,
+	}
+	// The served SVG is the one written to the destination file, without reading it back.
+	out := filepath.Join(dir, "out.svg")
+	var web bytes.Buffer
+	if _, err := processor(context.Background(), in, out, "", "", false, &web, proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("expected the SVG output to be written: %v", err)
+	}
+	if web.Len() == 0 || !bytes.Equal(web.Bytes(), b) {
+		t.Fatalf("expected the %d bytes of the SVG file to be kept in memory, got %d bytes", len(b), web.Len())
+	}
+
+	// The file is removed, so the response can only come from the memory.
+	if err := os.Remove(out); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(svgHandler(web.Bytes()))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("expected the image/svg+xml content type, got %q", ct)
+	}
+	if !bytes.Equal(body, b) {
+		t.Errorf("expected the SVG contents to be served, got %d bytes", len(body))
+	}
+}
+
+func TestBench(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			src.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8((x ^ y) * 4), A: 255})
+		}
+	}
+	in := filepath.Join(t.TempDir(), "in.png")
+	f, err := os.Create(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, src); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var buf bytes.Buffer
+	args := []string{"-in", in, "-pts", "50,100", "-bl", "1,2", "-so", "10", "-rmse"}
+	if err := bench(context.Background(), args, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The header is followed by a row for each combination of the swept values.
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got %d:\n%s", len(lines), buf.String())
+	}
+	if fields := strings.Fields(lines[0]); len(fields) != 7 || fields[6] != "RMSE" {
+		t.Errorf("unexpected header: %q", lines[0])
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != 7 {
+			t.Fatalf("unexpected row: %q", line)
+		}
+		if triangles, _ := strconv.Atoi(fields[5]); triangles == 0 {
+			t.Errorf("expected the triangles to be generated: %q", line)
+		}
+	}
+
+	if err := bench(context.Background(), []string{"-in", in, "-pts", "50,x"}, &buf); err == nil {
+		t.Error("expected an error for the invalid -pts value")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	// The main function is run by the child process, since it parses the flags of the whole program.
+	if os.Getenv("TRIANGLE_TEST_MAIN") == "1" {
+		os.Args = []string{"triangle", "-version"}
+		main()
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestVersion$")
+	cmd.Env = append(os.Environ(), "TRIANGLE_TEST_MAIN=1")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("the -version flag failed: %v", err)
+	}
+
+	line, _, _ := strings.Cut(string(out), "\n")
+	for _, want := range []string{"triangle ", runtime.Version(), runtime.GOOS + "/" + runtime.GOARCH} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected the version output %q to contain %q", line, want)
+		}
+	}
+}
+
+// runMain runs the main function with the arguments in a child process running the test, since it parses the flags
+// of the whole program and exits on failure, returning its standard error. In the child process the main function
+// is run instead of the test, and done is true.
+func runMain(t *testing.T, args ...string) (stderr string, err error, done bool) {
+	if args := os.Getenv("TRIANGLE_TEST_ARGS"); args != "" {
+		os.Args = append([]string{"triangle"}, strings.Split(args, "\n")...)
+		main()
+		return "", nil, true
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$")
+	cmd.Env = append(os.Environ(), "TRIANGLE_TEST_ARGS="+strings.Join(args, "\n"))
+	var buf bytes.Buffer
+	cmd.Stderr = &buf
+	err = cmd.Run()
+	return buf.String(), err, false
+}
+
+func TestFlags_Help(t *testing.T) {
+	// The -h flag prints the usage, so the output height has another name.
+	stderr, err, done := runMain(t, "-h")
+	if done {
+		return
+	}
+	if err != nil {
+		t.Fatalf("expected the usage to be printed, got %v: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "-oh") {
+		t.Errorf("expected the usage to list the flags, got %q", stderr)
+	}
+}
+
+func TestFlags_Rejected(t *testing.T) {
+	if _, _, done := runMain(t); done {
+		return
+	}
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.png")
+	f, err := os.Create(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 64, 48))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"format of a single image", []string{"-in", in, "-out", filepath.Join(dir, "out.png"), "-format", "svg"}, "-format flag"},
+		{"fidelity with output size", []string{"-in", in, "-out", filepath.Join(dir, "out.png"), "-fidelity", "-ow", "32"}, "-fidelity flag"},
+		{"debug dir of a dry run", []string{"-in", in, "-out", filepath.Join(dir, "out.png"), "-dry-run", "-debug-dir", dir}, "-debug-dir"},
+		{"debug dir of a directory dry run", []string{"-in", dir, "-out", filepath.Join(dir, "out"), "-dry-run", "-debug-dir", dir}, "-debug-dir"},
+	} {
+		if stderr, err, _ := runMain(t, tc.args...); err == nil {
+			t.Errorf("%s: expected the flags to be rejected", tc.name)
+		} else if !strings.Contains(stderr, tc.want) {
+			t.Errorf("%s: expected the error to mention %q, got %q", tc.name, tc.want, stderr)
+		}
+	}
+}
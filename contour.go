@@ -0,0 +1,224 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+const (
+	// contourFraction is the fraction of the edge pixels having the strongest gradient which are traced as contours.
+	contourFraction = 0.1
+	// minContourLength is the minimum number of pixels of a traced contour, the shorter ones being dropped as noise.
+	minContourLength = 10
+	// contourTolerance is the maximum distance in pixels the simplified contours deviate from the traced pixels.
+	contourTolerance = 1.0
+	// contourMargin is the width in pixels of the image border which is not traced, since the gradient
+	// computed over the border of the image outlines the image itself.
+	contourMargin = 3
+)
+
+// contourNeighbors are the offsets of the 8-connected neighbors of a pixel, the 4-connected ones being the first,
+// so the contours are followed along the straight steps before the diagonal ones.
+var contourNeighbors = [8]image.Point{{1, 0}, {0, 1}, {-1, 0}, {0, -1}, {1, 1}, {-1, 1}, {-1, -1}, {1, -1}}
+
+// traceContours returns the polylines following the strongest edges of the edge map, read from its green channel,
+// which holds the unfiltered gradient magnitudes. The strongest edge pixels are thinned to one pixel wide lines,
+// which are followed from their ends, then around the closed loops, and simplified. The contours are in the
+// coordinates of the edge map.
+func traceContours(edges *image.NRGBA) [][]Node {
+	b := edges.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= 2*contourMargin || h <= 2*contourMargin {
+		return nil
+	}
+
+	var hist [256]int
+	var total int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if g := edges.Pix[y*edges.Stride+x*4+1]; g > 0 {
+				hist[g]++
+				total++
+			}
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	// The threshold is lowered until the strongest fraction of the edge pixels is reached.
+	threshold, count := 255, hist[255]
+	for threshold > 1 && float64(count) < float64(total)*contourFraction {
+		threshold--
+		count += hist[threshold]
+	}
+
+	// The image border is left empty, so the neighbors of the marked pixels are always inside the image.
+	pix := make([]uint8, w*h)
+	for y := contourMargin; y < h-contourMargin; y++ {
+		for x := contourMargin; x < w-contourMargin; x++ {
+			if int(edges.Pix[y*edges.Stride+x*4+1]) >= threshold {
+				pix[y*w+x] = 1
+			}
+		}
+	}
+	thinEdges(pix, w, h)
+
+	neighbors := func(i int) int {
+		n := 0
+		for _, d := range contourNeighbors {
+			n += int(pix[i+d.Y*w+d.X])
+		}
+		return n
+	}
+	var contours [][]Node
+	trace := func(i int) {
+		start := i
+		chain := []Node{{X: float64(i % w), Y: float64(i / w)}}
+		pix[i] = 0
+		for {
+			next := -1
+			for _, d := range contourNeighbors {
+				if j := i + d.Y*w + d.X; pix[j] != 0 {
+					next = j
+					break
+				}
+			}
+			if next < 0 {
+				break
+			}
+			i, pix[next] = next, 0
+			chain = append(chain, Node{X: float64(i % w), Y: float64(i / w)})
+		}
+		if len(chain) < minContourLength {
+			return
+		}
+		// The loops are closed in case the chain ended next to its start.
+		if dx, dy := i%w-start%w, i/w-start/w; dx*dx <= 1 && dy*dy <= 1 {
+			chain = append(chain, chain[0])
+		}
+		contours = append(contours, simplifyPolyline(chain, contourTolerance))
+	}
+
+	// The open lines are followed from their ends first, so they are not split in two.
+	for i, v := range pix {
+		if v != 0 && neighbors(i) <= 1 {
+			trace(i)
+		}
+	}
+	for i, v := range pix {
+		if v != 0 {
+			trace(i)
+		}
+	}
+	return contours
+}
+
+// thinEdges thins the marked pixels of the w*h binary image to one pixel wide lines in place,
+// using the Zhang-Suen thinning algorithm. The border pixels must not be marked.
+func thinEdges(pix []uint8, w, h int) {
+	var removed []int
+	for changed := true; changed; {
+		changed = false
+		for step := 0; step < 2; step++ {
+			removed = removed[:0]
+			for y := 1; y < h-1; y++ {
+				for x := 1; x < w-1; x++ {
+					i := y*w + x
+					if pix[i] == 0 {
+						continue
+					}
+					// The neighbors are listed clockwise, starting from the one above the pixel.
+					n := [8]uint8{pix[i-w], pix[i-w+1], pix[i+1], pix[i+w+1], pix[i+w], pix[i+w-1], pix[i-1], pix[i-w-1]}
+					count, transitions := 0, 0
+					for k := range n {
+						count += int(n[k])
+						if n[k] == 0 && n[(k+1)%8] != 0 {
+							transitions++
+						}
+					}
+					if count < 2 || count > 6 || transitions != 1 {
+						continue
+					}
+					if step == 0 && (n[0]&n[2]&n[4] != 0 || n[2]&n[4]&n[6] != 0) {
+						continue
+					}
+					if step == 1 && (n[0]&n[2]&n[6] != 0 || n[0]&n[4]&n[6] != 0) {
+						continue
+					}
+					removed = append(removed, i)
+				}
+			}
+			for _, i := range removed {
+				pix[i] = 0
+			}
+			changed = changed || len(removed) > 0
+		}
+	}
+}
+
+// simplifyPolyline simplifies the polyline with the Ramer-Douglas-Peucker algorithm,
+// keeping its nodes which deviate more than the tolerance from the simplified line.
+func simplifyPolyline(nodes []Node, tolerance float64) []Node {
+	if len(nodes) < 3 {
+		return nodes
+	}
+	keep := make([]bool, len(nodes))
+	keep[0], keep[len(nodes)-1] = true, true
+
+	var simplify func(first, last int)
+	simplify = func(first, last int) {
+		a, b := nodes[first], nodes[last]
+		dx, dy := b.X-a.X, b.Y-a.Y
+		length := math.Hypot(dx, dy)
+
+		index, dist := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			var d float64
+			if length == 0 {
+				d = math.Hypot(nodes[i].X-a.X, nodes[i].Y-a.Y)
+			} else {
+				d = math.Abs(dy*(nodes[i].X-a.X)-dx*(nodes[i].Y-a.Y)) / length
+			}
+			if d > dist {
+				index, dist = i, d
+			}
+		}
+		if index >= 0 {
+			keep[index] = true
+			simplify(first, index)
+			simplify(index, last)
+		}
+	}
+	simplify(0, len(nodes)-1)
+
+	simplified := make([]Node, 0, len(nodes))
+	for i, n := range nodes {
+		if keep[i] {
+			simplified = append(simplified, n)
+		}
+	}
+	return simplified
+}
+
+// drawContours strokes the contours over the context, which is scaled to the output size.
+// The width is in the pixels of the output image.
+func drawContours(dc *gg.Context, contours [][]Node, c color.Color, width float64) {
+	if len(contours) == 0 {
+		return
+	}
+	for _, contour := range contours {
+		dc.MoveTo(contour[0].X, contour[0].Y)
+		for _, n := range contour[1:] {
+			dc.LineTo(n.X, n.Y)
+		}
+		dc.NewSubPath()
+	}
+	dc.SetColor(c)
+	dc.SetLineWidth(width)
+	dc.SetLineJoin(gg.LineJoinRound)
+	dc.SetLineCap(gg.LineCapRound)
+	dc.Stroke()
+}
@@ -0,0 +1,114 @@
+package triangle
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newSquareImage returns a dark image having a bright square, with clear borders, in the middle of it.
+func newSquareImage(w, h int, square image.Rectangle) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: 20, G: 20, B: 60, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, square, image.NewUniform(color.NRGBA{R: 240, G: 220, B: 80, A: 255}), image.Point{}, draw.Src)
+	return img
+}
+
+func TestTraceContours(t *testing.T) {
+	square := image.Rect(30, 20, 90, 60)
+	src := newSquareImage(120, 80, square)
+	proc := newTestProcessor()
+	proc.TraceContours, proc.StrokeColor = true, "#ff0000"
+
+	// The distance of the node from the border of the square.
+	distance := func(x, y float64) float64 {
+		dx := math.Max(math.Max(float64(square.Min.X)-x, x-float64(square.Max.X)), 0)
+		dy := math.Max(math.Max(float64(square.Min.Y)-y, y-float64(square.Max.Y)), 0)
+		if dx > 0 || dy > 0 {
+			return math.Hypot(dx, dy)
+		}
+		return math.Min(math.Min(x-float64(square.Min.X), float64(square.Max.X)-x), math.Min(y-float64(square.Min.Y), float64(square.Max.Y)-y))
+	}
+
+	// The triangles of the compact output are polygons, so the paths are the contours.
+	svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+	svg.Compact = true
+	if _, _, _, err := svg.Draw(src, proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := svg.Render(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	paths := regexp.MustCompile(`<path d="([^"]+)"/>`).FindAllStringSubmatch(buf.String(), -1)
+	if len(paths) == 0 {
+		t.Fatal("expected the contour paths to be rendered")
+	}
+	if !strings.Contains(buf.String(), `stroke="#f00"`) {
+		t.Errorf("expected the contours to be stroked with the stroke color")
+	}
+	var length float64
+	for _, path := range paths {
+		var prev []float64
+		for _, cmd := range strings.Fields(path[1]) {
+			xy := strings.Split(strings.TrimLeft(cmd, "ML"), ",")
+			x, _ := strconv.ParseFloat(xy[0], 64)
+			y, _ := strconv.ParseFloat(xy[1], 64)
+			if d := distance(x, y); d > 3 {
+				t.Errorf("expected the contour node %v,%v to follow the border of the square, got %v away", x, y, d)
+			}
+			if prev != nil {
+				length += math.Hypot(x-prev[0], y-prev[1])
+			}
+			prev = []float64{x, y}
+		}
+	}
+	// The contours go around the most of the square.
+	if perimeter := float64(2 * (square.Dx() + square.Dy())); length < perimeter*0.75 {
+		t.Errorf("expected the contours to be at least %v long, got %v", perimeter*0.75, length)
+	}
+
+	// The contours are drawn in red over the triangles of the raster output, which have no red pixels otherwise.
+	redPixels := func(proc Processor) int {
+		res, _, _, err := (&Image{Processor: proc}).Draw(src, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		img, n := ImgToNRGBA(res), 0
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				if c := img.NRGBAAt(x, y); c.R > 200 && c.G < 100 && c.B < 100 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	if n := redPixels(proc); n < square.Dx() {
+		t.Errorf("expected the contours to be drawn over the triangles, got %d red pixels", n)
+	}
+	proc.TraceContours = false
+	if n := redPixels(proc); n != 0 {
+		t.Errorf("expected no contours without the TraceContours option, got %d red pixels", n)
+	}
+}
+
+func TestSimplifyPolyline(t *testing.T) {
+	line := []Node{{0, 0}, {1, 0}, {2, 0.5}, {3, 0}, {4, 0}, {4, 1}, {4, 2}, {4, 3}}
+	got := simplifyPolyline(line, 1)
+	want := []Node{{0, 0}, {4, 0}, {4, 3}}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package triangle
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// Names of the files written by WriteDebug.
+const (
+	DebugEdgesFile     = "edges.png"
+	DebugPointsFile    = "points.png"
+	DebugTrianglesFile = "triangles.svg"
+)
+
+// debugPointColor is the color the sampled points are marked with.
+var debugPointColor = color.NRGBA{R: 255, G: 0, B: 0, A: 255}
+
+// debugKey is the context key of the debug directory.
+type debugKey struct{}
+
+// WithDebug returns a copy of the context making the triangulations run with it write the intermediate results
+// of their pipeline into the directory, like WriteDebug does. Since the files are written by the same run which
+// generates the output, they show the points and the triangles of the output, without triangulating the image again.
+func WithDebug(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, debugKey{}, dir)
+}
+
+// debugDir returns the debug directory carried by the context, or an empty string in case it's not defined.
+func debugDir(ctx context.Context) string {
+	dir, _ := ctx.Value(debugKey{}).(string)
+	return dir
+}
+
+// WriteDebug triangulates the source image and writes the intermediate results of the pipeline into the
+// directory, which is created in case it doesn't exist: the edge map the points were extracted from as
+// edges.png, the source image with the sampled points marked as points.png and the triangles as triangles.svg.
+// The edge map is not written in case the edges are not detected, like in case of the UniformGrid sampling.
+// The debug files of an output can be written by the same run generating it, using a context created by WithDebug.
+func WriteDebug(ctx context.Context, src image.Image, p Processor, dir string) error {
+	// The debug run doesn't report its progress and statistics, leaving the ones of the caller's run intact.
+	ctx = WithDebug(WithProgress(ctx, nil), dir)
+	p.Stats = nil
+	_, _, _, err := (&Triangulator{Processor: p}).ProcessContext(ctx, src)
+	return err
+}
+
+// writeDebug writes the intermediate results of the triangulation of the source image into the directory.
+func (s *scratch) writeDebug(dir string, src image.Image, img *image.NRGBA, triangles []Triangle, points []Point, p Processor) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if edges := s.grayEdges(); edges != nil {
+		if err := writeDebugPNG(filepath.Join(dir, DebugEdgesFile), edges); err != nil {
+			return err
+		}
+	}
+
+	// Each point is marked with a 3x3 square over the source image.
+	bounds := src.Bounds().Sub(src.Bounds().Min)
+	marked := image.NewNRGBA(bounds)
+	draw.Draw(marked, bounds, src, src.Bounds().Min, draw.Src)
+	for _, pt := range points {
+		x, y := round(pt.X), round(pt.Y)
+		r := image.Rect(x-1, y-1, x+2, y+2).Intersect(bounds)
+		draw.Draw(marked, r, &image.Uniform{C: debugPointColor}, image.Point{}, draw.Src)
+	}
+	if err := writeDebugPNG(filepath.Join(dir, DebugPointsFile), marked); err != nil {
+		return err
+	}
+
+	svg := &SVG{
+		Width:         bounds.Dx(),
+		Height:        bounds.Dy(),
+		ViewBoxWidth:  bounds.Dx(),
+		ViewBoxHeight: bounds.Dy(),
+		Title:         "Triangles",
+		StrokeLineCap: "round",
+		StrokeWidth:   1,
+	}
+	// The triangle contours are outlined, so the triangles can be told apart.
+	stroke := color.RGBA{R: 0, G: 0, B: 0, A: 255}
+	pal := p.fillPalette(img)
+	for i, t := range triangles {
+		ct := p.colorTriangle(img, pal, i, t)
+		n := t.Nodes
+		svg.Lines = append(svg.Lines, Line{n[0], n[1], n[2], n[0], ct.fill, stroke})
+	}
+
+	f, err := os.Create(filepath.Join(dir, DebugTrianglesFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := svg.Render(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeDebugPNG encodes the image as PNG into the file at path.
+func writeDebugPNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,49 @@
+package triangle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDebug(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "debug")
+
+	if err := WriteDebug(context.Background(), newTestImage(120, 80), newTestProcessor(), dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{DebugEdgesFile, DebugPointsFile, DebugTrianglesFile} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("expected %s to be created: %v", name, err)
+		}
+		if fi.Size() == 0 {
+			t.Errorf("expected %s to be non-empty", name)
+		}
+	}
+}
+
+func TestWithDebug(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "debug")
+	ctx := WithDebug(context.Background(), dir)
+
+	proc := newTestProcessor()
+	_, triangles, _, err := (&Image{Processor: proc}).DrawContext(ctx, newTestImage(120, 80), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The debug files are written by the same run, so they hold the triangles of the output.
+	b, err := os.ReadFile(filepath.Join(dir, DebugTrianglesFile))
+	if err != nil {
+		t.Fatalf("expected %s to be created: %v", DebugTrianglesFile, err)
+	}
+	if paths := strings.Count(string(b), "<path"); len(triangles) == 0 || paths != len(triangles) {
+		t.Errorf("expected %d triangles in %s, got %d", len(triangles), DebugTrianglesFile, paths)
+	}
+	if _, err := os.Stat(filepath.Join(dir, DebugEdgesFile)); err != nil {
+		t.Errorf("expected %s to be created: %v", DebugEdgesFile, err)
+	}
+}
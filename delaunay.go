@@ -1,5 +1,12 @@
 package triangle
 
+import (
+	"context"
+	"image/color"
+	"math"
+	"sort"
+)
+
 // Point defines a struct having as components the point X and Y coordinate position.
 type Point struct {
 	X, Y float64
@@ -10,11 +17,45 @@ type Node struct {
 	X, Y float64
 }
 
+// pointEpsilon defines the minimum distance between two distinct points. Points closer than this
+// to an already inserted one are skipped, since they would produce degenerate, zero-area triangles.
+const pointEpsilon = 0.5
+
+// pointSet is a spatial hash of the inserted points, used for detecting the near-coincident ones.
+// The diagonal of the grid cells is pointEpsilon, so each cell holds at most one point.
+type pointSet map[[2]int]Node
+
+// cell returns the grid cell of the spatial hash containing the node.
+func (s pointSet) cell(n Node) [2]int {
+	size := pointEpsilon / math.Sqrt2
+	return [2]int{int(math.Floor(n.X / size)), int(math.Floor(n.Y / size))}
+}
+
+// add adds the node to the set, returning false if it's closer than pointEpsilon to an existing node.
+func (s pointSet) add(n Node) bool {
+	c := s.cell(n)
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			if m, ok := s[[2]int{c[0] + dx, c[1] + dy}]; ok {
+				if (m.X-n.X)*(m.X-n.X)+(m.Y-n.Y)*(m.Y-n.Y) < pointEpsilon*pointEpsilon {
+					return false
+				}
+			}
+		}
+	}
+	s[c] = n
+	return true
+}
+
 // circle defines the basic circle element.
 type circle struct {
 	x, y, radius float64
 }
 
+// collinearEpsilon is the squared sine of the angle between the edges of a triangle below which its nodes
+// are considered collinear.
+const collinearEpsilon = 1e-20
+
 // newNode instantiate a new node.
 func newNode(x, y float64) Node {
 	return Node{x, y}
@@ -31,7 +72,7 @@ func (n Node) isEq(p Node) bool {
 	if dy < 0 {
 		dy = -dy
 	}
-	if float64(dx) < 0.0001 && float64(dy) < 0.0001 {
+	if dx < 0.0001 && dy < 0.0001 {
 		return true
 	}
 	return false
@@ -68,27 +109,85 @@ type Triangle struct {
 	Nodes  []Node
 	edges  []edge
 	circle circle
+	fill   color.RGBA
 }
 
 var t = Triangle{}
 
+// Area returns the area of the triangle.
+func (t Triangle) Area() float64 {
+	return math.Abs(t.signedArea())
+}
+
+// signedArea returns the area of the triangle, being negative if its nodes are in clockwise order.
+func (t Triangle) signedArea() float64 {
+	p0, p1, p2 := t.Nodes[0], t.Nodes[1], t.Nodes[2]
+	return ((p1.X-p0.X)*(p2.Y-p0.Y) - (p2.X-p0.X)*(p1.Y-p0.Y)) / 2
+}
+
+// Centroid returns the X and Y coordinates of the triangle centroid.
+func (t Triangle) Centroid() (float64, float64) {
+	p0, p1, p2 := t.Nodes[0], t.Nodes[1], t.Nodes[2]
+	return (p0.X + p1.X + p2.X) / 3, (p0.Y + p1.Y + p2.Y) / 3
+}
+
+// Contains checks if the point is inside the triangle, the points on its edges being considered inside.
+// A degenerate, zero-area triangle doesn't contain any point.
+func (t Triangle) Contains(p Node) bool {
+	area := t.signedArea()
+	if area == 0 {
+		return false
+	}
+	// The point is inside if it's on the same side of every edge as the opposite node.
+	for i := 0; i < 3; i++ {
+		a, b := t.Nodes[i], t.Nodes[(i+1)%3]
+		if ((b.X-a.X)*(p.Y-a.Y)-(b.Y-a.Y)*(p.X-a.X))*area < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ctxCheckInterval defines how many points are inserted between two context checks.
+const ctxCheckInterval = 64
+
+// triangleChunk defines how many triangles are allocated at once by the triangulation.
+const triangleChunk = 1024
+
+// triangleData holds the nodes and the edges of a triangle.
+type triangleData struct {
+	nodes [3]Node
+	edges [3]edge
+}
+
 // newTriangle creates a new triangle which circumcircle encloses the points to be added.
-func (t Triangle) newTriangle(p0, p1, p2 Node) Triangle {
-	t.Nodes = []Node{p0, p1, p2}
-	t.edges = []edge{{newEdge(p0, p1)}, {newEdge(p1, p2)}, {newEdge(p2, p0)}}
+// The triangle nodes and edges are stored in the provided data.
+func (t Triangle) newTriangle(data *triangleData, p0, p1, p2 Node) Triangle {
+	data.nodes = [3]Node{p0, p1, p2}
+	data.edges = [3]edge{{newEdge(p0, p1)}, {newEdge(p1, p2)}, {newEdge(p2, p0)}}
+	t.Nodes = data.nodes[:]
+	t.edges = data.edges[:]
 
 	// Create a circumscribed circle of this triangle.
 	// The circumcircle of a triangle is the circle which has the three vertices of the triangle laying on its circumference.
-	circle := t.circle
 	ax, ay := p1.X-p0.X, p1.Y-p0.Y
 	bx, by := p2.X-p0.X, p2.Y-p0.Y
 
+	// The collinear or coincident nodes have no circumcircle, the determinant being zero, or close to it because of
+	// the rounding errors. The circle of such a degenerate triangle is placed at infinity, so it never contains any point.
+	det := ax*by - ay*bx
+	if det*det <= collinearEpsilon*(ax*ax+ay*ay)*(bx*bx+by*by) {
+		t.circle = circle{x: math.Inf(1), y: math.Inf(1), radius: math.Inf(1)}
+		return t
+	}
+
+	circle := t.circle
 	m := p1.X*p1.X - p0.X*p0.X + p1.Y*p1.Y - p0.Y*p0.Y
 	u := p2.X*p2.X - p0.X*p0.X + p2.Y*p2.Y - p0.Y*p0.Y
-	s := 1.0 / (2.0 * float64(ax*by-ay*bx))
+	s := 1.0 / (2.0 * det)
 
-	circle.x = float64((p2.Y-p0.Y)*m+(p0.Y-p1.Y)*u) * s
-	circle.y = float64((p0.X-p2.X)*m+(p1.X-p0.X)*u) * s
+	circle.x = ((p2.Y-p0.Y)*m + (p0.Y-p1.Y)*u) * s
+	circle.y = ((p0.X-p2.X)*m + (p1.X-p0.X)*u) * s
 
 	// Calculate the distance between the node points and the triangle circumcircle.
 	dx := p0.X - circle.x
@@ -101,11 +200,24 @@ func (t Triangle) newTriangle(p0, p1, p2 Node) Triangle {
 	return t
 }
 
+// degenerate reports whether the nodes of the triangle are collinear, its circumcircle being at infinity.
+func (t Triangle) degenerate() bool {
+	return math.IsInf(t.circle.radius, 1)
+}
+
 // Delaunay defines the main components of the triangulation.
 type Delaunay struct {
 	width     float64
 	height    float64
 	triangles []Triangle
+	edges     []edge
+	polygon   []edge
+	// nodes holds the inserted nodes, including the supertriangle corners.
+	nodes pointSet
+	// The triangle data is allocated in chunks, the next one being at the used index of the last chunk.
+	chunks [][]triangleData
+	chunk  int
+	used   int
 }
 
 // Init initialize the Delaunay structure.
@@ -114,13 +226,39 @@ func (d *Delaunay) Init(width, height int) *Delaunay {
 	d.height = float64(height)
 
 	d.triangles = nil
+	d.chunks = nil
+	d.nodes = nil
 	d.clear()
 
 	return d
 }
 
+// reset is like Init, but it reuses the buffers of the previous triangulation,
+// overwriting the triangles returned by GetTriangles before.
+func (d *Delaunay) reset(width, height int) *Delaunay {
+	d.width = float64(width)
+	d.height = float64(height)
+	d.clear()
+
+	return d
+}
+
+// alloc returns the storage of a new triangle from the allocated chunks, allocating a new chunk if they are used up.
+func (d *Delaunay) alloc() *triangleData {
+	if d.chunk == len(d.chunks) {
+		d.chunks = append(d.chunks, make([]triangleData, triangleChunk))
+	}
+	data := &d.chunks[d.chunk][d.used]
+	if d.used++; d.used == triangleChunk {
+		d.chunk, d.used = d.chunk+1, 0
+	}
+	return data
+}
+
 // clear method clears the delaunay triangles slice.
 func (d *Delaunay) clear() {
+	d.chunk, d.used = 0, 0
+
 	p0 := newNode(0, 0)
 	p1 := newNode(d.width, 0)
 	p2 := newNode(d.width, d.height)
@@ -129,24 +267,199 @@ func (d *Delaunay) clear() {
 	// Create the supertriangle, an artificial triangle which encompasses all the points.
 	// At the end of the triangulation process any triangles which
 	// share edges with the supertriangle are deleted from the triangle list.
-	d.triangles = []Triangle{t.newTriangle(p0, p1, p2), t.newTriangle(p0, p2, p3)}
+	d.triangles = append(d.triangles[:0], t.newTriangle(d.alloc(), p0, p1, p2), t.newTriangle(d.alloc(), p0, p2, p3))
+
+	if d.nodes != nil {
+		for c := range d.nodes {
+			delete(d.nodes, c)
+		}
+		for _, n := range []Node{p0, p1, p2, p3} {
+			d.nodes.add(n)
+		}
+	}
 }
 
 // Insert will insert new triangles into the triangles slice.
 func (d *Delaunay) Insert(points []Point) *Delaunay {
+	d.insert(context.Background(), points, nil)
+	return d
+}
+
+// Remove removes the point from the triangulation, re-triangulating only the cavity left by the triangles
+// sharing the point, so the result is the same as the triangulation of the remaining points.
+// The point is matched approximately; in case it's not part of the triangulation, or it's one of the
+// corners the triangulation is bounded by, the triangulation is left unchanged.
+func (d *Delaunay) Remove(p Point) *Delaunay {
+	n := newNode(p.X, p.Y)
+	for _, c := range []Node{{0, 0}, {d.width, 0}, {d.width, d.height}, {0, d.height}} {
+		if n.isEq(c) {
+			return d
+		}
+	}
+
+	// The new triangles are appended after the current ones, like in the case of the insertion.
+	var (
+		temps = d.triangles[len(d.triangles):]
+		next  = make(map[Node]Node)
+		prev  = make(map[Node]Node)
+		node  Node
+		found bool
+	)
+	for _, t := range d.triangles {
+		i := -1
+		for j, tn := range t.Nodes {
+			if tn.isEq(n) {
+				i = j
+			}
+		}
+		if i < 0 {
+			temps = append(temps, t)
+			continue
+		}
+		node, found = t.Nodes[i], true
+
+		// The edge opposite to the removed node is oriented counterclockwise around it.
+		a, b := t.Nodes[(i+1)%3], t.Nodes[(i+2)%3]
+		if t.signedArea() < 0 {
+			a, b = b, a
+		}
+		next[a], prev[b] = b, a
+	}
+	if !found {
+		return d
+	}
+
+	// Walk the edges around the removed node, starting from the beginning of the chain in case
+	// the node is on the border of the triangulation, so the cavity is not closed around it.
+	var start Node
+	for a := range next {
+		start = a
+		if _, ok := prev[a]; !ok {
+			break
+		}
+	}
+	polygon := []Node{start}
+	for a, ok := next[start]; ok && a != start && len(polygon) <= len(next); a, ok = next[a] {
+		polygon = append(polygon, a)
+	}
+
+	for _, tn := range triangulateCavity(polygon) {
+		temps = append(temps, t.newTriangle(d.alloc(), tn[0], tn[1], tn[2]))
+	}
+	d.triangles = temps
+
+	if d.nodes != nil {
+		delete(d.nodes, d.nodes.cell(node))
+	}
+	return d
+}
+
+// triangulateCavity returns the Delaunay triangulation of the polygon having its nodes in counterclockwise order,
+// by clipping its ears whose circumcircle doesn't contain any of the polygon nodes.
+// Since the polygon is the cavity left by a node removed from a Delaunay triangulation, such an ear always exists,
+// but in case none is found because of the rounding errors, the first valid ear is clipped.
+func triangulateCavity(polygon []Node) [][3]Node {
+	nodes := polygon
+	polygon = append([]Node(nil), polygon...)
+
+	// isEar checks if the triangle of the consecutive polygon nodes a, b and c is inside the polygon.
+	isEar := func(a, b, c Node) bool {
+		t := Triangle{Nodes: []Node{a, b, c}}
+		if t.signedArea() <= 0 {
+			return false
+		}
+		for _, n := range polygon {
+			if n != a && n != b && n != c && t.Contains(n) {
+				return false
+			}
+		}
+		return true
+	}
+	// isDelaunay checks if the circumcircle of the triangle doesn't contain any of the polygon nodes.
+	isDelaunay := func(a, b, c Node) bool {
+		circle := t.newTriangle(&triangleData{}, a, b, c).circle
+		for _, n := range nodes {
+			dx, dy := circle.x-n.X, circle.y-n.Y
+			if n != a && n != b && n != c && dx*dx+dy*dy < circle.radius*(1-1e-9) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var triangles [][3]Node
+	for len(polygon) > 3 {
+		ear := -1
+		for i := range polygon {
+			a, b, c := polygon[(i+len(polygon)-1)%len(polygon)], polygon[i], polygon[(i+1)%len(polygon)]
+			if !isEar(a, b, c) {
+				continue
+			}
+			if ear < 0 {
+				ear = i
+			}
+			if isDelaunay(a, b, c) {
+				ear = i
+				break
+			}
+		}
+		if ear < 0 {
+			// The remaining nodes are collinear, so they don't enclose any triangles.
+			return triangles
+		}
+		a, b, c := polygon[(ear+len(polygon)-1)%len(polygon)], polygon[ear], polygon[(ear+1)%len(polygon)]
+		triangles = append(triangles, [3]Node{a, b, c})
+		polygon = append(polygon[:ear], polygon[ear+1:]...)
+	}
+	if len(polygon) == 3 && (Triangle{Nodes: polygon}).signedArea() > 0 {
+		triangles = append(triangles, [3]Node{polygon[0], polygon[1], polygon[2]})
+	}
+	return triangles
+}
+
+// insert inserts the points into the triangulation, checking periodically
+// whether the context is done, in which case it returns the context error.
+// The duplicated and near-coincident points are skipped. In case the progress function is not nil,
+// it's called with the fraction of the inserted points along with the context checks, and with 1 at the end.
+func (d *Delaunay) insert(ctx context.Context, points []Point, progress func(float64)) error {
 	var (
 		i, j, k      int
 		x, y, dx, dy float64
 		distSq       float64
-		polygon      []edge
-		edges        []edge
-		temps        []Triangle
+		polygon      = d.polygon
+		edges        = d.edges
+		// The new triangles are appended after the current ones, so the triangles returned
+		// by GetTriangles before are not altered, but the spare capacity of the slice is reused.
+		temps = d.triangles[len(d.triangles):]
 	)
 
+	// Seed the set with the nodes already present, including the supertriangle corners.
+	if d.nodes == nil {
+		d.nodes = make(pointSet, len(points))
+		for _, t := range d.triangles {
+			for _, n := range t.Nodes {
+				d.nodes.add(n)
+			}
+		}
+	}
+	nodes := d.nodes
+
 	for k = 0; k < len(points); k++ {
+		if k%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if progress != nil && k > 0 {
+				progress(float64(k) / float64(len(points)))
+			}
+		}
 		x = points[k].X
 		y = points[k].Y
 
+		if !nodes.add(newNode(x, y)) {
+			continue
+		}
+
 		triangles := d.triangles
 		edges = edges[:0]
 		temps = temps[:0]
@@ -169,7 +482,7 @@ func (d *Delaunay) Insert(points []Point) *Delaunay {
 			}
 		}
 
-		polygon = nil
+		polygon = polygon[:0]
 		// Check duplication of edges, delete if duplicates.
 	edgesLoop:
 		for i = 0; i < len(edges); i++ {
@@ -187,15 +500,63 @@ func (d *Delaunay) Insert(points []Point) *Delaunay {
 
 		}
 		for i = 0; i < len(polygon); i++ {
+			// The point lying on an edge of the border closes no triangle with it, like with the image corners.
 			edge := polygon[i]
-			temps = append(temps, t.newTriangle(edge.nodes[0], edge.nodes[1], newNode(x, y)))
+			if nt := t.newTriangle(d.alloc(), edge.nodes[0], edge.nodes[1], newNode(x, y)); !nt.degenerate() {
+				temps = append(temps, nt)
+			}
 		}
 		d.triangles = temps
 	}
-	return d
+	d.edges, d.polygon = edges, polygon
+
+	if progress != nil {
+		progress(1)
+	}
+	return nil
 }
 
 // GetTriangles returns the generated triangles.
 func (d *Delaunay) GetTriangles() []Triangle {
 	return d.triangles
 }
+
+// Adjacency returns the neighbors of the generated triangles, mapping the index of every triangle returned by
+// GetTriangles to the indices of the triangles sharing an edge with it, in increasing order. Since the neighbors
+// are found by their shared edges, every triangle has at most three of them.
+func (d *Delaunay) Adjacency() map[int][]int {
+	return adjacency(d.triangles)
+}
+
+// adjacency maps the index of every triangle to the indices of the triangles sharing an edge with it, in increasing order.
+func adjacency(triangles []Triangle) map[int][]int {
+	adj := make(map[int][]int, len(triangles))
+	shared := make(map[[2]Node]int, len(triangles)*3/2)
+
+	for i, t := range triangles {
+		adj[i] = nil
+		for j, n := range t.Nodes {
+			key := edgeKey(n, t.Nodes[(j+1)%3])
+			if other, ok := shared[key]; ok {
+				adj[i] = append(adj[i], other)
+				adj[other] = append(adj[other], i)
+				delete(shared, key)
+			} else {
+				shared[key] = i
+			}
+		}
+	}
+	for _, neighbors := range adj {
+		sort.Ints(neighbors)
+	}
+	return adj
+}
+
+// edgeKey returns the key of the edge between the two nodes, having its nodes in a fixed order,
+// so the key of an edge is the same regardless of the direction it's traversed in.
+func edgeKey(a, b Node) [2]Node {
+	if b.X < a.X || (b.X == a.X && b.Y < a.Y) {
+		a, b = b, a
+	}
+	return [2]Node{a, b}
+}
@@ -0,0 +1,212 @@
+package triangle
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDelaunay_DuplicatePoints(t *testing.T) {
+	points := []Point{
+		{X: 10, Y: 10}, {X: 10, Y: 10}, {X: 10.2, Y: 9.9},
+		{X: 50, Y: 20}, {X: 50, Y: 20},
+		{X: 30, Y: 70}, {X: 30.1, Y: 70.1},
+		{X: 80, Y: 80}, {X: 0, Y: 0}, {X: 100, Y: 100},
+	}
+	delaunay := &Delaunay{}
+	triangles := delaunay.Init(100, 100).Insert(points).GetTriangles()
+
+	// 4 unique inner points and the 4 corners produce 2*n-2-h = 2*8-2-4 triangles.
+	if len(triangles) != 10 {
+		t.Errorf("expected 10 triangles, got %d", len(triangles))
+	}
+	for _, tri := range triangles {
+		r := tri.circle.radius
+		if r == 0 || math.IsNaN(r) || math.IsInf(r, 0) {
+			t.Errorf("expected a non-degenerate triangle, got %v with the circumradius %v", tri.Nodes, r)
+		}
+	}
+}
+
+func TestDelaunay_CollinearPoints(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		points []Point
+		want   int
+	}{
+		// The points on the border close no triangle with the border edge they lie on.
+		{"on border", []Point{{X: 25, Y: 0}, {X: 50, Y: 0}, {X: 75, Y: 0}}, 2*7 - 7 - 2},
+		{"inside", []Point{{X: 20, Y: 50}, {X: 50, Y: 50}, {X: 80, Y: 50}}, 2*7 - 4 - 2},
+	} {
+		triangles := (&Delaunay{}).Init(100, 100).Insert(tc.points).GetTriangles()
+		if len(triangles) != tc.want {
+			t.Errorf("%s: expected %d triangles, got %d", tc.name, tc.want, len(triangles))
+		}
+		var area float64
+		for _, tri := range triangles {
+			c := tri.circle
+			if math.IsInf(c.x, 0) || math.IsInf(c.y, 0) || math.IsInf(c.radius, 0) || math.IsNaN(c.x+c.y+c.radius) {
+				t.Errorf("%s: expected a finite circumcircle, got %+v for %v", tc.name, c, tri.Nodes)
+			}
+			area += tri.Area()
+		}
+		if math.Abs(area-100*100) > 1e-6 {
+			t.Errorf("%s: expected the triangles to cover the area 10000, got %v", tc.name, area)
+		}
+	}
+
+	// The circle of the collinear nodes never contains any point.
+	tri := Triangle{}.newTriangle(&triangleData{}, Node{X: 0, Y: 0}, Node{X: 10, Y: 10}, Node{X: 20, Y: 20})
+	if !tri.degenerate() {
+		t.Errorf("expected the triangle of the collinear nodes to be degenerate, got the circle %+v", tri.circle)
+	}
+	if dx, dy := tri.circle.x-10, tri.circle.y-10; dx*dx+dy*dy < tri.circle.radius {
+		t.Error("expected the circle of the collinear nodes to contain no point")
+	}
+}
+
+func TestDelaunay_SubpixelPoints(t *testing.T) {
+	// The points lie off the pixel grid, but farther apart than the distance of the near-coincident points.
+	points := []Point{{X: 10.25, Y: 20.75}, {X: 11.125, Y: 20.5}, {X: 40.6, Y: 60.3}, {X: 70.01, Y: 30.99}, {X: 33.3333, Y: 33.6667}}
+	triangles := (&Delaunay{}).Init(100, 100).Insert(points).GetTriangles()
+
+	nodes := make(map[Node]bool)
+	for _, tri := range triangles {
+		for _, n := range tri.Nodes {
+			nodes[n] = true
+		}
+	}
+	for _, p := range points {
+		if !nodes[Node{X: p.X, Y: p.Y}] {
+			t.Errorf("expected the point %v to be a node of the triangles at its exact position", p)
+		}
+	}
+	if len(triangles) != 2*9-4-2 {
+		t.Errorf("expected %d triangles, got %d", 2*9-4-2, len(triangles))
+	}
+}
+
+func TestTriangle_Contains(t *testing.T) {
+	// The nodes are listed both in counterclockwise and clockwise order.
+	for _, nodes := range [][]Node{
+		{{X: 0, Y: 0}, {X: 40, Y: 0}, {X: 0, Y: 30}},
+		{{X: 0, Y: 0}, {X: 0, Y: 30}, {X: 40, Y: 0}},
+	} {
+		tri := Triangle{Nodes: nodes}
+		for _, tc := range []struct {
+			name string
+			p    Node
+			want bool
+		}{
+			{"inside", Node{X: 10, Y: 10}, true},
+			{"on edge", Node{X: 20, Y: 15}, true},
+			{"on node", Node{X: 40, Y: 0}, true},
+			{"outside", Node{X: 30, Y: 30}, false},
+			{"outside along edge", Node{X: 50, Y: 0}, false},
+		} {
+			if got := tri.Contains(tc.p); got != tc.want {
+				t.Errorf("%v: %s: expected %v, got %v", nodes, tc.name, tc.want, got)
+			}
+		}
+		if area := tri.Area(); area != 600 {
+			t.Errorf("%v: expected the area 600, got %v", nodes, area)
+		}
+		if x, y := tri.Centroid(); math.Abs(x-40.0/3) > 1e-9 || math.Abs(y-10) > 1e-9 {
+			t.Errorf("%v: expected the centroid (13.33, 10), got (%v, %v)", nodes, x, y)
+		}
+	}
+
+	degenerate := Triangle{Nodes: []Node{{X: 0, Y: 0}, {X: 10, Y: 10}, {X: 20, Y: 20}}}
+	if degenerate.Area() != 0 || degenerate.Contains(Node{X: 5, Y: 5}) {
+		t.Errorf("expected a zero-area triangle containing no points")
+	}
+}
+
+func TestDelaunay_Remove(t *testing.T) {
+	// canonical returns the triangles as sorted lists of their nodes, so the triangulations can be compared.
+	canonical := func(triangles []Triangle) []string {
+		keys := make([]string, 0, len(triangles))
+		for _, tri := range triangles {
+			nodes := make([]string, 0, 3)
+			for _, n := range tri.Nodes {
+				nodes = append(nodes, fmt.Sprintf("%.6f,%.6f", n.X, n.Y))
+			}
+			sort.Strings(nodes)
+			keys = append(keys, strings.Join(nodes, " "))
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	r := rand.New(rand.NewSource(1))
+	points := make([]Point, 0, 100)
+	for i := 0; i < 100; i++ {
+		points = append(points, Point{X: 1 + r.Float64()*198, Y: 1 + r.Float64()*148})
+	}
+	// The points on the border leave a cavity which is not closed around them.
+	points = append(points, Point{X: 0, Y: 60.5}, Point{X: 120.5, Y: 150})
+
+	all := canonical((&Delaunay{}).Init(200, 150).Insert(points).GetTriangles())
+	for _, i := range []int{0, 42, 99, 100, 101} {
+		remaining := append(append([]Point(nil), points[:i]...), points[i+1:]...)
+
+		delaunay := (&Delaunay{}).Init(200, 150).Insert(points)
+		got := canonical(delaunay.Remove(points[i]).GetTriangles())
+		expected := canonical((&Delaunay{}).Init(200, 150).Insert(remaining).GetTriangles())
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("removing the point %v: expected the triangulation of the remaining points, got %d triangles instead of %d",
+				points[i], len(got), len(expected))
+		}
+
+		// The removed point can be inserted again, restoring the original triangulation.
+		if got := canonical(delaunay.Insert(points[i : i+1]).GetTriangles()); strings.Join(got, "\n") != strings.Join(all, "\n") {
+			t.Errorf("inserting the removed point %v again: expected the original triangulation", points[i])
+		}
+	}
+
+	delaunay := (&Delaunay{}).Init(200, 150).Insert(points)
+	before := len(delaunay.GetTriangles())
+	if n := len(delaunay.Remove(Point{X: 0, Y: 0}).Remove(Point{X: 50, Y: 50}).GetTriangles()); n != before {
+		t.Errorf("expected the corners and the missing points not to be removed, got %d triangles instead of %d", n, before)
+	}
+}
+
+func TestDelaunay_Adjacency(t *testing.T) {
+	// The two triangles of the empty rectangle share its diagonal.
+	d := &Delaunay{}
+	if adj := d.Init(10, 10).Adjacency(); fmt.Sprint(adj) != "map[0:[1] 1:[0]]" {
+		t.Errorf("expected the two triangles to be neighbors, got %v", adj)
+	}
+
+	// The center point splits the rectangle into four triangles, each of them
+	// sharing an edge with the two triangles next to it around the center.
+	triangles := d.Init(10, 10).Insert([]Point{{X: 5, Y: 5}}).GetTriangles()
+	adj := d.Adjacency()
+	if len(triangles) != 4 || len(adj) != 4 {
+		t.Fatalf("expected 4 triangles, got %d", len(triangles))
+	}
+	for i, neighbors := range adj {
+		if len(neighbors) != 2 {
+			t.Errorf("expected the triangle %d to have 2 neighbors, got %v", i, neighbors)
+		}
+		for _, j := range neighbors {
+			var common int
+			for _, a := range triangles[i].Nodes {
+				for _, b := range triangles[j].Nodes {
+					if a == b {
+						common++
+					}
+				}
+			}
+			if common != 2 {
+				t.Errorf("expected the triangles %d and %d to share an edge, got %d common nodes", i, j, common)
+			}
+			if k := sort.SearchInts(adj[j], i); k == len(adj[j]) || adj[j][k] != i {
+				t.Errorf("expected the triangle %d to be a neighbor of %d, got %v", i, j, adj[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package triangle
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// dirExts are the extensions of the source images processed by ProcessDir.
+var dirExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".bmp": true, ".gif": true}
+
+// DirResult is the result of the triangulation of an image processed by ProcessDir.
+type DirResult struct {
+	// Path is the path of the source image.
+	Path string
+	// Dest is the path of the triangulated image.
+	Dest string
+	// Stats are the processing statistics of the image.
+	Stats Stats
+	// Err is the error which prevented the image to be triangulated, if any.
+	Err error
+}
+
+// ProcessDir triangulates the images found under the src directory and its subdirectories concurrently,
+// writing the results to the same relative paths under the dst directory, in the format of the source images.
+// The dst directory is not walked in case it's placed under the src directory.
+// The onResult callback is called for every image as soon as it's processed, from the calling goroutine,
+// so it doesn't have to be safe for concurrent use. The directory is walked only as fast as the images are
+// processed, so the number of the pending images is bounded by the number of the workers, regardless of
+// the size of the directory. The progress function defined by WithProgress is called concurrently for the images being processed.
+// ProcessDir returns the error of the directory walk, or the context error in case it's cancelled, while the
+// errors of the images are reported to the callback.
+func ProcessDir(ctx context.Context, src, dst string, p *Processor, onResult func(DirResult)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := runtime.NumCPU()
+	paths := make(chan string, workers)
+	results := make(chan DirResult, workers)
+
+	errc := make(chan error, 1)
+	go func() {
+		defer close(paths)
+		errc <- filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != src && filepath.Clean(path) == filepath.Clean(dst) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !dirExts[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case paths <- path:
+			}
+			return nil
+		})
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				res := processFile(ctx, src, dst, path, p)
+				select {
+				case <-ctx.Done():
+					return
+				case results <- res:
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(results)
+		wg.Wait()
+	}()
+
+	for res := range results {
+		onResult(res)
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// processFile triangulates the image found under the src directory into the same relative path
+// under the dst directory, creating its parent directories. The partially written output is removed
+// in case the triangulation fails.
+func processFile(ctx context.Context, src, dst, path string, p *Processor) DirResult {
+	res := DirResult{Path: path}
+	rel, err := filepath.Rel(src, path)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Dest = filepath.Join(dst, rel)
+	if err := os.MkdirAll(filepath.Dir(res.Dest), 0755); err != nil {
+		res.Err = err
+		return res
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer in.Close()
+
+	out, err := os.Create(res.Dest)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	// The images processed concurrently have their own statistics.
+	proc := *p
+	proc.Stats = new(Stats)
+	err = RunContext(ctx, in, out, filepath.Ext(path), &proc)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(res.Dest)
+		res.Err = err
+	}
+	res.Stats = *proc.Stats
+	return res
+}
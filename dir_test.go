@@ -0,0 +1,73 @@
+package triangle
+
+import (
+	"context"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessDir(t *testing.T) {
+	src := t.TempDir()
+	files := []string{"a.png", "b.png", filepath.Join("sub", "c.png")}
+	for _, name := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, newTestImage(60, 40)); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	// The files which are not images are skipped.
+	if err := os.WriteFile(filepath.Join(src, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The output is written under the source directory, which must not be walked again.
+	dst := filepath.Join(src, "out")
+	p := newTestProcessor()
+	calls := make(map[string]int)
+	err := ProcessDir(context.Background(), src, dst, &p, func(res DirResult) {
+		calls[res.Path]++
+		if res.Err != nil {
+			t.Errorf("%s: unexpected error: %v", res.Path, res.Err)
+			return
+		}
+		if res.Stats.Triangles == 0 {
+			t.Errorf("%s: expected the triangles to be counted", res.Path)
+		}
+		if _, err := os.Stat(res.Dest); err != nil {
+			t.Errorf("%s: expected the output to be written: %v", res.Path, err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(calls) != len(files) {
+		t.Errorf("expected the callback to be called for %d files, got %d: %v", len(files), len(calls), calls)
+	}
+	for _, name := range files {
+		if n := calls[filepath.Join(src, name)]; n != 1 {
+			t.Errorf("%s: expected the callback to be called once, got %d", name, n)
+		}
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("%s: expected the output to preserve the relative path: %v", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = ProcessDir(ctx, src, t.TempDir(), &p, func(DirResult) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+// defaultPointRadius is the radius of the dots drawn at the points in case the PointRadius option is 0.
+const defaultPointRadius = 2
+
+// dot is a filled circle drawn at a triangulated point, in the coordinates of the source image.
+type dot struct {
+	Center Node
+	Radius float64
+	Color  color.RGBA
+}
+
+// pointDots returns the dots drawn at the points in case the ShowPoints option is enabled, filled with the colors
+// of the image at the points, replaced by the closest palette color in case the palette is not nil.
+// The points over the transparent areas are skipped in case a background color is defined, like the triangles.
+func (p Processor) pointDots(img *image.NRGBA, pal color.Palette, points []Point) []dot {
+	if !p.ShowPoints {
+		return nil
+	}
+	radius := p.PointRadius
+	if radius == 0 {
+		radius = defaultPointRadius
+	}
+
+	b := img.Bounds()
+	dots := make([]dot, 0, len(points))
+	for _, pt := range points {
+		x := Min(Max(int(pt.X), b.Min.X), b.Max.X-1)
+		y := Min(Max(int(pt.Y), b.Min.Y), b.Max.Y-1)
+		c := img.NRGBAAt(x, y)
+		if pal != nil {
+			c = snapColor(pal, c)
+		}
+		if c.A == 0 && p.BgColor != "" {
+			continue
+		}
+		if p.BgColor != "" {
+			c.A = 255
+		}
+		dots = append(dots, dot{
+			Center: Node{X: pt.X, Y: pt.Y},
+			Radius: radius,
+			Color:  color.RGBAModel.Convert(c).(color.RGBA),
+		})
+	}
+	return dots
+}
+
+// drawDots draws the dots over the context, which is scaled to the output size.
+func drawDots(dc *gg.Context, dots []dot) {
+	for _, d := range dots {
+		dc.DrawCircle(d.Center.X, d.Center.Y, d.Radius)
+		dc.SetColor(d.Color)
+		dc.Fill()
+	}
+}
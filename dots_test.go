@@ -0,0 +1,49 @@
+package triangle
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+func TestShowPoints(t *testing.T) {
+	src := newTestImage(120, 80)
+	proc := newTestProcessor()
+	proc.ShowPoints, proc.PointRadius, proc.BgColor = true, 3, "#ffffff"
+
+	for _, compact := range []bool{false, true} {
+		svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+		svg.Compact = compact
+		_, _, points, err := svg.Draw(src, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := svg.Render(&buf); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := strings.Count(buf.String(), "<circle "); n != len(points) || n == 0 {
+			t.Errorf("compact %v: expected a circle for each of the %d points, got %d", compact, len(points), n)
+		}
+	}
+
+	// The dots are drawn over the blue strokes, filled with the uniform source color.
+	uniform := image.NewNRGBA(image.Rect(0, 0, 120, 80))
+	draw.Draw(uniform, uniform.Bounds(), image.NewUniform(color.NRGBA{R: 200, G: 50, B: 50, A: 255}), image.Point{}, draw.Src)
+	pts := []Point{{30, 20}, {90, 20}, {60, 40}, {30, 60}, {90, 60}}
+
+	proc.Wireframe, proc.StrokeColor, proc.BgColor = WireframeOnly, "#0000ff", "#000000"
+	res, _, _, err := (&Image{Processor: proc}).DrawWithPoints(uniform, pts, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img := ImgToNRGBA(res)
+	for _, pt := range pts {
+		if got := img.NRGBAAt(int(pt.X), int(pt.Y)); got != (color.NRGBA{R: 200, G: 50, B: 50, A: 255}) {
+			t.Errorf("expected the dot at %v to have the source color, got %v", pt, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package triangle
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"golang.org/x/image/bmp"
+)
+
+// EncodeOptions defines the options of the encoded images.
+type EncodeOptions struct {
+	// Quality defines the quality of the JPEG and WebP images in the [1, 100] range.
+	// When it's 0, the images are encoded with the maximum quality.
+	Quality int
+}
+
+// Encode encodes the image in the provided format, returning the encoded bytes without writing any file.
+// The supported formats are jpg, jpeg, png, bmp, webp, gif and the binary Netpbm ppm and pgm formats,
+// which can be given as file extensions too, like ".png". An empty format encodes the image as JPEG. The SVG output is encoded by the SVG Bytes method.
+// The transparent areas are filled with white in case of the JPEG and Netpbm formats, which don't support transparency.
+func Encode(img image.Image, format string, opts EncodeOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, img, format, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encode writes the image to w in the provided format.
+func encode(w io.Writer, img image.Image, format string, opts EncodeOptions) error {
+	quality := opts.Quality
+	if quality < 1 || quality > 100 {
+		quality = 100
+	}
+
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	// The transparent areas are filled with white, instead of being flattened to black by the encoders.
+	switch format {
+	case "", "jpg", "jpeg", "ppm", "pgm":
+		img = flatten(img, color.White)
+	}
+
+	switch format {
+	case "", "jpg", "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case "png":
+		return png.Encode(w, img)
+	case "bmp":
+		return bmp.Encode(w, img)
+	case "webp":
+		return EncodeWebP(w, img, quality)
+	case "gif":
+		return gif.Encode(w, img, nil)
+	case "ppm":
+		return encodeNetpbm(w, img, false)
+	case "pgm":
+		return encodeNetpbm(w, img, true)
+	}
+	return fmt.Errorf("unsupported image format: %q", format)
+}
+
+// Bytes renders the generated SVG to a byte slice, in the same way as the Render method.
+func (svg *SVG) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := svg.Render(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
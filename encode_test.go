@@ -0,0 +1,125 @@
+package triangle
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	img := newTestImage(40, 30)
+
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{"", "jpeg"},
+		{".jpg", "jpeg"},
+		{"JPEG", "jpeg"},
+		{"png", "png"},
+		{".bmp", "bmp"},
+		{"gif", "gif"},
+	} {
+		b, err := Encode(img, tc.format, EncodeOptions{Quality: 90})
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.format, err)
+			continue
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+		if err != nil {
+			t.Errorf("%q: unable to decode the encoded image: %v", tc.format, err)
+			continue
+		}
+		if format != tc.want {
+			t.Errorf("%q: expected the %s format, got %s", tc.format, tc.want, format)
+		}
+		if cfg.Width != 40 || cfg.Height != 30 {
+			t.Errorf("%q: expected 40x30 size, got %dx%d", tc.format, cfg.Width, cfg.Height)
+		}
+	}
+
+	b, err := Encode(img, "webp", EncodeOptions{})
+	if err != nil {
+		t.Fatalf("webp: unexpected error: %v", err)
+	}
+	if got := decodeWebP(t, b); got.Bounds().Dx() != 40 || got.Bounds().Dy() != 30 {
+		t.Errorf("webp: expected 40x30 size, got %v", got.Bounds().Size())
+	}
+
+	if _, err := Encode(img, "tiff", EncodeOptions{}); err == nil {
+		t.Error("tiff: expected an unsupported format error")
+	}
+}
+
+func TestEncode_JPEGQuality(t *testing.T) {
+	img := newRampImage(120, 80)
+
+	low, err := Encode(img, "jpg", EncodeOptions{Quality: 50})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	high, err := Encode(img, "jpg", EncodeOptions{Quality: 100})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(low) >= len(high) {
+		t.Errorf("expected the quality of 50 to give a smaller file than 100, got %d >= %d bytes", len(low), len(high))
+	}
+
+	// The quality out of the accepted range falls back to the highest one.
+	def, err := Encode(img, "jpg", EncodeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(def, high) {
+		t.Error("expected the undefined quality to encode the image at the quality of 100")
+	}
+}
+
+func TestEncode_Transparent(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+
+	// The transparent pixels are written as white by the formats not supporting transparency.
+	for _, format := range []string{"ppm", "pgm"} {
+		b, err := Encode(img, format, EncodeOptions{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if pix := b[len(b)-8:]; !bytes.Equal(pix, bytes.Repeat([]byte{0xff}, len(pix))) {
+			t.Errorf("%s: expected the transparent pixels to be white, got %v", format, pix)
+		}
+	}
+
+	b, err := Encode(img, "jpg", EncodeOptions{})
+	if err != nil {
+		t.Fatalf("jpg: unexpected error: %v", err)
+	}
+	res, err := jpeg.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("jpg: unable to decode the encoded image: %v", err)
+	}
+	if r, g, bl, _ := res.At(4, 4).RGBA(); r>>8 < 250 || g>>8 < 250 || bl>>8 < 250 {
+		t.Errorf("jpg: expected the transparent pixels to be white, got %v", res.At(4, 4))
+	}
+}
+
+func TestSVG_Bytes(t *testing.T) {
+	proc := newTestProcessor()
+	svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+	if _, _, _, err := svg.Draw(newTestImage(80, 60), proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := svg.Bytes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := svg.Render(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(b, buf.Bytes()) {
+		t.Error("expected the same output as the Render method")
+	}
+}
@@ -0,0 +1,121 @@
+package triangle
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// exifOrientationTag is the tag of the EXIF orientation field, defining how the image has to be transformed to be upright.
+const exifOrientationTag = 0x0112
+
+// jpegOrientation returns the EXIF orientation of the JPEG image, in the [1, 8] range.
+// In case the image has no EXIF metadata or its orientation can't be read, it returns 1, meaning upright.
+func jpegOrientation(b []byte) int {
+	if len(b) < 4 || b[0] != 0xff || b[1] != 0xd8 {
+		return 1
+	}
+	// Walk the marker segments preceding the image data, looking for the APP1 segment holding the EXIF metadata.
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xff {
+			return 1
+		}
+		marker := b[i+1]
+		if marker == 0xff {
+			i++
+			continue
+		}
+		// The image data follows the start of scan marker, so there is no metadata after it.
+		if marker == 0xda || marker == 0xd9 {
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(b[i+2:]))
+		if size < 2 || i+2+size > len(b) {
+			return 1
+		}
+		if seg := b[i+4 : i+2+size]; marker == 0xe1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation returns the orientation field of the first IFD of the TIFF structure holding the EXIF metadata.
+func tiffOrientation(b []byte) int {
+	if len(b) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(b[2:]) != 42 {
+		return 1
+	}
+
+	ifd := int(order.Uint32(b[4:]))
+	if ifd < 8 || ifd+2 > len(b) {
+		return 1
+	}
+	entries := int(order.Uint16(b[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(b) {
+			return 1
+		}
+		// The orientation is a single short value, stored in the first two bytes of the value field.
+		if order.Uint16(b[entry:]) == exifOrientationTag {
+			if o := int(order.Uint16(b[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient transforms the image according to the EXIF orientation, returning it upright.
+// The orientations 5 to 8 swap the width and height of the image.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// The source pixel of each destination pixel, depending on the flip and rotation of the orientation.
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,92 @@
+package triangle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+)
+
+// exifJPEG encodes the image as JPEG, adding an EXIF segment defining the orientation in the provided byte order.
+func exifJPEG(t *testing.T, img image.Image, orientation int, order binary.ByteOrder) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The TIFF header is followed by the first IFD holding only the orientation entry.
+	tiff := make([]byte, 26)
+	copy(tiff, "II")
+	if order == binary.BigEndian {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], exifOrientationTag)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(seg)+2))
+	app1 = append(app1, seg...)
+
+	b := buf.Bytes()
+	return append(append(append([]byte{}, b[:2]...), app1...), b[2:]...)
+}
+
+func TestDecodeImage_EXIFOrientation(t *testing.T) {
+	// The 40x20 image has a red square in its top-left corner.
+	src := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	draw.Draw(src, src.Bounds(), &image.Uniform{C: color.NRGBA{B: 255, A: 255}}, image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(0, 0, 10, 10), &image.Uniform{C: color.NRGBA{R: 255, A: 255}}, image.Point{}, draw.Src)
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		red         image.Point
+	}{
+		{1, image.Pt(40, 20), image.Pt(5, 5)},
+		{2, image.Pt(40, 20), image.Pt(35, 5)},
+		{3, image.Pt(40, 20), image.Pt(35, 15)},
+		{4, image.Pt(40, 20), image.Pt(5, 15)},
+		{5, image.Pt(20, 40), image.Pt(5, 5)},
+		{6, image.Pt(20, 40), image.Pt(15, 5)},
+		{7, image.Pt(20, 40), image.Pt(15, 35)},
+		{8, image.Pt(20, 40), image.Pt(5, 35)},
+	}
+	for _, tt := range tests {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			img, err := decodeImage(bytes.NewReader(exifJPEG(t, src, tt.orientation, order)))
+			if err != nil {
+				t.Fatalf("orientation %d: unexpected error: %v", tt.orientation, err)
+			}
+			if size := img.Bounds().Size(); size != tt.size {
+				t.Errorf("orientation %d: expected the size %v, got %v", tt.orientation, tt.size, size)
+				continue
+			}
+			if r, _, b, _ := img.At(tt.red.X, tt.red.Y).RGBA(); r < b {
+				t.Errorf("orientation %d: expected the red square at %v", tt.orientation, tt.red)
+			}
+		}
+	}
+
+	// The triangulated output of a portrait photo stored sideways is upright.
+	tri := &Image{Processor: newTestProcessor()}
+	img, err := tri.DecodeImage(bytes.NewReader(exifJPEG(t, src, 6, binary.BigEndian)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, _, _, err := tri.Draw(img, tri.Processor, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size := res.Bounds().Size(); size != image.Pt(20, 40) {
+		t.Errorf("expected the output size %v, got %v", image.Pt(20, 40), size)
+	}
+}
@@ -0,0 +1,74 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// SourceColor - fills every triangle with the color sampled from the source image
+	SourceColor = iota
+	// FacetIndex - fills every triangle with a unique color encoding its index, for picking the triangles
+	FacetIndex
+	// FacetNormal - fills every triangle with the normal of its facet, the image luminance being the height
+	FacetNormal
+)
+
+// fillColor returns the fill color of the i-th triangle according to the FillMode option. The colors sampled
+// from the source image are replaced by the closest palette color in case the palette is not nil, while the
+// false colors are never quantized, since they would lose the encoded values.
+func (p Processor) fillColor(img *image.NRGBA, pal color.Palette, i int, t Triangle) color.NRGBA {
+	switch p.FillMode {
+	case FacetIndex:
+		return facetIndexColor(i)
+	case FacetNormal:
+		return p.facetNormalColor(img, t)
+	}
+	c := p.sampleColor(img, t)
+	if pal != nil {
+		c = snapColor(pal, c)
+	}
+	return c
+}
+
+// facetIndexColor encodes the index of the triangle increased by one into the 24 bits of the red, green and
+// blue channels, in this order, so the black pixels of the background are not mistaken for the first triangle.
+func facetIndexColor(i int) color.NRGBA {
+	n := i + 1
+	return color.NRGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 255}
+}
+
+// FacetIndexAt returns the index of the triangle having the color in the output of the FacetIndex fill mode,
+// or -1 in case the color is black, like the background not covered by any triangle.
+func FacetIndexAt(c color.Color) int {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return (int(n.R)<<16 | int(n.G)<<8 | int(n.B)) - 1
+}
+
+// facetNormalColor returns the normal of the plane passing through the triangle vertices, their heights being
+// the luminance of the image at the vertices, in the [0, 255] range. The normal's x, y and z components are mapped
+// from the [-1, 1] range to the red, green and blue channels, the y axis pointing downwards like the image rows,
+// so the flat facets are (128, 128, 255).
+func (p Processor) facetNormalColor(img *image.NRGBA, t Triangle) color.NRGBA {
+	var h [3]float64
+	for i, c := range p.vertexColors(img, nil, t) {
+		h[i] = 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+	}
+
+	// The gradient of the height is solved from its differences along the two edges starting at the first node.
+	n0, n1, n2 := t.Nodes[0], t.Nodes[1], t.Nodes[2]
+	x1, y1 := n1.X-n0.X, n1.Y-n0.Y
+	x2, y2 := n2.X-n0.X, n2.Y-n0.Y
+	var gx, gy float64
+	if det := x1*y2 - x2*y1; det != 0 {
+		gx = ((h[1]-h[0])*y2 - (h[2]-h[0])*y1) / det
+		gy = (x1*(h[2]-h[0]) - x2*(h[1]-h[0])) / det
+	}
+
+	l := math.Sqrt(gx*gx + gy*gy + 1)
+	encode := func(v float64) uint8 {
+		return uint8(math.Round((v/l + 1) / 2 * 255))
+	}
+	return color.NRGBA{R: encode(-gx), G: encode(-gy), B: encode(1), A: 255}
+}
@@ -0,0 +1,84 @@
+package triangle
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDraw_FillMode(t *testing.T) {
+	w, h := 120, 80
+	src := newRampImage(w, h)
+
+	// The points have integer coordinates, so the luminance is sampled exactly at the vertices.
+	rng := rand.New(rand.NewSource(1))
+	pts := make([]Point, 100)
+	for i := range pts {
+		pts[i] = Point{X: float64(1 + rng.Intn(w-2)), Y: float64(1 + rng.Intn(h-2))}
+	}
+
+	t.Run("FacetIndex", func(t *testing.T) {
+		proc := newTestProcessor()
+		proc.FillMode = FacetIndex
+		res, triangles, _, err := (&Image{Processor: proc}).DrawWithPoints(src, pts, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		img := ImgToNRGBA(res)
+
+		colors := make(map[color.RGBA]bool)
+		for i, tr := range triangles {
+			colors[tr.fill] = true
+			if idx := FacetIndexAt(tr.fill); idx != i {
+				t.Errorf("expected the color of the triangle %d to encode its index, got %d", i, idx)
+			}
+
+			// The triangles are picked at their centroid, away from the antialiased edges.
+			n := tr.Nodes
+			a, b, c := math.Hypot(n[1].X-n[0].X, n[1].Y-n[0].Y), math.Hypot(n[2].X-n[1].X, n[2].Y-n[1].Y), math.Hypot(n[0].X-n[2].X, n[0].Y-n[2].Y)
+			area := math.Abs((n[1].X-n[0].X)*(n[2].Y-n[0].Y)-(n[2].X-n[0].X)*(n[1].Y-n[0].Y)) / 2
+			if 2*area/(a+b+c) < 2 {
+				continue
+			}
+			cx, cy := (n[0].X+n[1].X+n[2].X)/3, (n[0].Y+n[1].Y+n[2].Y)/3
+			if idx := FacetIndexAt(img.At(int(cx), int(cy))); idx != i {
+				t.Errorf("expected the pixel at the centroid of the triangle %d to be picked, got %d", i, idx)
+			}
+		}
+		if len(colors) != len(triangles) {
+			t.Errorf("expected %d distinct colors, got %d", len(triangles), len(colors))
+		}
+		if idx := FacetIndexAt(color.Black); idx != -1 {
+			t.Errorf("expected no triangle to be picked by black, got %d", idx)
+		}
+	})
+
+	t.Run("FacetNormal", func(t *testing.T) {
+		proc := newTestProcessor()
+		proc.FillMode = FacetNormal
+		_, triangles, _, err := (&Image{Processor: proc}).DrawWithPoints(src, pts, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The luminance of the ramp image grows linearly, so every facet has the same normal.
+		gx, gy := 0.299*2, 0.587*3
+		l := math.Sqrt(gx*gx + gy*gy + 1)
+		want := [3]float64{(-gx/l + 1) / 2 * 255, (-gy/l + 1) / 2 * 255, (1/l + 1) / 2 * 255}
+		for i, tr := range triangles {
+			// The vertices on the right and bottom border are sampled from the last pixels.
+			if math.Max(tr.Nodes[0].X, math.Max(tr.Nodes[1].X, tr.Nodes[2].X)) >= float64(w-1) ||
+				math.Max(tr.Nodes[0].Y, math.Max(tr.Nodes[1].Y, tr.Nodes[2].Y)) >= float64(h-1) {
+				continue
+			}
+			got := [3]float64{float64(tr.fill.R), float64(tr.fill.G), float64(tr.fill.B)}
+			for c := range got {
+				if math.Abs(got[c]-want[c]) > 1 {
+					t.Errorf("triangle %d: expected the normal %v, got %v", i, want, got)
+					break
+				}
+			}
+		}
+	})
+}
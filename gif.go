@@ -0,0 +1,301 @@
+package triangle
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math"
+	"sort"
+)
+
+const (
+	// gifFrameDelay is the delay between the successive frames in 100ths of a second.
+	gifFrameDelay = 25
+	// gifLastFrameDelay is the delay of the last frame, which holds the final triangulation.
+	gifLastFrameDelay = 200
+)
+
+// DrawGIF renders the triangulation being built up progressively as an animated GIF.
+// The points are sampled once, like by the Draw method, and the number of frames is defined
+// by the Frames field of the processor, each frame triangulating a growing part of the sampled
+// points. The last frame triangulates all of them, so it's the same as the output of the Draw
+// method. It returns the triangles and points of the last frame.
+func (im *Image) DrawGIF(ctx context.Context, src image.Image, proc Processor, fn Fn) (*gif.GIF, []Triangle, []Point, error) {
+	var (
+		triangles []Triangle
+		points    []Point
+	)
+
+	t, err := triangulateImage(ctx, src, nil, proc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	frames := Max(proc.Frames, 1)
+	if t.blurred() {
+		frames = 1
+	}
+	// The intermediate frames don't overwrite the statistics of the last one.
+	frameProc := t.proc
+	frameProc.Stats = nil
+	s := new(scratch)
+
+	anim := &gif.GIF{}
+	for i := 1; i <= frames; i++ {
+		ft := t
+		if i < frames {
+			n := Max(len(t.points)*i/frames, 1)
+			img, tris, pts, err := s.triangulatePoints(ctx, t.src, frameProc, t.points[:n])
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			ft = &triangulation{src: t.src, img: img, triangles: tris, points: pts, proc: frameProc, start: t.start, sampling: t.sampling}
+		}
+
+		img, tris, pts, err := im.render(ft, func() {}, nil)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		triangles, points = tris, pts
+
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(frame, img.Bounds(), img, img.Bounds().Min)
+
+		delay := gifFrameDelay
+		if i == frames {
+			delay = gifLastFrameDelay
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	fn()
+	return anim, triangles, points, nil
+}
+
+// TriangulateGIF triangulates each frame of the animated GIF using the same processor options, returning
+// an animated GIF which preserves the frame delays and the loop count of the source. The frames are composited
+// according to their disposal methods before the triangulation, so each one is triangulated as it's displayed.
+// The output frames share a common palette computed from the colors of all the triangulated frames,
+// since the per-frame palettes would make the colors of the unchanged areas flicker between the frames.
+func TriangulateGIF(g *gif.GIF, p Processor) (*gif.GIF, error) {
+	return TriangulateGIFContext(context.Background(), g, p)
+}
+
+// TriangulateGIFContext is like TriangulateGIF, but it aborts the triangulation of the frames as soon as the context
+// is cancelled or its deadline is exceeded, returning the context error.
+func TriangulateGIFContext(ctx context.Context, g *gif.GIF, p Processor) (*gif.GIF, error) {
+	if len(g.Image) == 0 {
+		return nil, errors.New("the GIF image has no frames")
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range g.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+	canvas := image.NewNRGBA(bounds)
+	previous := image.NewNRGBA(bounds)
+
+	tri := &Image{Processor: p}
+	frames := make([]*image.NRGBA, 0, len(g.Image))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		img, _, _, err := tri.DrawContext(ctx, canvas, p, func() {})
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, ImgToNRGBA(img))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(canvas.Pix, previous.Pix)
+		}
+	}
+
+	pal, transparent := medianCut(frames, 256, true)
+	anim := &gif.GIF{
+		Image:     make([]*image.Paletted, len(frames)),
+		Delay:     make([]int, len(frames)),
+		LoopCount: g.LoopCount,
+		Config: image.Config{
+			ColorModel: pal,
+			Width:      frames[0].Bounds().Dx(),
+			Height:     frames[0].Bounds().Dy(),
+		},
+	}
+	copy(anim.Delay, g.Delay)
+
+	// The frames cover the whole image, but their transparent pixels would let through the previous frame.
+	if transparent {
+		anim.Disposal = make([]byte, len(frames))
+		for i := range anim.Disposal {
+			anim.Disposal[i] = gif.DisposalBackground
+		}
+	}
+
+	cache := make([]int16, 1<<15)
+	for i := range cache {
+		cache[i] = -1
+	}
+	for i, img := range frames {
+		frame := image.NewPaletted(img.Bounds(), pal)
+		for j := 0; j < len(img.Pix)/4; j++ {
+			px := img.Pix[j*4 : j*4+4]
+			if transparent && px[3] < 128 {
+				frame.Pix[j] = 0
+				continue
+			}
+			key := colorKey(px[0], px[1], px[2])
+			if cache[key] < 0 {
+				cache[key] = int16(nearestColor(pal, transparent, px[0], px[1], px[2]))
+			}
+			frame.Pix[j] = uint8(cache[key])
+		}
+		anim.Image[i] = frame
+	}
+	return anim, nil
+}
+
+// colorKey returns the 15 bit key of the color, keeping the 5 most significant bits of the channels.
+func colorKey(r, g, b uint8) int {
+	return int(r>>3)<<10 | int(g>>3)<<5 | int(b>>3)
+}
+
+// colorBox holds the color keys of a median cut box, sorted along one of the channels when it's split.
+type colorBox struct {
+	keys  []int
+	count int
+}
+
+// medianCut computes a palette of at most n colors representing the opaque pixels of the images using
+// the median cut algorithm. In case some of the pixels are transparent and keepTransparent is true, the
+// first palette color is the transparent one, otherwise the palette has only opaque colors. The second
+// returned value reports whether some of the pixels are transparent.
+func medianCut(images []*image.NRGBA, n int, keepTransparent bool) (color.Palette, bool) {
+	var (
+		counts      [1 << 15]int
+		sums        [1 << 15][3]int
+		transparent bool
+	)
+	for _, img := range images {
+		for i := 0; i < len(img.Pix); i += 4 {
+			px := img.Pix[i : i+4]
+			if px[3] < 128 {
+				transparent = true
+				continue
+			}
+			key := colorKey(px[0], px[1], px[2])
+			counts[key]++
+			sums[key][0] += int(px[0])
+			sums[key][1] += int(px[1])
+			sums[key][2] += int(px[2])
+		}
+	}
+
+	var pal color.Palette
+	if transparent && keepTransparent {
+		pal = append(pal, color.RGBA{})
+		n--
+	}
+
+	box := colorBox{}
+	for key, count := range counts {
+		if count > 0 {
+			box.keys = append(box.keys, key)
+			box.count += count
+		}
+	}
+	if len(box.keys) == 0 {
+		return append(pal, color.RGBA{A: 255}), transparent
+	}
+
+	// Split the most populated box along its widest channel until the palette is full.
+	boxes := []colorBox{box}
+	for len(boxes) < n {
+		idx := -1
+		for i, b := range boxes {
+			if len(b.keys) > 1 && (idx < 0 || b.count > boxes[idx].count) {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			break
+		}
+		b := boxes[idx]
+
+		var lo, hi [3]int
+		lo = [3]int{31, 31, 31}
+		for _, key := range b.keys {
+			for c := 0; c < 3; c++ {
+				v := key >> (10 - c*5) & 31
+				lo[c], hi[c] = Min(lo[c], v), Max(hi[c], v)
+			}
+		}
+		ch := 0
+		for c := 1; c < 3; c++ {
+			if hi[c]-lo[c] > hi[ch]-lo[ch] {
+				ch = c
+			}
+		}
+		shift := 10 - ch*5
+		sort.Slice(b.keys, func(i, j int) bool {
+			return b.keys[i]>>shift&31 < b.keys[j]>>shift&31
+		})
+
+		// Split at the weighted median, keeping at least one key on each side.
+		var count int
+		split := 1
+		for i, key := range b.keys[:len(b.keys)-1] {
+			count += counts[key]
+			split = i + 1
+			if count*2 >= b.count {
+				break
+			}
+		}
+		boxes[idx] = colorBox{keys: b.keys[:split], count: count}
+		boxes = append(boxes, colorBox{keys: b.keys[split:], count: b.count - count})
+	}
+
+	// The palette colors are the average colors of the boxes.
+	for _, b := range boxes {
+		var r, g, bl int
+		for _, key := range b.keys {
+			r += sums[key][0]
+			g += sums[key][1]
+			bl += sums[key][2]
+		}
+		pal = append(pal, color.RGBA{R: uint8(r / b.count), G: uint8(g / b.count), B: uint8(bl / b.count), A: 255})
+	}
+	return pal, transparent
+}
+
+// nearestColor returns the index of the opaque palette color closest to the provided color.
+func nearestColor(pal color.Palette, transparent bool, r, g, b uint8) int {
+	idx, best := 0, math.MaxInt
+	for i, c := range pal {
+		if transparent && i == 0 {
+			continue
+		}
+		pc := c.(color.RGBA)
+		dr, dg, db := int(pc.R)-int(r), int(pc.G)-int(g), int(pc.B)-int(b)
+		if d := dr*dr + dg*dg + db*db; d < best {
+			idx, best = i, d
+		}
+	}
+	return idx
+}
@@ -0,0 +1,111 @@
+package triangle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"reflect"
+	"testing"
+)
+
+func TestDrawGIF(t *testing.T) {
+	proc := newTestProcessor()
+	proc.Frames = 4
+
+	tri := &Image{Processor: proc}
+	anim, triangles, points, err := tri.DrawGIF(context.Background(), newTestImage(120, 80), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(anim.Image) != proc.Frames || len(anim.Delay) != proc.Frames {
+		t.Fatalf("expected %d frames, got %d images and %d delays", proc.Frames, len(anim.Image), len(anim.Delay))
+	}
+	for i, frame := range anim.Image {
+		if w, h := frame.Bounds().Dx(), frame.Bounds().Dy(); w != 120 || h != 80 {
+			t.Errorf("frame %d: expected 120x80 size, got %dx%d", i, w, h)
+		}
+	}
+	if len(triangles) == 0 || len(points) == 0 {
+		t.Errorf("expected the triangulation of the last frame, got %d triangles and %d points", len(triangles), len(points))
+	}
+
+	// The last frame triangulates all the sampled points.
+	_, want, _, err := tri.DrawWithPoints(newTestImage(120, 80), points, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(triangles) != len(want) {
+		t.Fatalf("expected the %d triangles of the sampled points, got %d", len(want), len(triangles))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(triangles[i].Nodes, want[i].Nodes) {
+			t.Fatalf("triangle %d: expected %v, got %v", i, want[i].Nodes, triangles[i].Nodes)
+		}
+	}
+}
+
+func TestTriangulateGIF(t *testing.T) {
+	pal := color.Palette{
+		color.RGBA{R: 20, G: 40, B: 60, A: 255},
+		color.RGBA{R: 220, G: 200, B: 180, A: 255},
+		color.RGBA{R: 200, G: 30, B: 30, A: 255},
+	}
+	src := &gif.GIF{LoopCount: 2}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 120, 80), pal)
+		draw.Draw(frame, frame.Bounds(), newTestImage(120, 80), image.Point{}, draw.Src)
+		// Move a red square across the frames.
+		draw.Draw(frame, image.Rect(10+i*30, 10, 30+i*30, 30), &image.Uniform{pal[2]}, image.Point{}, draw.Src)
+
+		src.Image = append(src.Image, frame)
+		src.Delay = append(src.Delay, 10*(i+1))
+	}
+
+	anim, err := TriangulateGIF(src, newTestProcessor())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(anim.Image) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(anim.Image))
+	}
+	if !reflect.DeepEqual(anim.Delay, src.Delay) {
+		t.Errorf("expected the %v delays, got %v", src.Delay, anim.Delay)
+	}
+	if anim.LoopCount != src.LoopCount {
+		t.Errorf("expected %d loop count, got %d", src.LoopCount, anim.LoopCount)
+	}
+	for i, frame := range anim.Image {
+		if w, h := frame.Bounds().Dx(), frame.Bounds().Dy(); w != 120 || h != 80 {
+			t.Errorf("frame %d: expected 120x80 size, got %dx%d", i, w, h)
+		}
+		if !reflect.DeepEqual(frame.Palette, anim.Image[0].Palette) {
+			t.Errorf("frame %d: expected the frames to share the same palette", i)
+		}
+	}
+	if len(anim.Image[0].Palette) > 256 {
+		t.Errorf("expected at most 256 palette colors, got %d", len(anim.Image[0].Palette))
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("unable to encode the GIF: %v", err)
+	}
+
+	// The triangulation of the frames is aborted by the cancelled context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := TriangulateGIFContext(ctx, src, newTestProcessor()); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+
+	// The same holds for the animated GIF sources of RunContext.
+	var dst bytes.Buffer
+	p := newTestProcessor()
+	if err := RunContext(ctx, bytes.NewReader(buf.Bytes()), &dst, "gif", &p); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error from RunContext, got %v", err)
+	}
+}
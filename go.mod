@@ -4,12 +4,10 @@ go 1.18
 
 require (
 	github.com/fogleman/gg v1.0.0
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	golang.org/x/exp v0.0.0-20220407100705-7b9b53b0aca4
 	golang.org/x/image v0.0.0-20171214225156-12117c17ca67
 	golang.org/x/term v0.0.0-20210429154555-c04ba851c2a4
 )
 
-require (
-	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	golang.org/x/sys v0.0.0-20211019181941-9d821ace8654 // indirect
-)
+require golang.org/x/sys v0.0.0-20211019181941-9d821ace8654 // indirect
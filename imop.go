@@ -3,30 +3,74 @@ package triangle
 import (
 	"image"
 	"image/color"
+	"image/draw"
 	"math"
 
 	"golang.org/x/exp/constraints"
 )
 
-// Grayscale converts the image to grayscale mode.
+// Grayscale converts the image to grayscale mode, using the Rec. 601 luma coefficients.
 func Grayscale(src *image.NRGBA) *image.NRGBA {
+	return grayscale(image.NewNRGBA(src.Bounds()), src, Rec601Luminance)
+}
+
+// grayscale is like Grayscale, but it writes the result into the provided image having the same size as the source,
+// computing the luminance with the provided mode. The transparent pixels are composited over a black background.
+func grayscale(dst, src *image.NRGBA, mode int) *image.NRGBA {
 	dx, dy := src.Bounds().Max.X, src.Bounds().Max.Y
-	dst := image.NewNRGBA(src.Bounds())
 	for x := 0; x < dx; x++ {
 		for y := 0; y < dy; y++ {
-			r, g, b, a := src.At(x, y).RGBA()
-			// check for swapped color channel order
-			if r == 0 {
-				r = a
+			var gray uint8
+
+			c := src.NRGBAAt(x, y)
+			switch mode {
+			case LinearLuminance:
+				lum := 0.2126*srgbToLinear[c.R] + 0.7152*srgbToLinear[c.G] + 0.0722*srgbToLinear[c.B]
+				gray = linearToSRGB(lum * float64(c.A) / 255)
+			default:
+				wr, wg, wb := float32(0.299), float32(0.587), float32(0.114)
+				if mode == Rec709Luminance {
+					wr, wg, wb = 0.2126, 0.7152, 0.0722
+				}
+				r, g, b, _ := c.RGBA()
+				lum := float32(r)*wr + float32(g)*wg + float32(b)*wb
+				gray = uint8(lum / 256)
 			}
-			lum := float32(r)*0.299 + float32(g)*0.587 + float32(b)*0.114
-			pixel := color.Gray{uint8(lum / 256)}
-			dst.Set(x, y, pixel)
+			dst.SetNRGBA(x, y, color.NRGBA{R: gray, G: gray, B: gray, A: 255})
 		}
 	}
 	return dst
 }
 
+// srgbToLinear maps the sRGB encoded 8-bit values to the linear light intensity in the [0, 1] range.
+var srgbToLinear = func() (table [256]float64) {
+	for i := range table {
+		table[i] = decodeSRGB(float64(i) / 255)
+	}
+	return table
+}()
+
+// linearToSRGB encodes the linear light intensity in the [0, 1] range to an sRGB 8-bit value.
+func linearToSRGB(v float64) uint8 {
+	return uint8(Min(Max(encodeSRGB(v)*255+0.5, 0), 255))
+}
+
+// decodeSRGB converts the sRGB encoded value in the [0, 1] range to the linear light intensity.
+func decodeSRGB(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// encodeSRGB converts the linear light intensity in the [0, 1] range to the sRGB encoded value.
+func encodeSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
 // ImgToNRGBA converts any image type to *image.NRGBA with min-point at (0, 0).
 func ImgToNRGBA(img image.Image) *image.NRGBA {
 	srcBounds := img.Bounds()
@@ -35,13 +79,18 @@ func ImgToNRGBA(img image.Image) *image.NRGBA {
 			return src0
 		}
 	}
+	return convertNRGBA(image.NewNRGBA(srcBounds.Sub(srcBounds.Min)), img)
+}
+
+// convertNRGBA is like ImgToNRGBA, but it always copies the image pixels
+// into the provided image, having the source size and its min-point at (0, 0).
+func convertNRGBA(dst *image.NRGBA, img image.Image) *image.NRGBA {
+	srcBounds := img.Bounds()
 	srcMinX := srcBounds.Min.X
 	srcMinY := srcBounds.Min.Y
 
-	dstBounds := srcBounds.Sub(srcBounds.Min)
-	dstW := dstBounds.Dx()
-	dstH := dstBounds.Dy()
-	dst := image.NewNRGBA(dstBounds)
+	dstW := srcBounds.Dx()
+	dstH := srcBounds.Dy()
 
 	switch src := img.(type) {
 	case *image.NRGBA:
@@ -49,9 +98,7 @@ func ImgToNRGBA(img image.Image) *image.NRGBA {
 		for dstY := 0; dstY < dstH; dstY++ {
 			di := dst.PixOffset(0, dstY)
 			si := src.PixOffset(srcMinX, srcMinY+dstY)
-			for dstX := 0; dstX < dstW; dstX++ {
-				copy(dst.Pix[di:di+rowSize], src.Pix[si:si+rowSize])
-			}
+			copy(dst.Pix[di:di+rowSize], src.Pix[si:si+rowSize])
 		}
 	case *image.YCbCr:
 		for dstY := 0; dstY < dstH; dstY++ {
@@ -86,9 +133,114 @@ func ImgToNRGBA(img image.Image) *image.NRGBA {
 	return dst
 }
 
+// downscale reduces the image to the width x height size, each pixel being the average of the source pixels
+// it covers, weighted by their alpha, so the transparent pixels don't darken the colors of the opaque ones.
+func downscale(dst, src *image.NRGBA, width, height int) *image.NRGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, Max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, Max((x+1)*sw/width, x*sw/width+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					pa := int(src.Pix[i+3])
+					r += int(src.Pix[i]) * pa
+					g += int(src.Pix[i+1]) * pa
+					b += int(src.Pix[i+2]) * pa
+					a += pa
+					n++
+					i += 4
+				}
+			}
+			i := dst.PixOffset(x, y)
+			if a > 0 {
+				dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2] = uint8(r/a), uint8(g/a), uint8(b/a)
+			} else {
+				dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2] = 0, 0, 0
+			}
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// posterize reduces the color channels of the image to the provided number of evenly spaced levels in place,
+// rounding every value to the closest level. The alpha channel is left unchanged.
+func posterize(img *image.NRGBA, levels int) *image.NRGBA {
+	var lut [256]uint8
+	step := 255 / float64(levels-1)
+	for v := range lut {
+		lut[v] = uint8(math.Round(math.Round(float64(v)/step) * step))
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = lut[img.Pix[i]], lut[img.Pix[i+1]], lut[img.Pix[i+2]]
+	}
+	return img
+}
+
+// rotateFlip rotates the image clockwise by the provided angle, which is a multiple of 90 degrees, then mirrors
+// it horizontally and vertically. The source image is returned in case it's not transformed, otherwise a new image
+// is returned, keeping the precision of the 16-bit images.
+func rotateFlip(img image.Image, angle int, flipH, flipV bool) image.Image {
+	if angle == 0 && !flipH && !flipV {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if angle == 90 || angle == 270 {
+		dw, dh = h, w
+	}
+
+	var dst draw.Image = image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	if is16Bit(img) {
+		dst = image.NewNRGBA64(image.Rect(0, 0, dw, dh))
+	}
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// The flips mirror the rotated image, so they are undone first.
+			rx, ry := x, y
+			if flipH {
+				rx = dw - 1 - x
+			}
+			if flipV {
+				ry = dh - 1 - y
+			}
+			sx, sy := rx, ry
+			switch angle {
+			case 90:
+				sx, sy = ry, h-1-rx
+			case 180:
+				sx, sy = w-1-rx, h-1-ry
+			case 270:
+				sx, sy = w-1-ry, rx
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// flatten composites the image over the background color, returning the source image in case it's opaque.
+func flatten(img image.Image, bg color.Color) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
+
 // convolutionFilter applies a mathematical operation over the source image by taking
 // the matrix table as input parameter and convolving the matrix values over the pixels data.
-func convolutionFilter(matrix []float64, img *image.NRGBA, divisor float64) {
+// The values buffer holds a copy of the pixels data, having an element for each pixel.
+func convolutionFilter(matrix []float64, img *image.NRGBA, divisor float64, values []int) {
 	var (
 		divscalar float64
 
@@ -104,9 +256,8 @@ func convolutionFilter(matrix []float64, img *image.NRGBA, divisor float64) {
 			matrix[k] *= divscalar
 		}
 	}
-	copy := make([]int, len(img.Pix)/4)
-	for i := 0; i < len(copy); i++ {
-		copy[i] = int(img.Pix[i*4])
+	for i := 0; i < len(values); i++ {
+		values[i] = int(img.Pix[i*4])
 	}
 
 	for y := 0; y < height; y++ {
@@ -125,7 +276,7 @@ func convolutionFilter(matrix []float64, img *image.NRGBA, divisor float64) {
 						sx := x + col
 						v := matrix[(col+dim)+kstep]
 						if sx >= 0 && sx < width {
-							r += int(float64(copy[sx+jstep]) * v)
+							r += int(float64(values[sx+jstep]) * v)
 						}
 					}
 				}
@@ -142,6 +293,87 @@ func convolutionFilter(matrix []float64, img *image.NRGBA, divisor float64) {
 	}
 }
 
+// separableFilter convolves a one dimensional kernel over all the image channels,
+// first horizontally then vertically. The image borders are extended by repeating the edge pixels.
+func separableFilter(kernel []float64, img *image.NRGBA) {
+	var (
+		width  = img.Bounds().Dx()
+		height = img.Bounds().Dy()
+		dim    = len(kernel) / 2
+	)
+
+	tmp := make([]uint8, len(img.Pix))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+
+			for k := -dim; k <= dim; k++ {
+				sx := Min(Max(x+k, 0), width-1)
+				idx := img.PixOffset(sx, y)
+				v := kernel[k+dim]
+				for c := 0; c < 4; c++ {
+					sum[c] += float64(img.Pix[idx+c]) * v
+				}
+			}
+			idx := img.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				tmp[idx+c] = uint8(Min(Max(sum[c]+0.5, 0), 255))
+			}
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+
+			for k := -dim; k <= dim; k++ {
+				sy := Min(Max(y+k, 0), height-1)
+				idx := img.PixOffset(x, sy)
+				v := kernel[k+dim]
+				for c := 0; c < 4; c++ {
+					sum[c] += float64(tmp[idx+c]) * v
+				}
+			}
+			idx := img.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				img.Pix[idx+c] = uint8(Min(Max(sum[c]+0.5, 0), 255))
+			}
+		}
+	}
+}
+
+// GaussianBlur applies a gaussian blur filter to the provided image.
+// The radius defines the size of the kernel, the standard deviation being half of the radius.
+// Since the cost of the filter grows linearly with the radius, for large images and radiuses
+// the StackBlur method is considerably faster, but the gaussian blur gives a smoother result.
+func GaussianBlur(img *image.NRGBA, radius uint32) *image.NRGBA {
+	// Stop blurring and return the original image in case the radius is less then 1.
+	if radius < 1 {
+		return img
+	}
+	separableFilter(setGaussianMatrix(int(radius)), img)
+
+	return img
+}
+
+// blendLayer blends the layer over the base image having the same size, at the provided opacity in the [0, 1] range.
+// The pixels are linearly interpolated, so an opacity of 0 gives the base image, while 1 keeps the layer unchanged.
+func blendLayer(layer, base *image.RGBA, opacity float64) {
+	for i, v := range layer.Pix {
+		layer.Pix[i] = uint8(math.Round(float64(base.Pix[i])*(1-opacity) + float64(v)*opacity))
+	}
+}
+
+// blendLayer64 is like blendLayer, but it blends the images having 16 bits per channel.
+func blendLayer64(layer, base *image.RGBA64, opacity float64) {
+	for i := 0; i < len(layer.Pix); i += 2 {
+		v := float64(uint16(layer.Pix[i])<<8 | uint16(layer.Pix[i+1]))
+		b := float64(uint16(base.Pix[i])<<8 | uint16(base.Pix[i+1]))
+		c := uint16(math.Round(b*(1-opacity) + v*opacity))
+		layer.Pix[i], layer.Pix[i+1] = uint8(c>>8), uint8(c)
+	}
+}
+
 // Min returns the smallest value between two numbers.
 func Min[T constraints.Ordered](values ...T) T {
 	var acc T = values[0]
@@ -181,6 +413,27 @@ func setBlurMatrix(size int) []float64 {
 	return matrix
 }
 
+// setGaussianMatrix populates a one dimensional normalized gaussian kernel used by the separable filter.
+func setGaussianMatrix(radius int) []float64 {
+	var (
+		side   = radius*2 + 1
+		sigma  = Max(float64(radius)*0.5, 0.5)
+		matrix = make([]float64, side)
+		sum    float64
+	)
+
+	for i := 0; i < side; i++ {
+		x := float64(i - radius)
+		matrix[i] = math.Exp(-(x * x) / (2 * sigma * sigma))
+		sum += matrix[i]
+	}
+	for i := 0; i < side; i++ {
+		matrix[i] /= sum
+	}
+
+	return matrix
+}
+
 // setEdgeMatrix populates a matrix table with values used in conjunction with the convolution filter operator.
 func setEdgeMatrix(size int) []float64 {
 	var (
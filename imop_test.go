@@ -0,0 +1,183 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestGrayscale_LuminanceModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		c        color.NRGBA
+		expected [3]uint8 // Rec601Luminance, Rec709Luminance, LinearLuminance
+	}{
+		{"black", color.NRGBA{A: 255}, [3]uint8{0, 0, 0}},
+		{"white", color.NRGBA{R: 255, G: 255, B: 255, A: 255}, [3]uint8{255, 255, 255}},
+		{"gray", color.NRGBA{R: 128, G: 128, B: 128, A: 255}, [3]uint8{128, 128, 128}},
+		{"red", color.NRGBA{R: 255, A: 255}, [3]uint8{76, 54, 127}},
+		{"green", color.NRGBA{G: 255, A: 255}, [3]uint8{150, 183, 220}},
+		{"blue", color.NRGBA{B: 255, A: 255}, [3]uint8{29, 18, 76}},
+		{"transparent", color.NRGBA{R: 255, G: 255, B: 255}, [3]uint8{0, 0, 0}},
+	}
+	modes := []int{Rec601Luminance, Rec709Luminance, LinearLuminance}
+
+	for _, tt := range tests {
+		src := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+		for i := 0; i < 4; i++ {
+			src.SetNRGBA(i%2, i/2, tt.c)
+		}
+		for i, mode := range modes {
+			dst := grayscale(image.NewNRGBA(src.Bounds()), src, mode)
+			c := dst.NRGBAAt(1, 1)
+			if c.R != tt.expected[i] || c.G != c.R || c.B != c.R || c.A != 255 {
+				t.Errorf("%s: expected the luminance %d with the mode %d, got %v", tt.name, tt.expected[i], mode, c)
+			}
+		}
+	}
+}
+
+func TestDraw_Posterize(t *testing.T) {
+	levels := map[uint8]bool{0: true, 85: true, 170: true, 255: true}
+
+	proc := newTestProcessor()
+	proc.Posterize = 4
+	for _, drawer := range []Drawer{&Image{Processor: proc}, &SVG{Processor: proc}} {
+		_, triangles, _, err := drawer.Draw(newRampImage(120, 80), proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(triangles) == 0 {
+			t.Fatal("expected the image to be triangulated")
+		}
+		for _, tr := range triangles {
+			if c := tr.fill; !levels[c.R] || !levels[c.G] || !levels[c.B] {
+				t.Fatalf("%T: expected the fill color to take only the posterized levels, got %v", drawer, c)
+			}
+		}
+	}
+}
+
+func TestRotateFlip(t *testing.T) {
+	// Every pixel encodes its coordinates, so the source of each transformed pixel is known.
+	w, h := 4, 3
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+
+	tests := []struct {
+		name         string
+		angle        int
+		flipH, flipV bool
+		size         image.Point
+		source       func(x, y int) (int, int)
+	}{
+		{"rotate 90", 90, false, false, image.Pt(h, w), func(x, y int) (int, int) { return y, h - 1 - x }},
+		{"rotate 180", 180, false, false, image.Pt(w, h), func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }},
+		{"rotate 270", 270, false, false, image.Pt(h, w), func(x, y int) (int, int) { return w - 1 - y, x }},
+		{"flip horizontal", 0, true, false, image.Pt(w, h), func(x, y int) (int, int) { return w - 1 - x, y }},
+		{"flip vertical", 0, false, true, image.Pt(w, h), func(x, y int) (int, int) { return x, h - 1 - y }},
+		{"rotate 90 and flip horizontal", 90, true, false, image.Pt(h, w), func(x, y int) (int, int) { return y, x }},
+	}
+	for _, tt := range tests {
+		dst := ImgToNRGBA(rotateFlip(src, tt.angle, tt.flipH, tt.flipV))
+		if size := dst.Bounds().Size(); size != tt.size {
+			t.Errorf("%s: expected the size %v, got %v", tt.name, tt.size, size)
+			continue
+		}
+		for y := 0; y < tt.size.Y; y++ {
+			for x := 0; x < tt.size.X; x++ {
+				sx, sy := tt.source(x, y)
+				if c := dst.NRGBAAt(x, y); int(c.R) != sx || int(c.G) != sy {
+					t.Errorf("%s: expected the pixel at (%d, %d) to come from (%d, %d), got (%d, %d)", tt.name, x, y, sx, sy, c.R, c.G)
+				}
+			}
+		}
+	}
+
+	if dst := rotateFlip(src, 0, false, false); dst != image.Image(src) {
+		t.Error("expected the source image to be returned without a transformation")
+	}
+}
+
+func TestDraw_Rotate(t *testing.T) {
+	proc := newTestProcessor()
+	proc.Rotate = 90
+	res, triangles, _, err := (&Image{Processor: proc}).Draw(newRampImage(120, 80), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size := res.Bounds().Size(); size != image.Pt(80, 120) {
+		t.Errorf("expected the width and height to be swapped, got %v", size)
+	}
+	for _, tr := range triangles {
+		for _, n := range tr.Nodes {
+			if n.X > 80 || n.Y > 120 {
+				t.Fatalf("expected the triangles to cover the rotated image, got the node %v", n)
+			}
+		}
+	}
+}
+
+func TestSetGaussianMatrix(t *testing.T) {
+	for _, radius := range []int{1, 2, 5, 12} {
+		matrix := setGaussianMatrix(radius)
+		if len(matrix) != radius*2+1 {
+			t.Fatalf("radius %d: expected %d weights, got %d", radius, radius*2+1, len(matrix))
+		}
+		var sum float64
+		for i, v := range matrix {
+			sum += v
+			if j := len(matrix) - 1 - i; math.Abs(v-matrix[j]) > 1e-12 {
+				t.Errorf("radius %d: expected the kernel to be symmetric, got %v at %d and %v at %d", radius, v, i, matrix[j], j)
+			}
+			// The weights decrease from the center towards the ends.
+			if i > 0 && i <= radius && v < matrix[i-1] {
+				t.Errorf("radius %d: expected the weights to increase towards the center, got %v", radius, matrix)
+			}
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("radius %d: expected the kernel to sum to 1, got %v", radius, sum)
+		}
+	}
+}
+
+func TestGaussianBlur_StepEdge(t *testing.T) {
+	// The left half of the image is black, while the right half is white.
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 40; x++ {
+			v := uint8(0)
+			if x >= 20 {
+				v = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	blurred := GaussianBlur(img, 4)
+
+	for y := 0; y < 8; y++ {
+		prev := -1
+		for x := 0; x < 40; x++ {
+			c := blurred.NRGBAAt(x, y)
+			if c.R != c.G || c.G != c.B || c.A != 255 {
+				t.Fatalf("expected an opaque gray pixel at %d,%d, got %v", x, y, c)
+			}
+			if int(c.R) < prev {
+				t.Fatalf("expected the blurred edge to increase monotonically, got %d after %d at %d,%d", c.R, prev, x, y)
+			}
+			prev = int(c.R)
+		}
+		// The edge is smoothed, while the far ends keep their values.
+		if v := blurred.NRGBAAt(19, y).R; v == 0 || v == 255 {
+			t.Errorf("expected the edge to be smoothed, got %d next to it", v)
+		}
+		if l, r := blurred.NRGBAAt(0, y).R, blurred.NRGBAAt(39, y).R; l != 0 || r != 255 {
+			t.Errorf("expected the far ends to keep their values, got %d and %d", l, r)
+		}
+	}
+}
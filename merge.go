@@ -0,0 +1,349 @@
+package triangle
+
+import (
+	"image/color"
+	"math"
+)
+
+// svgPolygon is a convex polygon of the SVG output, covering one or more triangles of similar colors.
+type svgPolygon struct {
+	Nodes       []Node
+	FillColor   color.RGBA
+	StrokeColor color.RGBA
+}
+
+// mergeTriangles merges the adjacent triangles whose fill colors differ by at most the tolerance into convex
+// polygons. The regions of similar colors are grown over the adjacency graph of the triangles, then the border
+// of every region is split into as few convex polygons as the greedy merging of its triangulation finds.
+// The polygons are filled with the colors of the triangles of their region, weighted by their area.
+// The degenerate triangles, covering no area, are left out.
+func mergeTriangles(lines []Line, tolerance float64) []svgPolygon {
+	// The nodes are kept in counter-clockwise order, so the interior is on the left of every edge.
+	triangles := make([]Triangle, len(lines))
+	for i, l := range lines {
+		triangles[i] = Triangle{Nodes: []Node{l.P0, l.P1, l.P2}}
+		if triangles[i].signedArea() < 0 {
+			triangles[i].Nodes[1], triangles[i].Nodes[2] = l.P2, l.P1
+		}
+	}
+	adj := adjacency(triangles)
+	owner := make([]int, len(lines))
+	for i := range owner {
+		owner[i] = -1
+	}
+
+	var polygons []svgPolygon
+	for i := range triangles {
+		if owner[i] >= 0 || triangles[i].Area() == 0 {
+			continue
+		}
+		members := growRegion(triangles, lines, adj, owner, i, tolerance)
+
+		var fill, stroke [4]float64
+		var area float64
+		for _, j := range members {
+			a := triangles[j].Area()
+			addColor(&fill, lines[j].FillColor, a)
+			addColor(&stroke, lines[j].StrokeColor, a)
+			area += a
+		}
+		fillColor, strokeColor := averageRGBA(fill, area), averageRGBA(stroke, area)
+
+		// In the rare case the border can't be triangulated, the triangles of the region are merged instead.
+		ears, ok := earClip(dropCollinear(regionBorder(triangles, members)))
+		if !ok {
+			ears = ears[:0]
+			for _, j := range members {
+				ears = append(ears, triangles[j])
+			}
+		}
+		for _, nodes := range convexPieces(ears) {
+			polygons = append(polygons, svgPolygon{Nodes: nodes, FillColor: fillColor, StrokeColor: strokeColor})
+		}
+	}
+	return polygons
+}
+
+// growRegion grows the region of similar colors starting from the seed triangle over the adjacency graph,
+// marking its triangles as owned by the seed. A triangle is added only in case the fill colors of every pair
+// of the region triangles remain within the tolerance, and the region remains a simple polygon, without holes.
+func growRegion(triangles []Triangle, lines []Line, adj map[int][]int, owner []int, seed int, tolerance float64) []int {
+	edges := make(map[[2]Node]struct{})
+	nodes := make(map[Node]struct{})
+	var lo, hi [4]uint8
+	add := func(i int) {
+		t := triangles[i].Nodes
+		for k, v := range t {
+			edges[[2]Node{v, t[(k+1)%3]}] = struct{}{}
+			nodes[v] = struct{}{}
+		}
+		c := lines[i].FillColor
+		for ch, v := range [4]uint8{c.R, c.G, c.B, c.A} {
+			lo[ch], hi[ch] = Min(lo[ch], v), Max(hi[ch], v)
+		}
+		owner[i] = seed
+	}
+	c := lines[seed].FillColor
+	lo = [4]uint8{c.R, c.G, c.B, c.A}
+	hi = lo
+	add(seed)
+
+	members := []int{seed}
+	queue := append([]int(nil), adj[seed]...)
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if owner[i] >= 0 || triangles[i].Area() == 0 {
+			continue
+		}
+
+		c := lines[i].FillColor
+		var span float64
+		for ch, v := range [4]uint8{c.R, c.G, c.B, c.A} {
+			d := float64(Max(hi[ch], v) - Min(lo[ch], v))
+			span += d * d
+		}
+		if math.Sqrt(span) > tolerance {
+			continue
+		}
+
+		// The region remains a simple polygon in case the triangle shares two edges with it, or a single edge
+		// while its third node lies outside of it. The shared edges have their nodes in opposite order.
+		t := triangles[i].Nodes
+		shared, third := 0, Node{}
+		for k, v := range t {
+			if _, ok := edges[[2]Node{t[(k+1)%3], v}]; ok {
+				shared++
+				third = t[(k+2)%3]
+			}
+		}
+		if _, ok := nodes[third]; shared == 0 || shared == 3 || (shared == 1 && ok) {
+			continue
+		}
+
+		add(i)
+		members = append(members, i)
+		queue = append(queue, adj[i]...)
+	}
+	return members
+}
+
+// regionBorder returns the nodes of the border of the region made of the triangles of the members,
+// in counter-clockwise order, starting from the first border edge of the first triangle.
+func regionBorder(triangles []Triangle, members []int) []Node {
+	edges := make(map[[2]Node]struct{}, len(members)*3)
+	for _, i := range members {
+		t := triangles[i].Nodes
+		for k, v := range t {
+			edges[[2]Node{v, t[(k+1)%3]}] = struct{}{}
+		}
+	}
+
+	var start Node
+	next := make(map[Node]Node)
+	for _, i := range members {
+		t := triangles[i].Nodes
+		for k, v := range t {
+			if _, ok := edges[[2]Node{t[(k+1)%3], v}]; !ok {
+				if len(next) == 0 {
+					start = v
+				}
+				next[v] = t[(k+1)%3]
+			}
+		}
+	}
+
+	border := []Node{start}
+	for v := next[start]; v != start && len(border) <= len(next); v = next[v] {
+		border = append(border, v)
+	}
+	return border
+}
+
+// earClip triangulates the simple polygon having its nodes in counter-clockwise order by cutting off its ears,
+// the triangles formed by a convex node and its neighbors without any other node inside them.
+// It reports whether the polygon could be triangulated.
+func earClip(nodes []Node) ([]Triangle, bool) {
+	poly := append([]Node(nil), nodes...)
+	ears := make([]Triangle, 0, len(poly))
+	for len(poly) > 3 {
+		n := len(poly)
+		clipped := false
+		for k, b := range poly {
+			a, c := poly[(k+n-1)%n], poly[(k+1)%n]
+			if cross(a, b, c) <= 0 {
+				continue
+			}
+			ear := true
+			for _, p := range poly {
+				if p != a && p != b && p != c && cross(a, b, p) >= 0 && cross(b, c, p) >= 0 && cross(c, a, p) >= 0 {
+					ear = false
+					break
+				}
+			}
+			if ear {
+				ears = append(ears, Triangle{Nodes: []Node{a, b, c}})
+				poly = append(poly[:k], poly[k+1:]...)
+				clipped = true
+				break
+			}
+		}
+		if !clipped {
+			return ears, false
+		}
+	}
+	if len(poly) < 3 {
+		return ears, false
+	}
+	return append(ears, Triangle{Nodes: poly}), true
+}
+
+// convexPieces merges the triangles, having their nodes in counter-clockwise order, into convex polygons.
+// Starting with a polygon for every triangle, the polygons sharing an edge are merged as long as their union
+// remains convex, which finds at most four times as many polygons as the smallest convex partition.
+func convexPieces(triangles []Triangle) [][]Node {
+	adj := adjacency(triangles)
+	pieces := make([][]Node, len(triangles))
+	owner := make([]int, len(triangles))
+	for i, t := range triangles {
+		pieces[i], owner[i] = t.Nodes, i
+	}
+	find := func(i int) int {
+		for owner[i] != i {
+			owner[i] = owner[owner[i]]
+			i = owner[i]
+		}
+		return i
+	}
+
+	// The merges are repeated until none of the polygons can be merged, since a rejected merge may become
+	// possible after the polygons have grown.
+	for merged := true; merged; {
+		merged = false
+		for i := range triangles {
+			for _, j := range adj[i] {
+				a, b := find(i), find(j)
+				if a == b {
+					continue
+				}
+				if union, ok := convexUnion(pieces[a], pieces[b]); ok {
+					pieces[a], owner[b] = union, a
+					merged = true
+				}
+			}
+		}
+	}
+
+	var res [][]Node
+	for i := range triangles {
+		if find(i) == i {
+			res = append(res, dropCollinear(pieces[i]))
+		}
+	}
+	return res
+}
+
+// convexUnion returns the union of the two convex polygons having their nodes in counter-clockwise order,
+// in case they share a single continuous chain of edges and their union is convex too.
+// The nodes of the shared chain are left out, except for its ends.
+func convexUnion(p, q []Node) ([]Node, bool) {
+	// The shared edges have their nodes in opposite order in the two polygons.
+	edges := make(map[[2]Node]struct{}, len(q))
+	for k, v := range q {
+		edges[[2]Node{v, q[(k+1)%len(q)]}] = struct{}{}
+	}
+	n := len(p)
+	shared := make([]bool, n)
+	for k, v := range p {
+		_, shared[k] = edges[[2]Node{p[(k+1)%n], v}]
+	}
+
+	// The union of two polygons touching along more than one chain would have a hole.
+	start, chains := -1, 0
+	for k := range shared {
+		if shared[k] && !shared[(k+n-1)%n] {
+			start = k
+			chains++
+		}
+	}
+	if chains != 1 {
+		return nil, false
+	}
+	end := start
+	for shared[(end+1)%n] {
+		end = (end + 1) % n
+	}
+
+	// The union follows p from the end of the chain around to its start, then q from there to the end of the chain.
+	first, last := p[start], p[(end+1)%n]
+	union := make([]Node, 0, n+len(q))
+	for k := (end + 1) % n; ; k = (k + 1) % n {
+		union = append(union, p[k])
+		if k == start {
+			break
+		}
+	}
+	m, j := len(q), 0
+	for j < m && q[j] != first {
+		j++
+	}
+	for k := 1; k < m; k++ {
+		v := q[(j+k)%m]
+		if v == last {
+			break
+		}
+		union = append(union, v)
+	}
+
+	// Every node of the convex union turns left, or lies on the line between its neighbors.
+	seen := make(map[Node]struct{}, len(union))
+	for k, v := range union {
+		if _, ok := seen[v]; ok {
+			return nil, false
+		}
+		seen[v] = struct{}{}
+		if cross(union[(k+len(union)-1)%len(union)], v, union[(k+1)%len(union)]) < 0 {
+			return nil, false
+		}
+	}
+	return union, true
+}
+
+// dropCollinear removes the nodes lying on the line between their neighbors, which don't change the polygon shape.
+func dropCollinear(nodes []Node) []Node {
+	n := len(nodes)
+	res := make([]Node, 0, n)
+	for k, v := range nodes {
+		if cross(nodes[(k+n-1)%n], v, nodes[(k+1)%n]) != 0 {
+			res = append(res, v)
+		}
+	}
+	if len(res) < 3 {
+		return nodes
+	}
+	return res
+}
+
+// cross returns the z component of the cross product of the vectors o→a and o→b, which is positive
+// in case the o, a and b nodes are in counter-clockwise order.
+func cross(o, a, b Node) float64 {
+	return (a.X-o.X)*(b.Y-o.Y) - (b.X-o.X)*(a.Y-o.Y)
+}
+
+// addColor adds the color channels to the sum, weighted by w.
+func addColor(sum *[4]float64, c color.RGBA, w float64) {
+	sum[0] += float64(c.R) * w
+	sum[1] += float64(c.G) * w
+	sum[2] += float64(c.B) * w
+	sum[3] += float64(c.A) * w
+}
+
+// averageRGBA returns the color of the weighted sum of the color channels, divided by the total weight.
+func averageRGBA(sum [4]float64, w float64) color.RGBA {
+	return color.RGBA{
+		R: uint8(math.Round(sum[0] / w)),
+		G: uint8(math.Round(sum[1] / w)),
+		B: uint8(math.Round(sum[2] / w)),
+		A: uint8(math.Round(sum[3] / w)),
+	}
+}
@@ -0,0 +1,61 @@
+package triangle
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestMergeTriangles(t *testing.T) {
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	nodes := []Node{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {20, 0}, {20, 10}}
+	line := func(a, b, c int, fill color.RGBA) Line {
+		return Line{nodes[a], nodes[b], nodes[c], nodes[a], fill, fill}
+	}
+
+	// The two squares, each made of two triangles, are merged into a rectangle having their average color.
+	lines := []Line{
+		line(0, 1, 2, red), line(0, 2, 3, color.RGBA{R: 251, A: 255}),
+		line(1, 4, 5, red), line(1, 5, 2, red),
+	}
+	polygons := mergeTriangles(lines, 10)
+	if len(polygons) != 1 {
+		t.Fatalf("expected a single polygon, got %v", polygons)
+	}
+	if p := polygons[0]; len(p.Nodes) != 4 || p.FillColor != (color.RGBA{R: 254, A: 255}) {
+		t.Errorf("expected a rectangle having the average color, got %v", p)
+	}
+
+	// The triangles of different colors are not merged.
+	lines[2].FillColor, lines[3].FillColor = blue, blue
+	if polygons := mergeTriangles(lines, 10); len(polygons) != 2 {
+		t.Errorf("expected a polygon for each color, got %v", polygons)
+	}
+
+	// The polygons merged from the triangles of a gradient are convex and cover the same area as the triangles.
+	proc := newTestProcessor()
+	svg := &SVG{Processor: proc}
+	if _, _, _, err := svg.Draw(newRampImage(120, 80), proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var want, got float64
+	for _, l := range svg.Lines {
+		want += Triangle{Nodes: []Node{l.P0, l.P1, l.P2}}.Area()
+	}
+	polygons = mergeTriangles(svg.Lines, 40)
+	for _, p := range polygons {
+		n := len(p.Nodes)
+		for k, v := range p.Nodes {
+			if cross(v, p.Nodes[(k+1)%n], p.Nodes[(k+2)%n]) < 0 {
+				t.Fatalf("expected the polygons to be convex, got %v", p.Nodes)
+			}
+			got += (v.X*p.Nodes[(k+1)%n].Y - p.Nodes[(k+1)%n].X*v.Y) / 2
+		}
+	}
+	if math.Abs(got-want) > want*1e-9 {
+		t.Errorf("expected the polygons to cover the area %v of the triangles, got %v", want, got)
+	}
+	if len(polygons) >= len(svg.Lines)/2 {
+		t.Errorf("expected the similar triangles to be merged, got %d polygons for %d triangles", len(polygons), len(svg.Lines))
+	}
+}
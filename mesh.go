@@ -0,0 +1,282 @@
+package triangle
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ColoredTriangle extends the Triangle with the fill and stroke colors sampled from the source image.
+// The colors are alpha-premultiplied, preserving the source image transparency.
+type ColoredTriangle struct {
+	Triangle
+	Fill   color.RGBA
+	Stroke color.RGBA
+}
+
+// DrawMesh triangulates the source image, but instead of rendering the triangles like the Draw methods,
+// it returns them together with their colors sampled the same way as the raster and SVG outputs do.
+func (p Processor) DrawMesh(ctx context.Context, src image.Image) ([]ColoredTriangle, []Point, error) {
+	if err := p.Validate(); err != nil {
+		return nil, nil, err
+	}
+	src = rotateFlip(src, p.Rotate, p.FlipH, p.FlipV)
+	if src.Bounds().Dx() <= 1 || src.Bounds().Dy() <= 1 {
+		return nil, nil, errors.New("The image width and height must be greater than 1px.\n")
+	}
+
+	src, p, err := p.padSquare(src)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	img, triangles, points, err := genTriangles(ctx, src, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	sampling := time.Now()
+	if p.Points == nil && p.maxPoints(src.Bounds().Dx(), src.Bounds().Dy()) < 1 {
+		p.Stats.finish(start, sampling)
+		return nil, nil, nil
+	}
+
+	mesh := make([]ColoredTriangle, 0, len(triangles))
+	pal := p.fillPalette(img)
+	for i, t := range triangles {
+		mesh = append(mesh, p.colorTriangle(img, pal, i, t))
+	}
+	p.Stats.finish(start, sampling)
+	return mesh, points, nil
+}
+
+// strokeDarkening is the factor the fill color is multiplied with in case the DarkenStroke option is enabled.
+const strokeDarkening = 0.7
+
+// colorTriangle defines the fill color of the i-th triangle according to the FillMode and its stroke color.
+// In case the palette is not nil, the color sampled from the image is replaced by the closest palette color.
+func (p Processor) colorTriangle(img *image.NRGBA, pal color.Palette, i int, t Triangle) ColoredTriangle {
+	return p.coloredTriangle(t, p.fillColor(img, pal, i, t))
+}
+
+// fillTriangles stores the fill colors into the triangles, in case they're not drawn themselves, like by the Voronoi
+// diagram and the HexGrid tessellation, so the triangles returned by the Draw methods have their colors for NewMesh.
+func (p Processor) fillTriangles(img *image.NRGBA, pal color.Palette, triangles []Triangle) {
+	for i, t := range triangles {
+		triangles[i].fill = p.colorTriangle(img, pal, i, t).fill
+	}
+}
+
+// coloredTriangle returns the triangle having the fill color c and its stroke color.
+func (p Processor) coloredTriangle(t Triangle, c color.NRGBA) ColoredTriangle {
+	t.fill = color.RGBA{R: c.R, G: c.G, B: c.B, A: 255}
+
+	fill := color.RGBAModel.Convert(c).(color.RGBA)
+	return ColoredTriangle{Triangle: t, Fill: fill, Stroke: p.strokeFor(fill)}
+}
+
+// strokeFor returns the stroke color of a shape having the fill color. The stroke is the StrokeColor in case it's
+// defined, the darkened fill color in case the DarkenStroke option is enabled, the SolidStrokeColor in case it's
+// defined, black in case the IsStrokeSolid option is enabled, otherwise it's the same as the fill color.
+func (p Processor) strokeFor(fill color.RGBA) color.RGBA {
+	stroke := fill
+	switch {
+	case p.StrokeColor != "":
+		stroke, _ = ParseHexColor(p.StrokeColor)
+	case p.DarkenStroke:
+		stroke.R = uint8(float64(fill.R) * strokeDarkening)
+		stroke.G = uint8(float64(fill.G) * strokeDarkening)
+		stroke.B = uint8(float64(fill.B) * strokeDarkening)
+	case p.SolidStrokeColor != "":
+		stroke, _ = ParseHexColor(p.SolidStrokeColor)
+	case p.IsStrokeSolid:
+		stroke = color.RGBA{R: 0, G: 0, B: 0, A: 255}
+	}
+	return stroke
+}
+
+// hasStrokeColor checks if the stroke color is defined by the options instead of being the same as the fill color.
+func (p Processor) hasStrokeColor() bool {
+	return p.StrokeColor != "" || p.DarkenStroke || p.SolidStrokeColor != "" || p.IsStrokeSolid
+}
+
+// defaultStrokeAlpha is the alpha of the faint black strokes drawn in the WithWireframe mode by default.
+const defaultStrokeAlpha = 20
+
+// wireframeStroke returns the color of the strokes drawn over the triangles in the WithWireframe mode, from the
+// stroke color of the triangle. It's the triangle's stroke color in case it's defined by the StrokeColor,
+// DarkenStroke or SolidStrokeColor options, otherwise black, having its opacity multiplied by the StrokeOpacity.
+// When the StrokeOpacity is 0, the default faint black color is returned.
+func (p Processor) wireframeStroke(stroke color.RGBA) color.RGBA {
+	if p.StrokeColor == "" && !p.DarkenStroke && p.SolidStrokeColor == "" {
+		if p.StrokeOpacity == 0 {
+			return color.RGBA{R: 0, G: 0, B: 0, A: defaultStrokeAlpha}
+		}
+		stroke = color.RGBA{R: 0, G: 0, B: 0, A: 255}
+	}
+	if p.StrokeOpacity == 0 {
+		return stroke
+	}
+	// The color is alpha-premultiplied, so all of its components are scaled.
+	scale := func(v uint8) uint8 {
+		return uint8(math.Round(float64(v) * p.StrokeOpacity))
+	}
+	return color.RGBA{R: scale(stroke.R), G: scale(stroke.G), B: scale(stroke.B), A: scale(stroke.A)}
+}
+
+// Mesh bundles the triangulated mesh of an image: the image size, the triangulated points and the triangles,
+// together with the fill colors of the triangles, in the order of the triangles. It's the representation
+// serialized by the JSON and CSV writers, built by NewMesh from the results of the Draw methods, which keep
+// returning the triangles and the points.
+type Mesh struct {
+	Width, Height int
+	Points        []Point
+	Triangles     []Triangle
+	Colors        []color.RGBA
+}
+
+// NewMesh bundles the triangles and points returned by the Draw methods for the w x h image into a Mesh.
+// The colors are the fill colors sampled from the source image by the Draw methods.
+func NewMesh(triangles []Triangle, points []Point, w, h int) *Mesh {
+	colors := make([]color.RGBA, 0, len(triangles))
+	for _, t := range triangles {
+		colors = append(colors, t.fill)
+	}
+	return &Mesh{Width: w, Height: h, Points: points, Triangles: triangles, Colors: colors}
+}
+
+// meshJSON defines the JSON representation of the triangulated mesh.
+type meshJSON struct {
+	Width     int            `json:"width"`
+	Height    int            `json:"height"`
+	Points    [][2]int       `json:"points"`
+	Triangles []triangleJSON `json:"triangles"`
+}
+
+// triangleJSON defines the JSON representation of a single triangle.
+type triangleJSON struct {
+	Nodes [][2]int `json:"nodes"`
+	Color string   `json:"color"`
+}
+
+// MarshalJSON serializes the mesh to JSON. The node coordinates are rounded to integer pixel positions
+// and the color of each triangle is written in #rrggbb format, the triangles without a color being black.
+func (m Mesh) MarshalJSON() ([]byte, error) {
+	mesh := meshJSON{
+		Width:     m.Width,
+		Height:    m.Height,
+		Points:    make([][2]int, 0, len(m.Points)),
+		Triangles: make([]triangleJSON, 0, len(m.Triangles)),
+	}
+
+	for _, p := range m.Points {
+		mesh.Points = append(mesh.Points, [2]int{round(p.X), round(p.Y)})
+	}
+	for i, t := range m.Triangles {
+		nodes := make([][2]int, 0, len(t.Nodes))
+		for _, n := range t.Nodes {
+			nodes = append(nodes, [2]int{round(n.X), round(n.Y)})
+		}
+		var c color.RGBA
+		if i < len(m.Colors) {
+			c = m.Colors[i]
+		}
+		mesh.Triangles = append(mesh.Triangles, triangleJSON{
+			Nodes: nodes,
+			Color: fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B),
+		})
+	}
+	return json.Marshal(mesh)
+}
+
+// UnmarshalJSON parses the JSON representation of the mesh written by MarshalJSON.
+func (m *Mesh) UnmarshalJSON(b []byte) error {
+	var mesh meshJSON
+	if err := json.Unmarshal(b, &mesh); err != nil {
+		return err
+	}
+
+	points := make([]Point, 0, len(mesh.Points))
+	for _, p := range mesh.Points {
+		points = append(points, Point{X: float64(p[0]), Y: float64(p[1])})
+	}
+	data := make([]triangleData, len(mesh.Triangles))
+	triangles := make([]Triangle, 0, len(mesh.Triangles))
+	colors := make([]color.RGBA, 0, len(mesh.Triangles))
+	for i, t := range mesh.Triangles {
+		if len(t.Nodes) != 3 {
+			return fmt.Errorf("the triangle %d has %d nodes instead of 3", i, len(t.Nodes))
+		}
+		c, err := ParseHexColor(t.Color)
+		if err != nil {
+			return fmt.Errorf("the triangle %d has an invalid color: %w", i, err)
+		}
+		var nodes [3]Node
+		for j, n := range t.Nodes {
+			nodes[j] = Node{X: float64(n[0]), Y: float64(n[1])}
+		}
+		tri := Triangle{}.newTriangle(&data[i], nodes[0], nodes[1], nodes[2])
+		tri.fill = c
+		triangles = append(triangles, tri)
+		colors = append(colors, c)
+	}
+	*m = Mesh{Width: mesh.Width, Height: mesh.Height, Points: points, Triangles: triangles, Colors: colors}
+	return nil
+}
+
+// MarshalMesh serializes the triangles and points returned by the Draw method to JSON.
+// It's a shorthand for marshaling the Mesh returned by NewMesh.
+func MarshalMesh(triangles []Triangle, points []Point, w, h int) ([]byte, error) {
+	return NewMesh(triangles, points, w, h).MarshalJSON()
+}
+
+// meshCSVHeader names the columns of the CSV representation of the mesh written by WriteMeshCSV.
+var meshCSVHeader = []string{"x0", "y0", "x1", "y1", "x2", "y2", "r", "g", "b", "area"}
+
+// WriteMeshCSV writes the triangles of the mesh to w in CSV format, one row for each triangle after the header row,
+// holding the node coordinates, the color channels of its fill color and its area in square pixels.
+// Unlike the JSON representation, the coordinates are written at their full precision.
+func WriteMeshCSV(w io.Writer, m Mesh) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(meshCSVHeader); err != nil {
+		return err
+	}
+
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	row := make([]string, 0, len(meshCSVHeader))
+	for i, t := range m.Triangles {
+		if len(t.Nodes) != 3 {
+			return fmt.Errorf("the triangle %d has %d nodes instead of 3", i, len(t.Nodes))
+		}
+		var c color.RGBA
+		if i < len(m.Colors) {
+			c = m.Colors[i]
+		}
+
+		row = row[:0]
+		for _, n := range t.Nodes {
+			row = append(row, formatFloat(n.X), formatFloat(n.Y))
+		}
+		row = append(row, strconv.Itoa(int(c.R)), strconv.Itoa(int(c.G)), strconv.Itoa(int(c.B)), formatFloat(t.Area()))
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// round rounds a float number to the nearest integer.
+func round(v float64) int {
+	return int(math.Round(v))
+}
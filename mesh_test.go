@@ -0,0 +1,174 @@
+package triangle
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestMesh_JSON(t *testing.T) {
+	proc := newTestProcessor()
+	tri := &Image{Processor: proc}
+	_, triangles, points, err := tri.Draw(newTestImage(120, 80), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mesh := NewMesh(triangles, points, 120, 80)
+	if len(mesh.Colors) != len(triangles) {
+		t.Fatalf("expected %d colors, got %d", len(triangles), len(mesh.Colors))
+	}
+	b, err := json.Marshal(mesh)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got Mesh
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Width != 120 || got.Height != 80 {
+		t.Errorf("expected a 120x80 mesh, got %dx%d", got.Width, got.Height)
+	}
+	if len(got.Points) != len(points) || len(got.Triangles) != len(triangles) {
+		t.Fatalf("expected %d points and %d triangles, got %d points and %d triangles",
+			len(points), len(triangles), len(got.Points), len(got.Triangles))
+	}
+	if !reflect.DeepEqual(got.Colors, mesh.Colors) {
+		t.Errorf("expected the colors to survive the round trip")
+	}
+	for i, tr := range got.Triangles {
+		for j, n := range tr.Nodes {
+			if want := triangles[i].Nodes[j]; n.X != float64(round(want.X)) || n.Y != float64(round(want.Y)) {
+				t.Fatalf("triangle %d: expected the node %v, got %v", i, want, n)
+			}
+		}
+	}
+
+	// The parsed mesh is serialized to the same JSON.
+	b2, err := json.Marshal(&got)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(b2) != string(b) {
+		t.Errorf("expected the round trip to give the same JSON")
+	}
+	if b3, _ := MarshalMesh(triangles, points, 120, 80); string(b3) != string(b) {
+		t.Errorf("expected MarshalMesh to give the same JSON as the mesh")
+	}
+
+	if err := json.Unmarshal([]byte(`{"triangles":[{"nodes":[[0,0],[1,1]],"color":"#000000"}]}`), &got); err == nil {
+		t.Error("expected an error for a triangle having 2 nodes")
+	}
+}
+
+func TestMarshalMesh(t *testing.T) {
+	proc := newTestProcessor()
+	tri := &Image{Processor: proc}
+	_, triangles, points, err := tri.Draw(newTestImage(120, 80), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := MarshalMesh(triangles, points, 120, 80)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The JSON is decoded independently of the Mesh type, following the documented format.
+	var got struct {
+		Width     int      `json:"width"`
+		Height    int      `json:"height"`
+		Points    [][2]int `json:"points"`
+		Triangles []struct {
+			Nodes [][2]int `json:"nodes"`
+			Color string   `json:"color"`
+		} `json:"triangles"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unable to parse the JSON: %v", err)
+	}
+	if got.Width != 120 || got.Height != 80 {
+		t.Errorf("expected a 120x80 mesh, got %dx%d", got.Width, got.Height)
+	}
+	if len(got.Points) != len(points) || len(got.Triangles) != len(triangles) {
+		t.Fatalf("expected %d points and %d triangles, got %d points and %d triangles",
+			len(points), len(triangles), len(got.Points), len(got.Triangles))
+	}
+	for i, p := range got.Points {
+		if p != [2]int{round(points[i].X), round(points[i].Y)} {
+			t.Fatalf("expected the point %v, got %v", points[i], p)
+		}
+	}
+	for i, tr := range got.Triangles {
+		if len(tr.Nodes) != 3 {
+			t.Fatalf("triangle %d: expected 3 nodes, got %d", i, len(tr.Nodes))
+		}
+		for j, n := range tr.Nodes {
+			if want := triangles[i].Nodes[j]; n != [2]int{round(want.X), round(want.Y)} {
+				t.Fatalf("triangle %d: expected the node %v, got %v", i, want, n)
+			}
+		}
+		c := triangles[i].fill
+		if want := fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B); tr.Color != want {
+			t.Errorf("triangle %d: expected the color %s, got %s", i, want, tr.Color)
+		}
+	}
+}
+
+func TestWriteMeshCSV(t *testing.T) {
+	var data [2]triangleData
+	mesh := Mesh{
+		Width: 100, Height: 50,
+		Triangles: []Triangle{
+			Triangle{}.newTriangle(&data[0], Node{0, 0}, Node{12.5, 40}, Node{64, 0}),
+			Triangle{}.newTriangle(&data[1], Node{64, 0}, Node{12.5, 40}, Node{100, 50}),
+		},
+		Colors: []color.RGBA{{R: 163, G: 177, B: 194, A: 255}, {R: 1, G: 2, B: 3, A: 255}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteMeshCSV(&buf, mesh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("unable to parse the CSV: %v", err)
+	}
+	if len(records) != len(mesh.Triangles)+1 {
+		t.Fatalf("expected a header and %d rows, got %d records", len(mesh.Triangles), len(records))
+	}
+	if !reflect.DeepEqual(records[0], meshCSVHeader) {
+		t.Errorf("expected the header %v, got %v", meshCSVHeader, records[0])
+	}
+
+	for i, rec := range records[1:] {
+		var v [10]float64
+		for j, field := range rec {
+			if v[j], err = strconv.ParseFloat(field, 64); err != nil {
+				t.Fatalf("row %d: unable to parse %q: %v", i, field, err)
+			}
+		}
+		tr := mesh.Triangles[i]
+		for j, n := range tr.Nodes {
+			if v[j*2] != n.X || v[j*2+1] != n.Y {
+				t.Errorf("row %d: expected the node %v, got (%v, %v)", i, n, v[j*2], v[j*2+1])
+			}
+		}
+		c := mesh.Colors[i]
+		if v[6] != float64(c.R) || v[7] != float64(c.G) || v[8] != float64(c.B) {
+			t.Errorf("row %d: expected the color %v, got %v", i, c, v[6:9])
+		}
+		if math.Abs(v[9]-tr.Area()) > 1e-9 {
+			t.Errorf("row %d: expected the area %v, got %v", i, tr.Area(), v[9])
+		}
+	}
+	if records[1][9] != "1280" {
+		t.Errorf("expected the area of the first triangle to be 1280, got %s", records[1][9])
+	}
+}
@@ -0,0 +1,104 @@
+package triangle
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+const (
+	// ssimWindow is the size of the square windows the structural similarity is computed over.
+	ssimWindow = 8
+	// ssimStep is the distance between the neighboring windows, which overlap by half of their size.
+	ssimStep = ssimWindow / 2
+)
+
+// The constants stabilizing the division of the structural similarity with weak denominators.
+var (
+	ssimC1 = math.Pow(0.01*255, 2)
+	ssimC2 = math.Pow(0.03*255, 2)
+)
+
+// Fidelity returns the peak signal-to-noise ratio (PSNR) in decibels and the mean structural similarity
+// index (SSIM) of the output image against the source image, the higher values meaning a more faithful output.
+// The PSNR is computed over the color channels, being positive infinity for identical images, while the SSIM is
+// computed over the luminance in 8x8 windows, being 1 for identical images. The colors are compared as alpha
+// premultiplied values, so the transparent pixels count as black. The images must have the same size.
+func Fidelity(src, out image.Image) (psnr float64, ssim float64, err error) {
+	sb, ob := src.Bounds(), out.Bounds()
+	if sb.Dx() != ob.Dx() || sb.Dy() != ob.Dy() {
+		return 0, 0, fmt.Errorf("the images have different sizes: %dx%d and %dx%d", sb.Dx(), sb.Dy(), ob.Dx(), ob.Dy())
+	}
+	if sb.Empty() {
+		return 0, 0, errors.New("the images are empty")
+	}
+
+	a, b := toRGBA(src), toRGBA(out)
+	return peakSNR(a, b), meanSSIM(luma(a), luma(b), sb.Dx(), sb.Dy()), nil
+}
+
+// toRGBA converts the image to alpha-premultiplied *image.RGBA with min-point at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b.Sub(b.Min))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// peakSNR returns the peak signal-to-noise ratio of the color channels of the images having the same size.
+func peakSNR(a, b *image.RGBA) float64 {
+	var sum float64
+	for i := 0; i < len(a.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			d := float64(a.Pix[i+c]) - float64(b.Pix[i+c])
+			sum += d * d
+		}
+	}
+	mse := sum / float64(len(a.Pix)/4*3)
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+// luma returns the rec. 601 luminance of the image pixels, in row-major order.
+func luma(img *image.RGBA) []float64 {
+	l := make([]float64, 0, len(img.Pix)/4)
+	for i := 0; i < len(img.Pix); i += 4 {
+		l = append(l, 0.299*float64(img.Pix[i])+0.587*float64(img.Pix[i+1])+0.114*float64(img.Pix[i+2]))
+	}
+	return l
+}
+
+// meanSSIM returns the mean structural similarity of the luminance planes of the images having the same size.
+// The images smaller than the window are compared as a single window.
+func meanSSIM(a, b []float64, w, h int) float64 {
+	ww, wh := Min(ssimWindow, w), Min(ssimWindow, h)
+	n := float64(ww * wh)
+
+	var sum float64
+	var count int
+	for y0 := 0; y0+wh <= h; y0 += ssimStep {
+		for x0 := 0; x0+ww <= w; x0 += ssimStep {
+			var sa, sb, saa, sbb, sab float64
+			for y := y0; y < y0+wh; y++ {
+				for x := x0; x < x0+ww; x++ {
+					va, vb := a[y*w+x], b[y*w+x]
+					sa += va
+					sb += vb
+					saa += va * va
+					sbb += vb * vb
+					sab += va * vb
+				}
+			}
+			ma, mb := sa/n, sb/n
+			varA, varB, cov := saa/n-ma*ma, sbb/n-mb*mb, sab/n-ma*mb
+
+			sum += (2*ma*mb + ssimC1) * (2*cov + ssimC2) / ((ma*ma + mb*mb + ssimC1) * (varA + varB + ssimC2))
+			count++
+		}
+	}
+	return sum / float64(count)
+}
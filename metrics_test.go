@@ -0,0 +1,45 @@
+package triangle
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestFidelity(t *testing.T) {
+	src := newRampImage(120, 80)
+
+	psnr, ssim, err := Fidelity(src, src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !math.IsInf(psnr, 1) {
+		t.Errorf("expected an infinite PSNR for identical images, got %v", psnr)
+	}
+	if math.Abs(ssim-1) > 1e-9 {
+		t.Errorf("expected a SSIM of 1 for identical images, got %v", ssim)
+	}
+
+	// The stronger the blur, the lower the fidelity of the blurred image.
+	blurred := func(radius uint32) image.Image {
+		return StackBlur(newTestImage(120, 80), radius)
+	}
+	psnr1, ssim1, err := Fidelity(newTestImage(120, 80), blurred(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	psnr2, ssim2, err := Fidelity(newTestImage(120, 80), blurred(8))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.IsInf(psnr1, 1) || ssim1 >= 1 {
+		t.Errorf("expected the blurred image to differ from the source, got PSNR %v and SSIM %v", psnr1, ssim1)
+	}
+	if psnr2 >= psnr1 || ssim2 >= ssim1 {
+		t.Errorf("expected a lower fidelity for the stronger blur, got PSNR %v >= %v or SSIM %v >= %v", psnr2, psnr1, ssim2, ssim1)
+	}
+
+	if _, _, err := Fidelity(src, newRampImage(60, 80)); err == nil {
+		t.Error("expected an error for images having different sizes")
+	}
+}
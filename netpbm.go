@@ -0,0 +1,52 @@
+package triangle
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// encodeNetpbm writes the image in the binary Netpbm format, as a P6 pixmap, or as a P5 graymap in case
+// gray is true, having the Rec. 601 luma of the colors. The 16-bit images are written with 16 bits per sample.
+// The Netpbm formats don't support transparency, so the alpha-premultiplied colors are written, which are
+// flattened over black, but the Encode function fills the transparent areas with white first, like in the JPEG output.
+func encodeNetpbm(w io.Writer, img image.Image, gray bool) error {
+	b := img.Bounds()
+	magic, maxVal := "P6", 255
+	if gray {
+		magic = "P5"
+	}
+	wide := is16Bit(img)
+	if wide {
+		maxVal = 65535
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "%s\n%d %d\n%d\n", magic, b.Dx(), b.Dy(), maxVal); err != nil {
+		return err
+	}
+
+	// The samples are written in big endian order in case they have 16 bits.
+	sample := func(v uint32) {
+		bw.WriteByte(byte(v >> 8))
+		if wide {
+			bw.WriteByte(byte(v))
+		}
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.At(x, y)
+			if gray {
+				sample(uint32(color.Gray16Model.Convert(c).(color.Gray16).Y))
+				continue
+			}
+			r, g, bl, _ := c.RGBA()
+			sample(r)
+			sample(g)
+			sample(bl)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,107 @@
+package triangle
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// decodeNetpbm decodes the binary P5 and P6 images having 8 bits per sample.
+func decodeNetpbm(t *testing.T, b []byte) (string, *image.NRGBA) {
+	t.Helper()
+	r := bufio.NewReader(bytes.NewReader(b))
+	var magic string
+	var w, h, maxVal int
+	if _, err := fmt.Fscan(r, &magic, &w, &h, &maxVal); err != nil {
+		t.Fatalf("unable to read the header: %v", err)
+	}
+	if maxVal != 255 {
+		t.Fatalf("expected 255 as the maximum value, got %d", maxVal)
+	}
+	// A single whitespace separates the header from the samples.
+	r.ReadByte()
+
+	channels := 3
+	if magic == "P5" {
+		channels = 1
+	}
+	data := make([]byte, w*h*channels)
+	if _, err := io.ReadFull(r, data); err != nil {
+		t.Fatalf("unable to read the samples: %v", err)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < w*h; i++ {
+		s := data[i*channels:]
+		if channels == 1 {
+			img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2] = s[0], s[0], s[0]
+		} else {
+			img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2] = s[0], s[1], s[2]
+		}
+		img.Pix[i*4+3] = 255
+	}
+	return magic, img
+}
+
+func TestEncode_Netpbm(t *testing.T) {
+	p := newTestProcessor()
+	tri := &Image{Processor: p}
+	res, _, _, err := tri.Draw(newTestImage(60, 40), p, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := Encode(res, "ppm", EncodeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	magic, got := decodeNetpbm(t, b)
+	if magic != "P6" {
+		t.Fatalf("expected a P6 pixmap, got %s", magic)
+	}
+	if got.Bounds().Size() != res.Bounds().Size() {
+		t.Fatalf("expected %v size, got %v", res.Bounds().Size(), got.Bounds().Size())
+	}
+	// The semi-transparent colors are flattened over white.
+	bounds, want := res.Bounds(), flatten(res, color.White)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.RGBAModel.Convert(want.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			if g := got.NRGBAAt(x, y); g.R != c.R || g.G != c.G || g.B != c.B {
+				t.Fatalf("expected %v at %d,%d, got %v", c, x, y, g)
+			}
+		}
+	}
+}
+
+func TestRun_Netpbm(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, newTestImage(60, 40)); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProcessor()
+
+	var dst bytes.Buffer
+	if err := Run(bytes.NewReader(src.Bytes()), &dst, "ppm", &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if magic, _ := decodeNetpbm(t, dst.Bytes()); magic != "P6" {
+		t.Errorf("expected a P6 pixmap, got %s", magic)
+	}
+
+	// The grayscale output is written as a graymap, even with the ppm format.
+	p.Grayscale = true
+	for _, format := range []string{"ppm", "pgm"} {
+		dst.Reset()
+		if err := Run(bytes.NewReader(src.Bytes()), &dst, format, &p); err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if magic, _ := decodeNetpbm(t, dst.Bytes()); magic != "P5" {
+			t.Errorf("%s: expected a P5 graymap, got %s", format, magic)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package triangle
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RenderPDF writes the generated triangles to w as a single page vector PDF document, using the same
+// colors as the SVG output. The page size is the SVG width and height in points, the triangles being
+// scaled from the view box the same way as in the case of the SVG output. In case the PlotterMode option is enabled,
+// only the unique edges of the triangles are stroked, like in the SVG output.
+func (svg *SVG) RenderPDF(w io.Writer) error {
+	precision := Max(svg.Precision, 0)
+	num := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', precision, 64)
+	}
+	rgb := func(v uint8) string {
+		return strconv.FormatFloat(float64(v)/255, 'f', 3, 64)
+	}
+
+	var content bytes.Buffer
+	zw := zlib.NewWriter(&content)
+	cw := bufio.NewWriter(zw)
+
+	// Flip the y axis, since the origin of the PDF coordinate system is the bottom-left corner of the page.
+	sx := float64(svg.Width) / float64(Max(svg.ViewBoxWidth, 1))
+	sy := float64(svg.Height) / float64(Max(svg.ViewBoxHeight, 1))
+	fmt.Fprintf(cw, "%g 0 0 %g 0 %d cm\n", sx, -sy, svg.Height)
+	fmt.Fprintf(cw, "1 J 1 j %g w\n", svg.StrokeWidth)
+
+	if svg.PlotterMode {
+		// Stroke only the unique edges of the triangles.
+		c := svg.plotterColor()
+		fmt.Fprintf(cw, "%s %s %s RG\n", rgb(c.R), rgb(c.G), rgb(c.B))
+		for _, s := range svg.segments() {
+			fmt.Fprintf(cw, "%s %s m %s %s l S\n", num(s[0].X), num(s[0].Y), num(s[1].X), num(s[1].Y))
+		}
+	} else {
+		// Fill the triangles, stroking them too in case the stroke width is defined.
+		paint := "f"
+		if svg.StrokeWidth > 0 {
+			paint = "B"
+		}
+		for _, l := range svg.Lines {
+			fc, sc := l.FillColor, l.StrokeColor
+			fmt.Fprintf(cw, "%s %s %s rg %s %s %s RG %s %s m %s %s l %s %s l h %s\n",
+				rgb(fc.R), rgb(fc.G), rgb(fc.B), rgb(sc.R), rgb(sc.G), rgb(sc.B),
+				num(l.P0.X), num(l.P0.Y), num(l.P1.X), num(l.P1.Y), num(l.P2.X), num(l.P2.Y), paint,
+			)
+		}
+	}
+	if err := cw.Flush(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Contents 4 0 R /Resources << >> >>", svg.Width, svg.Height),
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.Bytes()),
+		fmt.Sprintf("<< /Title %s /Subject %s >>", pdfString(svg.Title), pdfString(svg.Description)),
+	}
+
+	// The cross-reference table holds the byte offset of each object.
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// pdfString returns the text as a PDF literal string, escaping the special characters.
+func pdfString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", `\r`, "\n", `\n`)
+	return "(" + r.Replace(s) + ")"
+}
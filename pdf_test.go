@@ -0,0 +1,68 @@
+package triangle
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSVG_RenderPDF(t *testing.T) {
+	proc := newTestProcessor()
+	proc.OutputWidth = 240
+
+	svg := &SVG{Title: "Triangle (test)", StrokeWidth: 1, Processor: proc}
+	if _, _, _, err := svg.Draw(newTestImage(120, 80), proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := svg.RenderPDF(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("expected a PDF header and trailer")
+	}
+	// The page has the output size, preserving the aspect ratio of the image.
+	if !bytes.Contains(pdf, []byte("/MediaBox [0 0 240 160]")) {
+		t.Error("expected a 240x160 page")
+	}
+	if !bytes.Contains(pdf, []byte(`/Title (Triangle \(test\))`)) {
+		t.Error("expected the escaped title in the document information")
+	}
+
+	// Every entry of the cross-reference table points to the beginning of its object.
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("expected the startxref offset")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := strings.Split(string(pdf[xref:]), "\n")[3:8]
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[:10])
+		if obj := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(pdf[offset:], []byte(obj)) {
+			t.Errorf("expected the object %d at the offset %d", i+1, offset)
+		}
+	}
+
+	// The content stream has a path for each triangle.
+	start := bytes.Index(pdf, []byte("stream\n")) + len("stream\n")
+	end := bytes.Index(pdf, []byte("\nendstream"))
+	zr, err := zlib.NewReader(bytes.NewReader(pdf[start:end]))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := bytes.Count(content, []byte(" h B\n")); n != len(svg.Lines) {
+		t.Errorf("expected %d paths, got %d", len(svg.Lines), n)
+	}
+}
@@ -1,26 +1,460 @@
 package triangle
 
 import (
+	"container/heap"
 	"image"
+	"math"
 	"math/rand"
+	"sort"
 	"time"
 )
 
+// alphaThreshold is the source alpha value below which the pixels are not considered
+// as edge candidates in case the IgnoreTransparent option is enabled.
+const alphaThreshold = 128
+
+// randomSeed returns the seed of the random point selection. It's replaced by the tests needing reproducible points.
+var randomSeed = func() int64 { return time.Now().UnixNano() }
+
 // GetPoints retrieves the triangle points after the Sobel threshold has been applied.
+// The image is split into horizontal bands scanned concurrently by the number of workers defined by the processor.
+// In case the processor has a Mask, the points are selected proportionally to its values.
 func (p *Processor) GetPoints(img *image.NRGBA, threshold, maxPoints int) []Point {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return p.getPoints(new(scratch), img, nil, image.Point{}, threshold, maxPoints)
+}
+
+// getPoints is like GetPoints, but it skips the pixels whose alpha value in the mask image
+// is below the alpha threshold. A nil mask means that every pixel is considered.
+// The origin defines the position of the image on the source image, used for looking up the processor's Mask.
+// The candidate and the returned points are stored in the scratch buffers, the candidates buffer
+// holding every candidate the points were selected from, or a random sample of them in case of the LowMemory option.
+func (p *Processor) getPoints(s *scratch, img, mask *image.NRGBA, origin image.Point, threshold, maxPoints int) []Point {
+	r := rand.New(rand.NewSource(randomSeed()))
+
+	var points []Point
+	if p.LowMemory {
+		var sample []Point
+		sample, s.candidateCount = p.sampleCandidates(s, img, mask, origin, threshold, maxPoints*sampleOversampling, r)
+		s.candidates = append(s.candidates[:0], sample...)
+		points = s.candidates
+	} else {
+		points = p.scanCandidates(s, img, mask, origin, threshold, r)
+		s.candidateCount = len(points)
+	}
+
+	ilen := len(points)
+	limit := Min(int(float64(s.candidateCount)*p.PointRate), maxPoints, ilen)
+
+	var spaced *spacedSet
+	if p.MinPointDistance > 0 {
+		spaced = newSpacedSet(float64(p.MinPointDistance))
+	}
+	// The points ordered by their edge energy or by their gradient are taken in order.
+	ordered := false
+	switch {
+	case p.PointSelection == FarthestPoint:
+		n := farthestPoints(points, limit, float64(p.MinPointDistance), r)
+		s.points = append(s.points[:0], points[:n]...)
+		return s.points
+	case p.PointSelection == TopGradient:
+		// The points having the same gradient are shuffled, so they are not selected in the scan order.
+		r.Shuffle(ilen, func(i, j int) { points[i], points[j] = points[j], points[i] })
+		width := img.Bounds().Dx()
+		sort.Slice(points, func(i, j int) bool {
+			return img.Pix[(int(points[i].X)+int(points[i].Y)*width)<<2] > img.Pix[(int(points[j].X)+int(points[j].Y)*width)<<2]
+		})
+		ordered = true
+	case p.BackgroundCoarsening > 0:
+		coarsenOrder(points, img, p.BackgroundCoarsening, r)
+		ordered = true
+	}
+
+	// Select the points without replacement by moving each chosen point in front of the
+	// remaining ones, otherwise the same point could be picked more than once. The candidates
+	// too close to an already chosen point are skipped, until the limit is reached.
+	n := 0
+	for i := 0; i < ilen && n < limit; i++ {
+		j := i
+		if !ordered {
+			j += r.Intn(ilen - i)
+		}
+		points[i], points[j] = points[j], points[i]
+		if spaced != nil && !spaced.add(points[i]) {
+			continue
+		}
+		points[n] = points[i]
+		n++
+	}
+	s.points = append(s.points[:0], points[:n]...)
+	return s.points
+}
+
+// scanCandidates scans the candidates of the image into the candidates buffer of the scratch. The image is split into
+// horizontal bands scanned concurrently by the number of workers defined by the processor.
+// The candidates are thinned by the density mask in case the processor has a Mask.
+func (p *Processor) scanCandidates(s *scratch, img, mask *image.NRGBA, origin image.Point, threshold int, r *rand.Rand) []Point {
+	height := img.Bounds().Dy()
+
+	workers := Min(Max(p.Workers, 1), height)
+	if workers <= 1 {
+		// The rows are scanned in steps, so the progress can be reported between them.
+		s.candidates = s.candidates[:0]
+		steps := Min(progressSteps, height)
+		for i := 0; i < steps; i++ {
+			y0, y1 := i*height/steps, (i+1)*height/steps
+			s.candidates = scanPoints(s.candidates, img, mask, threshold, y0, y1)
+			s.progress(ScanStage, float64(i+1)/float64(steps))
+		}
+	} else {
+		s.bands = reuseSlice(s.bands, workers)
+		bandHeight := (height + workers - 1) / workers
+		done := make(chan struct{}, workers)
+
+		for i := 0; i < workers; i++ {
+			y0 := i * bandHeight
+			y1 := Min(y0+bandHeight, height)
+
+			go func(i, y0, y1 int) {
+				s.bands[i] = scanPoints(s.bands[i][:0], img, mask, threshold, y0, y1)
+				done <- struct{}{}
+			}(i, y0, y1)
+		}
+		// The progress is reported as the bands are completed, from the calling goroutine.
+		for i := 0; i < workers; i++ {
+			<-done
+			s.progress(ScanStage, float64(i+1)/float64(workers))
+		}
+
+		// Merge the bands in order, so the result is the same as in the case of the serial scan.
+		s.candidates = s.candidates[:0]
+		for _, band := range s.bands {
+			s.candidates = append(s.candidates, band...)
+		}
+	}
+
+	points := s.candidates
+
+	// Keep each candidate with a probability proportional to its density mask value.
+	if p.Mask != nil {
+		n := 0
+		for _, pt := range points {
+			if p.maskKeeps(pt, origin, r) {
+				points[n] = pt
+				n++
+			}
+		}
+		points = points[:n]
+		s.candidates = points
+	}
+	return points
+}
+
+// maskKeeps reports whether the candidate is kept, with a probability proportional to its density mask value.
+func (p *Processor) maskKeeps(pt Point, origin image.Point, r *rand.Rand) bool {
+	v := p.Mask.GrayAt(p.Mask.Rect.Min.X+origin.X+int(pt.X), p.Mask.Rect.Min.Y+origin.Y+int(pt.Y)).Y
+	return int(v) > r.Intn(255)
+}
+
+// sampleOversampling is the number of times the sample of the candidates kept in case of the LowMemory option
+// exceeds the maximum number of points, leaving room for the candidates rejected by the MinPointDistance
+// and for the ones favored by the BackgroundCoarsening.
+const sampleOversampling = 4
+
+// sampleCandidates scans the candidates like scanCandidates, but it keeps only a uniform random sample of at most size
+// candidates while scanning, so the memory use is bounded regardless of the number of the candidates. The candidates
+// are thinned by the density mask while scanning. It returns the sample and the number of the candidates.
+func (p *Processor) sampleCandidates(s *scratch, img, mask *image.NRGBA, origin image.Point, threshold, size int, r *rand.Rand) ([]Point, int) {
+	height := img.Bounds().Dy()
+	workers := Min(Max(p.Workers, 1), height)
+
+	// Every band has its own sample and random source, since the random sources are not safe for concurrent use.
+	samples := make([]*reservoir, workers)
+	scan := func(i, y0, y1 int) {
+		rs := samples[i]
+		scanEdges(img, mask, threshold, y0, y1, func(x, y int) {
+			pt := Point{X: float64(x), Y: float64(y)}
+			if p.Mask == nil || p.maskKeeps(pt, origin, rs.r) {
+				rs.add(pt)
+			}
+		})
+	}
+	for i := range samples {
+		samples[i] = &reservoir{size: size, r: rand.New(rand.NewSource(r.Int63()))}
+	}
+
+	if workers <= 1 {
+		steps := Min(progressSteps, height)
+		for i := 0; i < steps; i++ {
+			scan(0, i*height/steps, (i+1)*height/steps)
+			s.progress(ScanStage, float64(i+1)/float64(steps))
+		}
+	} else {
+		bandHeight := (height + workers - 1) / workers
+		done := make(chan struct{}, workers)
+		for i := 0; i < workers; i++ {
+			y0 := i * bandHeight
+			go func(i, y0, y1 int) {
+				scan(i, y0, y1)
+				done <- struct{}{}
+			}(i, y0, Min(y0+bandHeight, height))
+		}
+		for i := 0; i < workers; i++ {
+			<-done
+			s.progress(ScanStage, float64(i+1)/float64(workers))
+		}
+	}
+
+	// The candidates having the smallest keys among the samples of the bands are a uniform sample of every candidate.
+	var count int
+	var entries []sampleEntry
+	for _, rs := range samples {
+		count += rs.count
+		entries = append(entries, rs.entries...)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	sample := make([]Point, Min(len(entries), size))
+	for i := range sample {
+		sample[i] = entries[i].pt
+	}
+	return sample, count
+}
+
+// sampleEntry is a candidate of the sample, having a random key.
+type sampleEntry struct {
+	key float64
+	pt  Point
+}
+
+// reservoir keeps the candidates having the smallest random keys, which are a uniform random sample of at most size
+// of the candidates added to it, regardless of their number. The entries are kept in a max-heap ordered by their keys,
+// so the candidate having the largest key is replaced by the next candidate having a smaller one.
+type reservoir struct {
+	size    int
+	count   int
+	entries []sampleEntry
+	r       *rand.Rand
+}
+
+func (rs *reservoir) Len() int           { return len(rs.entries) }
+func (rs *reservoir) Less(i, j int) bool { return rs.entries[i].key > rs.entries[j].key }
+func (rs *reservoir) Swap(i, j int)      { rs.entries[i], rs.entries[j] = rs.entries[j], rs.entries[i] }
+func (rs *reservoir) Push(x any)         { rs.entries = append(rs.entries, x.(sampleEntry)) }
+func (rs *reservoir) Pop() any {
+	e := rs.entries[len(rs.entries)-1]
+	rs.entries = rs.entries[:len(rs.entries)-1]
+	return e
+}
+
+// add adds the candidate to the sample, in case its random key is smaller than the largest one of the sample.
+func (rs *reservoir) add(pt Point) {
+	rs.count++
+	key := rs.r.Float64()
+	switch {
+	case len(rs.entries) < rs.size:
+		rs.entries = append(rs.entries, sampleEntry{key, pt})
+		if len(rs.entries) == rs.size {
+			heap.Init(rs)
+		}
+	case key < rs.entries[0].key:
+		rs.entries[0] = sampleEntry{key, pt}
+		heap.Fix(rs, 0)
+	}
+}
+
+const (
+	// farthestSampling is the number of times the random sample of the candidates the farthest points are selected from
+	// exceeds the number of the selected points, bounding the cost of the selection on the images having many candidates.
+	farthestSampling = 8
+	// maxFarthestSample caps the size of the random sample in case many points are selected, unless the number of the
+	// selected points exceeds it.
+	maxFarthestSample = 1 << 15
+)
+
+// farthestPoints moves in front of the points the ones selected by the greedy farthest point sampling, each selected
+// point being the farthest one from the already selected ones, starting with a random one. The points are selected
+// among a random sample of the points, until the limit is reached, or until the farthest point is closer than
+// minDist to the selected ones. It returns the number of the selected points.
+// Every selection updates the distances of the whole sample, so the cost is limit times the sample size:
+// 8*limit², or limit*maxFarthestSample once the sample is capped, still growing quadratically with the limit.
+func farthestPoints(points []Point, limit int, minDist float64, r *rand.Rand) int {
+	m := Min(len(points), limit*farthestSampling, Max(limit, maxFarthestSample))
+	for i := 0; i < m; i++ {
+		j := i + r.Intn(len(points)-i)
+		points[i], points[j] = points[j], points[i]
+	}
+	points = points[:m]
+	if m == 0 || limit == 0 {
+		return 0
+	}
+
+	// dist holds the squared distance of the points from the closest selected point.
+	dist := make([]float64, m)
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	n := 0
+	for next := 0; n < limit; n++ {
+		if n > 0 && dist[next] < minDist*minDist {
+			break
+		}
+		points[n], points[next] = points[next], points[n]
+		dist[n], dist[next] = dist[next], dist[n]
+
+		sel, farthest := points[n], -1.0
+		for i := n + 1; i < m; i++ {
+			dx, dy := points[i].X-sel.X, points[i].Y-sel.Y
+			dist[i] = math.Min(dist[i], dx*dx+dy*dy)
+			if dist[i] > farthest {
+				next, farthest = i, dist[i]
+			}
+		}
+		if farthest < 0 {
+			n++
+			break
+		}
+	}
+	return n
+}
+
+// coarseningCells is the number of the cells along the shorter side of the edge map, whose edge energy
+// weights the points in case of the background coarsening.
+const coarseningCells = 16
+
+// coarsenOrder shuffles the points in place, the points of the cells having a higher edge energy being more likely
+// to come first, so the selection favors the high detail regions. The weight of a point is interpolated by the
+// coarsening factor between 1 and the edge energy of its cell relative to the highest one, the weighted random
+// order being given by the exponential keys of the weighted sampling without replacement.
+func coarsenOrder(points []Point, img *image.NRGBA, coarsening float64, r *rand.Rand) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	size := Max(Min(width, height)/coarseningCells, 1)
+	cols, rows := (width+size-1)/size, (height+size-1)/size
+
+	energy := make([]float64, cols*rows)
+	var highest float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := x/size + y/size*cols
+			energy[i] += float64(img.Pix[(x+y*width)<<2])
+			highest = math.Max(highest, energy[i])
+		}
+	}
+	if highest == 0 {
+		return
+	}
+
+	keys := make([]float64, len(points))
+	for i, pt := range points {
+		x, y := Min(Max(int(pt.X), 0), width-1), Min(Max(int(pt.Y), 0), height-1)
+		w := 1 - coarsening + coarsening*energy[x/size+y/size*cols]/highest
+		keys[i] = math.Log(1-r.Float64()) / math.Max(w, 1e-9)
+	}
+	sort.Sort(byKey{points, keys})
+}
+
+// byKey sorts the points by their keys in descending order.
+type byKey struct {
+	points []Point
+	keys   []float64
+}
+
+func (b byKey) Len() int           { return len(b.points) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] > b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.points[i], b.points[j] = b.points[j], b.points[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// spacedSet is a spatial hash of the chosen points, used for rejecting the candidates closer than the minimum
+// distance to them. The diagonal of the grid cells is the minimum distance, so each cell holds at most one point.
+type spacedSet struct {
+	cells map[[2]int]Point
+	dist  float64
+}
+
+// newSpacedSet returns an empty set of the points being at least dist apart.
+func newSpacedSet(dist float64) *spacedSet {
+	return &spacedSet{cells: make(map[[2]int]Point), dist: dist}
+}
+
+// add adds the point to the set, returning false if it's closer than the minimum distance to an existing point.
+func (s *spacedSet) add(p Point) bool {
+	size := s.dist / math.Sqrt2
+	c := [2]int{int(math.Floor(p.X / size)), int(math.Floor(p.Y / size))}
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			if q, ok := s.cells[[2]int{c[0] + dx, c[1] + dy}]; ok {
+				if (q.X-p.X)*(q.X-p.X)+(q.Y-p.Y)*(q.Y-p.Y) < s.dist*s.dist {
+					return false
+				}
+			}
+		}
+	}
+	s.cells[c] = p
+	return true
+}
+
+// gridPoints generates about maxPoints points on a jittered grid covering the width x height rectangle,
+// each point being placed randomly inside its grid cell. The grid cells are kept close to squares.
+// The points on the pixels whose alpha value in the mask image is below the alpha threshold are skipped,
+// like the points closer than minDist to the previous ones, in case it's greater than 0.
+// The returned points are stored in the scratch buffer.
+func (s *scratch) gridPoints(mask *image.NRGBA, width, height, maxPoints int, minDist float64) []Point {
+	r := rand.New(rand.NewSource(randomSeed()))
+
+	var spaced *spacedSet
+	if minDist > 0 {
+		spaced = newSpacedSet(minDist)
+	}
+
+	cols := Max(int(math.Round(math.Sqrt(float64(maxPoints)*float64(width)/float64(height)))), 1)
+	rows := Max(int(math.Round(float64(maxPoints)/float64(cols))), 1)
+	cw, ch := float64(width)/float64(cols), float64(height)/float64(rows)
+
+	s.points = s.points[:0]
+	for j := 0; j < rows; j++ {
+		for i := 0; i < cols; i++ {
+			x := (float64(i) + r.Float64()) * cw
+			y := (float64(j) + r.Float64()) * ch
+			if mask != nil {
+				px, py := Min(int(x), width-1), Min(int(y), height-1)
+				if mask.Pix[((px+py*width)<<2)+3] < alphaThreshold {
+					continue
+				}
+			}
+			if spaced != nil && !spaced.add(Point{X: x, Y: y}) {
+				continue
+			}
+			s.points = append(s.points, Point{X: x, Y: y})
+		}
+	}
+	return s.points
+}
+
+// scanPoints appends to the points slice the pixels between the y0 and y1 rows
+// of the image whose neighborhood average value exceeds the threshold.
+func scanPoints(points []Point, img, mask *image.NRGBA, threshold, y0, y1 int) []Point {
+	scanEdges(img, mask, threshold, y0, y1, func(x, y int) {
+		points = append(points, Point{X: float64(x), Y: float64(y)})
+	})
+	return points
+}
+
+// scanEdges calls fn with the coordinates of the pixels between the y0 and y1 rows
+// of the image whose neighborhood average value exceeds the threshold.
+func scanEdges(img, mask *image.NRGBA, threshold, y0, y1 int, fn func(x, y int)) {
 	width, height := img.Bounds().Dx(), img.Bounds().Dy()
 
 	var (
 		sum, total     uint8
 		x, y, sx, sy   int
 		row, col, step int
-		points         []Point
-		dpoints        []Point
 	)
 
-	for y = 0; y < height; y++ {
+	for y = y0; y < y1; y++ {
 		for x = 0; x < width; x++ {
+			if mask != nil && mask.Pix[((x+y*width)<<2)+3] < alphaThreshold {
+				continue
+			}
 			sum, total = 0, 0
 
 			for row = -1; row <= 1; row++ {
@@ -40,19 +474,8 @@ func (p *Processor) GetPoints(img *image.NRGBA, threshold, maxPoints int) []Poin
 				sum /= total
 			}
 			if sum > uint8(threshold) {
-				points = append(points, Point{X: float64(x), Y: float64(y)})
+				fn(x, y)
 			}
 		}
 	}
-	ilen := len(points)
-	limit := int(float64(ilen) * p.PointRate)
-	if limit > maxPoints {
-		limit = maxPoints
-	}
-
-	for i := 0; i < limit && i < ilen; i++ {
-		j := int(float64(ilen) * r.Float64())
-		dpoints = append(dpoints, points[j])
-	}
-	return dpoints
 }
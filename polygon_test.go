@@ -0,0 +1,316 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestGetPoints_Unique(t *testing.T) {
+	img := newEdgeImage()
+	proc := &Processor{PointRate: 1}
+
+	points := proc.GetPoints(img, 20, 5000)
+	if len(points) != 5000 {
+		t.Fatalf("expected 5000 points, got %d", len(points))
+	}
+	seen := make(map[Point]bool, len(points))
+	for _, p := range points {
+		if seen[p] {
+			t.Fatalf("expected unique points, got %v more than once", p)
+		}
+		seen[p] = true
+	}
+}
+
+func TestGetPoints_Limit(t *testing.T) {
+	img := newTestImage(120, 80)
+	edges := SobelFilter(Grayscale(img), 10)
+
+	all := (&Processor{PointRate: 1}).GetPoints(edges, 10, len(edges.Pix))
+	if len(all) == 0 {
+		t.Fatal("expected edge points")
+	}
+
+	// The number of points is defined by the point rate, limited by the maximum number of points.
+	if n := len((&Processor{PointRate: 0.5}).GetPoints(edges, 10, len(edges.Pix))); n != len(all)/2 {
+		t.Errorf("expected %d points, got %d", len(all)/2, n)
+	}
+	if n := len((&Processor{PointRate: 1}).GetPoints(edges, 10, 10)); n != 10 {
+		t.Errorf("expected 10 points, got %d", n)
+	}
+}
+
+func TestGetPoints_Parallel(t *testing.T) {
+	img := newTestImage(120, 80)
+	edges := SobelFilter(Grayscale(img), 10)
+
+	// Selecting all the points, the serial and the concurrent scan give the same points.
+	serial := (&Processor{PointRate: 1, Workers: 1}).GetPoints(edges, 10, len(edges.Pix))
+	parallel := (&Processor{PointRate: 1, Workers: 4}).GetPoints(edges, 10, len(edges.Pix))
+
+	sortPoints := func(points []Point) {
+		sort.Slice(points, func(i, j int) bool {
+			if points[i].Y != points[j].Y {
+				return points[i].Y < points[j].Y
+			}
+			return points[i].X < points[j].X
+		})
+	}
+	sortPoints(serial)
+	sortPoints(parallel)
+
+	if len(serial) != len(parallel) {
+		t.Fatalf("expected %d points, got %d", len(serial), len(parallel))
+	}
+	for i := range serial {
+		if serial[i] != parallel[i] {
+			t.Fatalf("expected the point %v, got %v", serial[i], parallel[i])
+		}
+	}
+}
+
+func TestGridPoints(t *testing.T) {
+	for _, size := range [][2]int{{120, 80}, {80, 300}, {500, 500}} {
+		w, h := size[0], size[1]
+		for _, maxPoints := range []int{100, 1000, 2500} {
+			points := new(scratch).gridPoints(nil, w, h, maxPoints, 0)
+			if n := len(points); n < maxPoints*9/10 || n > maxPoints*11/10 {
+				t.Errorf("%dx%d: expected about %d points, got %d", w, h, maxPoints, n)
+			}
+
+			// Every point is inside the rectangle and the points are evenly spread over its quadrants.
+			var quadrants [4]int
+			for _, p := range points {
+				if p.X < 0 || p.X >= float64(w) || p.Y < 0 || p.Y >= float64(h) {
+					t.Fatalf("%dx%d: the point %v is outside of the image", w, h, p)
+				}
+				q := 0
+				if p.X >= float64(w)/2 {
+					q++
+				}
+				if p.Y >= float64(h)/2 {
+					q += 2
+				}
+				quadrants[q]++
+			}
+			for _, n := range quadrants {
+				if d := n - len(points)/4; d*d > (len(points)/10)*(len(points)/10) {
+					t.Errorf("%dx%d: expected the points to be evenly distributed, got %v", w, h, quadrants)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestGetPoints_MinPointDistance(t *testing.T) {
+	img := newEdgeImage()
+
+	for _, dist := range []int{3, 10} {
+		proc := &Processor{PointRate: 1, MinPointDistance: dist}
+		points := proc.GetPoints(img, 20, 5000)
+		if len(points) == 0 {
+			t.Fatal("expected edge points")
+		}
+		for i, p := range points {
+			for _, q := range points[i+1:] {
+				if d := math.Hypot(p.X-q.X, p.Y-q.Y); d < float64(dist) {
+					t.Fatalf("expected the points to be at least %d apart, got %v and %v at %.2f", dist, p, q, d)
+				}
+			}
+		}
+	}
+
+	points := new(scratch).gridPoints(nil, 200, 200, 2500, 5)
+	for i, p := range points {
+		for _, q := range points[i+1:] {
+			if d := math.Hypot(p.X-q.X, p.Y-q.Y); d < 5 {
+				t.Fatalf("expected the grid points to be at least 5 apart, got %v and %v at %.2f", p, q, d)
+			}
+		}
+	}
+}
+
+func TestGetPoints_BackgroundCoarsening(t *testing.T) {
+	// A sharp checkerboard subject in the middle of a blurry background of soft waves.
+	const size = 160
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := 128 + 60*math.Sin(float64(x)/6)*math.Cos(float64(y)/6)
+			if x >= 50 && x < 110 && y >= 50 && y < 110 && (x/4+y/4)%2 == 0 {
+				v = 255
+			} else if x >= 50 && x < 110 && y >= 50 && y < 110 {
+				v = 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(v), G: uint8(v), B: uint8(v), A: 255})
+		}
+	}
+	edges := SobelFilter(Grayscale(img), 10)
+
+	// The point density of the cells is compared with their edge energy.
+	const cell = 20
+	cells := size / cell
+	energy := make([]float64, cells*cells)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			energy[x/cell+y/cell*cells] += float64(edges.Pix[(x+y*size)*4])
+		}
+	}
+	correlation := func(points []Point) float64 {
+		density := make([]float64, len(energy))
+		for _, p := range points {
+			density[int(p.X)/cell+int(p.Y)/cell*cells]++
+		}
+		return pearson(density, energy)
+	}
+
+	const maxPoints = 1500
+	even := (&Processor{PointRate: 1}).GetPoints(edges, 10, maxPoints)
+	coarse := (&Processor{PointRate: 1, BackgroundCoarsening: 1}).GetPoints(edges, 10, maxPoints)
+	if len(coarse) != len(even) {
+		t.Fatalf("expected the same number of points, got %d and %d", len(even), len(coarse))
+	}
+
+	r0, r1 := correlation(even), correlation(coarse)
+	if r1 < 0.85 {
+		t.Errorf("expected the point density to correlate with the edge energy, got %.3f", r1)
+	}
+	if r1 <= r0 {
+		t.Errorf("expected a higher correlation than %.3f without coarsening, got %.3f", r0, r1)
+	}
+}
+
+// pearson returns the Pearson correlation coefficient of the two samples.
+func pearson(a, b []float64) float64 {
+	var ma, mb float64
+	for i := range a {
+		ma += a[i]
+		mb += b[i]
+	}
+	ma /= float64(len(a))
+	mb /= float64(len(b))
+
+	var cov, va, vb float64
+	for i := range a {
+		cov += (a[i] - ma) * (b[i] - mb)
+		va += (a[i] - ma) * (a[i] - ma)
+		vb += (b[i] - mb) * (b[i] - mb)
+	}
+	return cov / math.Sqrt(va*vb)
+}
+
+func TestGetPoints_LowMemory(t *testing.T) {
+	// The left part of the edge map is denser than the right one, so the points follow an uneven distribution.
+	const width, height = 400, 300
+	edges := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/4 || (x+y)%7 == 0 {
+				edges.Pix[(x+y*width)*4] = 255
+			}
+			edges.Pix[(x+y*width)*4+3] = 255
+		}
+	}
+
+	const cells, maxPoints = 4, 2000
+	histogram := func(points []Point) []float64 {
+		h := make([]float64, cells*cells)
+		for _, p := range points {
+			h[int(p.X)*cells/width+int(p.Y)*cells/height*cells] += 1 / float64(len(points))
+		}
+		return h
+	}
+	// The sampled points are compared with the distribution of every candidate.
+	candidates := scanPoints(nil, edges, nil, 10, 0, height)
+	want := histogram(candidates)
+
+	for _, workers := range []int{1, 4} {
+		s := new(scratch)
+		points := (&Processor{PointRate: 1, Workers: workers, LowMemory: true}).getPoints(s, edges, nil, image.Point{}, 10, maxPoints)
+		if len(points) != maxPoints {
+			t.Fatalf("workers %d: expected %d points, got %d", workers, maxPoints, len(points))
+		}
+		if s.candidateCount != len(candidates) {
+			t.Errorf("workers %d: expected %d candidates, got %d", workers, len(candidates), s.candidateCount)
+		}
+		if len(s.candidates) > maxPoints*sampleOversampling {
+			t.Errorf("workers %d: expected at most %d sampled candidates, got %d", workers, maxPoints*sampleOversampling, len(s.candidates))
+		}
+		seen := make(map[Point]bool, len(points))
+		for _, p := range points {
+			if seen[p] {
+				t.Fatalf("workers %d: expected unique points, got %v more than once", workers, p)
+			}
+			seen[p] = true
+		}
+		for i, v := range histogram(points) {
+			if math.Abs(v-want[i]) > 0.04 {
+				t.Errorf("workers %d: expected %.3f of the points in the cell %d, got %.3f", workers, want[i], i, v)
+			}
+		}
+	}
+
+	// The memory allocated by the scan doesn't depend on the number of the edge pixels.
+	alloc := func(lowMemory bool) uint64 {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		(&Processor{PointRate: 1, LowMemory: lowMemory}).GetPoints(edges, 10, 100)
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+	if full, low := alloc(false), alloc(true); low > 1<<20 || low > full/4 {
+		t.Errorf("expected the low memory scan to allocate less than 1MB, got %d bytes, compared to %d bytes", low, full)
+	}
+}
+
+func TestGetPoints_Selection(t *testing.T) {
+	img := newTestImage(120, 80)
+	edges := SobelFilter(Grayscale(img), 10)
+	gradient := func(p Point) uint8 {
+		return edges.Pix[(int(p.X)+int(p.Y)*edges.Bounds().Dx())*4]
+	}
+
+	candidates := scanPoints(nil, edges, nil, 10, 0, edges.Bounds().Dy())
+	values := make([]int, len(candidates))
+	for i, p := range candidates {
+		values[i] = int(gradient(p))
+	}
+	sort.Ints(values)
+	median := values[len(values)/2]
+
+	const maxPoints = 200
+	points := (&Processor{PointRate: 1, PointSelection: TopGradient}).GetPoints(edges, 10, maxPoints)
+	if len(points) != maxPoints {
+		t.Fatalf("expected %d points, got %d", maxPoints, len(points))
+	}
+	for _, p := range points {
+		if int(gradient(p)) <= median {
+			t.Fatalf("expected the gradient of every point to be above the %d median, got %d at %v", median, gradient(p), p)
+		}
+	}
+
+	// The farthest points are spread more evenly than the random ones.
+	minDist := func(points []Point) float64 {
+		d := math.Inf(1)
+		for i, p := range points {
+			for _, q := range points[i+1:] {
+				d = math.Min(d, math.Hypot(p.X-q.X, p.Y-q.Y))
+			}
+		}
+		return d
+	}
+	random := (&Processor{PointRate: 1}).GetPoints(edges, 10, 50)
+	farthest := (&Processor{PointRate: 1, PointSelection: FarthestPoint}).GetPoints(edges, 10, 50)
+	if len(farthest) != 50 {
+		t.Fatalf("expected 50 points, got %d", len(farthest))
+	}
+	if dr, df := minDist(random), minDist(farthest); df < 2*dr || df < 3 {
+		t.Errorf("expected the farthest points to be spread out, got %.2f minimum distance, compared to %.2f", df, dr)
+	}
+}
@@ -1,13 +1,28 @@
 package triangle
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fogleman/gg"
+
+	// Register the decoders of the supported input formats, so the images can be decoded from any reader,
+	// like the standard input, regardless of the encoders imported by the other files.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
 )
 
 const (
@@ -19,13 +34,105 @@ const (
 	WireframeOnly
 )
 
+const (
+	// SobelOperator - detects the image edges using the Sobel kernels
+	SobelOperator = iota
+	// ScharrOperator - detects the image edges using the Scharr kernels, having a better rotational symmetry
+	ScharrOperator
+	// PrewittOperator - detects the image edges using the Prewitt kernels, being the cheapest one
+	PrewittOperator
+	// CannyOperator - detects the image edges using the Canny edge detector, resulting in thin contours
+	CannyOperator
+)
+
+const (
+	// NoEdgeBias - detects the edges regardless of their direction
+	NoEdgeBias = iota
+	// HorizontalEdgeBias - favors the horizontal edges, like the horizon of the seascapes, weakening the other ones
+	HorizontalEdgeBias
+	// VerticalEdgeBias - favors the vertical edges, like the trunks of the trees, weakening the other ones
+	VerticalEdgeBias
+)
+
+const (
+	// Rec601Luminance - computes the luma of the gamma encoded colors with the Rec. 601 coefficients
+	Rec601Luminance = iota
+	// Rec709Luminance - computes the luma of the gamma encoded colors with the Rec. 709 coefficients
+	Rec709Luminance
+	// LinearLuminance - computes the luminance of the linearized sRGB colors with the Rec. 709 coefficients
+	LinearLuminance
+)
+
+const (
+	// EdgeSampling - places the points along the edges detected on the image
+	EdgeSampling = iota
+	// UniformGrid - places the points on a jittered grid regardless of the image content
+	UniformGrid
+)
+
+const (
+	// RandomSelection - selects the points randomly among the edge pixels
+	RandomSelection = iota
+	// FarthestPoint - selects the edge pixels farthest from the already selected points, resulting in an even mesh.
+	// Its cost grows with the square of the number of points, so it's slow for tens of thousands of points.
+	FarthestPoint
+	// TopGradient - selects the edge pixels having the strongest gradient
+	TopGradient
+)
+
+const (
+	// DelaunayTessellation - triangulates the points sampled from the image
+	DelaunayTessellation = iota
+	// HexGrid - tiles the image with hexagonal cells regardless of the image content
+	HexGrid
+	// TriGrid - tiles the image with triangles regardless of the image content
+	TriGrid
+)
+
+const (
+	// StackBlurType - smooths the image using the stack blur algorithm
+	StackBlurType = iota
+	// GaussianBlurType - smooths the image using a separable gaussian blur
+	GaussianBlurType
+)
+
 // Processor encompasses all of the currently supported processing options.
 type Processor struct {
 	// BlurRadius defines the intensity of the applied blur filter.
 	BlurRadius int
+	// BlurType defines the blur algorithm applied prior to the edge detection (StackBlurType|GaussianBlurType).
+	// The stack blur runs in constant time regardless of the radius, so it's the faster option on large images,
+	// while the gaussian blur gives smoother edges and less spurious points on photographic sources.
+	BlurType int
+	// BlurPasses defines how many times the stack blur filter is applied. Multiple passes give a stronger
+	// smoothing without increasing the blur radius. A value lower than 2 applies the filter only once.
+	BlurPasses int
 	// SobelThreshold defines the threshold intesinty of the sobel edge detector.
 	// By increasing this value the contours of the detected objects will be more evident.
+	// The points are extracted from the edge map of the selected EdgeDetector, having the gradient magnitudes
+	// below the threshold cleared, so it applies to the Sobel, Scharr and Prewitt operators alike.
 	SobelThreshold int
+	// AutoThreshold computes the SobelThreshold from the histogram of the image gradient magnitudes, instead of using
+	// the provided value. The threshold is chosen so that the number of the edge pixels is the number of points
+	// reduced by the PointRate to MaxPoints, which makes the point count predictable across images having
+	// different brightness and contrast. It's ignored by the Canny edge detector.
+	AutoThreshold bool
+	// EdgeDetector defines the operator used for detecting the image edges (SobelOperator|ScharrOperator|PrewittOperator|CannyOperator).
+	// The Canny edge detector keeps only the single pixel wide contours, placing the points along the crisp lines
+	// of the line art, and it uses the CannyLowThreshold and CannyHighThreshold values instead of the SobelThreshold.
+	EdgeDetector int
+	// ColorEdges detects the edges on the red, green and blue channels of the image, keeping the strongest gradient
+	// of the three, instead of on its luminance, so the borders between the colors having the same luminance, like
+	// red and green, attract the points too. It's ignored by the Canny edge detector.
+	ColorEdges bool
+	// EdgeBias favors the edges having the provided direction when selecting the points (NoEdgeBias|HorizontalEdgeBias|VerticalEdgeBias),
+	// so more triangle edges are aligned to the dominant direction of the image. The gradient across the other edges is weakened,
+	// so fewer of them exceed the threshold.
+	EdgeBias int
+	// CannyLowThreshold defines the gradient magnitude above which the pixels connected to the strong edges are also edges.
+	CannyLowThreshold int
+	// CannyHighThreshold defines the gradient magnitude above which the pixels are considered strong edges.
+	CannyHighThreshold int
 	// PointsThreshold defines the threshold of computed pixel value below a point is generated.
 	PointsThreshold int
 	// PointRate defines the point rate by which the generated polygons will be multiplied by.
@@ -37,25 +144,235 @@ type Processor struct {
 	// EdgeFactor defines the factor used to populate the matrix table in conjunction with the convolution filter operator.
 	// The bigger this value is the more cubic alike will be the final image.
 	EdgeFactor int
+	// CustomEdgeKernel replaces the matrix generated from the EdgeFactor by a custom convolution kernel, like
+	// a sharpen or a Laplacian kernel, applied to the detected edges before the points are extracted from them.
+	// It's a square matrix having an odd side, defined in row-major order, and it's applied without normalization.
+	CustomEdgeKernel []float64
+	// SamplingMethod defines how the points are placed on the image (EdgeSampling|UniformGrid). The uniform grid
+	// generates about MaxPoints points on a jittered grid, skipping the edge detection, which gives an even low-poly
+	// mosaic regardless of the image content and runs much faster. The edge detection options and the Mask
+	// are ignored in this case.
+	SamplingMethod int
+	// Tessellation defines how the image is tiled (DelaunayTessellation|HexGrid|TriGrid). The grid tessellations
+	// skip the edge detection and the point sampling, tiling the image with the cells of CellSize pixels, each of
+	// them being filled with the color sampled from the image, for a clean mosaic look. The TriGrid triangulates
+	// the nodes of a regular triangular grid, while the HexGrid renders the hexagons centered at the same nodes
+	// instead of the triangles, which are returned as well. The HexGrid is supported only by the 8-bit raster output.
+	Tessellation int
+	// CellSize defines the distance in pixels between the centers of the neighboring cells of the grid tessellations.
+	// The cells are stretched slightly, so the grid fits the image exactly.
+	CellSize int
 	// MaxPoints holds the maximum number of generated points the vertices/triangles will be generated from.
+	// When it's set to 0 the triangulation is skipped and only the blurred source image is returned.
 	MaxPoints int
+	// PointsPerMegapixel, when it's greater than 0, replaces the MaxPoints with a number of points proportional to
+	// the source image resolution, so the images of different sizes processed in batch get the same point density.
+	PointsPerMegapixel int
+	// MaxDimension, when it's greater than 0, limits the size of the image the points are sampled from. The source
+	// images having their larger side exceeding it are downscaled, keeping their aspect ratio, before the edge
+	// detection, which speeds up the processing of the very large images considerably. The triangles are scaled back
+	// to the source image, so they are rendered at its size, their colors being sampled from the source image.
+	// It's ignored by the grid tessellations, whose triangles don't depend on the image content.
+	MaxDimension int
+	// MinPointDistance defines the minimum distance in pixels between the sampled points, the candidates closer
+	// than this to an already chosen point being rejected. It controls the size of the smallest triangles,
+	// although fewer than MaxPoints points might be chosen. It's not enforced in case it's 0.
+	MinPointDistance int
+	// BackgroundCoarsening, in the [0, 1] range, favors the sampled points of the regions having a high local edge
+	// energy, measured from the edge map, over the ones of the low detail regions, like the blurry backgrounds.
+	// The points budget is redistributed, so the subject gets finer triangles while the background gets coarser ones.
+	// When it's 1, the chances of the points are proportional to the local edge energy, while 0 disables it.
+	BackgroundCoarsening float64
+	// PointSelection defines how the points are selected among the edge pixels (RandomSelection|FarthestPoint|TopGradient).
+	// The farthest point selection greedily selects the pixel farthest from the already selected points, among a random
+	// sample of a few times MaxPoints pixels, which gives an even mesh without the cost of a full Poisson disk sampling.
+	// The top gradient selection keeps the pixels of the strongest edges. The BackgroundCoarsening requires the random selection.
+	PointSelection int
+	// LowMemory keeps only a random sample of the edge pixels the points are selected from while scanning the edge map,
+	// instead of collecting every edge pixel, bounding the memory use of the very large images. The sample holds
+	// a few times MaxPoints candidates, so the MinPointDistance might reject more of the points.
+	LowMemory bool
+	// ColorSampling defines how the fill color of the triangles is sampled from the source image
+	// (CentroidColor|AverageColor|DominantColor). The dominant color, computed by grouping the covered
+	// pixels into clusters, gives a poster like look without washing out the details at the edges.
+	ColorSampling int
+	// FillMode defines the colors the triangles are filled with (SourceColor|FacetIndex|FacetNormal). Instead of the
+	// colors sampled from the source image, the FacetIndex fills every triangle with a unique color encoding its
+	// index, which FacetIndexAt decodes, useful for picking the triangles, while the FacetNormal fills it with its
+	// facet normal encoded like in a normal map, the luminance being the height. The false colors are not quantized
+	// by the palette, and they are ignored by the Voronoi diagram and the HexGrid tessellation.
+	FillMode int
+	// GammaCorrect averages the colors of the AverageColor sampling and interpolates the vertex colors of the
+	// SmoothShading as linear light intensities instead of the sRGB encoded values, which would darken the blends
+	// of the saturated colors, giving more accurate colors on the gradients. The SVG gradients are not affected.
+	GammaCorrect bool
+	// Shading defines how the triangles are filled (FlatShading|SmoothShading). The smooth shading interpolates
+	// the colors sampled at the vertices of each triangle across it (Gouraud shading), giving soft gradients instead
+	// of the faceted look. It's ignored by the Voronoi diagram, the PDF output and the PlotterMode.
+	Shading int
+	// ShowPoints draws a dot at every triangulated point over the triangles, filled with the color of the image
+	// at the point, for a stippled or constellation like look. It's ignored by the PlotterMode and the PDF output,
+	// and it's not supported by the 16-bit output.
+	ShowPoints bool
+	// PointRadius defines the radius of the dots drawn by the ShowPoints option, in the pixels of the source image.
+	// The radius of 2 pixels is used in case it's 0.
+	PointRadius float64
+	// TraceContours draws the strongest edges of the edge map as connected lines over the triangles, for crisp outlines
+	// over the faceted fill. The lines are drawn with the StrokeColor or the SolidStrokeColor, otherwise black, and
+	// rendered as path elements in the SVG output. The edges are not detected by the UniformGrid sampling, the grid
+	// tessellations and the provided Points, which have no contours. It's ignored by the PDF output, and it's not
+	// supported by the 16-bit output.
+	TraceContours bool
 	// Wireframe defines the visual appearence of the generated vertices (WithoutWireframe|WithWireframe|WireframeOnly).
 	Wireframe int
 	// Noise defines the intensity of the noise factor used to give a noisy, despeckle like touch of the final image.
 	Noise int
+	// NoiseChromatic adds its own noise to every color channel, resulting in a chromatic grain.
+	// Otherwise the same noise is added to every channel, resulting in a monochrome grain.
+	NoiseChromatic bool
+	// NoiseSeed defines the seed of the noise, so different noise patterns can be generated reproducibly.
+	// The same seed always generates the same pattern; 0 selects the default one.
+	NoiseSeed int64
 	// StrokeWidth defines the contour width in case of using WithWireframe | WireframeOnly mode.
 	StrokeWidth float64
 	// IsStrokeSolid - when this is set as true, the applied stroke color will be black.
+	// Deprecated: use the SolidStrokeColor option, which accepts any color.
 	IsStrokeSolid bool
+	// SolidStrokeColor defines the solid color of the strokes in hexadecimal format, like #rgb, #rrggbb or #rrggbbaa,
+	// applied the same way as the black color of the IsStrokeSolid option, which it takes precedence over.
+	SolidStrokeColor string
+	// StrokeColor defines the color of the strokes in hexadecimal format, like #rgb, #rrggbb or #rrggbbaa.
+	// When it's defined, it takes precedence over the DarkenStroke, SolidStrokeColor and IsStrokeSolid options.
+	StrokeColor string
+	// DarkenStroke draws the strokes of each triangle with a darkened version of its fill color, for a subtle
+	// outlined look. It takes precedence over the SolidStrokeColor and IsStrokeSolid options.
+	DarkenStroke bool
+	// StrokeOpacity defines the opacity of the strokes drawn over the triangles in the WithWireframe mode of the
+	// raster output, in the [0, 1] range. The strokes are black, unless their color is defined by the StrokeColor,
+	// DarkenStroke or SolidStrokeColor options. When it's 0, the strokes are drawn in a faint black, giving a subtle mesh overlay,
+	// while the higher values give a crisp low-poly look.
+	StrokeOpacity float64
 	// Grayscale will generate the output in grayscale mode.
 	Grayscale bool
+	// LuminanceMode defines how the grayscale image used by the edge detection and the grayscale output is computed
+	// (Rec601Luminance|Rec709Luminance|LinearLuminance). The linear luminance, computed on the linearized sRGB colors,
+	// matches the perceived brightness more closely, especially in the case of the saturated colors.
+	LuminanceMode int
 	// OutputToSVG saves the generated triangles to an SVG file.
 	OutputToSVG bool
 	// ShowInBrowser shows the generated svg file in the browser.
 	ShowInBrowser bool
+	// Compact groups the SVG triangles having the same colors and renders them as polygon elements.
+	Compact bool
+	// MergeTolerance merges the adjacent SVG triangles whose fill colors are closer than the tolerance, measured as
+	// the Euclidean distance of their RGBA values, into convex polygons filled with their average color. The edges
+	// between the merged triangles are not stroked, and the polygons are grouped by their colors like in case of
+	// the Compact option. When it's 0, the triangles are not merged. It's not supported by the SmoothShading.
+	MergeTolerance float64
+	// Precision defines the number of decimals of the node coordinates in the SVG and PDF output.
+	Precision int
+	// PlotterMode renders only the edges of the triangles in the SVG and PDF output, without any fill, for the pen
+	// plotters and the laser cutters. The edges shared by the adjacent triangles are rendered only once, using the
+	// StrokeColor, or black in case it's not defined.
+	PlotterMode bool
+	// EmbedPreview embeds a low resolution PNG preview of the source image into the SVG output, as a fallback layer
+	// behind the triangles for the viewers unable to render them, together with the metadata recording the processor
+	// options as a JSON processing profile. The preview is not embedded in the PlotterMode.
+	EmbedPreview bool
 	// BgColor defines the background color in case of using transparent images as source files.
-	// By default the background is transparent, but it can be changed using a hexadecimal format, like #fff or #ffff00.
+	// By default the background is transparent, but it can be changed using a hexadecimal format, like #fff, #ffff00
+	// or #ffffff80, the last one defining also the alpha channel.
+	// When it's not defined, the triangles preserve the source image transparency sampled at their centroid.
+	// The SVG output renders it as a rectangle behind the triangles, except in the PlotterMode.
 	BgColor string
+	// OutputWidth defines the width of the rendered image. The edge detection still runs on the source image resolution.
+	// If only one of the OutputWidth and OutputHeight is set, the other one is computed by preserving the aspect ratio.
+	OutputWidth int
+	// OutputHeight defines the height of the rendered image.
+	OutputHeight int
+	// Output16Bit renders the raster output at 16 bits per channel, preventing the visible banding of the smooth
+	// gradients. The fill colors are sampled at 16 bits too in case the source image has 16 bits per channel,
+	// and the PNG encoder keeps the full precision.
+	Output16Bit bool
+	// Workers defines the number of goroutines used by the parallelizable processing stages, including the
+	// rendering of the raster output, which is split into horizontal bands filled concurrently.
+	// A value lower than 2 runs every stage on the calling goroutine.
+	Workers int
+	// Quality defines the quality of the encoded output image in the [1, 100] range (JPEG and WebP).
+	Quality int
+	// RelaxationPasses defines how many Lloyd's relaxation passes are applied after the triangulation, moving each point
+	// toward the centroid of its neighboring triangles for obtaining more evenly sized triangles. Since every pass
+	// triangulates the moved points again, each one costs roughly as much as the initial triangulation.
+	RelaxationPasses int
+	// MinTriangleArea defines the minimum area, in the source image pixels, of the output triangles. The smaller
+	// triangles, like the slivers generated between the clustered points, are dropped after the triangulation,
+	// reducing the visual noise and the size of the SVG output. The triangles are not overlapping, so the dropped
+	// ones leave holes in the mesh, showing the background through them, which are barely noticeable as long as
+	// the threshold is kept low. When it's 0, all the triangles are kept.
+	MinTriangleArea float64
+	// ClipShape clips the output to a shape, leaving the pixels outside of it transparent, like the corners of
+	// the avatars (NoClip|CircleClip|RoundedRectClip). The SVG output is clipped by a clip path element.
+	ClipShape int
+	// ClipRadius defines, in the output pixels, the radius of the circle centered on the image in case of the
+	// CircleClip, or the radius of the corners in case of the RoundedRectClip. When it's 0, the circle is the
+	// largest one fitting the image, while the radius of the corners is a tenth of its shorter side.
+	ClipRadius float64
+	// Overlay blends the triangulated raster output over the source image, defining the opacity of the triangles
+	// in the [0, 1] range, for a stylized but recognizable effect. Unlike the transparency of the triangles, the whole
+	// layer of the triangles is blended. When it's 0 or 1, only the triangles are rendered.
+	Overlay float64
+	// PaletteSize defines the number of colors the fill colors are reduced to, for a retro, poster like look.
+	// The palette is computed from the image with the median cut algorithm and each sampled fill color is replaced
+	// by the closest palette color, which also reduces the size of the encoded output. When it's 0, the sampled
+	// colors are used as they are.
+	PaletteSize int
+	// Posterize reduces every color channel of the image the triangle colors are sampled from to the provided number
+	// of evenly spaced levels, for a bold, cel-shaded look. Unlike the PaletteSize, it doesn't require computing a
+	// palette, the channels being quantized independently. The edges are detected on the image as it is. The centroid
+	// color takes only the level values, while the average and the dominant color mix them. When it's 0, the colors
+	// are not posterized.
+	Posterize int
+	// Voronoi renders the cells of the Voronoi diagram dual to the triangulation instead of the triangles, each cell
+	// being filled with the color of the source image pixel found at its site. It's supported only by the 8-bit
+	// raster output, the wireframe modes and the stroke options applying to the cell contours.
+	Voronoi bool
+	// Frames defines the number of frames of the animated GIF output showing the progressive triangulation.
+	Frames int
+	// Region restricts the triangulation to a rectangle of the source image, defined in the source image coordinates.
+	// The edges are detected and the points are sampled only inside it, the rest of the image being left untouched
+	// by the raster output. When it's empty, the whole image is triangulated.
+	Region image.Rectangle
+	// PadToSquare pads the source image to a square canvas, centering it, so the output is square without distorting
+	// the image. The points are generated only inside the source image, the padding being filled with the PadColor
+	// by the raster output and left empty by the SVG output. The returned triangles and points are defined in the
+	// coordinates of the square canvas.
+	PadToSquare bool
+	// PadColor defines the color of the padding added by the PadToSquare option. When it's empty, the padding is transparent.
+	PadColor string
+	// Rotate rotates the source image clockwise by 0, 90, 180 or 270 degrees before the triangulation, so the points
+	// follow the image content. The output size follows the rotated image, whose width and height are swapped by the
+	// 90 and 270 degrees rotations. The Region, the Mask and the provided points refer to the transformed image.
+	Rotate int
+	// FlipH mirrors the source image horizontally, after the rotation.
+	FlipH bool
+	// FlipV mirrors the source image vertically, after the rotation.
+	FlipV bool
+	// Mask defines the density of the generated points: the brighter areas of the mask get proportionally more points,
+	// while no points are generated in the black areas. It's aligned to the top-left corner of the source image,
+	// the pixels outside of it being considered black. When it's nil, the points are evenly selected.
+	Mask *image.Gray
+	// Points defines the points to triangulate in place of the ones sampled from the image, like the externally
+	// computed feature points, skipping the blur, the edge detection and the point sampling stages. They are defined
+	// in the coordinates of the source image, the ones outside of it being dropped. When it's nil, the points are
+	// sampled from the image.
+	Points []Point
+	// IgnoreTransparent skips the (semi) transparent pixels of the source image when extracting the edge points,
+	// preventing the points to be generated in the transparent margins of the sprites or logos.
+	IgnoreTransparent bool
+	// Stats, when it's not nil, is populated with the timing of each processing stage and the number of the
+	// generated points and triangles. In case of the animated GIF outputs it holds the statistics of the last frame.
+	// Since it's shared by the copies of the Processor, every goroutine processing images concurrently should use its own Stats.
+	Stats *Stats
 }
 
 // Line defines the SVG line parameters.
@@ -74,9 +391,13 @@ type Image struct {
 }
 
 // SVG extends the Processor struct with the SVG parameters.
+// The Width and Height fields define the rendered size of the SVG, while the ViewBoxWidth
+// and ViewBoxHeight define the coordinate system of the triangles, matching the source image size.
 type SVG struct {
 	Width         int
 	Height        int
+	ViewBoxWidth  int
+	ViewBoxHeight int
 	Title         string
 	Lines         []Line
 	Color         color.RGBA
@@ -84,107 +405,172 @@ type SVG struct {
 	StrokeLineCap string
 	StrokeWidth   float64
 	Processor
+
+	// shades holds the vertex colors of the triangles in case of the SmoothShading, in the order of the lines.
+	shades [][3]color.NRGBA
+	// preview holds the base64 encoded PNG preview of the source image in case of the EmbedPreview option.
+	preview string
+	// dots holds the dots drawn over the triangles in case of the ShowPoints option.
+	dots []dot
+	// contours holds the lines drawn over the triangles in case of the TraceContours option.
+	contours [][]Node
 }
 
 // Fn is a callback function used on SVG generation.
 type Fn func()
 
-// Drawer interface defines the Draw method.
+// Drawer interface defines the Draw and DrawContext methods.
 // This interface should be implemented by every struct which declares a Draw method.
 // By using this method the image can be triangulated as raster type or SVG.
 type Drawer interface {
 	Draw(image.Image, Processor, Fn) (image.Image, []Triangle, []Point, error)
+	DrawContext(context.Context, image.Image, Processor, Fn) (image.Image, []Triangle, []Point, error)
 }
 
 // Draw triangulates the source image and outputs the result to a raster type.
 // It returns the number of triangles generated, the number of points and the error in case exists.
 func (im *Image) Draw(src image.Image, proc Processor, fn Fn) (image.Image, []Triangle, []Point, error) {
-	var (
-		err         error
-		strokeColor color.RGBA
-	)
+	return im.DrawContext(context.Background(), src, proc, fn)
+}
 
-	width, height := src.Bounds().Dx(), src.Bounds().Dy()
-	if width <= 1 || height <= 1 {
-		err = errors.New("The image width and height must be greater than 1px.\n")
-		return nil, nil, nil, err
+// DrawContext is like Draw, but it aborts the triangulation process as soon as the context
+// is cancelled or its deadline is exceeded, returning the context error.
+func (im *Image) DrawContext(ctx context.Context, src image.Image, proc Processor, fn Fn) (image.Image, []Triangle, []Point, error) {
+	return im.draw(ctx, src, nil, proc, fn, nil)
+}
+
+// DrawWithPoints is like Draw, but it triangulates the provided points, like facial landmarks or other feature
+// points, instead of the ones sampled from the image edges, so the blur, the edge detection and the point sampling
+// stages are skipped. The points are relative to the top left corner of the image, the ones outside of it being
+// dropped, while the image corners are always part of the triangulation.
+func (im *Image) DrawWithPoints(src image.Image, pts []Point, proc Processor, fn Fn) (image.Image, []Triangle, []Point, error) {
+	if pts == nil {
+		pts = []Point{}
 	}
+	return im.draw(context.Background(), src, pts, proc, fn, nil)
+}
 
-	// Define a new context and fill it with a background color.
-	ctx := gg.NewContext(width, height)
-	ctx.DrawRectangle(0, 0, float64(width), float64(height))
+// DrawInto is like Draw, but it renders the triangles into the destination image instead of a newly allocated one,
+// which is useful for the reused buffers, like the video frames. The output is scaled to the size of the destination
+// image, replacing the OutputWidth and OutputHeight options, and it overwrites the whole destination image.
+// The triangles are rendered directly into the *image.RGBA images owning their pixel buffer, while the other
+// images, like the sub-images, are overwritten by copying the rendered image over them.
+func (im *Image) DrawInto(dst draw.Image, src image.Image, proc Processor) ([]Triangle, []Point, error) {
+	b := dst.Bounds()
+	proc.OutputWidth, proc.OutputHeight = b.Dx(), b.Dy()
 
-	if im.BgColor != "" {
-		ctx.SetRGBA(1, 1, 1, 1)
-	} else {
-		ctx.SetRGBA(0, 0, 0, 0)
+	target, ok := dst.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) || target.Stride != 4*b.Dx() {
+		target = nil
 	}
-	ctx.Fill()
+	img, triangles, points, err := im.draw(context.Background(), src, nil, proc, func() {}, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rgba, ok := img.(*image.RGBA); !ok || target == nil || rgba != target {
+		draw.Draw(dst, b, img, img.Bounds().Min, draw.Src)
+	}
+	return triangles, points, nil
+}
 
-	img, triangles, points := genTriangles(src, proc)
-	if len(triangles) == 0 {
-		return img, nil, nil, err
+// draw triangulates the source image and renders the triangles. In case the points are nil, the Points of the
+// processor are triangulated, or the points are sampled from the image edges in case they're not defined either,
+// otherwise the provided points are triangulated. The triangles are rendered into dst in case it's not nil, which
+// must have the output size, otherwise into a new image.
+func (im *Image) draw(ctx context.Context, src image.Image, pts []Point, proc Processor, fn Fn, dst *image.RGBA) (image.Image, []Triangle, []Point, error) {
+	t, err := triangulateImage(ctx, src, pts, proc)
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	return im.render(t, fn, dst)
+}
 
-	for _, t := range triangles {
-		p0, p1, p2 := t.Nodes[0], t.Nodes[1], t.Nodes[2]
+// render renders the triangles of the triangulation into dst in case it's not nil, which must have the output size,
+// otherwise into a new image.
+func (im *Image) render(t *triangulation, fn Fn, dst *image.RGBA) (image.Image, []Triangle, []Point, error) {
+	var err error
+	src, img, triangles, points, proc := t.src, t.img, t.triangles, t.points, t.proc
+	start, sampling := t.start, t.sampling
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
 
-		ctx.Push()
-		ctx.MoveTo(float64(p0.X), float64(p0.Y))
-		ctx.LineTo(float64(p1.X), float64(p1.Y))
-		ctx.LineTo(float64(p2.X), float64(p2.Y))
-		ctx.LineTo(float64(p0.X), float64(p0.Y))
+	// In case no points are requested, the blurred source image is returned without triangulation.
+	if t.blurred() {
+		proc.Stats.finish(start, sampling)
+		fn()
+		return img, nil, nil, nil
+	}
 
-		cx := float64(p0.X+p1.X+p2.X) * 0.33333
-		cy := float64(p0.Y+p1.Y+p2.Y) * 0.33333
+	outWidth, outHeight := proc.outputSize(width, height)
+	if im.Output16Bit {
+		newImg, err := im.draw64(src, img, triangles, outWidth, outHeight, !proc.Region.Empty())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		proc.Stats.finish(start, sampling)
+		fn()
+		return newImg, triangles, points, nil
+	}
 
-		j := (int(cx) + int(cy)*width) * 4
-		r, g, b, a := img.Pix[j], img.Pix[j+1], img.Pix[j+2], img.Pix[j+3]
-		if im.IsStrokeSolid {
-			strokeColor = color.RGBA{R: 0, G: 0, B: 0, A: 255}
-		} else {
-			strokeColor = color.RGBA{R: r, G: g, B: b, A: 255}
+	// Define a new context and fill it with a background color. The background replaces the pixels of the
+	// destination image, which might be reused, instead of being composited over them.
+	var bg color.Color = color.Transparent
+	if im.BgColor != "" {
+		if bg, err = ParseHexColor(im.BgColor); err != nil {
+			return nil, nil, nil, err
 		}
+	}
+	if dst == nil {
+		dst = image.NewRGBA(image.Rect(0, 0, outWidth, outHeight))
+	}
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	dc := gg.NewContextForRGBA(dst)
 
-		switch im.Wireframe {
-		case WithoutWireframe:
-			if a != 0 {
-				ctx.SetFillStyle(gg.NewSolidPattern(color.RGBA{R: r, G: g, B: b, A: 255}))
-			} else if im.BgColor != "" {
-				ctx.SetHexColor(im.BgColor)
-			}
-			ctx.FillPreserve()
-			ctx.Fill()
-		case WithWireframe:
-			if a != 0 {
-				ctx.SetFillStyle(gg.NewSolidPattern(color.RGBA{R: r, G: g, B: b, A: 255}))
-				ctx.SetStrokeStyle(gg.NewSolidPattern(color.RGBA{R: 0, G: 0, B: 0, A: 20}))
-			} else if im.BgColor != "" {
-				ctx.SetHexColor(im.BgColor)
-			}
-			ctx.SetLineWidth(im.StrokeWidth)
-			ctx.FillPreserve()
-			ctx.StrokePreserve()
-			ctx.Stroke()
-		case WireframeOnly:
-			if a != 0 {
-				ctx.SetStrokeStyle(gg.NewSolidPattern(strokeColor))
-			} else if im.BgColor != "" {
-				ctx.SetHexColor(im.BgColor)
-			}
-			ctx.SetLineWidth(im.StrokeWidth)
-			ctx.StrokePreserve()
-			ctx.Stroke()
+	// Scale the triangles coordinates to the output size.
+	sx, sy := float64(outWidth)/float64(width), float64(outHeight)/float64(height)
+	dc.Scale(sx, sy)
+
+	// The triangulated region is composited over the source image.
+	if !proc.Region.Empty() {
+		dc.DrawImage(src, -src.Bounds().Min.X, -src.Bounds().Min.Y)
+	}
+
+	// The cells of the Voronoi diagram dual to the triangulation or the hexagonal cells are drawn instead of the triangles.
+	pal := im.fillPalette(img)
+	switch {
+	case im.Voronoi:
+		im.drawCells(dc, img, pal, NewVoronoiDiagram(triangles).Cells)
+		im.fillTriangles(img, pal, triangles)
+	case proc.Tessellation == HexGrid:
+		region := src.Bounds().Sub(src.Bounds().Min)
+		if !proc.Region.Empty() {
+			region = proc.Region.Sub(src.Bounds().Min).Intersect(region)
 		}
-		ctx.Pop()
+		im.drawCells(dc, img, pal, hexCells(region, proc.CellSize))
+		im.fillTriangles(img, pal, triangles)
+	default:
+		im.drawTriangles(dc.Image().(*image.RGBA), img, pal, triangles, sx, sy)
 	}
+	drawDots(dc, im.pointDots(img, pal, points))
+	drawContours(dc, t.contours, im.plotterColor(), Max(im.StrokeWidth, 1))
+
+	newImg := dc.Image()
 
-	newImg := ctx.Image()
+	// Blend the triangles over the source image scaled to the output size.
+	if im.Overlay > 0 && im.Overlay < 1 {
+		base := gg.NewContext(outWidth, outHeight)
+		base.Scale(float64(outWidth)/float64(width), float64(outHeight)/float64(height))
+		base.DrawImage(src, -src.Bounds().Min.X, -src.Bounds().Min.Y)
+		blendLayer(newImg.(*image.RGBA), base.Image().(*image.RGBA), im.Overlay)
+	}
 
 	// Apply a noise on the final image.
 	if im.Noise > 0 {
-		addNoise(im.Noise, newImg.(*image.RGBA))
+		addNoise(im.Noise, im.NoiseChromatic, im.NoiseSeed, newImg.(*image.RGBA))
+	}
+	if im.ClipShape != NoClip {
+		im.clipImage(newImg.(*image.RGBA))
 	}
+	proc.Stats.finish(start, sampling)
 	fn()
 	return newImg, triangles, points, err
 }
@@ -200,39 +586,76 @@ func (im *Image) DecodeImage(input io.Reader) (image.Image, error) {
 // for further processing, like opening the generated SVG file in the web browser.
 // It returns the number of triangles generated, the number of points and the error in case exists.
 func (svg *SVG) Draw(src image.Image, proc Processor, fn Fn) (image.Image, []Triangle, []Point, error) {
+	return svg.DrawContext(context.Background(), src, proc, fn)
+}
+
+// DrawContext is like Draw, but it aborts the triangulation process as soon as the context
+// is cancelled or its deadline is exceeded, returning the context error.
+func (svg *SVG) DrawContext(ctx context.Context, src image.Image, proc Processor, fn Fn) (image.Image, []Triangle, []Point, error) {
+	if err := svg.supported(); err != nil {
+		return nil, nil, nil, err
+	}
+	t, err := triangulateImage(ctx, src, nil, proc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return svg.render(t, fn)
+}
+
+// supported returns an error in case the processor options of the SVG can't be rendered as SVG.
+func (svg *SVG) supported() error {
+	if svg.Voronoi {
+		return errors.New("the Voronoi diagram is not supported by the SVG output")
+	}
+	if svg.Tessellation == HexGrid {
+		return errors.New("the HexGrid tessellation is not supported by the SVG output")
+	}
+	return nil
+}
+
+// render generates the SVG elements of the triangulation.
+func (svg *SVG) render(t *triangulation, fn Fn) (image.Image, []Triangle, []Point, error) {
 	var (
 		err         error
 		lines       []Line
 		fillColor   color.RGBA
 		strokeColor color.RGBA
 	)
-
+	src, img, triangles, points, proc := t.src, t.img, t.triangles, t.points, t.proc
+	start, sampling := t.start, t.sampling
 	width, height := src.Bounds().Dx(), src.Bounds().Dy()
-	if width <= 1 || height <= 1 {
-		err := errors.New("The image width and height must be greater than 1px.\n")
-		return nil, nil, nil, err
+
+	svg.Width, svg.Height = proc.outputSize(width, height)
+	svg.ViewBoxWidth = width
+	svg.ViewBoxHeight = height
+
+	svg.preview = ""
+	if svg.EmbedPreview && !svg.PlotterMode {
+		if svg.preview, err = encodePreview(src); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
-	ctx := gg.NewContext(width, height)
-	ctx.DrawRectangle(0, 0, float64(width), float64(height))
-	ctx.SetRGBA(1, 1, 1, 1)
-	ctx.Fill()
+	// In case no points are requested, the SVG remains empty and only the blurred source image is returned.
+	if t.blurred() {
+		svg.Lines, svg.shades, svg.dots, svg.contours = nil, nil, nil, nil
 
-	img, triangles, points := genTriangles(src, proc)
-	if len(triangles) == 0 {
-		return img, nil, nil, err
+		proc.Stats.finish(start, sampling)
+		fn()
+		return img, nil, nil, nil
 	}
 
-	for _, t := range triangles {
+	pal := svg.fillPalette(img)
+	svg.shades = nil
+	for i, t := range triangles {
 		p0, p1, p2 := t.Nodes[0], t.Nodes[1], t.Nodes[2]
-		cx := float64(p0.X+p1.X+p2.X) * 0.33333
-		cy := float64(p0.Y+p1.Y+p2.Y) * 0.33333
 
-		j := ((int(cx) | 0) + (int(cy)|0)*width) * 4
-		r, g, b := img.Pix[j], img.Pix[j+1], img.Pix[j+2]
+		ct := svg.colorTriangle(img, pal, i, t)
+		triangles[i].fill = ct.fill
+		r, g, b := ct.fill.R, ct.fill.G, ct.fill.B
 
-		if svg.IsStrokeSolid {
-			strokeColor = color.RGBA{R: 0, G: 0, B: 0, A: 255}
+		if svg.hasStrokeColor() {
+			strokeColor = ct.Stroke
 		} else {
 			strokeColor = color.RGBA{R: r, G: g, B: b, A: 255}
 		}
@@ -243,6 +666,9 @@ func (svg *SVG) Draw(src image.Image, proc Processor, fn Fn) (image.Image, []Tri
 		case WireframeOnly:
 			fillColor = color.RGBA{R: 255, G: 255, B: 255, A: 255}
 		}
+		if svg.Shading == SmoothShading && svg.Wireframe != WireframeOnly {
+			svg.shades = append(svg.shades, svg.vertexColors(img, pal, t))
+		}
 		lines = append(lines, []Line{
 			{
 				Node{p0.X, p0.Y},
@@ -254,61 +680,411 @@ func (svg *SVG) Draw(src image.Image, proc Processor, fn Fn) (image.Image, []Tri
 			},
 		}...)
 	}
-	svg.Width = width
-	svg.Height = height
 	svg.Lines = lines
+	svg.dots = svg.pointDots(img, pal, points)
+	svg.contours = t.contours
+	proc.Stats.finish(start, sampling)
 
 	// Trigger the callback function after the generation is completed.
 	fn()
 	return img, triangles, points, err
 }
 
+// triangulation is the result of the triangulation of the source image, which is rendered by the raster and the SVG
+// outputs alike, so the same triangles can be rendered to both of them.
+type triangulation struct {
+	// src is the source image, rotated, flipped and padded as requested by the processor.
+	src image.Image
+	// img is the image the colors of the triangles are sampled from.
+	img       *image.NRGBA
+	triangles []Triangle
+	points    []Point
+	// contours are the lines traced along the strongest edges in case of the TraceContours option.
+	contours [][]Node
+	proc     Processor
+	// start and sampling are the times the triangulation started and ended at.
+	start, sampling time.Time
+}
+
+// triangulateImage transforms the source image as requested by the processor and triangulates it. In case the points
+// are nil, the Points of the processor are triangulated, or the points are sampled from the image edges in case they're
+// not defined either, otherwise the provided points are triangulated.
+func triangulateImage(ctx context.Context, src image.Image, pts []Point, proc Processor) (*triangulation, error) {
+	var err error
+
+	if err := proc.Validate(); err != nil {
+		return nil, err
+	}
+	src = rotateFlip(src, proc.Rotate, proc.FlipH, proc.FlipV)
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	if width <= 1 || height <= 1 {
+		return nil, errors.New("The image width and height must be greater than 1px.\n")
+	}
+
+	if pts != nil {
+		proc.Points = pts
+	}
+	if src, proc, err = proc.padSquare(src); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	s := new(scratch)
+	img, triangles, points, err := s.triangulate(ctx, src, proc)
+	if err != nil {
+		return nil, err
+	}
+	return &triangulation{
+		src:       src,
+		img:       img,
+		triangles: triangles,
+		points:    points,
+		contours:  s.contours,
+		proc:      proc,
+		start:     start,
+		sampling:  time.Now(),
+	}, nil
+}
+
+// blurred reports whether no points were requested, in which case the image holds the blurred source image.
+func (t *triangulation) blurred() bool {
+	b := t.src.Bounds()
+	return t.proc.Points == nil && t.proc.maxPoints(b.Dx(), b.Dy()) < 1
+}
+
 // DecodeImage calls the decodeImage utility function which
 // decodes an image file type to the generic image.Image type.
 func (svg *SVG) DecodeImage(input io.Reader) (image.Image, error) {
 	return decodeImage(input)
 }
 
-// decodeImage decodes an input argument of type io.Reader to an image.
-func decodeImage(input io.Reader) (image.Image, error) {
-	src, _, err := image.Decode(input)
+// ErrInvalidOption is returned, wrapped with the name of the offending field, by the Validate method.
+var ErrInvalidOption = errors.New("invalid processor option")
+
+// Validate checks if the processor fields are within their accepted ranges.
+// It returns an error naming the first invalid field, which wraps ErrInvalidOption.
+func (p Processor) Validate() error {
+	switch {
+	case p.BlurRadius < 0:
+		return fmt.Errorf("%w: BlurRadius must not be negative, got %v", ErrInvalidOption, p.BlurRadius)
+	case p.BlurType < StackBlurType || p.BlurType > GaussianBlurType:
+		return fmt.Errorf("%w: BlurType must be StackBlurType or GaussianBlurType, got %v", ErrInvalidOption, p.BlurType)
+	case p.BlurPasses < 0:
+		return fmt.Errorf("%w: BlurPasses must not be negative, got %v", ErrInvalidOption, p.BlurPasses)
+	case p.SobelThreshold < 0:
+		return fmt.Errorf("%w: SobelThreshold must not be negative, got %v", ErrInvalidOption, p.SobelThreshold)
+	case p.EdgeDetector < SobelOperator || p.EdgeDetector > CannyOperator:
+		return fmt.Errorf("%w: EdgeDetector must be SobelOperator, ScharrOperator, PrewittOperator or CannyOperator, got %v", ErrInvalidOption, p.EdgeDetector)
+	case p.EdgeBias < NoEdgeBias || p.EdgeBias > VerticalEdgeBias:
+		return fmt.Errorf("%w: EdgeBias must be NoEdgeBias, HorizontalEdgeBias or VerticalEdgeBias, got %v", ErrInvalidOption, p.EdgeBias)
+	case p.CannyLowThreshold < 0 || p.CannyLowThreshold > 255:
+		return fmt.Errorf("%w: CannyLowThreshold must be between 0 and 255, got %v", ErrInvalidOption, p.CannyLowThreshold)
+	case p.CannyHighThreshold < p.CannyLowThreshold || p.CannyHighThreshold > 255:
+		return fmt.Errorf("%w: CannyHighThreshold must be between CannyLowThreshold and 255, got %v", ErrInvalidOption, p.CannyHighThreshold)
+	case p.PointsThreshold < 0 || p.PointsThreshold > 255:
+		return fmt.Errorf("%w: PointsThreshold must be between 0 and 255, got %v", ErrInvalidOption, p.PointsThreshold)
+	case p.PointRate <= 0 || p.PointRate > 1 || math.IsNaN(p.PointRate):
+		return fmt.Errorf("%w: PointRate must be in the (0, 1] range, got %v", ErrInvalidOption, p.PointRate)
+	case p.BlurFactor < 0:
+		return fmt.Errorf("%w: BlurFactor must not be negative, got %v", ErrInvalidOption, p.BlurFactor)
+	case p.EdgeFactor < 1:
+		return fmt.Errorf("%w: EdgeFactor must be greater than 0, got %v", ErrInvalidOption, p.EdgeFactor)
+	case p.CustomEdgeKernel != nil && !isOddSquare(len(p.CustomEdgeKernel)):
+		return fmt.Errorf("%w: CustomEdgeKernel must be a square matrix having an odd side, got %d values", ErrInvalidOption, len(p.CustomEdgeKernel))
+	case p.MaxPoints < 0:
+		return fmt.Errorf("%w: MaxPoints must not be negative, got %v", ErrInvalidOption, p.MaxPoints)
+	case p.PointsPerMegapixel < 0:
+		return fmt.Errorf("%w: PointsPerMegapixel must not be negative, got %v", ErrInvalidOption, p.PointsPerMegapixel)
+	case p.MinPointDistance < 0:
+		return fmt.Errorf("%w: MinPointDistance must not be negative, got %v", ErrInvalidOption, p.MinPointDistance)
+	case !(p.BackgroundCoarsening >= 0 && p.BackgroundCoarsening <= 1):
+		return fmt.Errorf("%w: BackgroundCoarsening must be in the [0, 1] range, got %v", ErrInvalidOption, p.BackgroundCoarsening)
+	case p.PointSelection < RandomSelection || p.PointSelection > TopGradient:
+		return fmt.Errorf("%w: PointSelection must be RandomSelection, FarthestPoint or TopGradient, got %v", ErrInvalidOption, p.PointSelection)
+	case p.BackgroundCoarsening > 0 && p.PointSelection != RandomSelection:
+		return fmt.Errorf("%w: BackgroundCoarsening requires the RandomSelection, got %v", ErrInvalidOption, p.PointSelection)
+	case p.MaxDimension < 0 || p.MaxDimension == 1:
+		return fmt.Errorf("%w: MaxDimension must be 0 or at least 2, got %v", ErrInvalidOption, p.MaxDimension)
+	case p.ColorSampling < CentroidColor || p.ColorSampling > DominantColor:
+		return fmt.Errorf("%w: ColorSampling must be CentroidColor, AverageColor or DominantColor, got %v", ErrInvalidOption, p.ColorSampling)
+	case p.FillMode < SourceColor || p.FillMode > FacetNormal:
+		return fmt.Errorf("%w: FillMode must be SourceColor, FacetIndex or FacetNormal, got %v", ErrInvalidOption, p.FillMode)
+	case p.FillMode != SourceColor && p.Shading == SmoothShading:
+		return fmt.Errorf("%w: FillMode other than SourceColor is not supported by the SmoothShading", ErrInvalidOption)
+	case p.Shading != FlatShading && p.Shading != SmoothShading:
+		return fmt.Errorf("%w: Shading must be FlatShading or SmoothShading, got %v", ErrInvalidOption, p.Shading)
+	case p.LuminanceMode < Rec601Luminance || p.LuminanceMode > LinearLuminance:
+		return fmt.Errorf("%w: LuminanceMode must be Rec601Luminance, Rec709Luminance or LinearLuminance, got %v", ErrInvalidOption, p.LuminanceMode)
+	case p.SamplingMethod < EdgeSampling || p.SamplingMethod > UniformGrid:
+		return fmt.Errorf("%w: SamplingMethod must be EdgeSampling or UniformGrid, got %v", ErrInvalidOption, p.SamplingMethod)
+	case p.Tessellation < DelaunayTessellation || p.Tessellation > TriGrid:
+		return fmt.Errorf("%w: Tessellation must be DelaunayTessellation, HexGrid or TriGrid, got %v", ErrInvalidOption, p.Tessellation)
+	case p.Tessellation != DelaunayTessellation && p.CellSize < 2:
+		return fmt.Errorf("%w: CellSize must be at least 2 pixels for the grid tessellations, got %v", ErrInvalidOption, p.CellSize)
+	case p.Tessellation == HexGrid && (p.Output16Bit || p.Voronoi):
+		return fmt.Errorf("%w: HexGrid is not supported by the 16-bit output and the Voronoi diagram", ErrInvalidOption)
+	case p.MergeTolerance < 0 || math.IsNaN(p.MergeTolerance):
+		return fmt.Errorf("%w: MergeTolerance must not be negative, got %v", ErrInvalidOption, p.MergeTolerance)
+	case p.MergeTolerance > 0 && p.Shading == SmoothShading:
+		return fmt.Errorf("%w: MergeTolerance is not supported by the SmoothShading", ErrInvalidOption)
+	case p.PointRadius < 0 || math.IsNaN(p.PointRadius):
+		return fmt.Errorf("%w: PointRadius must not be negative, got %v", ErrInvalidOption, p.PointRadius)
+	case p.ShowPoints && p.Output16Bit:
+		return fmt.Errorf("%w: ShowPoints is not supported by the 16-bit output", ErrInvalidOption)
+	case p.TraceContours && p.Output16Bit:
+		return fmt.Errorf("%w: TraceContours is not supported by the 16-bit output", ErrInvalidOption)
+	case p.Wireframe < WithoutWireframe || p.Wireframe > WireframeOnly:
+		return fmt.Errorf("%w: Wireframe must be WithoutWireframe, WithWireframe or WireframeOnly, got %v", ErrInvalidOption, p.Wireframe)
+	case p.Noise < 0:
+		return fmt.Errorf("%w: Noise must not be negative, got %v", ErrInvalidOption, p.Noise)
+	case p.StrokeWidth < 0:
+		return fmt.Errorf("%w: StrokeWidth must not be negative, got %v", ErrInvalidOption, p.StrokeWidth)
+	case p.OutputWidth < 0:
+		return fmt.Errorf("%w: OutputWidth must not be negative, got %v", ErrInvalidOption, p.OutputWidth)
+	case p.OutputHeight < 0:
+		return fmt.Errorf("%w: OutputHeight must not be negative, got %v", ErrInvalidOption, p.OutputHeight)
+	case p.BgColor != "" && !isHexColor(p.BgColor):
+		return fmt.Errorf("%w: BgColor must be a #rgb, #rrggbb or #rrggbbaa hex color, got %q", ErrInvalidOption, p.BgColor)
+	case p.PadColor != "" && !isHexColor(p.PadColor):
+		return fmt.Errorf("%w: PadColor must be a #rgb, #rrggbb or #rrggbbaa hex color, got %q", ErrInvalidOption, p.PadColor)
+	case p.Rotate != 0 && p.Rotate != 90 && p.Rotate != 180 && p.Rotate != 270:
+		return fmt.Errorf("%w: Rotate must be 0, 90, 180 or 270, got %v", ErrInvalidOption, p.Rotate)
+	case p.StrokeColor != "" && !isHexColor(p.StrokeColor):
+		return fmt.Errorf("%w: StrokeColor must be a #rgb, #rrggbb or #rrggbbaa hex color, got %q", ErrInvalidOption, p.StrokeColor)
+	case p.SolidStrokeColor != "" && !isHexColor(p.SolidStrokeColor):
+		return fmt.Errorf("%w: SolidStrokeColor must be a #rgb, #rrggbb or #rrggbbaa hex color, got %q", ErrInvalidOption, p.SolidStrokeColor)
+	case !(p.StrokeOpacity >= 0 && p.StrokeOpacity <= 1):
+		return fmt.Errorf("%w: StrokeOpacity must be between 0 and 1, got %v", ErrInvalidOption, p.StrokeOpacity)
+	case p.Quality < 0 || p.Quality > 100:
+		return fmt.Errorf("%w: Quality must be between 0 and 100, got %v", ErrInvalidOption, p.Quality)
+	case p.RelaxationPasses < 0:
+		return fmt.Errorf("%w: RelaxationPasses must not be negative, got %v", ErrInvalidOption, p.RelaxationPasses)
+	case p.MinTriangleArea < 0 || math.IsNaN(p.MinTriangleArea):
+		return fmt.Errorf("%w: MinTriangleArea must not be negative, got %v", ErrInvalidOption, p.MinTriangleArea)
+	case p.ClipShape < NoClip || p.ClipShape > RoundedRectClip:
+		return fmt.Errorf("%w: ClipShape must be NoClip, CircleClip or RoundedRectClip, got %v", ErrInvalidOption, p.ClipShape)
+	case p.ClipRadius < 0 || math.IsNaN(p.ClipRadius):
+		return fmt.Errorf("%w: ClipRadius must not be negative, got %v", ErrInvalidOption, p.ClipRadius)
+	case !(p.Overlay >= 0 && p.Overlay <= 1):
+		return fmt.Errorf("%w: Overlay must be between 0 and 1, got %v", ErrInvalidOption, p.Overlay)
+	case p.PaletteSize < 0:
+		return fmt.Errorf("%w: PaletteSize must not be negative, got %v", ErrInvalidOption, p.PaletteSize)
+	case p.Posterize < 0 || p.Posterize == 1 || p.Posterize > 256:
+		return fmt.Errorf("%w: Posterize must be 0 or between 2 and 256, got %v", ErrInvalidOption, p.Posterize)
+	case p.Voronoi && p.Output16Bit:
+		return fmt.Errorf("%w: Voronoi is not supported by the 16-bit output", ErrInvalidOption)
+	case p.Frames < 0:
+		return fmt.Errorf("%w: Frames must not be negative, got %v", ErrInvalidOption, p.Frames)
+	case p.Region != image.Rectangle{} && p.Region.Empty():
+		return fmt.Errorf("%w: Region must not be empty, got %v", ErrInvalidOption, p.Region)
+	case p.Precision < 0:
+		return fmt.Errorf("%w: Precision must not be negative, got %v", ErrInvalidOption, p.Precision)
+	}
+	return nil
+}
+
+// isOddSquare checks if n is the square of an odd number, like the number of values of a centered square kernel.
+func isOddSquare(n int) bool {
+	side := int(math.Sqrt(float64(n)))
+	return side*side == n && side%2 == 1
+}
+
+// ParseHexColor parses a color defined in hexadecimal format, like #rgb, #rrggbb or #rrggbbaa.
+// The leading hash sign is optional. In case the alpha channel is not defined the color is opaque.
+func ParseHexColor(hex string) (color.RGBA, error) {
+	if !isHexColor(hex) {
+		return color.RGBA{}, fmt.Errorf("invalid hex color: %q", hex)
+	}
+
+	hex = strings.TrimPrefix(hex, "#")
+	switch len(hex) {
+	case 3:
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2], 'f', 'f'})
+	case 6:
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
 	if err != nil {
-		return nil, err
+		return color.RGBA{}, fmt.Errorf("invalid hex color: %q", hex)
 	}
-	return src, nil
+
+	c := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(c).(color.RGBA), nil
 }
 
-// genTriangles generates the triangles and returns the triangles and points slices.
-func genTriangles(src image.Image, p Processor) (*image.NRGBA, []Triangle, []Point) {
-	var srcImg *image.NRGBA
-	delaunay := &Delaunay{}
+// isHexColor checks if the string is a valid #rgb, #rrggbb or #rrggbbaa hex color.
+func isHexColor(hex string) bool {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 3 && len(hex) != 6 && len(hex) != 8 {
+		return false
+	}
+	for _, c := range hex {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
 
-	img := ImgToNRGBA(src)
-	w, h := img.Bounds().Max.X, img.Bounds().Max.Y
+// maxPoints returns the maximum number of points generated on the source image of the provided size, which is
+// proportional to its resolution in case the PointsPerMegapixel is defined, otherwise it's the MaxPoints.
+// The grid tessellations place the number of the grid nodes instead.
+func (p Processor) maxPoints(width, height int) int {
+	if p.Tessellation != DelaunayTessellation {
+		return latticeSize(width, height, p.CellSize)
+	}
+	if p.PointsPerMegapixel > 0 {
+		return Max(round(float64(p.PointsPerMegapixel)*float64(width)*float64(height)/1e6), 1)
+	}
+	return p.MaxPoints
+}
+
+// outputSize returns the size of the rendered image based on the source image size and the output dimensions.
+func (p Processor) outputSize(width, height int) (int, int) {
+	switch {
+	case p.OutputWidth > 0 && p.OutputHeight > 0:
+		return p.OutputWidth, p.OutputHeight
+	case p.OutputWidth > 0:
+		return p.OutputWidth, Max(round(float64(height*p.OutputWidth)/float64(width)), 1)
+	case p.OutputHeight > 0:
+		return Max(round(float64(width*p.OutputHeight)/float64(height)), 1), p.OutputHeight
+	}
+	return width, height
+}
+
+// reduceSize returns the size the source image is reduced to by the MaxDimension option, keeping its aspect ratio,
+// and whether it's reduced at all.
+func (p Processor) reduceSize(width, height int) (int, int, bool) {
+	d := Max(width, height)
+	if p.MaxDimension <= 0 || d <= p.MaxDimension || p.Tessellation != DelaunayTessellation {
+		return width, height, false
+	}
+	scale := float64(p.MaxDimension) / float64(d)
+	return Max(round(float64(width)*scale), 2), Max(round(float64(height)*scale), 2), true
+}
+
+// scaled returns the processor having the options defined in pixels of the source image scaled by sx and sy,
+// for processing the image resized by them.
+func (p Processor) scaled(sx, sy float64, origin image.Point) Processor {
+	if !p.Region.Empty() {
+		r := p.Region.Sub(origin)
+		p.Region = image.Rect(
+			int(math.Floor(float64(r.Min.X)*sx)), int(math.Floor(float64(r.Min.Y)*sy)),
+			int(math.Ceil(float64(r.Max.X)*sx)), int(math.Ceil(float64(r.Max.Y)*sy)),
+		)
+	}
+	if p.Mask != nil {
+		// The mask is aligned to the top-left corner of the source image, so it's sampled at the same pixels.
+		w, h := Max(round(float64(p.Mask.Rect.Dx())*sx), 1), Max(round(float64(p.Mask.Rect.Dy())*sy), 1)
+		mask := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				mask.SetGray(x, y, p.Mask.GrayAt(p.Mask.Rect.Min.X+int((float64(x)+0.5)/sx), p.Mask.Rect.Min.Y+int((float64(y)+0.5)/sy)))
+			}
+		}
+		p.Mask = mask
+	}
+	if p.MinPointDistance > 0 {
+		p.MinPointDistance = Max(round(float64(p.MinPointDistance)*math.Min(sx, sy)), 1)
+	}
+	p.MinTriangleArea *= sx * sy
+	return p
+}
+
+// padSquare pads the source image to a square canvas filled with the PadColor in case the PadToSquare option is
+// enabled, returning the padded image and the processor restricting the triangulation to the area of the source
+// image, having its Points moved to the position of the source image on the canvas. Otherwise the source image
+// and the processor are returned.
+func (p Processor) padSquare(src image.Image) (image.Image, Processor, error) {
+	b := src.Bounds()
+	if !p.PadToSquare || b.Dx() == b.Dy() {
+		return src, p, nil
+	}
+	size := Max(b.Dx(), b.Dy())
+	off := image.Pt((size-b.Dx())/2, (size-b.Dy())/2)
+
+	// A region defined on the source image is kept, moved to the position of the source image on the canvas.
+	region := b.Sub(b.Min)
+	if !p.Region.Empty() {
+		if region = p.Region.Sub(b.Min).Intersect(region); region.Empty() {
+			return nil, p, fmt.Errorf("the region %v does not overlap the image", p.Region)
+		}
+	}
+	p.Region = region.Add(off)
 
-	newimg := image.NewNRGBA(img.Bounds())
-	draw.Draw(newimg, img.Bounds(), img, image.Point{}, draw.Src)
+	// The points are moved together with the image, the points outside of it being dropped. The corners of the
+	// image are added, so the triangles don't span across the image and the padding.
+	if p.Points != nil {
+		w, h := float64(b.Dx()), float64(b.Dy())
+		moved := make([]Point, 0, len(p.Points)+4)
+		for _, list := range [][]Point{p.Points, {{0, 0}, {w, 0}, {w, h}, {0, h}}} {
+			for _, pt := range list {
+				if pt.X >= 0 && pt.Y >= 0 && pt.X <= w && pt.Y <= h {
+					moved = append(moved, Point{X: pt.X + float64(off.X), Y: pt.Y + float64(off.Y)})
+				}
+			}
+		}
+		p.Points = moved
+	}
 
-	blur := StackBlur(img, uint32(p.BlurRadius))
-	if p.MaxPoints < 1 {
-		return blur, nil, nil
+	var padColor color.Color = color.Transparent
+	if p.PadColor != "" {
+		c, err := ParseHexColor(p.PadColor)
+		if err != nil {
+			return nil, p, err
+		}
+		padColor = c
 	}
 
-	gray := Grayscale(blur)
-	if p.Grayscale {
-		srcImg = gray
-	} else {
-		srcImg = newimg
+	// The precision of the 16-bit images is preserved.
+	var dst draw.Image = image.NewNRGBA(image.Rect(0, 0, size, size))
+	if is16Bit(src) {
+		dst = image.NewNRGBA64(image.Rect(0, 0, size, size))
 	}
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: padColor}, image.Point{}, draw.Src)
+	draw.Draw(dst, b.Sub(b.Min).Add(off), src, b.Min, draw.Src)
 
-	blurMatrix := setBlurMatrix(p.BlurFactor)
-	edgeMatrix := setEdgeMatrix(p.EdgeFactor)
+	return dst, p, nil
+}
 
-	convolutionFilter(blurMatrix, img, float64(len(blurMatrix)))
-	convolutionFilter(edgeMatrix, img, float64(p.EdgeFactor))
+// decodeImage decodes an input argument of type io.Reader to an image.
+// The JPEG images are rotated and flipped upright according to their EXIF orientation,
+// since the photos taken in portrait mode are stored sideways.
+func decodeImage(input io.Reader) (image.Image, error) {
+	b, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	src, format, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		if format == "" {
+			format = sniffFormat(b)
+		}
+		if format == "" {
+			return nil, fmt.Errorf("unable to decode the image, the format is not recognized: %w", err)
+		}
+		return nil, fmt.Errorf("unable to decode the %s image: %w", format, err)
+	}
+	if format == "jpeg" {
+		src = orient(src, jpegOrientation(b))
+	}
+	return src, nil
+}
 
-	points := p.GetPoints(img, p.PointsThreshold, p.MaxPoints)
-	triangles := delaunay.Init(w, h).Insert(points).GetTriangles()
+// sniffFormat returns the name of the image format recognized from the header of the data, for the formats
+// which are not registered for decoding, or an empty string in case the format is not recognized.
+func sniffFormat(b []byte) string {
+	switch {
+	case len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "WEBP":
+		return "webp"
+	case bytes.HasPrefix(b, []byte("II*\x00")) || bytes.HasPrefix(b, []byte("MM\x00*")):
+		return "tiff"
+	}
+	return ""
+}
 
-	return srcImg, triangles, points
+// genTriangles runs the triangulation pipeline on the source image using newly allocated buffers.
+func genTriangles(ctx context.Context, src image.Image, p Processor) (*image.NRGBA, []Triangle, []Point, error) {
+	return new(scratch).triangulate(ctx, src, p)
 }
@@ -0,0 +1,1096 @@
+package triangle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestImage returns an image with a bright rectangle drawn over a dark background.
+func newTestImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 20, G: 40, B: 60, A: 255}
+			if x > w/4 && x < w*3/4 && y > h/4 && y < h*3/4 {
+				c = color.NRGBA{R: 220, G: 200, B: 180, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// newTestProcessor returns a processor initialized with the CLI default values.
+func newTestProcessor() Processor {
+	return Processor{
+		BlurRadius:      2,
+		SobelThreshold:  10,
+		PointsThreshold: 10,
+		PointRate:       0.075,
+		BlurFactor:      1,
+		EdgeFactor:      6,
+		MaxPoints:       2500,
+		StrokeWidth:     1,
+	}
+}
+
+func TestDrawContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	proc := newTestProcessor()
+	drawers := map[string]Drawer{
+		"image": &Image{Processor: proc},
+		"svg":   &SVG{Processor: proc},
+	}
+	for name, drawer := range drawers {
+		completed := false
+		img, triangles, points, err := drawer.DrawContext(ctx, newTestImage(200, 200), proc, func() {
+			completed = true
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled error, got: %v", name, err)
+		}
+		if completed || img != nil || triangles != nil || points != nil {
+			t.Errorf("%s: the triangulation should not complete on a cancelled context", name)
+		}
+	}
+}
+
+func TestDraw_BlurOnly(t *testing.T) {
+	src := newTestImage(120, 80)
+	expected := StackBlur(ImgToNRGBA(newTestImage(120, 80)), 4)
+
+	proc := newTestProcessor()
+	proc.MaxPoints = 0
+	proc.BlurRadius = 4
+
+	tri := &Image{Processor: proc}
+	res, triangles, points, err := tri.Draw(src, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(triangles) != 0 || len(points) != 0 {
+		t.Errorf("expected no triangulation, got %d triangles and %d points", len(triangles), len(points))
+	}
+	if res == nil || res.Bounds().Empty() {
+		t.Fatal("expected a non-empty blurred image")
+	}
+
+	img := ImgToNRGBA(res)
+	if !img.Bounds().Eq(expected.Bounds()) {
+		t.Fatalf("expected bounds %v, got %v", expected.Bounds(), img.Bounds())
+	}
+	for i := range expected.Pix {
+		if img.Pix[i] != expected.Pix[i] {
+			t.Fatalf("the output differs from the blurred source at offset %d: %d != %d", i, img.Pix[i], expected.Pix[i])
+		}
+	}
+}
+
+func TestDraw_OutputSize(t *testing.T) {
+	proc := newTestProcessor()
+	proc.OutputWidth = 60
+
+	tri := &Image{Processor: proc}
+	res, _, _, err := tri.Draw(newTestImage(120, 80), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, h := res.Bounds().Dx(), res.Bounds().Dy(); w != 60 || h != 40 {
+		t.Errorf("expected a 60x40 output, got %dx%d", w, h)
+	}
+
+	svg := &SVG{Processor: proc}
+	if _, _, _, err := svg.Draw(newTestImage(120, 80), proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svg.Width != 60 || svg.Height != 40 || svg.ViewBoxWidth != 120 || svg.ViewBoxHeight != 80 {
+		t.Errorf("expected 60x40 SVG with a 120x80 viewBox, got %dx%d with %dx%d",
+			svg.Width, svg.Height, svg.ViewBoxWidth, svg.ViewBoxHeight)
+	}
+}
+
+func TestDraw_BgColorGaps(t *testing.T) {
+	// The strokes of the WireframeOnly mode leave the canvas uncovered between them.
+	for _, output16Bit := range []bool{false, true} {
+		proc := newTestProcessor()
+		proc.Wireframe, proc.BgColor, proc.Output16Bit = WireframeOnly, "#00ff00", output16Bit
+
+		tri := &Image{Processor: proc}
+		res, _, _, err := tri.Draw(newTestImage(160, 160), proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		img := ImgToNRGBA(res)
+		var bg, white int
+		for y := 0; y < 160; y++ {
+			for x := 0; x < 160; x++ {
+				switch img.NRGBAAt(x, y) {
+				case color.NRGBA{G: 255, A: 255}:
+					bg++
+				case color.NRGBA{R: 255, G: 255, B: 255, A: 255}:
+					white++
+				}
+			}
+		}
+		if bg < 160*160/4 || white > 0 {
+			t.Errorf("16-bit %v: expected the gaps to have the background color, got %d background and %d white pixels",
+				output16Bit, bg, white)
+		}
+	}
+}
+
+func TestDraw_PreserveTransparency(t *testing.T) {
+	const w, h = 160, 160
+
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// The top-left quadrant is fully transparent.
+			if x < w/2 && y < h/2 {
+				continue
+			}
+			src.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	// The points are sampled with a fixed seed, since the checked pixels may be covered
+	// by a triangle sampling the border of the transparent area otherwise.
+	seed := randomSeed
+	randomSeed = func() int64 { return 1 }
+	t.Cleanup(func() { randomSeed = seed })
+
+	proc := newTestProcessor()
+	for _, wireframe := range []int{WithoutWireframe, WithWireframe, WireframeOnly} {
+		tri := &Image{Processor: proc}
+		tri.Wireframe = wireframe
+		res, _, _, err := tri.Draw(src, proc, func() {})
+		if err != nil {
+			t.Fatalf("wireframe %d: unexpected error: %v", wireframe, err)
+		}
+
+		img := ImgToNRGBA(res)
+		if a := img.NRGBAAt(w/8, h/8).A; a > 10 {
+			t.Errorf("wireframe %d: expected a transparent pixel in the transparent quadrant, got alpha %d", wireframe, a)
+		}
+		// Only the triangles sampling the border of the opaque region cover the transparent quadrant.
+		var covered int
+		for y := 0; y < h/2; y++ {
+			for x := 0; x < w/2; x++ {
+				if img.NRGBAAt(x, y).A > 10 {
+					covered++
+				}
+			}
+		}
+		if covered > w*h/4/20 {
+			t.Errorf("wireframe %d: expected the transparent quadrant to be left uncovered, got %d covered pixels", wireframe, covered)
+		}
+		if wireframe == WireframeOnly {
+			continue
+		}
+		if a := img.NRGBAAt(w*7/8, h*7/8).A; a != 255 {
+			t.Errorf("wireframe %d: expected an opaque pixel in the opaque region, got alpha %d", wireframe, a)
+		}
+	}
+}
+
+func TestDraw_IgnoreTransparent(t *testing.T) {
+	const (
+		w, h   = 200, 200
+		radius = 50
+	)
+
+	// An opaque circular blob over a transparent background.
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := x-w/2, y-h/2
+			if dx*dx+dy*dy <= radius*radius {
+				src.SetNRGBA(x, y, color.NRGBA{R: 230, G: 120, B: 40, A: 255})
+			}
+		}
+	}
+
+	proc := newTestProcessor()
+	proc.IgnoreTransparent = true
+
+	tri := &Image{Processor: proc}
+	_, _, points, err := tri.Draw(src, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(points) == 0 {
+		t.Fatal("expected points to be generated on the opaque blob")
+	}
+	for _, p := range points {
+		dx, dy := p.X-w/2, p.Y-h/2
+		if dx*dx+dy*dy > (radius+2)*(radius+2) {
+			t.Fatalf("expected the points only around the blob, got a point at (%v, %v)", p.X, p.Y)
+		}
+	}
+}
+
+func TestProcessor_Validate(t *testing.T) {
+	if err := newTestProcessor().Validate(); err != nil {
+		t.Fatalf("expected the default processor to be valid, got: %v", err)
+	}
+
+	tests := []struct {
+		field  string
+		modify func(p *Processor)
+	}{
+		{"BlurRadius", func(p *Processor) { p.BlurRadius = -1 }},
+		{"BlurType", func(p *Processor) { p.BlurType = 2 }},
+		{"BlurPasses", func(p *Processor) { p.BlurPasses = -1 }},
+		{"SobelThreshold", func(p *Processor) { p.SobelThreshold = -1 }},
+		{"EdgeDetector", func(p *Processor) { p.EdgeDetector = -1 }},
+		{"EdgeDetector", func(p *Processor) { p.EdgeDetector = 4 }},
+		{"EdgeBias", func(p *Processor) { p.EdgeBias = 3 }},
+		{"PointsPerMegapixel", func(p *Processor) { p.PointsPerMegapixel = -1 }},
+		{"MinPointDistance", func(p *Processor) { p.MinPointDistance = -1 }},
+		{"CannyLowThreshold", func(p *Processor) { p.CannyLowThreshold = -1 }},
+		{"CannyHighThreshold", func(p *Processor) { p.CannyLowThreshold, p.CannyHighThreshold = 50, 20 }},
+		{"PointsThreshold", func(p *Processor) { p.PointsThreshold = 256 }},
+		{"PointRate", func(p *Processor) { p.PointRate = 0 }},
+		{"PointRate", func(p *Processor) { p.PointRate = 1.5 }},
+		{"BlurFactor", func(p *Processor) { p.BlurFactor = -1 }},
+		{"EdgeFactor", func(p *Processor) { p.EdgeFactor = 0 }},
+		{"CustomEdgeKernel", func(p *Processor) { p.CustomEdgeKernel = make([]float64, 4) }},
+		{"MaxPoints", func(p *Processor) { p.MaxPoints = -1 }},
+		{"ColorSampling", func(p *Processor) { p.ColorSampling = 3 }},
+		{"FillMode", func(p *Processor) { p.FillMode = 3 }},
+		{"FillMode", func(p *Processor) { p.FillMode, p.Shading = FacetIndex, SmoothShading }},
+		{"Shading", func(p *Processor) { p.Shading = 2 }},
+		{"LuminanceMode", func(p *Processor) { p.LuminanceMode = 3 }},
+		{"PointRadius", func(p *Processor) { p.PointRadius = -1 }},
+		{"ShowPoints", func(p *Processor) { p.ShowPoints, p.Output16Bit = true, true }},
+		{"TraceContours", func(p *Processor) { p.TraceContours, p.Output16Bit = true, true }},
+		{"Wireframe", func(p *Processor) { p.Wireframe = 3 }},
+		{"Noise", func(p *Processor) { p.Noise = -1 }},
+		{"StrokeWidth", func(p *Processor) { p.StrokeWidth = -1 }},
+		{"OutputWidth", func(p *Processor) { p.OutputWidth = -1 }},
+		{"OutputHeight", func(p *Processor) { p.OutputHeight = -1 }},
+		{"BgColor", func(p *Processor) { p.BgColor = "#12345" }},
+		{"StrokeColor", func(p *Processor) { p.StrokeColor = "red" }},
+		{"SolidStrokeColor", func(p *Processor) { p.SolidStrokeColor = "#12345" }},
+		{"StrokeOpacity", func(p *Processor) { p.StrokeOpacity = 1.5 }},
+		{"Overlay", func(p *Processor) { p.Overlay = 2 }},
+		{"ClipShape", func(p *Processor) { p.ClipShape = 3 }},
+		{"ClipRadius", func(p *Processor) { p.ClipRadius = -1 }},
+		{"SamplingMethod", func(p *Processor) { p.SamplingMethod = 2 }},
+		{"PaletteSize", func(p *Processor) { p.PaletteSize = -1 }},
+		{"Posterize", func(p *Processor) { p.Posterize = 1 }},
+		{"Voronoi", func(p *Processor) { p.Voronoi, p.Output16Bit = true, true }},
+		{"MaxDimension", func(p *Processor) { p.MaxDimension = 1 }},
+		{"Tessellation", func(p *Processor) { p.Tessellation = 3 }},
+		{"CellSize", func(p *Processor) { p.Tessellation, p.CellSize = TriGrid, 1 }},
+		{"HexGrid", func(p *Processor) { p.Tessellation, p.CellSize, p.Output16Bit = HexGrid, 20, true }},
+		{"Quality", func(p *Processor) { p.Quality = 101 }},
+		{"RelaxationPasses", func(p *Processor) { p.RelaxationPasses = -1 }},
+		{"MinTriangleArea", func(p *Processor) { p.MinTriangleArea = -1 }},
+		{"Frames", func(p *Processor) { p.Frames = -1 }},
+		{"Precision", func(p *Processor) { p.Precision = -1 }},
+		{"Region", func(p *Processor) { p.Region = image.Rect(10, 10, 10, 20) }},
+		{"PadColor", func(p *Processor) { p.PadColor = "#12" }},
+		{"Rotate", func(p *Processor) { p.Rotate = 45 }},
+		{"MergeTolerance", func(p *Processor) { p.MergeTolerance = -1 }},
+		{"BackgroundCoarsening", func(p *Processor) { p.BackgroundCoarsening = 1.5 }},
+		{"PointSelection", func(p *Processor) { p.PointSelection = 3 }},
+		{"BackgroundCoarsening with TopGradient", func(p *Processor) { p.PointSelection, p.BackgroundCoarsening = TopGradient, 0.5 }},
+	}
+	for _, tt := range tests {
+		proc := newTestProcessor()
+		tt.modify(&proc)
+
+		err := proc.Validate()
+		if !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("%s: expected ErrInvalidOption, got: %v", tt.field, err)
+			continue
+		}
+		// The cases of the same field are told apart by the words following its name.
+		if !strings.Contains(err.Error(), strings.Fields(tt.field)[0]) {
+			t.Errorf("%s: expected the error to name the field, got: %v", tt.field, err)
+		}
+
+		tri := &Image{Processor: proc}
+		if _, _, _, err := tri.Draw(newTestImage(20, 20), proc, func() {}); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("%s: expected Draw to return ErrInvalidOption, got: %v", tt.field, err)
+		}
+	}
+}
+
+func TestDraw_BgColorAlpha(t *testing.T) {
+	const w, h = 160, 160
+
+	// An opaque square over a transparent background.
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := h / 4; y < h*3/4; y++ {
+		for x := w / 4; x < w*3/4; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	// The points are sampled with a fixed seed, since the checked pixels may be covered
+	// by a triangle sampling the border of the transparent area otherwise.
+	seed := randomSeed
+	randomSeed = func() int64 { return 1 }
+	t.Cleanup(func() { randomSeed = seed })
+
+	proc := newTestProcessor()
+	proc.BgColor = "#00000080"
+
+	tri := &Image{Processor: proc}
+	res, _, _, err := tri.Draw(src, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	img := ImgToNRGBA(res)
+	for _, p := range []image.Point{{2, 2}, {w - 3, 2}, {2, h - 3}, {w - 3, h - 3}} {
+		if c := img.NRGBAAt(p.X, p.Y); c.A < 0x7f || c.A > 0x81 || c.R != 0 || c.G != 0 || c.B != 0 {
+			t.Errorf("expected a semi-transparent black background at %v, got %v", p, c)
+		}
+	}
+	if c := img.NRGBAAt(w/2, h/2); c.A != 0xff {
+		t.Errorf("expected an opaque triangle at the center, got %v", c)
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		hex      string
+		expected color.NRGBA
+		valid    bool
+	}{
+		{"#fff", color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, true},
+		{"#ff8000", color.NRGBA{R: 0xff, G: 0x80, B: 0x00, A: 0xff}, true},
+		{"00000080", color.NRGBA{R: 0x00, G: 0x00, B: 0x00, A: 0x80}, true},
+		{"#ffffff00", color.NRGBA{}, true},
+		{"#ffff", color.NRGBA{}, false},
+		{"#gg0000", color.NRGBA{}, false},
+	}
+	for _, tt := range tests {
+		c, err := ParseHexColor(tt.hex)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.hex)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.hex, err)
+			continue
+		}
+		if got := color.NRGBAModel.Convert(c).(color.NRGBA); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.hex, tt.expected, got)
+		}
+	}
+}
+
+func TestDrawMesh(t *testing.T) {
+	w, h := 100, 100
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), &image.Uniform{C: color.NRGBA{R: 200, G: 100, B: 50, A: 128}}, image.Point{}, draw.Src)
+
+	proc := newTestProcessor()
+	proc.IsStrokeSolid = true
+
+	mesh, _, err := proc.DrawMesh(context.Background(), src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mesh) == 0 {
+		t.Fatal("expected a non-empty mesh")
+	}
+
+	expected := color.RGBAModel.Convert(color.NRGBA{R: 200, G: 100, B: 50, A: 128}).(color.RGBA)
+	for _, ct := range mesh {
+		if ct.Fill != expected {
+			t.Errorf("expected the fill color %v, got %v", expected, ct.Fill)
+		}
+		if ct.Stroke != (color.RGBA{A: 255}) {
+			t.Errorf("expected a solid black stroke, got %v", ct.Stroke)
+		}
+	}
+
+	// The triangles and their colors are the same as the ones drawn by Draw for the same points.
+	proc = newTestProcessor()
+	_, proc.Points, err = proc.DrawMesh(context.Background(), newTestImage(w, h))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mesh, _, err = proc.DrawMesh(context.Background(), newTestImage(w, h))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, triangles, _, err := (&Image{Processor: proc}).Draw(newTestImage(w, h), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mesh) != len(triangles) {
+		t.Fatalf("expected the %d triangles drawn by Draw, got %d", len(triangles), len(mesh))
+	}
+	for i, ct := range mesh {
+		if !reflect.DeepEqual(ct.Nodes, triangles[i].Nodes) {
+			t.Fatalf("triangle %d: expected the nodes %v, got %v", i, triangles[i].Nodes, ct.Nodes)
+		}
+		if ct.fill != triangles[i].fill {
+			t.Errorf("triangle %d: expected the fill color %v, got %v", i, triangles[i].fill, ct.fill)
+		}
+		if c := (color.RGBA{R: ct.Fill.R, G: ct.Fill.G, B: ct.Fill.B, A: 255}); c != triangles[i].fill {
+			t.Errorf("triangle %d: expected the sampled color %v, got %v", i, triangles[i].fill, c)
+		}
+	}
+}
+
+func TestDraw_Region(t *testing.T) {
+	w, h := 120, 80
+	src := newTestImage(w, h)
+	region := image.Rect(30, 20, 90, 60)
+
+	proc := newTestProcessor()
+	proc.Region = region
+
+	im := &Image{Processor: proc}
+	res, triangles, _, err := im.Draw(src, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(triangles) == 0 {
+		t.Fatal("expected the region to be triangulated")
+	}
+	for _, tri := range triangles {
+		for _, n := range tri.Nodes {
+			if n.X < float64(region.Min.X) || n.X > float64(region.Max.X) || n.Y < float64(region.Min.Y) || n.Y > float64(region.Max.Y) {
+				t.Fatalf("expected the triangle nodes to be inside the region, got %v", n)
+			}
+		}
+	}
+
+	img := ImgToNRGBA(res)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (image.Point{X: x, Y: y}).In(region) {
+				continue
+			}
+			if c, expected := img.NRGBAAt(x, y), src.NRGBAAt(x, y); c != expected {
+				t.Fatalf("expected the pixel at (%d, %d) outside the region to be %v, got %v", x, y, expected, c)
+			}
+		}
+	}
+}
+
+func TestDraw_PadToSquare(t *testing.T) {
+	proc := newTestProcessor()
+	proc.PadToSquare = true
+	proc.PadColor = "#ff0000"
+	padColor := color.NRGBA{R: 255, A: 255}
+
+	for _, output16Bit := range []bool{false, true} {
+		proc.Output16Bit = output16Bit
+		im := &Image{Processor: proc}
+		res, triangles, _, err := im.Draw(newTestImage(100, 50), proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if b := res.Bounds(); b.Dx() != 100 || b.Dy() != 100 {
+			t.Fatalf("expected a 100x100 image, got %dx%d", b.Dx(), b.Dy())
+		}
+
+		// The source image is centered vertically, so no points are generated above and below it.
+		for _, tri := range triangles {
+			for _, n := range tri.Nodes {
+				if n.Y < 25 || n.Y > 75 {
+					t.Fatalf("expected the triangle nodes to be inside the source image, got %v", n)
+				}
+			}
+		}
+		img := ImgToNRGBA(res)
+		for y := 0; y < 100; y++ {
+			if y >= 25 && y < 75 {
+				continue
+			}
+			for x := 0; x < 100; x++ {
+				if c := img.NRGBAAt(x, y); c != padColor {
+					t.Fatalf("16-bit: %v, expected the padding at (%d, %d) to be %v, got %v", output16Bit, x, y, padColor, c)
+				}
+			}
+		}
+	}
+}
+
+func TestDraw_Mask(t *testing.T) {
+	w, h := 120, 80
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w/2; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	proc := newTestProcessor()
+	proc.PointRate = 0.5
+	proc.Mask = mask
+
+	im := &Image{Processor: proc}
+	_, _, points, err := im.Draw(newTestImage(w, h), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(points) == 0 {
+		t.Fatal("expected points in the white half of the mask")
+	}
+	for _, p := range points {
+		if p.X >= float64(w/2) {
+			t.Fatalf("expected the points to be in the white half of the mask, got %v", p)
+		}
+	}
+}
+
+func TestDraw_MinTriangleArea(t *testing.T) {
+	const minArea = 20
+
+	proc := newTestProcessor()
+	proc.MinTriangleArea = minArea
+
+	tri := &Image{Processor: proc}
+	_, triangles, _, err := tri.Draw(newTestImage(200, 200), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(triangles) == 0 {
+		t.Fatal("expected the larger triangles to be kept")
+	}
+	for _, tr := range triangles {
+		if area := tr.Area(); area < minArea {
+			t.Errorf("expected the triangles to have at least %v area, got %v for %v", minArea, area, tr.Nodes)
+		}
+	}
+
+	svg := &SVG{Processor: proc}
+	if _, _, _, err := svg.Draw(newTestImage(200, 200), proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, l := range svg.Lines {
+		tr := Triangle{Nodes: []Node{l.P0, l.P1, l.P2}}
+		if area := tr.Area(); area < minArea {
+			t.Errorf("expected the SVG triangles to have at least %v area, got %v for %v", minArea, area, tr.Nodes)
+		}
+	}
+}
+
+func TestDraw_StrokeColor(t *testing.T) {
+	proc := newTestProcessor()
+	proc.Wireframe = WireframeOnly
+	proc.StrokeWidth = 3
+	proc.StrokeColor = "#ff0000"
+
+	tri := &Image{Processor: proc}
+	res, _, _, err := tri.Draw(newTestImage(120, 80), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only the strokes are drawn over the transparent background, so every opaque pixel has the stroke color.
+	img := ImgToNRGBA(res)
+	var opaque int
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i+3] < 255 {
+			continue
+		}
+		opaque++
+		if c := img.Pix[i : i+3]; c[0] != 0xff || c[1] != 0 || c[2] != 0 {
+			t.Fatalf("expected the stroke color #ff0000, got %v", c)
+		}
+	}
+	if opaque == 0 {
+		t.Fatal("expected the strokes to be drawn")
+	}
+
+	svg := &SVG{Processor: proc}
+	if _, _, _, err := svg.Draw(newTestImage(120, 80), proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, l := range svg.Lines {
+		if l.StrokeColor != (color.RGBA{R: 0xff, A: 0xff}) {
+			t.Fatalf("expected the SVG stroke color #ff0000, got %v", l.StrokeColor)
+		}
+	}
+}
+
+func TestDraw_SolidStrokeColor(t *testing.T) {
+	proc := newTestProcessor()
+	proc.Wireframe = WireframeOnly
+	proc.StrokeWidth = 3
+	proc.IsStrokeSolid = true
+	proc.SolidStrokeColor = "#fff"
+
+	tri := &Image{Processor: proc}
+	res, _, _, err := tri.Draw(newTestImage(120, 80), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The solid stroke color replaces the black strokes of the IsStrokeSolid option.
+	img := ImgToNRGBA(res)
+	var opaque int
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i+3] < 255 {
+			continue
+		}
+		opaque++
+		if c := img.Pix[i : i+3]; c[0] != 0xff || c[1] != 0xff || c[2] != 0xff {
+			t.Fatalf("expected the solid stroke color #ffffff, got %v", c)
+		}
+	}
+	if opaque == 0 {
+		t.Fatal("expected the strokes to be drawn")
+	}
+
+	svg := &SVG{Processor: proc}
+	if _, _, _, err := svg.Draw(newTestImage(120, 80), proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, l := range svg.Lines {
+		if l.StrokeColor != (color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+			t.Fatalf("expected the SVG stroke color #ffffff, got %v", l.StrokeColor)
+		}
+	}
+}
+
+func TestDrawMesh_DarkenStroke(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(src, src.Bounds(), &image.Uniform{C: color.NRGBA{R: 200, G: 100, B: 50, A: 255}}, image.Point{}, draw.Src)
+
+	proc := newTestProcessor()
+	proc.DarkenStroke = true
+
+	mesh, _, err := proc.DrawMesh(context.Background(), src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, ct := range mesh {
+		if expected := (color.RGBA{R: 140, G: 70, B: 35, A: 255}); ct.Stroke != expected {
+			t.Fatalf("expected the darkened stroke color %v, got %v", expected, ct.Stroke)
+		}
+	}
+}
+
+func TestDraw_Stats(t *testing.T) {
+	for _, drawer := range []Drawer{&Image{}, &SVG{}} {
+		var stats Stats
+		p := newTestProcessor()
+		p.Stats = &stats
+
+		_, triangles, points, err := drawer.Draw(newTestImage(120, 80), p, func() {})
+		if err != nil {
+			t.Fatalf("%T: unexpected error: %v", drawer, err)
+		}
+		if stats.Points != len(points) || stats.Triangles != len(triangles) {
+			t.Errorf("%T: expected %d points and %d triangles, got %d and %d",
+				drawer, len(points), len(triangles), stats.Points, stats.Triangles)
+		}
+
+		stages := []time.Duration{stats.Blur, stats.EdgeDetection, stats.PointExtraction, stats.Triangulation, stats.Sampling}
+		var sum time.Duration
+		for i, d := range stages {
+			if d <= 0 {
+				t.Errorf("%T: expected a positive duration of the stage %d, got %v", drawer, i, d)
+			}
+			sum += d
+		}
+		if stats.Total < sum {
+			t.Errorf("%T: expected the total time %v to be at least the sum of the stages %v", drawer, stats.Total, sum)
+		}
+	}
+}
+
+func TestDraw_StrokeOpacity(t *testing.T) {
+	// A uniform image has no edges, so it's covered by two triangles only, the top border belonging to one of them.
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 60))
+	draw.Draw(src, src.Bounds(), &image.Uniform{C: color.NRGBA{A: 255}}, image.Point{}, draw.Src)
+
+	for _, opacity := range []float64{0.25, 0.5, 1} {
+		proc := newTestProcessor()
+		proc.Wireframe = WithWireframe
+		proc.StrokeWidth = 4
+		proc.StrokeColor = "#ffffff"
+		proc.StrokeOpacity = opacity
+
+		tri := &Image{Processor: proc}
+		res, _, _, err := tri.Draw(src, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The white stroke is composited over the black fill, so its brightness is its opacity.
+		c := ImgToNRGBA(res).NRGBAAt(50, 0)
+		if expected := opacity * 255; math.Abs(float64(c.R)-expected) > 1 {
+			t.Errorf("expected the stroke of opacity %v to be drawn with the brightness %v, got %v", opacity, expected, c.R)
+		}
+	}
+}
+
+func TestDraw_PaletteSize(t *testing.T) {
+	// A gradient image has a distinct color at almost every triangle.
+	src := image.NewNRGBA(image.Rect(0, 0, 160, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 160; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / 160), G: uint8(y * 255 / 120), B: uint8((x + y) % 256), A: 255})
+		}
+	}
+
+	for _, size := range []int{4, 16} {
+		proc := newTestProcessor()
+		proc.PaletteSize = size
+
+		svg := &SVG{Processor: proc}
+		if _, _, _, err := svg.Draw(src, proc, func() {}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		fills := make(map[color.RGBA]bool)
+		for _, l := range svg.Lines {
+			fills[l.FillColor] = true
+		}
+		if len(fills) > size {
+			t.Errorf("expected at most %d distinct fill colors, got %d", size, len(fills))
+		}
+
+		mesh, _, err := proc.DrawMesh(context.Background(), src)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, ct := range mesh {
+			fills[color.RGBA{R: ct.Fill.R, G: ct.Fill.G, B: ct.Fill.B, A: 255}] = true
+		}
+		if len(fills) > size {
+			t.Errorf("expected at most %d distinct mesh fill colors, got %d", size, len(fills))
+		}
+	}
+}
+
+func TestDraw_UniformGrid(t *testing.T) {
+	proc := newTestProcessor()
+	proc.SamplingMethod = UniformGrid
+	proc.MaxPoints = 500
+
+	tri := &Image{Processor: proc}
+	_, _, points, err := tri.Draw(newTestImage(200, 150), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(points); n < 450 || n > 550 {
+		t.Errorf("expected about 500 points, got %d", n)
+	}
+}
+
+func TestDraw_Overlay(t *testing.T) {
+	// No edges are detected with the maximum threshold, so the image is always covered by the same two triangles.
+	src := image.NewNRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+
+	draw := func(overlay float64) *image.NRGBA {
+		proc := newTestProcessor()
+		proc.SobelThreshold = 255
+		proc.Overlay = overlay
+
+		tri := &Image{Processor: proc}
+		res, _, points, err := tri.Draw(src, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(points) != 0 {
+			t.Fatalf("expected no edge points, got %d", len(points))
+		}
+		return ImgToNRGBA(res)
+	}
+	triangles, blended, full := draw(0), draw(0.25), draw(1)
+
+	if !bytes.Equal(full.Pix, triangles.Pix) {
+		t.Error("expected the overlay of 1 to render only the triangles")
+	}
+	for i := range blended.Pix {
+		expected := float64(src.Pix[i])*0.75 + float64(triangles.Pix[i])*0.25
+		if math.Abs(float64(blended.Pix[i])-expected) > 1 {
+			t.Fatalf("expected the blended value %v at %d, got %v", expected, i, blended.Pix[i])
+		}
+	}
+}
+
+func TestBlendLayer(t *testing.T) {
+	base, layer := newTestImage(40, 30), image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	for i := range layer.Pix {
+		layer.Pix[i] = uint8(i)
+	}
+	for _, opacity := range []float64{0, 1} {
+		dst := image.NewRGBA(layer.Rect)
+		copy(dst.Pix, layer.Pix)
+		blendLayer(dst, &image.RGBA{Pix: base.Pix, Stride: base.Stride, Rect: base.Rect}, opacity)
+
+		expected := layer.Pix
+		if opacity == 0 {
+			expected = base.Pix
+		}
+		if !bytes.Equal(dst.Pix, expected) {
+			t.Errorf("expected the opacity %v to give the %s image", opacity, map[bool]string{true: "base", false: "layer"}[opacity == 0])
+		}
+	}
+}
+
+func TestDraw_ClipShape(t *testing.T) {
+	src := newTestImage(120, 80)
+	for _, output16Bit := range []bool{false, true} {
+		for _, shape := range []int{CircleClip, RoundedRectClip} {
+			// The background makes the whole output opaque, including the antialiased seams between the triangles.
+			proc := newTestProcessor()
+			proc.BgColor = "#ffffff"
+			proc.ClipShape = shape
+			proc.Output16Bit = output16Bit
+
+			tri := &Image{Processor: proc}
+			res, _, _, err := tri.Draw(src, proc, func() {})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, pt := range []image.Point{{0, 0}, {119, 0}, {0, 79}, {119, 79}} {
+				if _, _, _, a := res.At(pt.X, pt.Y).RGBA(); a != 0 {
+					t.Errorf("expected the corner %v to be transparent with the clip shape %d, got alpha %d", pt, shape, a)
+				}
+			}
+			if _, _, _, a := res.At(60, 40).RGBA(); a != 0xffff {
+				t.Errorf("expected the center to be opaque with the clip shape %d, got alpha %d", shape, a)
+			}
+		}
+	}
+
+	proc := newTestProcessor()
+	proc.ClipShape = CircleClip
+	svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+	if _, _, _, err := svg.Draw(src, proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := svg.Bytes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := string(b)
+	if !strings.Contains(out, `<clipPath id="clip"><circle cx="60" cy="40" r="40"/></clipPath>`) ||
+		!strings.Contains(out, `clip-path="url(#clip)"`) {
+		t.Errorf("expected the SVG output to be clipped by a circle, got %s", out)
+	}
+}
+
+func TestDrawContext_WithProgress(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		progress := make(map[string][]float64)
+		ctx := WithProgress(context.Background(), func(stage string, fraction float64) {
+			progress[stage] = append(progress[stage], fraction)
+		})
+
+		proc := newTestProcessor()
+		proc.Workers = workers
+		proc.RelaxationPasses = 2
+		tri := &Image{Processor: proc}
+		if _, _, _, err := tri.DrawContext(ctx, newTestImage(400, 300), proc, func() {}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, stage := range []string{ScanStage, TriangulationStage} {
+			fractions := progress[stage]
+			if len(fractions) < 2 {
+				t.Fatalf("expected the %s progress to be reported incrementally with %d workers, got %v", stage, workers, fractions)
+			}
+			for i := 1; i < len(fractions); i++ {
+				if fractions[i] <= fractions[i-1] {
+					t.Fatalf("expected the %s progress to increase with %d workers, got %v", stage, workers, fractions)
+				}
+			}
+			if fractions[0] <= 0 || fractions[len(fractions)-1] != 1 {
+				t.Errorf("expected the %s progress to end at 1 with %d workers, got %v", stage, workers, fractions)
+			}
+		}
+	}
+}
+
+func TestDraw_StatsCandidates(t *testing.T) {
+	for _, maxPoints := range []int{10, 1e6} {
+		var stats Stats
+		p := newTestProcessor()
+		p.MaxPoints = maxPoints
+		p.Stats = &stats
+
+		if _, _, _, err := (&Image{Processor: p}).Draw(newTestImage(120, 80), p, func() {}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// The points are limited either by the maximum number of points or by the point rate of the candidates.
+		expected := Min(maxPoints, int(float64(stats.Candidates)*p.PointRate))
+		if stats.Candidates <= 10 || stats.Points != expected {
+			t.Errorf("expected %d points selected from the %d candidates, got %d", expected, stats.Candidates, stats.Points)
+		}
+	}
+}
+
+func TestDraw_PointsPerMegapixel(t *testing.T) {
+	// checkerboard returns the same 8x6 checkerboard pattern at the provided size.
+	checkerboard := func(w, h int) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := uint8(40 + (x*8/w+y*6/h)%2*160)
+				img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+			}
+		}
+		return img
+	}
+
+	for _, size := range []image.Point{{200, 150}, {400, 300}} {
+		var stats Stats
+		proc := newTestProcessor()
+		proc.MaxPoints = 0
+		proc.PointsPerMegapixel = 1000
+		proc.Stats = &stats
+
+		tri := &Image{Processor: proc}
+		if _, _, _, err := tri.Draw(checkerboard(size.X, size.Y), proc, func() {}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// The number of points is limited to 1000 per megapixel, the candidates being far more.
+		if expected := size.X * size.Y / 1000; stats.Points != expected {
+			t.Errorf("%v: expected %d points out of %d candidates, got %d", size, expected, stats.Candidates, stats.Points)
+		}
+	}
+}
+
+func TestDecodeImage_UnknownFormat(t *testing.T) {
+	webp := append([]byte("RIFF\x00\x00\x00\x00WEBPVP8L"), make([]byte, 16)...)
+	if _, err := decodeImage(bytes.NewReader(webp)); err == nil || !strings.Contains(err.Error(), "webp") {
+		t.Errorf("expected an error naming the webp format, got %v", err)
+	}
+	if _, err := decodeImage(strings.NewReader("not an image")); err == nil || !strings.Contains(err.Error(), "not recognized") {
+		t.Errorf("expected an unrecognized format error, got %v", err)
+	}
+}
+
+func TestDrawWithPoints(t *testing.T) {
+	w, h := 120, 80
+	corners := []Point{{X: 0, Y: 0}, {X: float64(w), Y: 0}, {X: float64(w), Y: float64(h)}, {X: 0, Y: float64(h)}}
+
+	proc := newTestProcessor()
+	tri := &Image{Processor: proc}
+	res, triangles, points, err := tri.DrawWithPoints(newTestImage(w, h), corners, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(triangles) != 2 {
+		t.Errorf("expected 2 triangles, got %d", len(triangles))
+	}
+	if len(points) != 4 {
+		t.Errorf("expected 4 points, got %d", len(points))
+	}
+	if b := res.Bounds(); b.Dx() != w || b.Dy() != h {
+		t.Errorf("expected a %dx%d image, got %dx%d", w, h, b.Dx(), b.Dy())
+	}
+
+	// The center point splits the image into four triangles, while the points outside of it are dropped.
+	pts := append(corners, Point{X: 60, Y: 40}, Point{X: -10, Y: 40}, Point{X: 60, Y: 200})
+	_, triangles, points, err = tri.DrawWithPoints(newTestImage(w, h), pts, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(triangles) != 4 || len(points) != 5 {
+		t.Errorf("expected 4 triangles and 5 points, got %d triangles and %d points", len(triangles), len(points))
+	}
+
+	// The points of the processor are triangulated by every output.
+	proc.Points = pts
+	drawers := []Drawer{&Image{Processor: proc}, &SVG{Processor: proc}}
+	for _, drawer := range drawers {
+		_, triangles, points, err := drawer.Draw(newTestImage(w, h), proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(triangles) != 4 || len(points) != 5 {
+			t.Errorf("%T: expected 4 triangles and 5 points, got %d triangles and %d points", drawer, len(triangles), len(points))
+		}
+	}
+	mesh, _, err := proc.DrawMesh(context.Background(), newTestImage(w, h))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mesh) != 4 {
+		t.Errorf("expected a mesh of 4 triangles, got %d", len(mesh))
+	}
+}
+
+func TestDrawInto(t *testing.T) {
+	magenta := color.RGBA{R: 255, B: 255, A: 255}
+	fill := func(img *image.RGBA) {
+		draw.Draw(img, img.Bounds(), image.NewUniform(magenta), image.Point{}, draw.Src)
+	}
+	countFill := func(img *image.RGBA, r image.Rectangle) int {
+		var n int
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if img.RGBAAt(x, y) == magenta {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	proc := newTestProcessor()
+	tri := &Image{Processor: proc}
+
+	// The triangles are scaled to the size of the destination image, overwriting all of it.
+	dst := image.NewRGBA(image.Rect(0, 0, 60, 40))
+	fill(dst)
+	triangles, points, err := tri.DrawInto(dst, newTestImage(120, 80), proc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(triangles) == 0 || len(points) == 0 {
+		t.Fatalf("expected a triangulated image, got %d triangles and %d points", len(triangles), len(points))
+	}
+	if n := countFill(dst, dst.Bounds()); n != 0 {
+		t.Errorf("expected the destination image to be overwritten, got %d pixels of the initial color", n)
+	}
+
+	// Only the sub-image of the destination image is overwritten.
+	parent := image.NewRGBA(image.Rect(0, 0, 100, 60))
+	fill(parent)
+	sub := parent.SubImage(image.Rect(20, 10, 80, 50)).(*image.RGBA)
+	if _, _, err := tri.DrawInto(sub, newTestImage(120, 80), proc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := countFill(parent, sub.Bounds()); n != 0 {
+		t.Errorf("expected the sub-image to be overwritten, got %d pixels of the initial color", n)
+	}
+	if n := countFill(parent, parent.Bounds()); n != 100*60-60*40 {
+		t.Errorf("expected the pixels outside of the sub-image to be kept, got %d pixels of the initial color", n)
+	}
+
+	// The transparent background replaces the pixels of the destination image, instead of being composited over them.
+	fill(dst)
+	if _, _, err := tri.DrawInto(dst, image.NewNRGBA(image.Rect(0, 0, 120, 80)), proc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := countFill(dst, dst.Bounds()); n != 0 {
+		t.Errorf("expected the destination image to be cleared under a transparent source, got %d pixels of the initial color", n)
+	}
+}
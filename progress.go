@@ -0,0 +1,39 @@
+package triangle
+
+import "context"
+
+// The stages of the triangulation pipeline reported to the progress function defined by WithProgress.
+const (
+	// ScanStage is the scan of the edge pixels the points are extracted from.
+	ScanStage = "scan"
+	// TriangulationStage is the Delaunay triangulation of the points, including the relaxation passes.
+	TriangulationStage = "triangulation"
+)
+
+// progressSteps defines how many times the progress of the serial pixel scan is reported.
+const progressSteps = 20
+
+// progressKey is the context key of the progress function.
+type progressKey struct{}
+
+// WithProgress returns a copy of the context carrying the progress function of the triangulations run with it.
+// The function is called during the pixel scan (ScanStage) and the Delaunay triangulation (TriangulationStage)
+// with the completed fraction of the stage, in the [0, 1] range, increasing up to 1. It's called from the
+// goroutine running the triangulation, so it has to return quickly. Since the function is not a field of the
+// Processor, the images processed concurrently with the same processor can report to their own functions.
+func WithProgress(ctx context.Context, fn func(stage string, fraction float64)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressFn returns the progress function carried by the context, or nil in case it's not defined.
+func progressFn(ctx context.Context) func(stage string, fraction float64) {
+	fn, _ := ctx.Value(progressKey{}).(func(stage string, fraction float64))
+	return fn
+}
+
+// progress reports the completed fraction of the stage to the progress function, in case it's defined.
+func (s *scratch) progress(stage string, fraction float64) {
+	if s.progressFn != nil {
+		s.progressFn(stage, fraction)
+	}
+}
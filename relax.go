@@ -0,0 +1,47 @@
+package triangle
+
+// relaxPoints moves every point to the area weighted centroid of its incident triangles,
+// which approximates one pass of Lloyd's relaxation on the Delaunay triangulation.
+// The points are kept within the image bounds and the ones on its border are moved only along it.
+// The points not being a node of any triangle (like the skipped duplicates) are returned unchanged.
+func relaxPoints(triangles []Triangle, points []Point, width, height int) []Point {
+	type centroid struct {
+		x, y, area float64
+	}
+	centroids := make(map[Node]centroid, len(points))
+
+	for _, t := range triangles {
+		area := t.Area()
+		cx, cy := t.Centroid()
+
+		for _, n := range t.Nodes {
+			c := centroids[n]
+			c.x += cx * area
+			c.y += cy * area
+			c.area += area
+			centroids[n] = c
+		}
+	}
+
+	relaxed := make([]Point, len(points))
+	for i, p := range points {
+		relaxed[i] = p
+
+		c, ok := centroids[newNode(p.X, p.Y)]
+		if !ok || c.area == 0 {
+			continue
+		}
+		relaxed[i] = Point{
+			X: Min(Max(c.x/c.area, 0), float64(width)),
+			Y: Min(Max(c.y/c.area, 0), float64(height)),
+		}
+		// The points on the border are only moved along it.
+		if p.X == 0 || p.X == float64(width) {
+			relaxed[i].X = p.X
+		}
+		if p.Y == 0 || p.Y == float64(height) {
+			relaxed[i].Y = p.Y
+		}
+	}
+	return relaxed
+}
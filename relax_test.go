@@ -0,0 +1,57 @@
+package triangle
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// areaVariance returns the variance of the triangle areas.
+func areaVariance(triangles []Triangle) float64 {
+	areas := make([]float64, len(triangles))
+
+	var mean float64
+	for i, t := range triangles {
+		areas[i] = t.Area()
+		mean += areas[i]
+	}
+	mean /= float64(len(areas))
+
+	var variance float64
+	for _, area := range areas {
+		variance += (area - mean) * (area - mean)
+	}
+	return variance / float64(len(areas))
+}
+
+func TestRelaxPoints(t *testing.T) {
+	w, h := 200, 200
+	r := rand.New(rand.NewSource(1))
+
+	// Clump most of the points into a small region, like the edge points of a detailed area.
+	var points []Point
+	for i := 0; i < 300; i++ {
+		points = append(points, Point{X: float64(20 + r.Intn(40)), Y: float64(20 + r.Intn(40))})
+	}
+	for i := 0; i < 50; i++ {
+		points = append(points, Point{X: float64(r.Intn(w)), Y: float64(r.Intn(h))})
+	}
+
+	delaunay := &Delaunay{}
+	triangles := delaunay.Init(w, h).Insert(points).GetTriangles()
+	before := areaVariance(triangles)
+
+	for i := 0; i < 3; i++ {
+		points = relaxPoints(triangles, points, w, h)
+		triangles = delaunay.Init(w, h).Insert(points).GetTriangles()
+	}
+	after := areaVariance(triangles)
+
+	if after >= before {
+		t.Errorf("expected the relaxation to reduce the variance of the triangle areas, got %.2f before and %.2f after", before, after)
+	}
+	for _, p := range points {
+		if p.X < 0 || p.X > float64(w) || p.Y < 0 || p.Y > float64(h) {
+			t.Errorf("expected the relaxed points to be within the image bounds, got %v", p)
+		}
+	}
+}
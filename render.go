@@ -0,0 +1,172 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// minBandHeight is the minimum height of the bands the output image is split into when the triangles are filled
+// concurrently, since the triangles overlapping several bands are rasterized once for each of them.
+const minBandHeight = 64
+
+// triangleStyle holds the colors a triangle is drawn with and the rows of the output image it covers.
+type triangleStyle struct {
+	fill   color.NRGBA
+	stroke color.NRGBA
+	// alpha is the alpha of the sampled fill color, before it's made opaque by the background color.
+	alpha uint8
+	// shade interpolates the vertex colors at the output pixels in case of the smooth shading, otherwise it's nil.
+	shade *gouraud
+	// wireframe is the color of the strokes drawn over the filled triangle in the WithWireframe mode.
+	wireframe color.RGBA
+	// skip is true for the transparent triangles left uncovered over the background color.
+	skip bool
+	// minY and maxY are the first and the last row of the output image touched by the triangle and its stroke.
+	minY, maxY int
+}
+
+// offsetPattern shifts the pattern vertically by dy pixels, so the patterns defined over the whole output image
+// fill the bands drawn into their own images at the right position.
+type offsetPattern struct {
+	gg.Pattern
+	dy int
+}
+
+// ColorAt returns the color of the pattern at the pixel shifted by the offset.
+func (p offsetPattern) ColorAt(x, y int) color.Color {
+	return p.Pattern.ColorAt(x, y+p.dy)
+}
+
+// drawTriangles draws the triangles over the image, their nodes being scaled by sx and sy to the image size.
+// The image is split into horizontal bands drawn concurrently by the Workers, each of them drawing the triangles
+// overlapping its band in their original order, so the result is the same as drawing them one by one.
+func (im *Image) drawTriangles(dst *image.RGBA, img *image.NRGBA, pal color.Palette, triangles []Triangle, sx, sy float64) {
+	styles := make([]triangleStyle, len(triangles))
+	parallelize(len(triangles), im.Workers, func(start, end int) {
+		for i := start; i < end; i++ {
+			styles[i] = im.triangleStyle(img, pal, i, &triangles[i], sx, sy)
+		}
+	})
+
+	height := dst.Bounds().Dy()
+	bands := Min(Max(im.Workers, 1), Max(height/minBandHeight, 1))
+	parallelize(height, bands, func(y0, y1 int) {
+		im.drawBand(dst, triangles, styles, y0, y1, sx, sy)
+	})
+}
+
+// triangleStyle returns the colors the i-th triangle is drawn with, storing its fill color into the triangle.
+func (im *Image) triangleStyle(img *image.NRGBA, pal color.Palette, i int, t *Triangle, sx, sy float64) triangleStyle {
+	ct := im.colorTriangle(img, pal, i, *t)
+	t.fill = ct.fill
+
+	c := color.NRGBAModel.Convert(ct.Fill).(color.NRGBA)
+	s := triangleStyle{alpha: c.A}
+
+	// The transparent areas are left uncovered in case a background color is defined, like by the strokes
+	// of the wireframe modes otherwise, the fill of the transparent triangles being invisible anyway.
+	if s.alpha == 0 && (im.BgColor != "" || im.Wireframe != WithoutWireframe) {
+		s.skip = true
+		return s
+	}
+
+	// Preserve the source image transparency in case no background color is defined.
+	if im.BgColor != "" {
+		c.A = 255
+	}
+	s.fill = c
+
+	// The shaded triangles are filled with the vertex colors interpolated at the output pixels.
+	if im.Shading == SmoothShading {
+		s.shade = newGouraud(*t, im.vertexColors(img, pal, *t), sx, sy, im.BgColor != "", im.GammaCorrect)
+	}
+
+	if im.hasStrokeColor() {
+		s.stroke = color.NRGBAModel.Convert(ct.Stroke).(color.NRGBA)
+	} else {
+		s.stroke = s.fill
+	}
+	s.wireframe = im.wireframeStroke(ct.Stroke)
+
+	// The rows are extended by the half of the stroke width and the antialiased pixels.
+	pad := im.StrokeWidth/2 + 1
+	minY := math.Min(t.Nodes[0].Y, math.Min(t.Nodes[1].Y, t.Nodes[2].Y))
+	maxY := math.Max(t.Nodes[0].Y, math.Max(t.Nodes[1].Y, t.Nodes[2].Y))
+	s.minY, s.maxY = int(math.Floor(minY*sy-pad)), int(math.Ceil(maxY*sy+pad))
+
+	return s
+}
+
+// drawBand draws the triangles overlapping the rows between y0 and y1 of the image. Unless the band covers
+// the whole image, it's drawn into its own image, since the gg context rasterizes the paths over its whole image.
+// The band image is extended upwards to the top of the overlapping triangles, since gg truncates the coordinates
+// towards zero when converting them to fixed point, so the negative ones would be rounded differently.
+func (im *Image) drawBand(dst *image.RGBA, triangles []Triangle, styles []triangleStyle, y0, y1 int, sx, sy float64) {
+	top := y0
+	for _, s := range styles {
+		if !s.skip && s.maxY >= y0 && s.minY < y1 {
+			top = Min(top, s.minY)
+		}
+	}
+	top = Max(top, 0)
+
+	// Only the rows of the band are copied, since the ones above it are drawn concurrently by the other bands.
+	band := dst
+	if y0 != 0 || y1 != dst.Bounds().Dy() {
+		band = image.NewRGBA(image.Rect(0, 0, dst.Bounds().Dx(), y1-top))
+		copy(band.Pix[(y0-top)*band.Stride:], dst.Pix[y0*dst.Stride:y1*dst.Stride])
+	}
+
+	dc := gg.NewContextForRGBA(band)
+	dc.Translate(0, -float64(top))
+	dc.Scale(sx, sy)
+
+	for i, t := range triangles {
+		s := styles[i]
+		if s.skip || s.maxY < y0 || s.minY >= y1 {
+			continue
+		}
+		p0, p1, p2 := t.Nodes[0], t.Nodes[1], t.Nodes[2]
+
+		fillStyle := gg.NewSolidPattern(s.fill)
+		if s.shade != nil {
+			fillStyle = offsetPattern{s.shade, top}
+		}
+
+		dc.Push()
+		dc.MoveTo(float64(p0.X), float64(p0.Y))
+		dc.LineTo(float64(p1.X), float64(p1.Y))
+		dc.LineTo(float64(p2.X), float64(p2.Y))
+		dc.LineTo(float64(p0.X), float64(p0.Y))
+
+		switch im.Wireframe {
+		case WithoutWireframe:
+			dc.SetFillStyle(fillStyle)
+			dc.FillPreserve()
+			dc.Fill()
+		case WithWireframe:
+			dc.SetFillStyle(fillStyle)
+			dc.SetStrokeStyle(gg.NewSolidPattern(s.wireframe))
+			dc.SetLineWidth(im.StrokeWidth)
+			dc.FillPreserve()
+			// The stroke is drawn only once in case its opacity is defined, so it's the requested one.
+			if im.StrokeOpacity == 0 {
+				dc.StrokePreserve()
+			}
+			dc.Stroke()
+		case WireframeOnly:
+			dc.SetStrokeStyle(gg.NewSolidPattern(s.stroke))
+			dc.SetLineWidth(im.StrokeWidth)
+			dc.StrokePreserve()
+			dc.Stroke()
+		}
+		dc.Pop()
+	}
+
+	if band != dst {
+		copy(dst.Pix[y0*dst.Stride:y1*dst.Stride], band.Pix[(y0-top)*band.Stride:])
+	}
+}
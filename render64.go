@@ -0,0 +1,237 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/golang/freetype/raster"
+	"golang.org/x/image/math/fixed"
+)
+
+// rgba64Painter paints the rasterized spans with a uniform color over a 16-bit per channel image,
+// or with the colors interpolated by the shading in case it's defined.
+type rgba64Painter struct {
+	img   *image.RGBA64
+	c     color.RGBA64
+	shade *gouraud
+}
+
+// Paint composites the spans over the image using the Porter-Duff over operator.
+func (p *rgba64Painter) Paint(ss []raster.Span, done bool) {
+	const m = 1<<16 - 1
+	b := p.img.Bounds()
+	src := [4]uint64{uint64(p.c.R), uint64(p.c.G), uint64(p.c.B), uint64(p.c.A)}
+
+	for _, s := range ss {
+		if s.Y < b.Min.Y || s.Y >= b.Max.Y {
+			continue
+		}
+		x0, x1 := Max(s.X0, b.Min.X), Min(s.X1, b.Max.X)
+		ma := uint64(s.Alpha)
+		a := m - src[3]*ma/m
+
+		i0, i1 := p.img.PixOffset(x0, s.Y), p.img.PixOffset(x1, s.Y)
+		for i, x := i0, x0; i < i1; i, x = i+8, x+1 {
+			if p.shade != nil {
+				c := p.shade.colorAt64(x, s.Y)
+				src = [4]uint64{uint64(c.R), uint64(c.G), uint64(c.B), uint64(c.A)}
+				a = m - src[3]*ma/m
+			}
+			for c := 0; c < 4; c++ {
+				d := uint64(p.img.Pix[i+c*2])<<8 | uint64(p.img.Pix[i+c*2+1])
+				d = (d*a + src[c]*ma) / m
+				p.img.Pix[i+c*2], p.img.Pix[i+c*2+1] = uint8(d>>8), uint8(d)
+			}
+		}
+	}
+}
+
+// canvas64 draws the triangles over a 16-bit per channel image, scaling their nodes to the image size.
+type canvas64 struct {
+	img     *image.RGBA64
+	sx, sy  float64
+	r       *raster.Rasterizer
+	path    raster.Path
+	painter rgba64Painter
+}
+
+// newCanvas64 returns a canvas of the provided size, the triangle nodes being scaled by sx and sy.
+func newCanvas64(width, height int, sx, sy float64) *canvas64 {
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	r := raster.NewRasterizer(width, height)
+	r.UseNonZeroWinding = true
+
+	return &canvas64{img: img, sx: sx, sy: sy, r: r, painter: rgba64Painter{img: img}}
+}
+
+// point converts the node to the fixed point image coordinates.
+func (cv *canvas64) point(n Node) fixed.Point26_6 {
+	return fixed.Point26_6{X: fixed.Int26_6(n.X * cv.sx * 64), Y: fixed.Int26_6(n.Y * cv.sy * 64)}
+}
+
+// fill fills the triangle with the color.
+func (cv *canvas64) fill(t Triangle, c color.Color) {
+	cv.area(t)
+	cv.paint(c)
+}
+
+// fillShaded fills the triangle with the vertex colors interpolated by the shading.
+func (cv *canvas64) fillShaded(t Triangle, shade *gouraud) {
+	cv.area(t)
+	cv.painter.shade = shade
+	cv.r.Rasterize(&cv.painter)
+	cv.painter.shade = nil
+}
+
+// area adds the triangle area to the cleared rasterizer.
+func (cv *canvas64) area(t Triangle) {
+	cv.r.Clear()
+	cv.r.Start(cv.point(t.Nodes[0]))
+	cv.r.Add1(cv.point(t.Nodes[1]))
+	cv.r.Add1(cv.point(t.Nodes[2]))
+	cv.r.Add1(cv.point(t.Nodes[0]))
+}
+
+// stroke strokes the triangle contour with the color, using round caps and joins like the 8-bit output.
+func (cv *canvas64) stroke(t Triangle, c color.Color, width float64) {
+	cv.path.Clear()
+	cv.path.Start(cv.point(t.Nodes[0]))
+	cv.path.Add1(cv.point(t.Nodes[1]))
+	cv.path.Add1(cv.point(t.Nodes[2]))
+	cv.path.Add1(cv.point(t.Nodes[0]))
+
+	cv.r.Clear()
+	raster.Stroke(cv.r, cv.path, fixed.Int26_6(width*64), raster.RoundCapper, raster.RoundJoiner)
+	cv.paint(c)
+}
+
+// paint rasterizes the current path with the color.
+func (cv *canvas64) paint(c color.Color) {
+	cv.painter.c = color.RGBA64Model.Convert(c).(color.RGBA64)
+	cv.r.Rasterize(&cv.painter)
+}
+
+// drawImage composites the image scaled to the canvas size over it, using the nearest neighbor sampling.
+func (cv *canvas64) drawImage(src image.Image) {
+	b := src.Bounds()
+	if cv.img.Bounds().Size() == b.Size() {
+		draw.Draw(cv.img, cv.img.Bounds(), src, b.Min, draw.Over)
+		return
+	}
+	dst := image.NewRGBA64(cv.img.Bounds())
+	for y := 0; y < dst.Bounds().Dy(); y++ {
+		for x := 0; x < dst.Bounds().Dx(); x++ {
+			dst.Set(x, y, src.At(b.Min.X+int(float64(x)/cv.sx), b.Min.Y+int(float64(y)/cv.sy)))
+		}
+	}
+	draw.Draw(cv.img, cv.img.Bounds(), dst, image.Point{}, draw.Over)
+}
+
+// is16Bit checks if the image has 16 bits per channel.
+func is16Bit(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+// draw64 renders the triangles the same way as DrawContext does, but at 16 bits per channel, which prevents the banding
+// of the smooth gradients. The fill colors are sampled from the 16-bit source image in case it has 16 bits per channel.
+// In case composite is true, the triangles are drawn over the source image.
+func (im *Image) draw64(src image.Image, img *image.NRGBA, triangles []Triangle, outWidth, outHeight int, composite bool) (*image.RGBA64, error) {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	cv := newCanvas64(outWidth, outHeight, float64(outWidth)/float64(width), float64(outHeight)/float64(height))
+
+	if im.BgColor != "" {
+		bgColor, err := ParseHexColor(im.BgColor)
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(cv.img, cv.img.Bounds(), &image.Uniform{C: bgColor}, image.Point{}, draw.Src)
+	}
+	// The triangulated region is composited over the source image.
+	if composite {
+		cv.drawImage(src)
+	}
+
+	var src64 *image.NRGBA64
+	// The posterized colors have 8 bits per channel, so they are not sampled again from the 16-bit source.
+	if is16Bit(src) && !im.Grayscale && im.Posterize == 0 {
+		src64 = image.NewNRGBA64(image.Rect(0, 0, width, height))
+		draw.Draw(src64, src64.Bounds(), src, src.Bounds().Min, draw.Src)
+	}
+
+	pal := im.fillPalette(img)
+	for i, t := range triangles {
+		// The source colors are sampled once at 16 bits per channel, the 8-bit fill color being derived from them,
+		// while the palette and the false colors have 8 bits per channel.
+		var (
+			ct ColoredTriangle
+			c  color.NRGBA64
+		)
+		if pal == nil && im.FillMode == SourceColor {
+			c = im.sampleColor64(img, src64, t)
+			ct = im.coloredTriangle(t, color.NRGBA{R: uint8(c.R >> 8), G: uint8(c.G >> 8), B: uint8(c.B >> 8), A: uint8(c.A >> 8)})
+		} else {
+			ct = im.colorTriangle(img, pal, i, t)
+			c = color.NRGBA64Model.Convert(ct.Fill).(color.NRGBA64)
+		}
+		triangles[i].fill = ct.fill
+		a := c.A
+
+		// The transparent areas are left uncovered in case a background color is defined.
+		if a == 0 && im.BgColor != "" {
+			continue
+		}
+		// Preserve the source image transparency in case no background color is defined.
+		if im.BgColor != "" {
+			c.A = 0xffff
+		}
+		strokeColor := c
+		if im.hasStrokeColor() {
+			strokeColor = color.NRGBA64Model.Convert(ct.Stroke).(color.NRGBA64)
+		}
+
+		// The shaded triangles are filled with the vertex colors interpolated at the output pixels.
+		fill := func() { cv.fill(t, c) }
+		if im.Shading == SmoothShading {
+			shade := newGouraud(t, im.vertexColors(img, pal, t), cv.sx, cv.sy, im.BgColor != "", im.GammaCorrect)
+			fill = func() { cv.fillShaded(t, shade) }
+		}
+
+		switch im.Wireframe {
+		case WithoutWireframe:
+			// The triangle is filled twice, like in the 8-bit output, covering the antialiased seams between the triangles.
+			fill()
+			fill()
+		case WithWireframe:
+			if a == 0 {
+				continue
+			}
+			fill()
+			cv.stroke(t, im.wireframeStroke(ct.Stroke), im.StrokeWidth)
+		case WireframeOnly:
+			if a != 0 {
+				cv.stroke(t, strokeColor, im.StrokeWidth)
+			}
+		}
+	}
+
+	// Blend the triangles over the source image scaled to the output size.
+	if im.Overlay > 0 && im.Overlay < 1 {
+		base := newCanvas64(outWidth, outHeight, cv.sx, cv.sy)
+		base.drawImage(src)
+		blendLayer64(cv.img, base.img, im.Overlay)
+	}
+
+	// Apply a noise on the final image.
+	if im.Noise > 0 {
+		addNoise(im.Noise, im.NoiseChromatic, im.NoiseSeed, cv.img)
+	}
+	if im.ClipShape != NoClip {
+		im.clipImage64(cv.img)
+	}
+	return cv.img, nil
+}
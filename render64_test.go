@@ -0,0 +1,87 @@
+package triangle
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// banding returns the average and the smallest non-zero difference between the adjacent pixels of the image rows.
+func banding(img image.Image) (float64, int) {
+	var sum, n int
+	step := 1 << 16
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X + 1; x < b.Max.X; x++ {
+			c0, _, _, _ := img.At(x-1, y).RGBA()
+			c1, _, _, _ := img.At(x, y).RGBA()
+			if d := int(c1) - int(c0); d != 0 {
+				if d < 0 {
+					d = -d
+				}
+				sum += d
+				step = Min(step, d)
+				n++
+			}
+		}
+	}
+	return float64(sum) / float64(Max(n, 1)), step
+}
+
+func TestDraw_Output16Bit(t *testing.T) {
+	// A smooth 16-bit gradient, having only a few distinct values at 8 bits per channel.
+	src := image.NewNRGBA64(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			v := uint16(0x4000 + x*0x1000/200 + y*0x800/100)
+			src.SetNRGBA64(x, y, color.NRGBA64{R: v, G: v, B: v, A: 0xffff})
+		}
+	}
+
+	proc := newTestProcessor()
+	proc.SobelThreshold = 0
+	proc.PointsThreshold = 0
+	proc.ColorSampling = AverageColor
+
+	tri := &Image{Processor: proc}
+	res8, _, _, err := tri.Draw(src, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	proc.Output16Bit = true
+	tri = &Image{Processor: proc}
+	res16, _, _, err := tri.Draw(src, proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res16.ColorModel() != color.RGBA64Model {
+		t.Fatalf("expected a 16-bit output image, got %T", res16)
+	}
+
+	avg8, step8 := banding(res8)
+	avg16, step16 := banding(res16)
+	if step16 >= 0x101 {
+		t.Errorf("expected the 16-bit output to have steps finer than the 8-bit precision, got %d", step16)
+	}
+	if avg16 >= avg8 {
+		t.Errorf("expected the 16-bit output to have smaller steps than the 8-bit one, got %.0f and %.0f", avg16, avg8)
+	}
+	if step8 < 0x101 {
+		t.Errorf("expected the 8-bit output steps to be multiples of the 8-bit precision, got %d", step8)
+	}
+
+	b, err := Encode(res16, "png", EncodeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("unable to decode the PNG image: %v", err)
+	}
+	if cfg.ColorModel != color.RGBA64Model && cfg.ColorModel != color.NRGBA64Model {
+		t.Errorf("expected a 16-bit PNG image, got the %T color model", cfg.ColorModel)
+	}
+}
@@ -0,0 +1,49 @@
+package triangle
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestDraw_Bands(t *testing.T) {
+	w, h := 300, 200
+	src := newRampImage(w, h)
+
+	// The same points are triangulated by every run, so the outputs are comparable.
+	rng := rand.New(rand.NewSource(1))
+	pts := make([]Point, 500)
+	for i := range pts {
+		pts[i] = Point{X: rng.Float64() * float64(w), Y: rng.Float64() * float64(h)}
+	}
+
+	draw := func(proc Processor, workers int) *image.NRGBA {
+		proc.Workers = workers
+		tri := &Image{Processor: proc}
+		res, _, _, err := tri.DrawWithPoints(src, pts, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return ImgToNRGBA(res)
+	}
+
+	wireframe := newTestProcessor()
+	wireframe.Wireframe, wireframe.StrokeWidth = WithWireframe, 3
+	shaded := newTestProcessor()
+	shaded.Shading = SmoothShading
+	scaled := newTestProcessor()
+	scaled.OutputWidth, scaled.BgColor = 900, "#ffffff"
+
+	for name, proc := range map[string]Processor{
+		"flat":      newTestProcessor(),
+		"wireframe": wireframe,
+		"shaded":    shaded,
+		"scaled":    scaled,
+	} {
+		serial, parallel := draw(proc, 1), draw(proc, 7)
+		if !bytes.Equal(serial.Pix, parallel.Pix) {
+			t.Errorf("%s: expected the image drawn in bands to match the one drawn serially", name)
+		}
+	}
+}
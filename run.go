@@ -0,0 +1,205 @@
+package triangle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"strings"
+)
+
+// Run triangulates the image read from src and writes the result to dst in the provided format,
+// running the same pipeline as the command line tool. The supported formats are svg, pdf, json, csv,
+// gif and the raster formats supported by Encode, which can be given as file extensions too, like ".svg".
+// An animated GIF source is triangulated frame by frame in case of the gif format, otherwise the gif
+// output shows the triangulation being built up. The processing statistics are populated in the
+// Stats field of the processor, in case it's defined.
+func Run(src io.Reader, dst io.Writer, format string, p *Processor) error {
+	return RunContext(context.Background(), src, dst, format, p)
+}
+
+// RunContext is like Run, but it aborts the triangulation process as soon as the context
+// is cancelled or its deadline is exceeded, returning the context error.
+func RunContext(ctx context.Context, src io.Reader, dst io.Writer, format string, p *Processor) error {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if err := checkBgColor(format, p); err != nil {
+		return err
+	}
+
+	switch format {
+	case "svg", "pdf":
+		svg := newSVG(p)
+		img, err := svg.DecodeImage(src)
+		if err != nil {
+			return err
+		}
+		if _, _, _, err := svg.DrawContext(ctx, img, *p, func() {}); err != nil {
+			return err
+		}
+
+		if format == "pdf" {
+			return svg.RenderPDF(dst)
+		}
+		return svg.Render(dst)
+	case "gif":
+		tri := &Image{Processor: *p}
+		b, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+
+		// The frames of an animated GIF are triangulated one by one, otherwise
+		// the output shows the triangulation of the source image being built up.
+		var anim *gif.GIF
+		if g, err := gif.DecodeAll(bytes.NewReader(b)); err == nil && len(g.Image) > 1 {
+			if anim, err = TriangulateGIFContext(ctx, g, *p); err != nil {
+				return err
+			}
+		} else {
+			img, err := tri.DecodeImage(bytes.NewReader(b))
+			if err != nil {
+				return err
+			}
+			if anim, _, _, err = tri.DrawGIF(ctx, img, *p, func() {}); err != nil {
+				return err
+			}
+		}
+		return gif.EncodeAll(dst, anim)
+	case "json", "csv":
+		tri := &Image{Processor: *p}
+		img, err := tri.DecodeImage(src)
+		if err != nil {
+			return err
+		}
+		_, triangles, points, err := tri.DrawContext(ctx, img, *p, func() {})
+		if err != nil {
+			return err
+		}
+
+		mesh := NewMesh(triangles, points, img.Bounds().Dx(), img.Bounds().Dy())
+		if format == "csv" {
+			return WriteMeshCSV(dst, *mesh)
+		}
+		b, err := json.Marshal(mesh)
+		if err != nil {
+			return err
+		}
+		_, err = dst.Write(b)
+		return err
+	default:
+		tri := &Image{Processor: *p}
+		img, err := tri.DecodeImage(src)
+		if err != nil {
+			return err
+		}
+		var res image.Image
+		if res, _, _, err = tri.DrawContext(ctx, img, *p, func() {}); err != nil {
+			return err
+		}
+		return writeImage(dst, res, format, p)
+	}
+}
+
+// RunWithSVG is like RunContext, but it writes the SVG output of the same triangulation to svgDst too, besides the
+// raster output written to dst in the provided format, which saves running the whole pipeline twice. The supported
+// formats are the single image raster formats supported by Encode, excluding gif. The triangles of both outputs are the same, as well as their colors.
+func RunWithSVG(ctx context.Context, src io.Reader, dst, svgDst io.Writer, format string, p *Processor) error {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	switch format {
+	case "svg", "pdf", "json", "csv", "gif":
+		return fmt.Errorf("the %s output can't be combined with the SVG output", format)
+	}
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if err := checkBgColor(format, p); err != nil {
+		return err
+	}
+
+	svg := newSVG(p)
+	if err := svg.supported(); err != nil {
+		return err
+	}
+	tri := &Image{Processor: *p}
+	img, err := tri.DecodeImage(src)
+	if err != nil {
+		return err
+	}
+
+	t, err := triangulateImage(ctx, img, nil, *p)
+	if err != nil {
+		return err
+	}
+	res, _, _, err := tri.render(t, func() {}, nil)
+	if err != nil {
+		return err
+	}
+	if err := writeImage(dst, res, format, p); err != nil {
+		return err
+	}
+	if _, _, _, err := svg.render(t, func() {}); err != nil {
+		return err
+	}
+	return svg.Render(svgDst)
+}
+
+// newSVG returns the SVG output of the processor, as generated by the command line tool.
+func newSVG(p *Processor) *SVG {
+	return &SVG{
+		Title:         "Image triangulator",
+		Lines:         []Line{},
+		Description:   "Convert images to computer generated art using delaunay triangulation.",
+		StrokeWidth:   p.StrokeWidth,
+		StrokeLineCap: "round", //butt, round, square
+		Processor:     *p,
+	}
+}
+
+// checkFormat checks if the output format is supported, so the image is not triangulated in vain otherwise.
+func checkFormat(format string) error {
+	switch format {
+	case "svg", "pdf", "json", "csv", "gif", "", "jpg", "jpeg", "png", "bmp", "webp", "ppm", "pgm":
+		return nil
+	}
+	return fmt.Errorf("unsupported image format: %q", format)
+}
+
+// checkBgColor checks if the background color of the processor can be encoded in the provided format,
+// since the transparency of the background color is preserved only by the PNG and WebP encoders.
+func checkBgColor(format string, p *Processor) error {
+	if p.BgColor == "" {
+		return nil
+	}
+	bgColor, err := ParseHexColor(p.BgColor)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "", "jpg", "jpeg", "bmp", "gif", "ppm", "pgm":
+		if bgColor.A < 255 {
+			return errors.New("a transparent background color requires a PNG or WebP output")
+		}
+	}
+	return nil
+}
+
+// writeImage encodes the raster image in the provided format and writes it to dst.
+func writeImage(dst io.Writer, img image.Image, format string, p *Processor) error {
+	// The grayscale output is written as a graymap, even in case a pixmap is requested.
+	if format == "ppm" && p.Grayscale {
+		format = "pgm"
+	}
+	b, err := Encode(img, format, EncodeOptions{Quality: p.Quality})
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(b)
+	return err
+}
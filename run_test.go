@@ -0,0 +1,213 @@
+package triangle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, newTestImage(120, 80)); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats Stats
+	p := newTestProcessor()
+	p.Stats = &stats
+
+	var dst bytes.Buffer
+	if err := Run(bytes.NewReader(src.Bytes()), &dst, "svg", &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Triangles == 0 {
+		t.Fatal("expected the triangles to be generated")
+	}
+
+	// The output has to be a well formed SVG document with a path element for each triangle.
+	var paths int
+	dec := xml.NewDecoder(&dst)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if el, ok := tok.(xml.StartElement); ok && el.Name.Local == "path" {
+			paths++
+		}
+	}
+	if paths != stats.Triangles {
+		t.Errorf("expected %d path elements, got %d", stats.Triangles, paths)
+	}
+
+	// The CSV output has a row for each triangle after the header row.
+	dst.Reset()
+	if err := Run(bytes.NewReader(src.Bytes()), &dst, ".csv", &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rows := strings.Count(dst.String(), "\n"); rows != stats.Triangles+1 {
+		t.Errorf("expected %d CSV rows, got %d", stats.Triangles+1, rows)
+	}
+
+	// The unsupported format is rejected before the source is decoded.
+	if err := Run(strings.NewReader(""), &dst, "tiff", &p); err == nil || !strings.Contains(err.Error(), "unsupported image format") {
+		t.Errorf("expected an error for the unsupported format, got %v", err)
+	}
+}
+
+func TestRunWithSVG(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, newTestImage(120, 80)); err != nil {
+		t.Fatal(err)
+	}
+	var stats Stats
+	p := newTestProcessor()
+	p.Stats = &stats
+	p.Precision = 3
+
+	var raster, svg bytes.Buffer
+	if err := RunWithSVG(context.Background(), bytes.NewReader(src.Bytes()), &raster, &svg, "png", &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(&raster)
+	if err != nil {
+		t.Fatalf("unable to decode the raster output: %v", err)
+	}
+
+	// Both outputs render the same triangles, so the raster output has the fill color of every SVG path at its centroid.
+	var paths, checked, matches int
+	dec := xml.NewDecoder(&svg)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok || el.Name.Local != "path" {
+			continue
+		}
+		paths++
+		var fill, d string
+		for _, attr := range el.Attr {
+			switch attr.Name.Local {
+			case "fill":
+				fill = attr.Value
+			case "d":
+				d = attr.Value
+			}
+		}
+		var x0, y0, x1, y1, x2, y2, x3, y3 float64
+		if _, err := fmt.Sscanf(d, "M%f,%f L%f,%f L%f,%f L%f,%f", &x0, &y0, &x1, &y1, &x2, &y2, &x3, &y3); err != nil {
+			t.Fatalf("unable to parse the path %q: %v", d, err)
+		}
+		// The centroids of the thin triangles are too close to the antialiased edges.
+		tri := Triangle{Nodes: []Node{{x0, y0}, {x1, y1}, {x2, y2}}}
+		perimeter := math.Hypot(x1-x0, y1-y0) + math.Hypot(x2-x1, y2-y1) + math.Hypot(x0-x2, y0-y2)
+		if 2*tri.Area()/perimeter < 2 {
+			continue
+		}
+		checked++
+		r, g, b, _ := img.At(int((x0+x1+x2)/3), int((y0+y1+y2)/3)).RGBA()
+		if fill == fmt.Sprintf("rgba(%d,%d,%d,255)", r>>8, g>>8, b>>8) {
+			matches++
+		}
+	}
+	if paths != stats.Triangles {
+		t.Errorf("expected %d path elements, got %d", stats.Triangles, paths)
+	}
+	if checked == 0 || matches != checked {
+		t.Errorf("expected the raster output to have the fill colors of the SVG paths, got %d matches of %d paths", matches, checked)
+	}
+
+	for _, format := range []string{"svg", "gif", "json"} {
+		if err := RunWithSVG(context.Background(), bytes.NewReader(src.Bytes()), &raster, &svg, format, &p); err == nil {
+			t.Errorf("%s: expected an error", format)
+		}
+	}
+}
+
+func TestRun_MeshColors(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, newTestImage(120, 80)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The colors of the triangles are exported even in case the cells are drawn instead of the triangles.
+	for _, tc := range []struct {
+		name   string
+		modify func(p *Processor)
+	}{
+		{"Voronoi", func(p *Processor) { p.Voronoi = true }},
+		{"HexGrid", func(p *Processor) { p.Tessellation, p.CellSize = HexGrid, 20 }},
+	} {
+		p := newTestProcessor()
+		tc.modify(&p)
+
+		var dst bytes.Buffer
+		if err := Run(bytes.NewReader(src.Bytes()), &dst, "json", &p); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		var mesh Mesh
+		if err := json.Unmarshal(dst.Bytes(), &mesh); err != nil {
+			t.Fatalf("%s: unable to decode the JSON output: %v", tc.name, err)
+		}
+		if len(mesh.Colors) == 0 {
+			t.Fatalf("%s: expected the triangles to be exported", tc.name)
+		}
+		for _, c := range mesh.Colors {
+			if c == (color.RGBA{A: 255}) {
+				t.Errorf("%s: expected the colors sampled from the image, got %v", tc.name, c)
+				break
+			}
+		}
+
+		dst.Reset()
+		if err := Run(bytes.NewReader(src.Bytes()), &dst, "csv", &p); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if strings.Contains(dst.String(), ",0,0,0,") {
+			t.Errorf("%s: expected the CSV colors sampled from the image", tc.name)
+		}
+	}
+}
+
+func TestRun_TransparentJPEG(t *testing.T) {
+	// An opaque subject in the middle of a transparent image.
+	img := image.NewNRGBA(image.Rect(0, 0, 120, 80))
+	for y := 20; y < 60; y++ {
+		for x := 30; x < 90; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 2), G: uint8(y * 3), B: 90, A: 255})
+		}
+	}
+	var src bytes.Buffer
+	if err := png.Encode(&src, img); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestProcessor()
+	var dst bytes.Buffer
+	if err := Run(bytes.NewReader(src.Bytes()), &dst, "jpg", &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err := jpeg.Decode(&dst)
+	if err != nil {
+		t.Fatalf("unable to decode the JPEG output: %v", err)
+	}
+
+	// The transparent areas are filled with white instead of black.
+	for _, pt := range []image.Point{{0, 0}, {119, 0}, {0, 79}, {119, 79}} {
+		r, g, b, _ := res.At(pt.X, pt.Y).RGBA()
+		if r>>8 < 240 || g>>8 < 240 || b>>8 < 240 {
+			t.Errorf("expected a white background at %v, got %v", pt, res.At(pt.X, pt.Y))
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// CentroidColor - fills the triangle with the color of the pixel found at its centroid
+	CentroidColor = iota
+	// AverageColor - fills the triangle with the average color of the pixels it covers
+	AverageColor
+	// DominantColor - fills the triangle with the dominant color of the pixels it covers
+	DominantColor
+)
+
+const (
+	// maxSampledPixels limits the number of pixels used for computing the dominant color of large triangles.
+	maxSampledPixels = 1024
+	// dominantClusters defines the number of k-means clusters the covered pixels are grouped into.
+	dominantClusters = 3
+	// kmeansIterations defines the number of iterations the k-means clustering is refined.
+	kmeansIterations = 8
+)
+
+// sampleColor returns the fill color of the triangle sampled from the image using the ColorSampling option.
+func (p Processor) sampleColor(img *image.NRGBA, t Triangle) color.NRGBA {
+	switch p.ColorSampling {
+	case AverageColor:
+		if pixels := trianglePixels(img, t, 0); len(pixels) > 0 {
+			return averageColor(pixels, p.GammaCorrect)
+		}
+	case DominantColor:
+		if pixels := trianglePixels(img, t, maxSampledPixels); len(pixels) > 0 {
+			return dominantColor(pixels)
+		}
+	}
+	return centroidColor(img, t)
+}
+
+// sampleColor64 is like sampleColor, but it returns the fill color at 16 bits per channel. In case the src64 image
+// is not nil, the colors are read from it instead of the 8-bit image, which has to be the same size. The average
+// color keeps the fractional part lost by the 8-bit one, while the dominant color is always computed at 8 bits.
+func (p Processor) sampleColor64(img *image.NRGBA, src64 *image.NRGBA64, t Triangle) color.NRGBA64 {
+	// The offset of a pixel of the 16-bit image is twice the offset of the same pixel of the 8-bit image.
+	channel := func(j, c int) int {
+		if src64 != nil {
+			return int(src64.Pix[j*2+c*2])<<8 | int(src64.Pix[j*2+c*2+1])
+		}
+		return int(img.Pix[j+c]) * 0x101
+	}
+
+	switch p.ColorSampling {
+	case AverageColor:
+		// The color channels are averaged as linear light intensities in case of the GammaCorrect option.
+		var sum [4]float64
+		n := 0
+		scanTriangle(img, t, func(j int) {
+			for c := range sum {
+				v := float64(channel(j, c))
+				if p.GammaCorrect && c < 3 {
+					v = decodeSRGB(v / 0xffff)
+				}
+				sum[c] += v
+			}
+			n++
+		})
+		if n > 0 {
+			var avg [4]uint16
+			for c, v := range sum {
+				v /= float64(n)
+				if p.GammaCorrect && c < 3 {
+					v = math.Round(encodeSRGB(v) * 0xffff)
+				}
+				avg[c] = uint16(v)
+			}
+			return color.NRGBA64{R: avg[0], G: avg[1], B: avg[2], A: avg[3]}
+		}
+	case DominantColor:
+		c := p.sampleColor(img, t)
+		return color.NRGBA64{R: uint16(c.R) * 0x101, G: uint16(c.G) * 0x101, B: uint16(c.B) * 0x101, A: uint16(c.A) * 0x101}
+	}
+
+	p0, p1, p2 := t.Nodes[0], t.Nodes[1], t.Nodes[2]
+	cx := float64(p0.X+p1.X+p2.X) * 0.33333
+	cy := float64(p0.Y+p1.Y+p2.Y) * 0.33333
+
+	j := (int(cx) + int(cy)*img.Bounds().Dx()) * 4
+	return color.NRGBA64{R: uint16(channel(j, 0)), G: uint16(channel(j, 1)), B: uint16(channel(j, 2)), A: uint16(channel(j, 3))}
+}
+
+// fillPalette computes the palette of PaletteSize colors the fill colors are quantized to from the image,
+// using the median cut algorithm. It returns nil in case the PaletteSize option is not set.
+func (p Processor) fillPalette(img *image.NRGBA) color.Palette {
+	if p.PaletteSize < 1 {
+		return nil
+	}
+	// The transparency of the fills is preserved separately, so only the opaque palette colors are used.
+	pal, _ := medianCut([]*image.NRGBA{img}, p.PaletteSize, false)
+	return pal
+}
+
+// snapColor returns the palette color closest to the color, keeping its alpha channel.
+func snapColor(pal color.Palette, c color.NRGBA) color.NRGBA {
+	pc := pal[nearestColor(pal, false, c.R, c.G, c.B)].(color.RGBA)
+	return color.NRGBA{R: pc.R, G: pc.G, B: pc.B, A: c.A}
+}
+
+// centroidColor returns the color of the pixel found at the triangle centroid.
+func centroidColor(img *image.NRGBA, t Triangle) color.NRGBA {
+	p0, p1, p2 := t.Nodes[0], t.Nodes[1], t.Nodes[2]
+	cx := float64(p0.X+p1.X+p2.X) * 0.33333
+	cy := float64(p0.Y+p1.Y+p2.Y) * 0.33333
+
+	j := (int(cx) + int(cy)*img.Bounds().Dx()) * 4
+	return color.NRGBA{R: img.Pix[j], G: img.Pix[j+1], B: img.Pix[j+2], A: img.Pix[j+3]}
+}
+
+// trianglePixels collects the colors of the pixels whose center is inside the triangle.
+// In case limit is greater than 0, the pixels are subsampled evenly to not exceed it.
+func trianglePixels(img *image.NRGBA, t Triangle, limit int) []color.NRGBA {
+	var pixels []color.NRGBA
+
+	count := 0
+	scanTriangle(img, t, func(int) { count++ })
+
+	step := 1
+	if limit > 0 && count > limit {
+		step = (count + limit - 1) / limit
+	}
+
+	i := 0
+	scanTriangle(img, t, func(j int) {
+		if i%step == 0 {
+			pixels = append(pixels, color.NRGBA{R: img.Pix[j], G: img.Pix[j+1], B: img.Pix[j+2], A: img.Pix[j+3]})
+		}
+		i++
+	})
+	return pixels
+}
+
+// scanTriangle calls fn with the Pix offset of every image pixel whose center is inside the triangle.
+func scanTriangle(img *image.NRGBA, t Triangle, fn func(offset int)) {
+	p0, p1, p2 := t.Nodes[0], t.Nodes[1], t.Nodes[2]
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// The signed area is used for normalizing the orientation of the edge functions.
+	area := (p1.X-p0.X)*(p2.Y-p0.Y) - (p2.X-p0.X)*(p1.Y-p0.Y)
+	if area == 0 {
+		return
+	}
+	edge := func(a, b Node, x, y float64) float64 {
+		return ((b.X-a.X)*(y-a.Y) - (b.Y-a.Y)*(x-a.X)) * area
+	}
+
+	minX := Max(int(math.Floor(Min(p0.X, p1.X, p2.X))), 0)
+	maxX := Min(int(math.Ceil(Max(p0.X, p1.X, p2.X))), width-1)
+	minY := Max(int(math.Floor(Min(p0.Y, p1.Y, p2.Y))), 0)
+	maxY := Min(int(math.Ceil(Max(p0.Y, p1.Y, p2.Y))), height-1)
+
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			if edge(p0, p1, px, py) >= 0 && edge(p1, p2, px, py) >= 0 && edge(p2, p0, px, py) >= 0 {
+				fn(y*img.Stride + x*4)
+			}
+		}
+	}
+}
+
+// averageColor returns the average of the colors. In case linear is true, the color channels are averaged
+// as linear light intensities, so the blends of the saturated colors are not darkened.
+func averageColor(pixels []color.NRGBA, linear bool) color.NRGBA {
+	if linear {
+		var r, g, b float64
+		var a int
+		for _, c := range pixels {
+			r += srgbToLinear[c.R]
+			g += srgbToLinear[c.G]
+			b += srgbToLinear[c.B]
+			a += int(c.A)
+		}
+		n := float64(len(pixels))
+		return color.NRGBA{R: linearToSRGB(r / n), G: linearToSRGB(g / n), B: linearToSRGB(b / n), A: uint8(a / len(pixels))}
+	}
+
+	var r, g, b, a int
+	for _, c := range pixels {
+		r += int(c.R)
+		g += int(c.G)
+		b += int(c.B)
+		a += int(c.A)
+	}
+	n := len(pixels)
+	return color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)}
+}
+
+// dominantColor groups the colors into clusters using the k-means algorithm
+// and returns the centroid of the most populous cluster.
+func dominantColor(pixels []color.NRGBA) color.NRGBA {
+	dist := func(c color.NRGBA, k [4]float64) float64 {
+		dr, dg := float64(c.R)-k[0], float64(c.G)-k[1]
+		db, da := float64(c.B)-k[2], float64(c.A)-k[3]
+		return dr*dr + dg*dg + db*db + da*da
+	}
+	nearest := func(c color.NRGBA, centroids [][4]float64) int {
+		idx, minDist := 0, math.MaxFloat64
+		for i, k := range centroids {
+			if d := dist(c, k); d < minDist {
+				idx, minDist = i, d
+			}
+		}
+		return idx
+	}
+
+	// Initialize the centroids deterministically, picking each time the color farthest from the existing ones.
+	c := pixels[0]
+	centroids := [][4]float64{{float64(c.R), float64(c.G), float64(c.B), float64(c.A)}}
+	for len(centroids) < dominantClusters {
+		far, farDist := -1, 0.0
+		for i, c := range pixels {
+			if d := dist(c, centroids[nearest(c, centroids)]); d > farDist {
+				far, farDist = i, d
+			}
+		}
+		if far < 0 {
+			break
+		}
+		c := pixels[far]
+		centroids = append(centroids, [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)})
+	}
+
+	counts := make([]int, len(centroids))
+	for iter := 0; iter < kmeansIterations; iter++ {
+		sums := make([][4]float64, len(centroids))
+		for i := range counts {
+			counts[i] = 0
+		}
+		for _, c := range pixels {
+			k := nearest(c, centroids)
+			sums[k][0] += float64(c.R)
+			sums[k][1] += float64(c.G)
+			sums[k][2] += float64(c.B)
+			sums[k][3] += float64(c.A)
+			counts[k]++
+		}
+		for k := range centroids {
+			if counts[k] == 0 {
+				continue
+			}
+			for ch := 0; ch < 4; ch++ {
+				centroids[k][ch] = sums[k][ch] / float64(counts[k])
+			}
+		}
+	}
+
+	best := 0
+	for k := range counts {
+		if counts[k] > counts[best] {
+			best = k
+		}
+	}
+	k := centroids[best]
+	return color.NRGBA{
+		R: uint8(math.Round(k[0])),
+		G: uint8(math.Round(k[1])),
+		B: uint8(math.Round(k[2])),
+		A: uint8(math.Round(k[3])),
+	}
+}
@@ -0,0 +1,108 @@
+package triangle
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestSampleColor_Dominant(t *testing.T) {
+	// The triangle is mostly red, having only a small blue patch around its centroid.
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	red := color.NRGBA{R: 220, G: 30, B: 30, A: 255}
+	blue := color.NRGBA{R: 20, G: 40, B: 200, A: 255}
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			if x > 25 && x < 40 && y > 25 && y < 40 {
+				img.SetNRGBA(x, y, blue)
+			} else {
+				img.SetNRGBA(x, y, red)
+			}
+		}
+	}
+	tri := Triangle{Nodes: []Node{{X: 0, Y: 0}, {X: 99, Y: 0}, {X: 0, Y: 99}}}
+
+	proc := Processor{ColorSampling: DominantColor}
+	if c := proc.sampleColor(img, tri); c != red {
+		t.Errorf("expected the dominant color %v, got %v", red, c)
+	}
+
+	proc.ColorSampling = CentroidColor
+	if c := proc.sampleColor(img, tri); c != blue {
+		t.Errorf("expected the centroid color %v, got %v", blue, c)
+	}
+
+	proc.ColorSampling = AverageColor
+	if c := proc.sampleColor(img, tri); c == red || c == blue || c.R < blue.R || c.R > red.R {
+		t.Errorf("expected a color between %v and %v, got %v", red, blue, c)
+	}
+}
+
+func TestSampleColor_UnmodifiedSource(t *testing.T) {
+	// The channels differ, so the colors would be off in case only the red channel of the source was blurred or convolved.
+	src := image.NewNRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			c := color.NRGBA{R: uint8(x * 2), G: uint8(y * 3), B: uint8(255 - x), A: 255}
+			if x > 30 && x < 90 && y > 20 && y < 60 {
+				c.R, c.G = 255-c.R, 255-c.G
+			}
+			src.SetNRGBA(x, y, c)
+		}
+	}
+	orig := image.NewNRGBA(src.Bounds())
+	copy(orig.Pix, src.Pix)
+
+	for _, sampling := range []int{CentroidColor, AverageColor} {
+		proc := newTestProcessor()
+		proc.ColorSampling = sampling
+
+		mesh, _, err := proc.DrawMesh(context.Background(), src)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(mesh) == 0 {
+			t.Fatal("expected the triangles to be generated")
+		}
+		// The colors sampled by the pipeline are the same as the ones sampled from the original source.
+		for _, ct := range mesh {
+			expected := color.RGBAModel.Convert(proc.sampleColor(orig, ct.Triangle)).(color.RGBA)
+			if ct.Fill != expected {
+				t.Fatalf("expected the fill color %v sampled from the source, got %v", expected, ct.Fill)
+			}
+		}
+	}
+}
+
+func TestAverageColor_GammaCorrect(t *testing.T) {
+	pixels := []color.NRGBA{{R: 255, A: 255}, {G: 255, A: 255}}
+
+	naive := averageColor(pixels, false)
+	if naive != (color.NRGBA{R: 127, G: 127, A: 255}) {
+		t.Errorf("expected the sRGB average to be the halves of the channels, got %v", naive)
+	}
+	// The half of the linear intensity is encoded as 188 in sRGB, so the blend is brighter than the naive one.
+	linear := averageColor(pixels, true)
+	if linear != (color.NRGBA{R: 188, G: 188, A: 255}) {
+		t.Errorf("expected the linear average to be the encoded half intensity, got %v", linear)
+	}
+}
+
+func TestFillPalette_Transparent(t *testing.T) {
+	// Two opaque colors next to a transparent area.
+	img := image.NewNRGBA(image.Rect(0, 0, 30, 10))
+	draw.Draw(img, image.Rect(0, 0, 10, 10), &image.Uniform{C: color.NRGBA{R: 200, A: 255}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(10, 0, 20, 10), &image.Uniform{C: color.NRGBA{B: 200, A: 255}}, image.Point{}, draw.Src)
+
+	pal := Processor{PaletteSize: 2}.fillPalette(img)
+	if len(pal) != 2 {
+		t.Fatalf("expected 2 palette colors, got %v", pal)
+	}
+	for _, c := range pal {
+		if _, _, _, a := c.RGBA(); a != 0xffff {
+			t.Errorf("expected only opaque palette colors, got %v", pal)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package triangle
 import (
 	"image"
 	"image/color"
+	"image/draw"
 	"math"
 )
 
@@ -15,35 +16,64 @@ type seed struct {
 }
 
 // addNoise applies a noise factor, like Adobe's grain filter in order to create a despeckle like image.
-func addNoise(amount int, src *image.RGBA) {
+// In case of the chromatic noise each color channel gets its own offset, otherwise the same offset is added
+// to every channel, resulting in a monochrome grain. The channel values are clamped to the valid range.
+// The 16-bit per channel images keep their precision, the noise being applied on the same 8-bit scale.
+func addNoise(amount int, chromatic bool, seed int64, src draw.Image) {
+	_, deep := src.(*image.RGBA64)
 	size := src.Bounds().Size()
-	s := &seed{
-		a:         16807,
-		m:         0x7fffffff,
-		randomNum: 1.0,
-		div:       1.0 / 0x7fffffff,
-	}
+	s := newSeed(seed)
+
 	for x := 0; x < size.X; x++ {
 		for y := 0; y < size.Y; y++ {
-			noise := (s.random() - 0.01) * float64(amount)
 			r, g, b, a := src.At(x, y).RGBA()
-			rf, gf, bf := float64(r>>8), float64(g>>8), float64(b>>8)
+			rf, gf, bf := float64(r)/0x101, float64(g)/0x101, float64(b)/0x101
 
-			// Check if color does not overflow the maximum limit after noise has been applied.
-			if math.Abs(rf+noise) < 255 && math.Abs(gf+noise) < 255 && math.Abs(bf+noise) < 255 {
+			noise := (s.random() - 0.01) * float64(amount)
+			if chromatic {
 				rf += noise
-				gf += noise
-				bf += noise
+				gf += (s.random() - 0.01) * float64(amount)
+				bf += (s.random() - 0.01) * float64(amount)
+			} else {
+				rf, gf, bf = rf+noise, gf+noise, bf+noise
 			}
-			r2 := Max(0, Min(255, uint8(rf)))
-			g2 := Max(0, Min(255, uint8(gf)))
-			b2 := Max(0, Min(255, uint8(bf)))
+			rf, gf, bf = clampChannel(rf), clampChannel(gf), clampChannel(bf)
 
-			src.Set(x, y, color.RGBA{R: r2, G: g2, B: b2, A: uint8(a)})
+			if deep {
+				src.Set(x, y, color.RGBA64{
+					R: uint16(rf * 0x101),
+					G: uint16(gf * 0x101),
+					B: uint16(bf * 0x101),
+					A: uint16(a),
+				})
+				continue
+			}
+			src.Set(x, y, color.RGBA{R: uint8(rf), G: uint8(gf), B: uint8(bf), A: uint8(a)})
 		}
 	}
 }
 
+// clampChannel clamps the color channel value to the [0, 255] range.
+// The value is clamped before being converted to an integer, which would otherwise wrap around.
+func clampChannel(v float64) float64 {
+	return math.Max(0, math.Min(255, v))
+}
+
+// newSeed returns the random number generator of the noise filter, seeded with n.
+// The generator's seed has to be in the [1, m-1] range, so 0 selects the default seed, which is 1.
+func newSeed(n int64) *seed {
+	s := &seed{
+		a:         16807,
+		m:         0x7fffffff,
+		randomNum: 1.0,
+		div:       1.0 / 0x7fffffff,
+	}
+	if n := int(uint64(n) % uint64(s.m-1)); n != 0 {
+		s.randomNum = n
+	}
+	return s
+}
+
 // nextLongRand retrieve the next long random number.
 func (s *seed) nextLongRand(seed int) int {
 	lo := s.a * (seed & 0xffff)
@@ -0,0 +1,104 @@
+package triangle
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// newUniformRGBA returns an image filled with the color.
+func newUniformRGBA(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: c}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestAddNoise_Clamping(t *testing.T) {
+	for _, v := range []uint8{0, 255} {
+		img := newUniformRGBA(40, 30, color.RGBA{R: v, G: v, B: v, A: 255})
+		addNoise(200, false, 0, img)
+
+		// The pixels are visited column by column, each one consuming a single random number in the monochrome mode.
+		s := newSeed(0)
+		for x := 0; x < 40; x++ {
+			for y := 0; y < 30; y++ {
+				expected := uint8(clampChannel(float64(v) + (s.random()-0.01)*200))
+				if c := img.RGBAAt(x, y); c.R != expected || c.G != expected || c.B != expected {
+					t.Fatalf("expected the value %d clamped to %d at (%d, %d), got %v", v, expected, x, y, c)
+				}
+			}
+		}
+	}
+}
+
+func TestAddNoise_Modes(t *testing.T) {
+	gray := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+
+	mono := newUniformRGBA(40, 30, gray)
+	addNoise(50, false, 0, mono)
+	for i := 0; i < len(mono.Pix); i += 4 {
+		if mono.Pix[i] != mono.Pix[i+1] || mono.Pix[i] != mono.Pix[i+2] {
+			t.Fatalf("expected the monochrome noise to keep the pixels gray, got %v", mono.Pix[i:i+4])
+		}
+	}
+
+	chromatic := newUniformRGBA(40, 30, gray)
+	addNoise(50, true, 0, chromatic)
+	var colored int
+	for i := 0; i < len(chromatic.Pix); i += 4 {
+		if chromatic.Pix[i] != chromatic.Pix[i+1] || chromatic.Pix[i] != chromatic.Pix[i+2] {
+			colored++
+		}
+	}
+	if colored < len(chromatic.Pix)/8 {
+		t.Errorf("expected most pixels to be colored by the chromatic noise, got %d of %d", colored, len(chromatic.Pix)/4)
+	}
+
+	// The same seed generates the same pattern, while a different one generates another.
+	seeded := func(seed int64) []uint8 {
+		img := newUniformRGBA(40, 30, gray)
+		addNoise(50, true, seed, img)
+		return img.Pix
+	}
+	if !bytes.Equal(seeded(0), chromatic.Pix) || !bytes.Equal(seeded(7), seeded(7)) {
+		t.Error("expected the same seed to generate the same noise")
+	}
+	if bytes.Equal(seeded(7), seeded(8)) {
+		t.Error("expected different seeds to generate different noise")
+	}
+}
+
+func TestDraw_NoiseWraparound(t *testing.T) {
+	// The noise is at most 0.99 times the noise factor, so any brighter pixel of the black image has wrapped around.
+	src := image.NewNRGBA(image.Rect(0, 0, 80, 60))
+	draw.Draw(src, src.Bounds(), &image.Uniform{C: color.NRGBA{A: 255}}, image.Point{}, draw.Src)
+
+	for _, output16Bit := range []bool{false, true} {
+		proc := newTestProcessor()
+		proc.Noise = 255
+		proc.Output16Bit = output16Bit
+
+		tri := &Image{Processor: proc}
+		res, _, _, err := tri.Draw(src, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var clamped int
+		for y := 0; y < 60; y++ {
+			for x := 0; x < 80; x++ {
+				r, _, _, _ := res.At(x, y).RGBA()
+				if float64(r) > 0.99*255*0x101 {
+					t.Fatalf("16-bit output %v: expected no wraparound at (%d, %d), got %d", output16Bit, x, y, r>>8)
+				}
+				if r == 0 {
+					clamped++
+				}
+			}
+		}
+		if clamped == 0 {
+			t.Errorf("16-bit output %v: expected the darkened pixels to be clamped to 0", output16Bit)
+		}
+	}
+}
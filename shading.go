@@ -0,0 +1,113 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// FlatShading - fills every triangle with a single color
+	FlatShading = iota
+	// SmoothShading - interpolates the colors sampled at the triangle vertices across the triangle (Gouraud shading)
+	SmoothShading
+)
+
+// vertexColors returns the colors of the image at the triangle vertices, replaced by the closest palette color
+// in case the palette is not nil. The vertices on the right and bottom border are sampled from the last pixels.
+func (p Processor) vertexColors(img *image.NRGBA, pal color.Palette, t Triangle) [3]color.NRGBA {
+	var colors [3]color.NRGBA
+
+	b := img.Bounds()
+	for i, n := range t.Nodes {
+		x := Min(Max(int(n.X), b.Min.X), b.Max.X-1)
+		y := Min(Max(int(n.Y), b.Min.Y), b.Max.Y-1)
+		c := img.NRGBAAt(x, y)
+		if pal != nil {
+			c = snapColor(pal, c)
+		}
+		colors[i] = c
+	}
+	return colors
+}
+
+// gouraud interpolates the colors of the triangle vertices at the pixels of the output image. It implements the
+// gg.Pattern interface, so the shaded triangles are filled with the same antialiasing as the flat ones.
+type gouraud struct {
+	nodes [3]Node
+	// colors holds the alpha-premultiplied vertex colors, in the [0, 0xffff] range.
+	colors [3][4]float64
+	det    float64
+	// linear is true in case the colors hold linear light intensities instead of sRGB encoded values.
+	linear bool
+}
+
+// newGouraud returns the shading of the triangle having the vertex colors, its nodes being scaled by sx and sy
+// to the output image size. In case opaque is true, the vertex colors are made opaque. In case linear is true,
+// the colors are interpolated as linear light intensities, encoded back to sRGB at every pixel.
+func newGouraud(t Triangle, colors [3]color.NRGBA, sx, sy float64, opaque, linear bool) *gouraud {
+	g := &gouraud{linear: linear}
+	for i, n := range t.Nodes {
+		g.nodes[i] = Node{n.X * sx, n.Y * sy}
+
+		c := colors[i]
+		if opaque {
+			c.A = 255
+		}
+		if linear {
+			a := float64(c.A) * 0x101
+			g.colors[i] = [4]float64{srgbToLinear[c.R] * a, srgbToLinear[c.G] * a, srgbToLinear[c.B] * a, a}
+			continue
+		}
+		r, gr, b, a := c.RGBA()
+		g.colors[i] = [4]float64{float64(r), float64(gr), float64(b), float64(a)}
+	}
+	n0, n1, n2 := g.nodes[0], g.nodes[1], g.nodes[2]
+	g.det = (n1.Y-n2.Y)*(n0.X-n2.X) + (n2.X-n1.X)*(n0.Y-n2.Y)
+	return g
+}
+
+// weights returns the barycentric coordinates of the point, clamped to the triangle, so the antialiased pixels
+// along its edges don't extrapolate the vertex colors.
+func (g *gouraud) weights(x, y float64) [3]float64 {
+	if g.det == 0 {
+		return [3]float64{1.0 / 3, 1.0 / 3, 1.0 / 3}
+	}
+	n0, n1, n2 := g.nodes[0], g.nodes[1], g.nodes[2]
+	w0 := ((n1.Y-n2.Y)*(x-n2.X) + (n2.X-n1.X)*(y-n2.Y)) / g.det
+	w1 := ((n2.Y-n0.Y)*(x-n2.X) + (n0.X-n2.X)*(y-n2.Y)) / g.det
+	w := [3]float64{math.Max(w0, 0), math.Max(w1, 0), math.Max(1-w0-w1, 0)}
+
+	sum := w[0] + w[1] + w[2]
+	for i := range w {
+		w[i] /= sum
+	}
+	return w
+}
+
+// colorAt64 returns the alpha-premultiplied color interpolated at the center of the pixel.
+func (g *gouraud) colorAt64(x, y int) color.RGBA64 {
+	w := g.weights(float64(x)+0.5, float64(y)+0.5)
+
+	var v [4]float64
+	for i := range v {
+		v[i] = math.Min(w[0]*g.colors[0][i]+w[1]*g.colors[1][i]+w[2]*g.colors[2][i], 0xffff)
+	}
+	// The linear intensities are encoded without the alpha, which is applied to the encoded values again.
+	if g.linear && v[3] > 0 {
+		for i := 0; i < 3; i++ {
+			v[i] = encodeSRGB(math.Min(v[i]/v[3], 1)) * v[3]
+		}
+	}
+
+	var c [4]uint16
+	for i := range c {
+		c[i] = uint16(math.Round(v[i]))
+	}
+	return color.RGBA64{R: c[0], G: c[1], B: c[2], A: c[3]}
+}
+
+// ColorAt returns the color interpolated at the center of the pixel.
+func (g *gouraud) ColorAt(x, y int) color.Color {
+	return g.colorAt64(x, y)
+}
@@ -0,0 +1,130 @@
+package triangle
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+// newRampImage returns an image whose color changes linearly in both directions.
+func newRampImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 2), G: uint8(y * 3), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestDraw_SmoothShading(t *testing.T) {
+	src := newRampImage(120, 80)
+
+	proc := newTestProcessor()
+	proc.SamplingMethod = UniformGrid
+	proc.MaxPoints = 40
+	proc.BgColor = "#ffffff"
+
+	draw := func(shading int, output16Bit bool) (*image.NRGBA, []Triangle) {
+		proc.Shading, proc.Output16Bit = shading, output16Bit
+		tri := &Image{Processor: proc}
+		res, triangles, _, err := tri.Draw(src, proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return ImgToNRGBA(res), triangles
+	}
+	flat, _ := draw(FlatShading, false)
+	smooth, triangles := draw(SmoothShading, false)
+	if bytes.Equal(flat.Pix, smooth.Pix) {
+		t.Fatal("expected the smooth shading to differ from the flat one")
+	}
+	smooth64, triangles64 := draw(SmoothShading, true)
+
+	// The colors of the ramp change linearly, so the colors interpolated between the vertices match the source colors,
+	// unlike the flat colors sampled at the centroids. The points between the vertices and the centroids are checked,
+	// unless they are close to the antialiased edges of the triangles.
+	check := func(img *image.NRGBA, triangles []Triangle) {
+		var checked int
+		for _, tri := range triangles {
+			cx, cy := tri.Centroid()
+			for _, n := range tri.Nodes {
+				x, y := int((n.X+cx)/2), int((n.Y+cy)/2)
+				if n.X < 10 || n.Y < 10 || n.X >= 110 || n.Y >= 70 || edgeDistance(tri, float64(x)+0.5, float64(y)+0.5) < 2 {
+					continue
+				}
+				checked++
+				got, want := img.NRGBAAt(x, y), src.NRGBAAt(x, y)
+				if absDiff(got.R, want.R) > 6 || absDiff(got.G, want.G) > 6 || absDiff(got.B, want.B) > 6 {
+					t.Fatalf("expected the color %v at (%d, %d), got %v", want, x, y, got)
+				}
+			}
+		}
+		if checked == 0 {
+			t.Fatal("expected inner points to be checked")
+		}
+	}
+	check(smooth, triangles)
+	check(smooth64, triangles64)
+}
+
+// edgeDistance returns the distance of the point from the closest edge of the triangle.
+func edgeDistance(t Triangle, x, y float64) float64 {
+	dist := math.Inf(1)
+	for i, a := range t.Nodes {
+		b := t.Nodes[(i+1)%3]
+		length := math.Hypot(b.X-a.X, b.Y-a.Y)
+		if length == 0 {
+			continue
+		}
+		dist = math.Min(dist, math.Abs((b.X-a.X)*(y-a.Y)-(b.Y-a.Y)*(x-a.X))/length)
+	}
+	return dist
+}
+
+func TestSVG_SmoothShading(t *testing.T) {
+	proc := newTestProcessor()
+	proc.SamplingMethod = UniformGrid
+	proc.MaxPoints = 40
+	proc.Shading = SmoothShading
+	proc.Compact = true
+
+	svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+	if _, _, _, err := svg.Draw(newRampImage(120, 80), proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := svg.Render(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "<linearGradient") || !strings.Contains(out, `fill="url(#shade`) {
+		t.Error("expected the triangles to be filled with gradients")
+	}
+}
+
+// absDiff returns the absolute difference of the two channel values.
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestGouraud_GammaCorrect(t *testing.T) {
+	tr := Triangle{Nodes: []Node{{0, 0}, {100, 0}, {0, 100}}}
+	colors := [3]color.NRGBA{{R: 255, A: 255}, {G: 255, A: 255}, {G: 255, A: 255}}
+
+	// The center of the pixel at (49, 0) is halfway between the red and the green vertex.
+	naive := newGouraud(tr, colors, 1, 1, true, false).colorAt64(49, 0)
+	linear := newGouraud(tr, colors, 1, 1, true, true).colorAt64(49, 0)
+	if linear.R <= naive.R || linear.G <= naive.G {
+		t.Errorf("expected the linear blend to be brighter than the sRGB one, got %v and %v", linear, naive)
+	}
+	if d := int(linear.R>>8) - 188; d < -2 || d > 2 {
+		t.Errorf("expected the red channel of the linear blend to be close to 188, got %v", linear.R>>8)
+	}
+}
@@ -7,6 +7,9 @@ import (
 
 type kernel [][]int32
 
+// sobelWeight is the sum of the positive Sobel kernel values, used for normalizing the other operators.
+const sobelWeight = 4
+
 var (
 	kernelX = kernel{
 		{-1, 0, 1},
@@ -19,82 +22,203 @@ var (
 		{0, 0, 0},
 		{1, 2, 1},
 	}
+
+	scharrKernelX = kernel{
+		{-3, 0, 3},
+		{-10, 0, 10},
+		{-3, 0, 3},
+	}
+
+	scharrKernelY = kernel{
+		{-3, -10, -3},
+		{0, 0, 0},
+		{3, 10, 3},
+	}
+
+	prewittKernelX = kernel{
+		{-1, 0, 1},
+		{-1, 0, 1},
+		{-1, 0, 1},
+	}
+
+	prewittKernelY = kernel{
+		{-1, -1, -1},
+		{0, 0, 0},
+		{1, 1, 1},
+	}
 )
 
+// edgeKernels returns the horizontal and vertical kernel pair of the provided edge detection operator.
+func edgeKernels(operator int) (kernel, kernel) {
+	switch operator {
+	case ScharrOperator:
+		return scharrKernelX, scharrKernelY
+	case PrewittOperator:
+		return prewittKernelX, prewittKernelY
+	default:
+		return kernelX, kernelY
+	}
+}
+
+// edgeBiasWeight is the factor the gradient across the edges not favored by the EdgeBias option is multiplied with.
+const edgeBiasWeight = 0.25
+
+// edgeBiasWeights returns the factors the horizontal and the vertical gradients are multiplied with,
+// weakening the edges not favored by the bias. The horizontal edges have a strong vertical gradient and vice versa.
+func edgeBiasWeights(bias int) (float64, float64) {
+	switch bias {
+	case HorizontalEdgeBias:
+		return edgeBiasWeight, 1
+	case VerticalEdgeBias:
+		return 1, edgeBiasWeight
+	default:
+		return 1, 1
+	}
+}
+
+// weight returns the sum of the positive kernel values.
+func (k kernel) weight() int32 {
+	var sum int32
+	for _, row := range k {
+		for _, v := range row {
+			if v > 0 {
+				sum += v
+			}
+		}
+	}
+	return sum
+}
+
 // SobelFilter uses the sobel threshold operator to detect the image edges.
 // See https://en.wikipedia.org/wiki/Sobel_operator
 func SobelFilter(img *image.NRGBA, threshold float64) *image.NRGBA {
+	return new(scratch).edgeFilter(img, threshold, kernelX, kernelY, NoEdgeBias, 1)
+}
+
+// edgeFilter detects the image edges by computing the gradient magnitude with the provided kernel pair.
+// The magnitude is normalized to the Sobel operator's scale, so the same threshold can be used with every kernel.
+// The gradients are weighted according to the edge bias, weakening the edges not favored by it.
+// The magnitude is computed on the first channels of the image, the largest one being kept, so the grayscale images
+// are filtered by a single channel, while the color images are filtered by their red, green and blue channels.
+func (s *scratch) edgeFilter(img *image.NRGBA, threshold float64, kernelX, kernelY kernel, bias, channels int) *image.NRGBA {
 	var sumX, sumY int32
 	dx, dy := img.Bounds().Max.X, img.Bounds().Max.Y
-	dst := image.NewNRGBA(img.Bounds())
-
-	// Get 3x3 window of pixels because image data given is just a 1D array of pixels
-	maxPixelOffset := dx*2 + len(kernelX) - 1
-
-	data := getImageData(img)
-	length := len(data)*4 - maxPixelOffset
-	magnitudes := make([]uint8, length)
-
-	for i := 0; i < length; i++ {
-		// Sum each pixel with the kernel value
-		sumX, sumY = 0, 0
-		for x := 0; x < len(kernelX); x++ {
-			for y := 0; y < len(kernelY); y++ {
-				if idx := i + (dx * y) + x; idx < len(data) {
-					r := data[i+(dx*y)+x]
-					sumX += int32(r) * kernelX[y][x]
-					sumY += int32(r) * kernelY[y][x]
-				}
-			}
-		}
-		magnitude := math.Sqrt(float64(sumX*sumX) + float64(sumY*sumY))
-		// Check for pixel color boundaries
-		if magnitude < 0 {
-			magnitude = 0
-		} else if magnitude > 255 {
-			magnitude = 255
-		}
+	norm := sobelWeight / float64(kernelX.weight())
+	wx, wy := edgeBiasWeights(bias)
 
-		// Set magnitude to 0 if doesn't exceed threshold, else set to magnitude
-		if magnitude > threshold {
-			magnitudes[i] = uint8(magnitude)
-		} else {
-			magnitudes[i] = 0
-		}
+	s.edges = reuseImage(s.edges, img.Bounds())
+	s.magnitudes = reuseSlice(s.magnitudes, dx*dy)
+	dst, magnitudes := s.edges, s.magnitudes
+	for i := range magnitudes {
+		magnitudes[i] = 0
 	}
 
-	dataLength := dx * dy * 4
-	edges := make([]int32, dataLength)
+	for c := 0; c < channels; c++ {
+		s.data = getChannelData(s.data, img, c)
+		data := s.data
 
-	// Apply the kernel values
-	for i := 0; i < dataLength; i++ {
-		edges[i] = 0
-		if i%4 != 0 {
-			m := magnitudes[i/4]
-			if m != 0 {
-				edges[i-1] = int32(m)
+		for i := 0; i < len(magnitudes); i++ {
+			sumX, sumY = gradient(data, dx, i, kernelX, kernelY)
+			magnitude := math.Sqrt(float64(sumX*sumX)*wx*wx+float64(sumY*sumY)*wy*wy) * norm
+			// Check for pixel color boundaries
+			if magnitude < 0 {
+				magnitude = 0
+			} else if magnitude > 255 {
+				magnitude = 255
+			}
+
+			// Keep the magnitude if it exceeds the threshold and the magnitude of the previous channels.
+			if magnitude > threshold && uint8(magnitude) > magnitudes[i] {
+				magnitudes[i] = uint8(magnitude)
 			}
 		}
 	}
 
 	// Generate the new image with the sobel filter applied
-	for idx := 0; idx < len(edges); idx += 4 {
-		dst.Pix[idx] = uint8(edges[idx])
-		dst.Pix[idx+1] = uint8(edges[idx+1])
-		dst.Pix[idx+2] = uint8(edges[idx+2])
+	for i, m := range magnitudes {
+		idx := i * 4
+		dst.Pix[idx] = m
+		dst.Pix[idx+1] = m
+		dst.Pix[idx+2] = m
 		dst.Pix[idx+3] = 255
 	}
 	return dst
 }
 
+// edgeThreshold returns the threshold above which the number of the image pixels having
+// their gradient magnitude computed with the kernel pair is the closest to the target.
+// The threshold is looked up in the histogram of the magnitudes, normalized and weighted by the edge bias
+// and computed on the image channels as in edgeFilter.
+func (s *scratch) edgeThreshold(img *image.NRGBA, target int, kernelX, kernelY kernel, bias, channels int) float64 {
+	var hist [256]int
+	dx, dy := img.Bounds().Max.X, img.Bounds().Max.Y
+	norm := sobelWeight / float64(kernelX.weight())
+	wx, wy := edgeBiasWeights(bias)
+
+	s.magnitudes = reuseSlice(s.magnitudes, dx*dy)
+	for i := range s.magnitudes {
+		s.magnitudes[i] = 0
+	}
+	for c := 0; c < channels; c++ {
+		s.data = getChannelData(s.data, img, c)
+		for i := range s.data {
+			sumX, sumY := gradient(s.data, dx, i, kernelX, kernelY)
+			magnitude := math.Sqrt(float64(sumX*sumX)*wx*wx+float64(sumY*sumY)*wy*wy) * norm
+			// The pixels are kept by edgeFilter if their magnitude is above the threshold, so it is rounded up.
+			if m := uint8(math.Min(math.Ceil(magnitude), 255)); m > s.magnitudes[i] {
+				s.magnitudes[i] = m
+			}
+		}
+	}
+	for _, m := range s.magnitudes {
+		hist[m]++
+	}
+
+	// Lower the threshold until enough pixels are above it, choosing the closer one of the two last steps.
+	var count int
+	for threshold := 254; threshold >= 0; threshold-- {
+		above := count + hist[threshold+1]
+		if above >= target {
+			if above-target > target-count && threshold < 254 {
+				return float64(threshold + 1)
+			}
+			return float64(threshold)
+		}
+		count = above
+	}
+	return 0
+}
+
+// gradient returns the horizontal and vertical gradients of the window starting at the i-th pixel,
+// by summing the window pixels weighted with the kernel values. The pixels out of the data are skipped.
+func gradient(data []uint8, width, i int, kernelX, kernelY kernel) (int32, int32) {
+	var sumX, sumY int32
+	for x := 0; x < len(kernelX); x++ {
+		for y := 0; y < len(kernelY); y++ {
+			if idx := i + (width * y) + x; idx < len(data) {
+				r := data[idx]
+				sumX += int32(r) * kernelX[y][x]
+				sumY += int32(r) * kernelY[y][x]
+			}
+		}
+	}
+	return sumX, sumY
+}
+
 // getImageData returns an array of pixel grayscale brightness values
-// for the image (taking the red component of each pixel).
-func getImageData(img *image.NRGBA) []uint8 {
+// for the image (taking the red component of each pixel), reusing the provided buffer.
+func getImageData(pixels []uint8, img *image.NRGBA) []uint8 {
+	return getChannelData(pixels, img, 0)
+}
+
+// getChannelData returns an array of the values of the provided color channel of the image pixels,
+// reusing the provided buffer.
+func getChannelData(pixels []uint8, img *image.NRGBA, c int) []uint8 {
 	dx, dy := img.Bounds().Max.X, img.Bounds().Max.Y
-	pixels := make([]uint8, dx*dy)
+	pixels = reuseSlice(pixels, dx*dy)
 
 	for i := range pixels {
-		pixels[i] = img.Pix[i*4]
+		pixels[i] = img.Pix[i*4+c]
 	}
 	return pixels
 }
@@ -0,0 +1,151 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// newNoiseImage returns a grayscale noise image, the pixel values being spread between lo and hi.
+func newNoiseImage(w, h int, lo, hi uint8, seed int64) *image.NRGBA {
+	r := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := lo + uint8(r.Intn(int(hi-lo)+1))
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return StackBlur(img, 1)
+}
+
+func TestEdgeKernels(t *testing.T) {
+	for _, operator := range []int{SobelOperator, ScharrOperator, PrewittOperator} {
+		kx, ky := edgeKernels(operator)
+		for i := range kx {
+			for j := range kx[i] {
+				// The vertical kernel is the transpose of the horizontal one, which is antisymmetric.
+				if kx[i][j] != ky[j][i] {
+					t.Errorf("operator %d: expected the vertical kernel to be the transpose of the horizontal one", operator)
+				}
+				if kx[i][j] != -kx[i][len(kx)-1-j] {
+					t.Errorf("operator %d: expected the horizontal kernel to be antisymmetric", operator)
+				}
+			}
+		}
+	}
+	if kx, _ := edgeKernels(ScharrOperator); kx[1][2] != 10 || kx[0][2] != 3 {
+		t.Errorf("expected the Scharr kernel, got %v", kx)
+	}
+	if kx, _ := edgeKernels(PrewittOperator); kx[0][2] != 1 || kx[1][2] != 1 {
+		t.Errorf("expected the Prewitt kernel, got %v", kx)
+	}
+}
+
+func TestEdgeFilter_Operators(t *testing.T) {
+	// The left half of the image is darker than the right one, while the bottom rows are darker than the top ones.
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			v := uint8(100)
+			if x >= 10 {
+				v = 140
+			}
+			if y >= 15 {
+				v -= 60
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+
+	// The magnitude is normalized to the Sobel scale, so the step of 40 gives the same magnitude for every operator,
+	// along the vertical and the horizontal edges alike. The kernels are applied on the pixel and the ones right
+	// and below it, so the edges are found on the two pixels before the steps.
+	for _, operator := range []int{SobelOperator, ScharrOperator, PrewittOperator} {
+		kx, ky := edgeKernels(operator)
+		edges := new(scratch).edgeFilter(img, 10, kx, ky, NoEdgeBias, 1)
+		for _, tc := range []struct {
+			x, y int
+			want uint8
+		}{
+			{8, 5, 160}, {9, 5, 160}, {5, 5, 0}, {12, 5, 0},
+			{5, 13, 240}, {15, 14, 240}, {5, 10, 0}, {15, 16, 0},
+		} {
+			if got := edges.NRGBAAt(tc.x, tc.y).R; got != tc.want {
+				t.Errorf("operator %d: expected the magnitude %d at %d,%d, got %d", operator, tc.want, tc.x, tc.y, got)
+			}
+		}
+	}
+}
+
+func TestEdgeThreshold(t *testing.T) {
+	const target = 2000
+
+	for _, tc := range []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"dark low contrast", newNoiseImage(160, 120, 10, 40, 1)},
+		{"bright high contrast", newNoiseImage(160, 120, 60, 255, 2)},
+	} {
+		s := new(scratch)
+		threshold := s.edgeThreshold(tc.img, target, kernelX, kernelY, NoEdgeBias, 1)
+		edges := countEdges(s.edgeFilter(tc.img, threshold, kernelX, kernelY, NoEdgeBias, 1))
+
+		if edges < target*3/4 || edges > target*5/4 {
+			t.Errorf("%s: expected about %d edge pixels, got %d with the threshold %v", tc.name, target, edges, threshold)
+		}
+	}
+}
+
+func TestEdgeBias(t *testing.T) {
+	// The points are selected reproducibly, so the share of the favored edges doesn't vary between the runs.
+	seed := randomSeed
+	randomSeed = func() int64 { return 1 }
+	t.Cleanup(func() { randomSeed = seed })
+
+	// The top half of the image has horizontal stripes, while the bottom half has vertical ones.
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 200; x++ {
+			stripe := x / 20
+			if y < 100 {
+				stripe = y / 20
+			}
+			v := uint8(100 + stripe%2*60)
+			src.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+
+	// count returns the number of the points found in the top and in the bottom half of the image.
+	count := func(bias int) (top, bottom int) {
+		p := newTestProcessor()
+		p.SobelThreshold = 60
+		p.EdgeBias = bias
+
+		tri := &Triangulator{Processor: p}
+		_, _, points, err := tri.Process(src)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, pt := range points {
+			if pt.Y < 100 {
+				top++
+			} else {
+				bottom++
+			}
+		}
+		return top, bottom
+	}
+
+	if top, bottom := count(NoEdgeBias); top < bottom/2 || bottom < top/2 {
+		t.Errorf("expected the points to be spread along every edge, got %d at the top and %d at the bottom", top, bottom)
+	}
+	if top, bottom := count(HorizontalEdgeBias); top < 4*bottom {
+		t.Errorf("expected the points to be concentrated along the horizontal edges, got %d at the top and %d at the bottom", top, bottom)
+	}
+	if top, bottom := count(VerticalEdgeBias); bottom < 4*top {
+		t.Errorf("expected the points to be concentrated along the vertical edges, got %d at the top and %d at the bottom", top, bottom)
+	}
+}
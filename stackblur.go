@@ -5,6 +5,7 @@ package triangle
 
 import (
 	"image"
+	"sync"
 )
 
 // blurStack is a linked list containing the color value and a pointer to the next struct.
@@ -59,17 +60,14 @@ func (bs *blurStack) NewBlurStack() *blurStack {
 // StackBlur applies a blur filter to the provided image.
 // The radius defines the bluring average.
 func StackBlur(img *image.NRGBA, radius uint32) *image.NRGBA {
-	var stackEnd, stackIn, stackOut *blurStack
-	var width, height = uint32(img.Bounds().Dx()), uint32(img.Bounds().Dy())
-	var (
-		div, widthMinus1, heightMinus1, radiusPlus1, sumFactor uint32
-		x, y, i, p, yp, yi, yw,
-		rSum, gSum, bSum, aSum,
-		rOutSum, gOutSum, bOutSum, aOutSum,
-		rInSum, gInSum, bInSum, aInSum,
-		pr, pg, pb, pa uint32
-	)
+	return StackBlurParallel(img, radius, 1, 1)
+}
 
+// StackBlurParallel applies the blur filter the number of times defined by passes,
+// which results in a stronger smoothing than increasing the radius. The horizontal
+// and the vertical passes are split into bands processed concurrently by the number
+// of workers. A value of workers lower than 2 runs the filter on the calling goroutine.
+func StackBlurParallel(img *image.NRGBA, radius uint32, passes, workers int) *image.NRGBA {
 	// Stop blurring and return the original image in case the radius is less then 1.
 	if radius < 1 {
 		return img
@@ -81,29 +79,84 @@ func StackBlur(img *image.NRGBA, radius uint32) *image.NRGBA {
 		radius = uint32(len(mulTable) - 1)
 	}
 
-	div = radius + radius + 1
-	widthMinus1 = width - 1
-	heightMinus1 = height - 1
-	radiusPlus1 = radius + 1
-	sumFactor = radiusPlus1 * (radiusPlus1 + 1) / 2
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	for pass := 0; pass < Max(passes, 1); pass++ {
+		parallelize(height, workers, func(y0, y1 int) {
+			blurRows(img, radius, uint32(y0), uint32(y1))
+		})
+		parallelize(width, workers, func(x0, x1 int) {
+			blurColumns(img, radius, uint32(x0), uint32(x1))
+		})
+	}
+	return img
+}
+
+// parallelize splits the [0, n) range into equal bands and calls fn concurrently for each of them.
+func parallelize(n, workers int, fn func(start, end int)) {
+	workers = Min(Max(workers, 1), n)
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	band := (n + workers - 1) / workers
+	for start := 0; start < n; start += band {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, Min(start+band, n))
+	}
+	wg.Wait()
+}
+
+// newBlurStack creates the circular blur stack used by the horizontal and vertical passes.
+// It returns the first element of the stack and the element at the radius position.
+func newBlurStack(radius uint32) (*blurStack, *blurStack) {
+	var stackEnd *blurStack
 
 	bs := blurStack{}
 	stackStart := bs.NewBlurStack()
 	stack := stackStart
 
-	for i = 1; i < div; i++ {
+	for i := uint32(1); i < radius+radius+1; i++ {
 		stack.next = bs.NewBlurStack()
 		stack = stack.next
-		if i == radiusPlus1 {
+		if i == radius+1 {
 			stackEnd = stack
 		}
 	}
 	stack.next = stackStart
 
+	return stackStart, stackEnd
+}
+
+// blurRows applies the horizontal blur pass on the rows between y0 and y1.
+func blurRows(img *image.NRGBA, radius, y0, y1 uint32) {
+	var stackIn, stackOut, stack *blurStack
+	var width = uint32(img.Bounds().Dx())
+	var (
+		widthMinus1, radiusPlus1, sumFactor uint32
+		x, y, i, p, yi, yw,
+		rSum, gSum, bSum, aSum,
+		rOutSum, gOutSum, bOutSum, aOutSum,
+		rInSum, gInSum, bInSum, aInSum,
+		pr, pg, pb, pa uint32
+	)
+
+	widthMinus1 = width - 1
+	radiusPlus1 = radius + 1
+	sumFactor = radiusPlus1 * (radiusPlus1 + 1) / 2
+
+	stackStart, stackEnd := newBlurStack(radius)
 	mulSum := mulTable[radius]
 	shgSum := shgTable[radius]
 
-	for y = 0; y < height; y++ {
+	yw = y0 * width
+	yi = yw << 2
+
+	for y = y0; y < y1; y++ {
 		rInSum, gInSum, bInSum, aInSum, rSum, gSum, bSum, aSum = 0, 0, 0, 0, 0, 0, 0, 0
 
 		pr = uint32(img.Pix[yi])
@@ -233,8 +286,30 @@ func StackBlur(img *image.NRGBA, radius uint32) *image.NRGBA {
 		}
 		yw += width
 	}
+}
+
+// blurColumns applies the vertical blur pass on the columns between x0 and x1.
+func blurColumns(img *image.NRGBA, radius, x0, x1 uint32) {
+	var stackIn, stackOut, stack *blurStack
+	var width, height = uint32(img.Bounds().Dx()), uint32(img.Bounds().Dy())
+	var (
+		heightMinus1, radiusPlus1, sumFactor uint32
+		x, y, i, p, yp, yi,
+		rSum, gSum, bSum, aSum,
+		rOutSum, gOutSum, bOutSum, aOutSum,
+		rInSum, gInSum, bInSum, aInSum,
+		pr, pg, pb, pa uint32
+	)
 
-	for x = 0; x < width; x++ {
+	heightMinus1 = height - 1
+	radiusPlus1 = radius + 1
+	sumFactor = radiusPlus1 * (radiusPlus1 + 1) / 2
+
+	stackStart, stackEnd := newBlurStack(radius)
+	mulSum := mulTable[radius]
+	shgSum := shgTable[radius]
+
+	for x = x0; x < x1; x++ {
 		rInSum, gInSum, bInSum, aInSum, rSum, gSum, bSum, aSum = 0, 0, 0, 0, 0, 0, 0, 0
 
 		yi = x << 2
@@ -367,5 +442,4 @@ func StackBlur(img *image.NRGBA, radius uint32) *image.NRGBA {
 			yi += width
 		}
 	}
-	return img
 }
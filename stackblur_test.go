@@ -0,0 +1,27 @@
+package triangle
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestStackBlurParallel(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 257, 131))
+	rand.New(rand.NewSource(1)).Read(src.Pix)
+
+	clone := func() *image.NRGBA {
+		img := image.NewNRGBA(src.Bounds())
+		copy(img.Pix, src.Pix)
+		return img
+	}
+
+	expected := StackBlur(StackBlur(clone(), 5), 5)
+	for _, workers := range []int{1, 3, 8} {
+		res := StackBlurParallel(clone(), 5, 2, workers)
+		if !bytes.Equal(res.Pix, expected.Pix) {
+			t.Errorf("%d workers: expected the same result as two serial blur passes", workers)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package triangle
+
+import "time"
+
+// Stats holds the processing statistics of the triangulation pipeline: the time spent in each of its stages
+// and the number of the generated points and triangles. The durations are encoded in nanoseconds in JSON.
+type Stats struct {
+	// Blur is the time spent on blurring the source image and converting it to grayscale.
+	Blur time.Duration `json:"blur_ns"`
+	// EdgeDetection is the time spent on detecting the edges and applying the convolution filters.
+	EdgeDetection time.Duration `json:"edge_detection_ns"`
+	// PointExtraction is the time spent on extracting the points from the detected edges.
+	PointExtraction time.Duration `json:"point_extraction_ns"`
+	// Triangulation is the time spent on the Delaunay triangulation, including the relaxation passes.
+	Triangulation time.Duration `json:"triangulation_ns"`
+	// Sampling is the time spent on sampling the triangle colors and rendering the output.
+	Sampling time.Duration `json:"sampling_ns"`
+	// Total is the time spent on the whole process, including the stages not measured separately.
+	Total time.Duration `json:"total_ns"`
+	// Candidates is the number of the edge pixels the points were randomly selected from, before limiting them to
+	// the MaxPoints. In case it's much higher than the number of points, the points are limited by the MaxPoints,
+	// otherwise by the SobelThreshold. In case of the UniformGrid sampling it's the number of the grid points.
+	Candidates int `json:"candidates"`
+	// Points is the number of the points the triangles were generated from.
+	Points int `json:"points"`
+	// Triangles is the number of the generated triangles.
+	Triangles int `json:"triangles"`
+}
+
+// lap records the time elapsed since the start into d, returning the current time as the start of the next stage.
+func lap(d *time.Duration, start time.Time) time.Time {
+	now := time.Now()
+	*d = now.Sub(start)
+	return now
+}
+
+// finish records the time elapsed since the start of the sampling and since the start of the whole process.
+// It does nothing in case the statistics are not requested.
+func (s *Stats) finish(start, sampling time.Time) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	s.Sampling = now.Sub(sampling)
+	s.Total = now.Sub(start)
+}
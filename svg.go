@@ -0,0 +1,375 @@
+package triangle
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// svgTemplate renders every triangle as a separate path element having its own fill and stroke colors.
+const svgTemplate = `<?xml version="1.0" ?>
+	<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN"
+	  "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd">
+	<svg width="{{.Width}}px" height="{{.Height}}px" viewBox="0 0 {{.ViewBoxWidth}} {{.ViewBoxHeight}}"
+	     xmlns="http://www.w3.org/2000/svg"{{if preview}} xmlns:xlink="http://www.w3.org/1999/xlink"{{end}} version="1.1">
+	  <title>{{.Title}}</title>
+	  <desc>{{.Description}}</desc>
+	  {{with metadata}}<metadata>{{.}}</metadata>{{end}}
+	  {{with clip}}<defs><clipPath id="clip">{{.}}</clipPath></defs>{{end}}
+	  {{with gradients}}<defs>{{range $i, $g := .}}{{with $g}}
+		<linearGradient id="shade{{$i}}" gradientUnits="userSpaceOnUse" x1="{{coord .X1}}" y1="{{coord .Y1}}" x2="{{coord .X2}}" y2="{{coord .Y2}}">
+			{{- range .Stops}}<stop offset="{{printf "%.3f" .Offset}}" stop-color="{{hex .Color}}"/>{{end -}}
+		</linearGradient>{{end}}{{end}}
+	  </defs>{{end}}
+	  <!-- Points -->
+	  <g{{if clip}} clip-path="url(#clip)"{{end}} stroke-linecap="{{.StrokeLineCap}}" stroke-width="{{.StrokeWidth}}">
+	    {{with background}}<rect width="{{$.ViewBoxWidth}}" height="{{$.ViewBoxHeight}}" fill="{{.}}"/>{{end}}
+	    {{with preview}}<image width="{{$.ViewBoxWidth}}" height="{{$.ViewBoxHeight}}" preserveAspectRatio="none" xlink:href="data:image/png;base64,{{.}}"/>{{end}}
+	    {{range $i, $l := .Lines}}
+		<path
+			fill="{{fill $i .FillColor}}"
+	   		stroke="rgba({{.StrokeColor.R}},{{.StrokeColor.G}},{{.StrokeColor.B}},{{.StrokeColor.A}})"
+			d="M{{coord .P0.X}},{{coord .P0.Y}} L{{coord .P1.X}},{{coord .P1.Y}} L{{coord .P2.X}},{{coord .P2.Y}} L{{coord .P3.X}},{{coord .P3.Y}}"
+		/>
+	    {{end}}
+	    {{- range dots}}
+		<circle cx="{{coord .Center.X}}" cy="{{coord .Center.Y}}" r="{{coord .Radius}}" fill="{{hex .Color}}"/>
+	    {{- end}}
+	    {{- with contours}}
+		<g fill="none" stroke="{{hex contourColor}}" stroke-width="{{contourWidth}}" stroke-linejoin="round">
+		{{- range .}}
+			<path d="{{path .}}"/>
+		{{- end}}
+		</g>
+	    {{- end}}</g>
+	</svg>`
+
+// svgCompactTemplate renders the triangles as polygon elements grouped by their colors,
+// without any redundant whitespace between the elements.
+const svgCompactTemplate = `<?xml version="1.0" ?>` +
+	`<svg width="{{.Width}}px" height="{{.Height}}px" viewBox="0 0 {{.ViewBoxWidth}} {{.ViewBoxHeight}}" xmlns="http://www.w3.org/2000/svg"{{if preview}} xmlns:xlink="http://www.w3.org/1999/xlink"{{end}} version="1.1">` +
+	`<title>{{.Title}}</title><desc>{{.Description}}</desc>{{with metadata}}<metadata>{{.}}</metadata>{{end}}` +
+	`{{with clip}}<defs><clipPath id="clip">{{.}}</clipPath></defs>{{end}}` +
+	`<g{{if clip}} clip-path="url(#clip)"{{end}} stroke-linecap="{{.StrokeLineCap}}" stroke-width="{{.StrokeWidth}}">` +
+	`{{with background}}<rect width="{{$.ViewBoxWidth}}" height="{{$.ViewBoxHeight}}" fill="{{.}}"/>{{end}}` +
+	`{{with preview}}<image width="{{$.ViewBoxWidth}}" height="{{$.ViewBoxHeight}}" preserveAspectRatio="none" xlink:href="data:image/png;base64,{{.}}"/>{{end}}` +
+	`{{range .Groups}}<g fill="{{hex .FillColor}}" stroke="{{hex .StrokeColor}}">` +
+	`{{range .Polygons}}<polygon points="{{points .}}"/>{{end}}` +
+	`</g>{{end}}` +
+	`{{range dots}}<circle cx="{{coord .Center.X}}" cy="{{coord .Center.Y}}" r="{{coord .Radius}}" fill="{{hex .Color}}"/>{{end}}` +
+	`{{with contours}}<g fill="none" stroke="{{hex contourColor}}" stroke-width="{{contourWidth}}" stroke-linejoin="round">{{range .}}<path d="{{path .}}"/>{{end}}</g>{{end}}` +
+	`</g></svg>`
+
+// svgPlotterTemplate renders only the unique edges of the triangles as line elements, without any fill,
+// so every edge is drawn only once by the pen plotters and the laser cutters.
+const svgPlotterTemplate = `<?xml version="1.0" ?>` +
+	`<svg width="{{.Width}}px" height="{{.Height}}px" viewBox="0 0 {{.ViewBoxWidth}} {{.ViewBoxHeight}}" xmlns="http://www.w3.org/2000/svg"{{if preview}} xmlns:xlink="http://www.w3.org/1999/xlink"{{end}} version="1.1">` +
+	`<title>{{.Title}}</title><desc>{{.Description}}</desc>{{with metadata}}<metadata>{{.}}</metadata>{{end}}` +
+	`{{with clip}}<defs><clipPath id="clip">{{.}}</clipPath></defs>{{end}}` +
+	`<g{{if clip}} clip-path="url(#clip)"{{end}} fill="none" stroke="{{hex .PlotterColor}}" stroke-linecap="{{.StrokeLineCap}}" stroke-width="{{.StrokeWidth}}">` +
+	`{{range .Segments}}<line x1="{{coord (index . 0).X}}" y1="{{coord (index . 0).Y}}" x2="{{coord (index . 1).X}}" y2="{{coord (index . 1).Y}}"/>{{end}}` +
+	`{{range contours}}<path d="{{path .}}"/>{{end}}` +
+	`</g></svg>`
+
+// svgGroup holds the polygons sharing the same fill and stroke colors.
+type svgGroup struct {
+	FillColor   color.RGBA
+	StrokeColor color.RGBA
+	Polygons    [][]Node
+}
+
+// Render writes the generated SVG to w. In case the Compact option is enabled, the triangles having
+// the same colors are grouped together and rendered as polygon elements, which results in a smaller file.
+// In case of the SmoothShading, every triangle is filled with its own gradient, so they are not grouped.
+// In case the MergeTolerance option is defined, the adjacent triangles of similar colors are merged into convex
+// polygons, rendered grouped by their colors like in case of the Compact option.
+// In case the PlotterMode option is enabled, only the unique edges of the triangles are rendered, without fill.
+// The dots of the ShowPoints option are rendered as circle elements over the triangles, and the contours of the
+// TraceContours option as unfilled path elements over them. In case the BgColor is
+// defined, the triangles are rendered over a rectangle of that color, otherwise the background is transparent.
+// The node coordinates are formatted with the number of decimals defined by the Precision option.
+func (svg *SVG) Render(w io.Writer) error {
+	precision := Max(svg.Precision, 0)
+	clip := svg.clipElement()
+	gradients := svg.gradients()
+
+	var metadata string
+	if svg.EmbedPreview {
+		b, err := svg.metadata()
+		if err != nil {
+			return err
+		}
+		metadata = string(b)
+	}
+	funcs := template.FuncMap{
+		"hex":       hexColor,
+		"clip":      func() string { return clip },
+		"preview":   func() string { return svg.preview },
+		"metadata":  func() string { return metadata },
+		"gradients": func() []*svgGradient { return gradients },
+		"dots":      func() []dot { return svg.dots },
+		"background": func() string {
+			// The color is rendered as it's defined, since the parsed one is alpha-premultiplied.
+			if c, err := ParseHexColor(svg.BgColor); svg.BgColor != "" && err == nil && c.A != 0 {
+				return "#" + strings.TrimPrefix(svg.BgColor, "#")
+			}
+			return ""
+		},
+		"contours":     func() [][]Node { return svg.contours },
+		"contourColor": svg.plotterColor,
+		"contourWidth": func() float64 { return Max(svg.StrokeWidth, 1) },
+		"fill": func(i int, c color.RGBA) string {
+			if i < len(gradients) && gradients[i] != nil {
+				return fmt.Sprintf("url(#shade%d)", i)
+			}
+			return fmt.Sprintf("rgba(%d,%d,%d,%d)", c.R, c.G, c.B, c.A)
+		},
+		"coord": func(v float64) string {
+			return strconv.FormatFloat(v, 'f', precision, 64)
+		},
+		"points": func(nodes []Node) string {
+			points := make([]string, len(nodes))
+			for i, n := range nodes {
+				points[i] = strconv.FormatFloat(n.X, 'f', precision, 64) + "," + strconv.FormatFloat(n.Y, 'f', precision, 64)
+			}
+			return strings.Join(points, " ")
+		},
+		"path": func(nodes []Node) string {
+			var b strings.Builder
+			for i, n := range nodes {
+				if i == 0 {
+					b.WriteString("M")
+				} else {
+					b.WriteString(" L")
+				}
+				b.WriteString(strconv.FormatFloat(n.X, 'f', precision, 64) + "," + strconv.FormatFloat(n.Y, 'f', precision, 64))
+			}
+			return b.String()
+		},
+	}
+
+	if svg.PlotterMode {
+		tmpl := template.Must(template.New("svg").Funcs(funcs).Parse(svgPlotterTemplate))
+		return tmpl.Execute(w, struct {
+			*SVG
+			PlotterColor color.RGBA
+			Segments     [][2]Node
+		}{svg, svg.plotterColor(), svg.segments()})
+	}
+	if (!svg.Compact && svg.MergeTolerance == 0) || gradients != nil {
+		tmpl := template.Must(template.New("svg").Funcs(funcs).Parse(svgTemplate))
+		return tmpl.Execute(w, svg)
+	}
+
+	tmpl := template.Must(template.New("svg").Funcs(funcs).Parse(svgCompactTemplate))
+	return tmpl.Execute(w, struct {
+		*SVG
+		Groups []svgGroup
+	}{svg, svg.groups()})
+}
+
+// groups groups the polygons by their fill and stroke colors, keeping the order of their first appearance.
+// Every line is a polygon of its own, unless the MergeTolerance option merges the triangles of similar colors.
+func (svg *SVG) groups() []svgGroup {
+	var polygons []svgPolygon
+	if svg.MergeTolerance > 0 {
+		polygons = mergeTriangles(svg.Lines, svg.MergeTolerance)
+	} else {
+		polygons = make([]svgPolygon, len(svg.Lines))
+		for i, l := range svg.Lines {
+			polygons[i] = svgPolygon{Nodes: []Node{l.P0, l.P1, l.P2}, FillColor: l.FillColor, StrokeColor: l.StrokeColor}
+		}
+	}
+
+	var groups []svgGroup
+	index := make(map[[2]color.RGBA]int)
+
+	for _, p := range polygons {
+		key := [2]color.RGBA{p.FillColor, p.StrokeColor}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, svgGroup{FillColor: p.FillColor, StrokeColor: p.StrokeColor})
+		}
+		groups[i].Polygons = append(groups[i].Polygons, p.Nodes)
+	}
+	return groups
+}
+
+// segments returns the edges of the non-degenerate triangles, the edges shared by two triangles being returned
+// only once, keeping the order of their first appearance.
+func (svg *SVG) segments() [][2]Node {
+	segments := make([][2]Node, 0, len(svg.Lines)*3/2)
+	seen := make(map[[2]Node]struct{}, len(svg.Lines)*3/2)
+
+	for _, l := range svg.Lines {
+		// The edges of the degenerate triangles overlap the edges of their neighbors.
+		if (Triangle{Nodes: []Node{l.P0, l.P1, l.P2}}).Area() == 0 {
+			continue
+		}
+		for _, s := range [][2]Node{{l.P0, l.P1}, {l.P1, l.P2}, {l.P2, l.P0}} {
+			// The shared edges have their nodes in opposite order in the adjacent triangles.
+			key := edgeKey(s[0], s[1])
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// svgGradient defines the linear gradient approximating the smooth shading of a triangle. The gradient runs along
+// the direction the vertex colors change the most, having a stop at the projection of every vertex.
+type svgGradient struct {
+	X1, Y1, X2, Y2 float64
+	Stops          []svgStop
+}
+
+// svgStop defines a color stop of the gradient, the offset being in the [0, 1] range.
+type svgStop struct {
+	Offset float64
+	Color  color.RGBA
+}
+
+// gradients returns the gradients of the triangles in case of the SmoothShading, or nil otherwise. The triangles
+// having the same color at every vertex, or being degenerate, are filled with their flat color, so their gradient is nil.
+func (svg *SVG) gradients() []*svgGradient {
+	if svg.Shading != SmoothShading || len(svg.shades) != len(svg.Lines) {
+		return nil
+	}
+
+	gradients := make([]*svgGradient, len(svg.Lines))
+	for i, l := range svg.Lines {
+		nodes, colors := [3]Node{l.P0, l.P1, l.P2}, svg.shades[i]
+
+		// The gradient of the summed color channels is constant over the triangle, the colors being interpolated linearly.
+		var sum [3]float64
+		for j, c := range colors {
+			sum[j] = float64(c.R) + float64(c.G) + float64(c.B)
+		}
+		e1x, e1y := nodes[1].X-nodes[0].X, nodes[1].Y-nodes[0].Y
+		e2x, e2y := nodes[2].X-nodes[0].X, nodes[2].Y-nodes[0].Y
+		det := e1x*e2y - e2x*e1y
+		if det == 0 {
+			continue
+		}
+		gx := ((sum[1]-sum[0])*e2y - (sum[2]-sum[0])*e1y) / det
+		gy := (e1x*(sum[2]-sum[0]) - e2x*(sum[1]-sum[0])) / det
+		length := math.Hypot(gx, gy)
+		if length == 0 {
+			continue
+		}
+		dx, dy := gx/length, gy/length
+
+		// The vertices are projected on the gradient direction, the first and last ones defining its ends.
+		var proj [3]float64
+		for j, n := range nodes {
+			proj[j] = (n.X-nodes[0].X)*dx + (n.Y-nodes[0].Y)*dy
+		}
+		order := []int{0, 1, 2}
+		sort.Slice(order, func(a, b int) bool { return proj[order[a]] < proj[order[b]] })
+		tmin, tmax := proj[order[0]], proj[order[2]]
+
+		g := &svgGradient{
+			X1: nodes[0].X + dx*tmin, Y1: nodes[0].Y + dy*tmin,
+			X2: nodes[0].X + dx*tmax, Y2: nodes[0].Y + dy*tmax,
+		}
+		for _, j := range order {
+			c := colors[j]
+			g.Stops = append(g.Stops, svgStop{
+				Offset: (proj[j] - tmin) / (tmax - tmin),
+				Color:  color.RGBA{R: c.R, G: c.G, B: c.B, A: 255},
+			})
+		}
+		gradients[i] = g
+	}
+	return gradients
+}
+
+// plotterColor returns the color of the edges rendered in the PlotterMode and of the contours of the TraceContours
+// option, which is the StrokeColor or the SolidStrokeColor in case it's defined, otherwise black.
+func (p Processor) plotterColor() color.RGBA {
+	for _, hex := range []string{p.StrokeColor, p.SolidStrokeColor} {
+		if c, err := ParseHexColor(hex); hex != "" && err == nil {
+			return c
+		}
+	}
+	return color.RGBA{R: 0, G: 0, B: 0, A: 255}
+}
+
+// previewSize defines the size of the longer side of the preview embedded into the SVG output.
+const previewSize = 128
+
+// encodePreview returns the base64 encoded PNG preview of the image, downscaled to the preview size.
+func encodePreview(src image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumbnail(src, previewSize)); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// thumbnail downscales the image so its longer side is at most size pixels, keeping its aspect ratio.
+// Each pixel of the thumbnail is the average of the source pixels it covers.
+func thumbnail(src image.Image, size int) *image.NRGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, Max(round(float64(h*size)/float64(w)), 1)
+		} else {
+			tw, th = Max(round(float64(w*size)/float64(h)), 1), size
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, Max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, Max((x+1)*w/tw, x*w/tw+1)
+
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					sum[0], sum[1], sum[2], sum[3] = sum[0]+uint64(cr), sum[1]+uint64(cg), sum[2]+uint64(cb), sum[3]+uint64(ca)
+				}
+			}
+			n := uint64((x1 - x0) * (y1 - y0))
+			dst.Set(x, y, color.RGBA64{R: uint16(sum[0] / n), G: uint16(sum[1] / n), B: uint16(sum[2] / n), A: uint16(sum[3] / n)})
+		}
+	}
+	return dst
+}
+
+// metadata returns the processor options as a JSON processing profile. The Mask, the Points and the Stats are left out.
+func (svg *SVG) metadata() ([]byte, error) {
+	p := svg.Processor
+	p.Mask, p.Points, p.Stats = nil, nil, nil
+	return json.Marshal(p)
+}
+
+// hexColor formats the color in the shortest hexadecimal notation, omitting the alpha channel if it's opaque.
+func hexColor(c color.RGBA) string {
+	if c.A != 0xff {
+		return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+	}
+	if c.R>>4 == c.R&0xf && c.G>>4 == c.G&0xf && c.B>>4 == c.B&0xf {
+		return fmt.Sprintf("#%x%x%x", c.R&0xf, c.G&0xf, c.B&0xf)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
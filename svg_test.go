@@ -0,0 +1,275 @@
+package triangle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestSVG_Compact(t *testing.T) {
+	// A noisy image produces a large number of edge points, hence triangles.
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 400))
+	r := rand.New(rand.NewSource(1))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 400; x++ {
+			v := uint8(r.Intn(8) * 32)
+			src.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: 255 - v, A: 255})
+		}
+	}
+
+	proc := newTestProcessor()
+	proc.MaxPoints = 2500
+
+	svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+	if _, _, _, err := svg.Draw(src, proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(svg.Lines) < 4000 {
+		t.Fatalf("expected a large number of triangles, got %d", len(svg.Lines))
+	}
+
+	var def, compact bytes.Buffer
+	if err := svg.Render(&def); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svg.Compact = true
+	if err := svg.Render(&compact); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n := strings.Count(compact.String(), "<polygon"); n != len(svg.Lines) {
+		t.Errorf("expected %d polygons, got %d", len(svg.Lines), n)
+	}
+	if compact.Len() >= def.Len()/2 {
+		t.Errorf("expected the compact SVG to be considerably smaller, got %d bytes versus %d bytes", compact.Len(), def.Len())
+	}
+}
+
+func TestHexColor(t *testing.T) {
+	tests := []struct {
+		c        color.RGBA
+		expected string
+	}{
+		{color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, "#fff"},
+		{color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}, "#123"},
+		{color.RGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}, "#123456"},
+		{color.RGBA{R: 0x12, G: 0x34, B: 0x56, A: 0x80}, "#12345680"},
+	}
+	for _, tt := range tests {
+		if got := hexColor(tt.c); got != tt.expected {
+			t.Errorf("hexColor(%v): expected %s, got %s", tt.c, tt.expected, got)
+		}
+	}
+}
+
+func TestSVG_Precision(t *testing.T) {
+	svg := &SVG{
+		Width:  10,
+		Height: 10,
+		Lines: []Line{{
+			P0:          Node{X: 1.23456, Y: 2},
+			P1:          Node{X: 3.5, Y: 4.25},
+			P2:          Node{X: 5, Y: 6.789},
+			P3:          Node{X: 1.23456, Y: 2},
+			FillColor:   color.RGBA{R: 0xff, A: 0xff},
+			StrokeColor: color.RGBA{R: 0xff, A: 0xff},
+		}},
+	}
+
+	tests := []struct {
+		precision int
+		compact   bool
+		expected  string
+	}{
+		{0, false, `d="M1,2 L4,4 L5,7 L1,2"`},
+		{2, false, `d="M1.23,2.00 L3.50,4.25 L5.00,6.79 L1.23,2.00"`},
+		{1, true, `points="1.2,2.0 3.5,4.2 5.0,6.8"`},
+	}
+	for _, tt := range tests {
+		svg.Precision, svg.Compact = tt.precision, tt.compact
+
+		var buf bytes.Buffer
+		if err := svg.Render(&buf); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(buf.String(), tt.expected) {
+			t.Errorf("precision %d: expected the output to contain %s, got:\n%s", tt.precision, tt.expected, buf.String())
+		}
+	}
+}
+
+func TestSVG_PlotterMode(t *testing.T) {
+	proc := newTestProcessor()
+	proc.PlotterMode = true
+	proc.StrokeColor = "#ff0000"
+
+	svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+	if _, _, _, err := svg.Draw(newTestImage(200, 150), proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := svg.Render(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	if !strings.Contains(out, `fill="none" stroke="#f00"`) || strings.Contains(out, "<path") || strings.Contains(out, "<polygon") {
+		t.Errorf("expected only the stroked lines without fill, got %s", out)
+	}
+	lines := strings.Split(out, "<line ")[1:]
+	if len(lines) == 0 || len(lines) >= 3*len(svg.Lines) {
+		t.Fatalf("expected less than %d lines, since the shared edges are rendered once, got %d", 3*len(svg.Lines), len(lines))
+	}
+
+	// Each edge is rendered once, regardless of the direction its nodes are listed in.
+	seen := make(map[string]bool)
+	for _, l := range lines {
+		var x1, y1, x2, y2 float64
+		if _, err := fmt.Sscanf(l, `x1="%g" y1="%g" x2="%g" y2="%g"`, &x1, &y1, &x2, &y2); err != nil {
+			t.Fatalf("unable to parse the line %q: %v", l, err)
+		}
+		k1, k2 := fmt.Sprint(x1, y1, x2, y2), fmt.Sprint(x2, y2, x1, y1)
+		if seen[k1] || seen[k2] {
+			t.Errorf("expected the edge %s to be rendered once", k1)
+		}
+		seen[k1] = true
+	}
+}
+
+func TestSVG_EmbedPreview(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		proc := newTestProcessor()
+		proc.EmbedPreview = true
+		proc.Compact = compact
+
+		svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+		if _, _, _, err := svg.Draw(newTestImage(400, 200), proc, func() {}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := svg.Render(&buf); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out := buf.String()
+
+		// The preview is rendered behind the triangles.
+		i := strings.Index(out, `<image width="400" height="200"`)
+		if i < 0 || !strings.Contains(out, `xlink:href="data:image/png;base64,`) {
+			t.Fatalf("compact %v: expected an embedded PNG preview", compact)
+		}
+		if j := strings.Index(out, "<polygon"); compact && j < i {
+			t.Errorf("expected the preview to be rendered before the triangles")
+		}
+		if j := strings.Index(out, "<path"); !compact && j < i {
+			t.Errorf("expected the preview to be rendered before the triangles")
+		}
+
+		// The metadata holds the processor options as a processing profile.
+		start, end := strings.Index(out, "<metadata>"), strings.Index(out, "</metadata>")
+		if start < 0 || end < start {
+			t.Fatalf("compact %v: expected the processor metadata", compact)
+		}
+		var p Processor
+		if err := json.Unmarshal([]byte(out[start+len("<metadata>"):end]), &p); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if p.MaxPoints != proc.MaxPoints || p.BlurRadius != proc.BlurRadius || p.Compact != compact {
+			t.Errorf("expected the metadata to record the processor options, got %+v", p)
+		}
+	}
+
+	// The preview is downscaled keeping the aspect ratio.
+	if b := thumbnail(newTestImage(400, 200), previewSize).Bounds(); b.Dx() != previewSize || b.Dy() != previewSize/2 {
+		t.Errorf("expected a %dx%d preview, got %dx%d", previewSize, previewSize/2, b.Dx(), b.Dy())
+	}
+}
+
+func TestSVG_BgColor(t *testing.T) {
+	for _, tt := range []struct {
+		bg, rect string
+	}{
+		{"", ""},
+		{"#ff0000", `<rect width="120" height="80" fill="#ff0000"/>`},
+		{"#12345680", `<rect width="120" height="80" fill="#12345680"/>`},
+		{"#00000000", ""},
+		{"fff", `<rect width="120" height="80" fill="#fff"/>`},
+	} {
+		proc := newTestProcessor()
+		proc.BgColor, proc.Wireframe = tt.bg, WireframeOnly
+
+		for _, compact := range []bool{false, true} {
+			svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+			svg.Compact = compact
+			if _, _, _, err := svg.Draw(newTestImage(120, 80), proc, func() {}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := svg.Render(&buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out := buf.String()
+			if tt.rect == "" {
+				if strings.Contains(out, "<rect") {
+					t.Errorf("%q: expected a transparent background, got a rect", tt.bg)
+				}
+				continue
+			}
+			if !strings.Contains(out, tt.rect) {
+				t.Errorf("%q, compact %v: expected the background %s", tt.bg, compact, tt.rect)
+			}
+			// The background is rendered behind the triangles.
+			shape := "<path"
+			if compact {
+				shape = "<polygon"
+			}
+			if strings.Index(out, "<rect") > strings.Index(out, shape) {
+				t.Errorf("%q, compact %v: expected the background to be rendered before the triangles", tt.bg, compact)
+			}
+		}
+	}
+}
+
+func TestSVG_MergeTolerance(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 150))
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3] = 40, 120, 200, 255
+	}
+
+	proc := newTestProcessor()
+	proc.SamplingMethod = UniformGrid
+	proc.MaxPoints = 500
+	proc.Compact = true
+
+	svg := &SVG{StrokeWidth: 1, StrokeLineCap: "round", Processor: proc}
+	if _, _, _, err := svg.Draw(src, proc, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(svg.Lines) < 500 {
+		t.Fatalf("expected a large number of triangles, got %d", len(svg.Lines))
+	}
+
+	var compact, merged bytes.Buffer
+	if err := svg.Render(&compact); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svg.MergeTolerance = 1
+	if err := svg.Render(&merged); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	n := strings.Count(merged.String(), "<polygon")
+	if m := strings.Count(compact.String(), "<polygon"); m != len(svg.Lines) {
+		t.Errorf("expected %d polygons without merging, got %d", len(svg.Lines), m)
+	}
+	if n == 0 || n > len(svg.Lines)/20 {
+		t.Errorf("expected the flat image to be covered by a few polygons, got %d polygons for %d triangles", n, len(svg.Lines))
+	}
+	if merged.Len() >= compact.Len()/5 {
+		t.Errorf("expected the merged SVG to be considerably smaller, got %d bytes versus %d bytes", merged.Len(), compact.Len())
+	}
+}
@@ -0,0 +1,118 @@
+package triangle
+
+import (
+	"image"
+	"math"
+)
+
+// gridSize returns the number of the columns and rows of the triangular grid covering the width x height rectangle,
+// the distance between its nodes being about cellSize, and the width of the columns and the height of the rows.
+// The nodes of the odd rows are shifted by half of the column width.
+func gridSize(width, height, cellSize int) (cols, rows int, cw, rh float64) {
+	size := float64(cellSize)
+	cols = Max(int(math.Round(float64(width)/size)), 1)
+	rows = Max(int(math.Round(float64(height)/(size*math.Sqrt(3)/2))), 1)
+	return cols, rows, float64(width) / float64(cols), float64(height) / float64(rows)
+}
+
+// latticeSize returns the number of the nodes of the triangular grid covering the width x height rectangle.
+// The even rows have cols+1 nodes, while the odd rows have cols+2 nodes, including the ones on the border.
+func latticeSize(width, height, cellSize int) int {
+	cols, rows, _, _ := gridSize(width, height, cellSize)
+	odd := (rows + 1) / 2
+	return (rows+1-odd)*(cols+1) + odd*(cols+2)
+}
+
+// latticePoints generates the nodes of the triangular grid covering the width x height rectangle. The first and
+// the last node of the odd rows are moved to the rectangle border, so the triangles cover the whole rectangle.
+// The returned points are stored in the scratch buffer.
+func (s *scratch) latticePoints(width, height, cellSize int) []Point {
+	cols, rows, cw, rh := gridSize(width, height, cellSize)
+
+	s.points = s.points[:0]
+	for j := 0; j <= rows; j++ {
+		y := float64(j) * rh
+		if j%2 == 1 {
+			s.points = append(s.points, Point{X: 0, Y: y})
+			for i := 0; i < cols; i++ {
+				s.points = append(s.points, Point{X: (float64(i) + 0.5) * cw, Y: y})
+			}
+			s.points = append(s.points, Point{X: float64(width), Y: y})
+			continue
+		}
+		for i := 0; i <= cols; i++ {
+			s.points = append(s.points, Point{X: float64(i) * cw, Y: y})
+		}
+	}
+	return s.points
+}
+
+// latticeTriangles joins the nodes of the triangular grid returned by latticePoints by triangles, each pair
+// of the neighboring rows being joined by a strip of triangles advancing along the row having the closer next node.
+func latticeTriangles(points []Point, width, height, cellSize int) []Triangle {
+	cols, rows, _, _ := gridSize(width, height, cellSize)
+	data := make([]triangleData, rows*(2*cols+1))
+	triangles := make([]Triangle, 0, len(data))
+
+	start := 0
+	for j := 0; j < rows; j++ {
+		n, m := cols+1, cols+2
+		if j%2 == 1 {
+			n, m = m, n
+		}
+		top, bottom := points[start:start+n], points[start+n:start+n+m]
+		for a, b := 0, 0; a < len(top)-1 || b < len(bottom)-1; {
+			p0, p1, p2 := top[a], bottom[b], bottom[Min(b+1, len(bottom)-1)]
+			if b == len(bottom)-1 || (a < len(top)-1 && top[a+1].X < bottom[b+1].X) {
+				p2 = top[a+1]
+				a++
+			} else {
+				b++
+			}
+			t := Triangle{}.newTriangle(&data[len(triangles)], Node(p0), Node(p1), Node(p2))
+			triangles = append(triangles, t)
+		}
+		start += n
+	}
+	return triangles
+}
+
+// hexCells returns the hexagonal cells centered at the nodes of the triangular grid covering the rectangle,
+// except the nodes moved to its border, the cells being clipped to the rectangle. The cell sites are the centers
+// of the hexagons, so the cells are filled with the colors found at the grid nodes.
+func hexCells(r image.Rectangle, cellSize int) []Cell {
+	cols, rows, cw, rh := gridSize(r.Dx(), r.Dy(), cellSize)
+	x0, y0, x1, y1 := float64(r.Min.X), float64(r.Min.Y), float64(r.Max.X), float64(r.Max.Y)
+
+	// The cells are clipped by the half-planes of the points closer to a site inside the rectangle than to its mirror.
+	mirrors := [][2]Node{
+		{{x0 + 1, y0}, {x0 - 1, y0}},
+		{{x1 - 1, y0}, {x1 + 1, y0}},
+		{{x0, y0 + 1}, {x0, y0 - 1}},
+		{{x0, y1 - 1}, {x0, y1 + 1}},
+	}
+
+	var cells []Cell
+	for j := 0; j <= rows; j++ {
+		n, shift := cols+1, 0.0
+		if j%2 == 1 {
+			n, shift = cols, 0.5
+		}
+		for i := 0; i < n; i++ {
+			site := Node{x0 + (float64(i)+shift)*cw, y0 + float64(j)*rh}
+			hex := []Node{
+				{site.X, site.Y - rh*2/3},
+				{site.X + cw/2, site.Y - rh/3},
+				{site.X + cw/2, site.Y + rh/3},
+				{site.X, site.Y + rh*2/3},
+				{site.X - cw/2, site.Y + rh/3},
+				{site.X - cw/2, site.Y - rh/3},
+			}
+			for _, m := range mirrors {
+				hex = clipHalfPlane(hex, m[0], m[1])
+			}
+			cells = append(cells, Cell{Site: site, Nodes: hex})
+		}
+	}
+	return cells
+}
@@ -0,0 +1,62 @@
+package triangle
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestHexCells(t *testing.T) {
+	// The 120x80 image is covered by 6 rows of 20px wide cells, the even rows having 7 cells and the odd rows 6.
+	cells := hexCells(image.Rect(0, 0, 120, 80), 20)
+	if len(cells) != 3*7+3*6 {
+		t.Fatalf("expected %d cells, got %d", 3*7+3*6, len(cells))
+	}
+
+	// The cells contain their sites and they cover the image without overlapping.
+	var area float64
+	for _, c := range cells {
+		var a float64
+		for i, n := range c.Nodes {
+			m := c.Nodes[(i+1)%len(c.Nodes)]
+			a += n.X*m.Y - m.X*n.Y
+		}
+		area += math.Abs(a) / 2
+
+		if !polygonContains(c.Nodes, c.Site) {
+			t.Errorf("expected the cell %v to contain its site %v", c.Nodes, c.Site)
+		}
+	}
+	if math.Abs(area-120*80) > 1e-6 {
+		t.Errorf("expected the cells to cover the area %v, got %v", 120*80, area)
+	}
+}
+
+func TestDraw_Tessellation(t *testing.T) {
+	for _, tess := range []int{TriGrid, HexGrid} {
+		proc := newTestProcessor()
+		proc.Tessellation, proc.CellSize = tess, 20
+
+		tri := &Image{Processor: proc}
+		res, triangles, points, err := tri.Draw(newTestImage(120, 80), proc, func() {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if b := res.Bounds(); b.Dx() != 120 || b.Dy() != 80 {
+			t.Errorf("expected a 120x80 image, got %dx%d", b.Dx(), b.Dy())
+		}
+
+		// The 5 rows of the triangular grid have 6 columns, each row holding 13 triangles.
+		if len(points) != 3*7+3*8 || len(triangles) != 5*13 {
+			t.Errorf("expected %d points and %d triangles, got %d points and %d triangles",
+				3*7+3*8, 5*13, len(points), len(triangles))
+		}
+		var area float64
+		for _, t := range triangles {
+			area += t.Area()
+		}
+		if math.Abs(area-120*80) > 1e-6 {
+			t.Errorf("expected the triangles to cover the area %v, got %v", 120*80, area)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package triangle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"time"
+)
+
+// Triangulator runs the triangulation pipeline over a series of images, like the frames of a video,
+// reusing the intermediate buffers between the calls instead of allocating them for every image.
+// The buffers are reused as long as the images have the same size. The returned image and slices
+// are owned by the Triangulator and they are overwritten by the next call, so they have to be copied
+// in case they are needed afterwards. A Triangulator is not safe for concurrent use.
+type Triangulator struct {
+	Processor
+	scratch scratch
+}
+
+// Process triangulates the source image, returning the image the triangle colors can be sampled from,
+// the generated triangles and the points they were generated from. The source image is rotated and flipped
+// as requested by the Rotate, FlipH and FlipV options first, so all of them are in the transformed coordinates.
+func (t *Triangulator) Process(src image.Image) (*image.NRGBA, []Triangle, []Point, error) {
+	return t.ProcessContext(context.Background(), src)
+}
+
+// ProcessContext is like Process, but it aborts the triangulation process as soon as the context
+// is cancelled or its deadline is exceeded, returning the context error.
+func (t *Triangulator) ProcessContext(ctx context.Context, src image.Image) (*image.NRGBA, []Triangle, []Point, error) {
+	if err := t.Validate(); err != nil {
+		return nil, nil, nil, err
+	}
+	src = rotateFlip(src, t.Rotate, t.FlipH, t.FlipV)
+	if src.Bounds().Dx() <= 1 || src.Bounds().Dy() <= 1 {
+		return nil, nil, nil, errors.New("The image width and height must be greater than 1px.\n")
+	}
+	start := time.Now()
+	img, triangles, points, err := t.scratch.triangulate(ctx, src, t.Processor)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	t.Stats.finish(start, time.Now())
+	return img, triangles, points, nil
+}
+
+// Edges returns the edge map the points of the last processed image were extracted from, as a grayscale image
+// in the coordinates of the triangulated region. It's nil in case the edges were not detected, like in case of
+// the UniformGrid sampling. Unlike the buffers returned by Process, the image is owned by the caller.
+func (t *Triangulator) Edges() *image.Gray {
+	return t.scratch.grayEdges()
+}
+
+// grayEdges returns a grayscale copy of the edge map of the last triangulation, or nil in case the edges were not detected.
+func (s *scratch) grayEdges() *image.Gray {
+	if s.edgeMap == nil {
+		return nil
+	}
+	// The edge map is stored in the red channel, the other ones holding the unfiltered edges.
+	gray := image.NewGray(s.edgeMap.Rect)
+	for i := range gray.Pix {
+		gray.Pix[i] = s.edgeMap.Pix[i*4]
+	}
+	return gray
+}
+
+// scratch holds the intermediate buffers of the triangulation pipeline.
+// The buffers are allocated on their first use and reused by the next ones.
+type scratch struct {
+	src, blur, gray *image.NRGBA
+	edges           *image.NRGBA
+	region, mask    *image.NRGBA
+	data            []uint8
+	magnitudes      []uint8
+	gradients       []float32
+	directions      []uint8
+	stack           []int
+	values          []int
+	candidates      []Point
+	candidateCount  int
+	bands           [][]Point
+	points          []Point
+	delaunay        Delaunay
+
+	// edgeMap is the edge map the points were extracted from, being nil in case the edges were not detected.
+	edgeMap *image.NRGBA
+	// contours are the lines traced along the strongest edges in case of the TraceContours option.
+	contours [][]Node
+	// full and reduced hold the source image and its reduced copy in case of the MaxDimension option.
+	full, reduced *image.NRGBA
+	// progressFn is the progress function of the context the triangulation runs with.
+	progressFn func(stage string, fraction float64)
+}
+
+// reuseImage returns the image if it has the provided bounds, otherwise it allocates a new one.
+func reuseImage(img *image.NRGBA, r image.Rectangle) *image.NRGBA {
+	if img != nil && img.Rect == r {
+		return img
+	}
+	return image.NewNRGBA(r)
+}
+
+// reuseSlice returns the slice resized to n elements, allocating a new one in case its capacity is not enough.
+func reuseSlice[T any](s []T, n int) []T {
+	if cap(s) >= n {
+		return s[:n]
+	}
+	return make([]T, n)
+}
+
+// triangulate generates the triangles and returns the triangles and points slices.
+// The context is checked between each processing stage, returning its error in case it's done.
+// The time spent in each stage is recorded in the processor's Stats, in case it's defined.
+// In case the Points of the processor are defined, they are triangulated instead of the sampled ones.
+// In case the context is created by WithDebug, the intermediate results are written into the debug directory.
+func (s *scratch) triangulate(ctx context.Context, src image.Image, p Processor) (*image.NRGBA, []Triangle, []Point, error) {
+	var (
+		img       *image.NRGBA
+		triangles []Triangle
+		points    []Point
+		err       error
+	)
+	if p.Points != nil {
+		img, triangles, points, err = s.triangulatePoints(ctx, src, p, p.Points)
+	} else {
+		img, triangles, points, err = s.triangulateEdges(ctx, src, p)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if dir := debugDir(ctx); dir != "" {
+		if err := s.writeDebug(dir, src, img, triangles, points, p); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return img, triangles, points, nil
+}
+
+// triangulateEdges triangulates the points sampled from the edges of the image.
+func (s *scratch) triangulateEdges(ctx context.Context, src image.Image, p Processor) (*image.NRGBA, []Triangle, []Point, error) {
+	var srcImg *image.NRGBA
+
+	stats := p.Stats
+	if stats == nil {
+		stats = new(Stats)
+	}
+	*stats = Stats{}
+	s.edgeMap, s.contours = nil, nil
+	s.progressFn = progressFn(ctx)
+	start := time.Now()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	bounds := src.Bounds().Sub(src.Bounds().Min)
+	p.MaxPoints = p.maxPoints(bounds.Dx(), bounds.Dy())
+
+	// The large images are triangulated at a reduced size, the triangles being scaled back to the source image.
+	// The blurred image returned without triangulation keeps the source image size.
+	width, height := bounds.Dx(), bounds.Dy()
+	rw, rh, reduced := p.reduceSize(width, height)
+	if reduced = reduced && p.MaxPoints > 0; reduced {
+		s.full = convertNRGBA(reuseImage(s.full, bounds), src)
+		s.reduced = downscale(reuseImage(s.reduced, image.Rect(0, 0, rw, rh)), s.full, rw, rh)
+		p = p.scaled(float64(rw)/float64(width), float64(rh)/float64(height), src.Bounds().Min)
+		src, bounds = s.reduced, s.reduced.Bounds()
+	}
+
+	// The blur is applied on a copy of the source, so the caller's image is not altered.
+	s.blur = convertNRGBA(reuseImage(s.blur, bounds), src)
+	s.src = reuseImage(s.src, bounds)
+	draw.Draw(s.src, bounds, s.blur, image.Point{}, draw.Src)
+
+	var blur *image.NRGBA
+	switch p.BlurType {
+	case GaussianBlurType:
+		blur = GaussianBlur(s.blur, uint32(p.BlurRadius))
+	default:
+		blur = StackBlurParallel(s.blur, uint32(p.BlurRadius), p.BlurPasses, p.Workers)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	if p.MaxPoints < 1 {
+		lap(&stats.Blur, start)
+		return blur, nil, nil, nil
+	}
+
+	s.gray = grayscale(reuseImage(s.gray, bounds), blur, p.LuminanceMode)
+	if p.Grayscale {
+		srcImg = s.gray
+	} else {
+		srcImg = s.src
+	}
+	start = lap(&stats.Blur, start)
+
+	// In case a region is defined, the edges are detected only inside it.
+	region, gray := bounds, s.gray
+	if !p.Region.Empty() {
+		region = p.Region.Sub(src.Bounds().Min).Intersect(bounds)
+		if region.Dx() <= 1 || region.Dy() <= 1 {
+			return nil, nil, nil, fmt.Errorf("the region %v does not overlap the image", p.Region)
+		}
+		s.region = convertNRGBA(reuseImage(s.region, region.Sub(region.Min)), s.gray.SubImage(region))
+		gray = s.region
+	}
+	w, h := region.Dx(), region.Dy()
+
+	var mask *image.NRGBA
+	if p.IgnoreTransparent {
+		mask = s.src
+		if region != bounds {
+			s.mask = convertNRGBA(reuseImage(s.mask, region.Sub(region.Min)), s.src.SubImage(region))
+			mask = s.mask
+		}
+	}
+
+	var points []Point
+	switch {
+	case p.Tessellation != DelaunayTessellation:
+		// The grid nodes cover the whole image, including its border, so the border is not seeded either.
+		points = s.latticePoints(w, h, p.CellSize)
+		stats.Candidates = len(points)
+		s.progress(ScanStage, 1)
+	case p.SamplingMethod == UniformGrid:
+		// The points are placed regardless of the image content, so the edges are not detected.
+		points = s.gridPoints(mask, w, h, p.MaxPoints, float64(p.MinPointDistance))
+		stats.Candidates = len(points)
+		s.progress(ScanStage, 1)
+	default:
+		var edges *image.NRGBA
+		if p.EdgeDetector == CannyOperator {
+			edges = s.cannyFilter(gray, float64(p.CannyLowThreshold), float64(p.CannyHighThreshold), p.EdgeBias)
+		} else {
+			// The gradient of the color channels detects the borders between the colors having the same luminance.
+			img, channels := gray, 1
+			if p.ColorEdges {
+				img, channels = blur, 3
+				if region != bounds {
+					img = convertNRGBA(image.NewNRGBA(region.Sub(region.Min)), blur.SubImage(region))
+				}
+			}
+			kernelX, kernelY := edgeKernels(p.EdgeDetector)
+			threshold := float64(p.SobelThreshold)
+			if p.AutoThreshold {
+				// Target as many edge pixels as the point rate reduces to the maximum number of points.
+				threshold = s.edgeThreshold(img, int(float64(p.MaxPoints)/p.PointRate), kernelX, kernelY, p.EdgeBias, channels)
+			}
+			edges = s.edgeFilter(img, threshold, kernelX, kernelY, p.EdgeBias, channels)
+		}
+
+		blurMatrix := setBlurMatrix(p.BlurFactor)
+		edgeMatrix, edgeDivisor := setEdgeMatrix(p.EdgeFactor), float64(p.EdgeFactor)
+		// The custom kernel is copied, since the convolution filter scales the matrix in place.
+		if p.CustomEdgeKernel != nil {
+			edgeMatrix, edgeDivisor = append([]float64(nil), p.CustomEdgeKernel...), 1
+		}
+
+		s.values = reuseSlice(s.values, w*h)
+		convolutionFilter(blurMatrix, edges, float64(len(blurMatrix)), s.values)
+		convolutionFilter(edgeMatrix, edges, edgeDivisor, s.values)
+		if err := ctx.Err(); err != nil {
+			return nil, nil, nil, err
+		}
+		start = lap(&stats.EdgeDetection, start)
+
+		points = p.getPoints(s, edges, mask, region.Min, p.PointsThreshold, p.MaxPoints)
+		s.edgeMap = edges
+		stats.Candidates = s.candidateCount
+		if p.TraceContours {
+			s.contours = traceContours(edges)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	// Seed the region border, so the triangles along it are not stretched between the corners.
+	if region != bounds && p.Tessellation == DelaunayTessellation {
+		points = seedBorder(points, w, h)
+		s.points = points
+	}
+	start = lap(&stats.PointExtraction, start)
+
+	// The relaxation passes triangulate the points again, so each pass takes an equal part of the progress.
+	passes := float64(p.RelaxationPasses + 1)
+	progress := func(pass int) func(float64) {
+		if s.progressFn == nil {
+			return nil
+		}
+		return func(fraction float64) {
+			s.progress(TriangulationStage, (float64(pass)+fraction)/passes)
+		}
+	}
+
+	var triangles []Triangle
+	if p.Tessellation != DelaunayTessellation {
+		// The grid nodes are joined by regular triangles, so they are neither triangulated nor relaxed.
+		triangles = latticeTriangles(points, w, h, p.CellSize)
+		s.progress(TriangulationStage, 1)
+	} else {
+		delaunay := &s.delaunay
+		if err := delaunay.reset(w, h).insert(ctx, points, progress(0)); err != nil {
+			return nil, nil, nil, err
+		}
+		triangles = delaunay.GetTriangles()
+
+		for i := 0; i < p.RelaxationPasses; i++ {
+			points = relaxPoints(triangles, points, w, h)
+			if err := delaunay.reset(w, h).insert(ctx, points, progress(i+1)); err != nil {
+				return nil, nil, nil, err
+			}
+			triangles = delaunay.GetTriangles()
+		}
+	}
+
+	// Drop the triangles smaller than the minimum area, the kept ones being moved in place.
+	if p.MinTriangleArea > 0 {
+		kept := triangles[:0]
+		for _, t := range triangles {
+			if t.Area() >= p.MinTriangleArea {
+				kept = append(kept, t)
+			}
+		}
+		triangles = kept
+	}
+
+	// Move the triangles and the points triangulated in the region coordinates to their place on the image.
+	if off := region.Min; off != (image.Point{}) {
+		for _, t := range triangles {
+			for i := range t.Nodes {
+				t.Nodes[i].X += float64(off.X)
+				t.Nodes[i].Y += float64(off.Y)
+			}
+		}
+		for i := range points {
+			points[i].X += float64(off.X)
+			points[i].Y += float64(off.Y)
+		}
+		for _, c := range s.contours {
+			for i := range c {
+				c[i].X += float64(off.X)
+				c[i].Y += float64(off.Y)
+			}
+		}
+	}
+	// The colors are sampled from the source image, since the triangles are rendered at its size.
+	if reduced {
+		sx, sy := float64(width)/float64(rw), float64(height)/float64(rh)
+		triangles = scaleTriangles(triangles, sx, sy)
+		for i := range points {
+			points[i].X *= sx
+			points[i].Y *= sy
+		}
+		for _, c := range s.contours {
+			for i := range c {
+				c[i].X *= sx
+				c[i].Y *= sy
+			}
+		}
+		srcImg = s.full
+		if p.Grayscale {
+			srcImg = grayscale(s.full, s.full, p.LuminanceMode)
+		}
+	}
+	if p.Posterize > 0 {
+		srcImg = posterize(srcImg, p.Posterize)
+	}
+	lap(&stats.Triangulation, start)
+	stats.Points, stats.Triangles = len(points), len(triangles)
+
+	return srcImg, triangles, points, nil
+}
+
+// scaleTriangles returns the triangles having their nodes scaled by sx and sy. The circumcircles are computed again,
+// since they are not scaled the same way in case the scale factors differ.
+func scaleTriangles(triangles []Triangle, sx, sy float64) []Triangle {
+	data := make([]triangleData, len(triangles))
+	for i, t := range triangles {
+		n := t.Nodes
+		triangles[i] = t.newTriangle(&data[i], Node{n[0].X * sx, n[0].Y * sy}, Node{n[1].X * sx, n[1].Y * sy}, Node{n[2].X * sx, n[2].Y * sy})
+	}
+	return triangles
+}
+
+// triangulatePoints triangulates the provided points instead of the ones sampled from the image, skipping the blur,
+// the edge detection and the point sampling stages. The points are relative to the top left corner of the image,
+// the ones outside of it being dropped. The triangle colors are sampled from the image as it is, without blurring it.
+func (s *scratch) triangulatePoints(ctx context.Context, src image.Image, p Processor, points []Point) (*image.NRGBA, []Triangle, []Point, error) {
+	stats := p.Stats
+	if stats == nil {
+		stats = new(Stats)
+	}
+	*stats = Stats{}
+	s.edgeMap, s.contours = nil, nil
+	s.progressFn = progressFn(ctx)
+	start := time.Now()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	bounds := src.Bounds().Sub(src.Bounds().Min)
+	s.src = convertNRGBA(reuseImage(s.src, bounds), src)
+	srcImg := s.src
+	if p.Grayscale {
+		s.gray = grayscale(reuseImage(s.gray, bounds), s.src, p.LuminanceMode)
+		srcImg = s.gray
+	}
+
+	// The points are copied, so the caller's slice is not altered by the triangulation.
+	w, h := bounds.Dx(), bounds.Dy()
+	s.points = s.points[:0]
+	for _, pt := range points {
+		if pt.X >= 0 && pt.Y >= 0 && pt.X <= float64(w) && pt.Y <= float64(h) {
+			s.points = append(s.points, pt)
+		}
+	}
+	stats.Candidates = len(points)
+
+	var progress func(float64)
+	if s.progressFn != nil {
+		progress = func(fraction float64) {
+			s.progress(TriangulationStage, fraction)
+		}
+	}
+	delaunay := &s.delaunay
+	if err := delaunay.reset(w, h).insert(ctx, s.points, progress); err != nil {
+		return nil, nil, nil, err
+	}
+	triangles := delaunay.GetTriangles()
+	if p.Posterize > 0 {
+		srcImg = posterize(srcImg, p.Posterize)
+	}
+
+	lap(&stats.Triangulation, start)
+	stats.Points, stats.Triangles = len(s.points), len(triangles)
+
+	return srcImg, triangles, s.points, nil
+}
+
+// seedBorder appends to the points evenly spaced points along the border of the width x height rectangle,
+// the spacing being the average distance between the points.
+func seedBorder(points []Point, width, height int) []Point {
+	spacing := math.Sqrt(float64(width*height) / float64(Max(len(points), 1)))
+	nx := int(math.Ceil(float64(width) / spacing))
+	ny := int(math.Ceil(float64(height) / spacing))
+
+	for i := 1; i < nx; i++ {
+		x := math.Round(float64(i*width) / float64(nx))
+		points = append(points, Point{X: x, Y: 0}, Point{X: x, Y: float64(height)})
+	}
+	for i := 1; i < ny; i++ {
+		y := math.Round(float64(i*height) / float64(ny))
+		points = append(points, Point{X: 0, Y: y}, Point{X: float64(width), Y: y})
+	}
+	return points
+}
@@ -0,0 +1,192 @@
+package triangle
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestTriangulator_Process(t *testing.T) {
+	tr := &Triangulator{Processor: newTestProcessor()}
+
+	src := newTestImage(120, 80)
+	orig := append([]uint8(nil), src.Pix...)
+
+	img, triangles, points, err := tr.Process(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(triangles) == 0 || len(points) == 0 {
+		t.Fatal("expected the triangles and the points to be generated")
+	}
+	if !bytes.Equal(src.Pix, orig) {
+		t.Error("expected the source image to be left unaltered")
+	}
+
+	// The buffers are reused for an image of the same size.
+	next, _, _, err := tr.Process(newTestImage(120, 80))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next != img {
+		t.Error("expected the image buffer to be reused")
+	}
+
+	// The buffers are reallocated for an image of a different size.
+	img, triangles, _, err = tr.Process(newTestImage(60, 90))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 60 || b.Dy() != 90 {
+		t.Errorf("expected a 60x90 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	for _, tri := range triangles {
+		for _, n := range tri.Nodes {
+			if n.X < 0 || n.X > 60 || n.Y < 0 || n.Y > 90 {
+				t.Fatalf("expected the triangle nodes to be within the image bounds, got %v", n)
+			}
+		}
+	}
+}
+
+func TestTriangulator_InvalidOptions(t *testing.T) {
+	proc := newTestProcessor()
+	proc.PointRate = 0
+
+	tr := &Triangulator{Processor: proc}
+	if _, _, _, err := tr.Process(newTestImage(120, 80)); err == nil {
+		t.Error("expected an error for the invalid options")
+	}
+}
+
+func TestTriangulator_RotateFlip(t *testing.T) {
+	proc := newTestProcessor()
+	proc.Rotate, proc.FlipH = 90, true
+
+	tr := &Triangulator{Processor: proc}
+	img, _, points, err := tr.Process(newTestImage(120, 80))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 80 || b.Dy() != 120 {
+		t.Fatalf("expected the image to be rotated to 80x120, got %dx%d", b.Dx(), b.Dy())
+	}
+	for _, p := range points {
+		if p.X < 0 || p.X >= 80 || p.Y < 0 || p.Y >= 120 {
+			t.Fatalf("expected the points to be inside the rotated image, got %v", p)
+		}
+	}
+
+	// The triangulation matches the one of the source image transformed up front.
+	want, _, _, err := (&Triangulator{Processor: newTestProcessor()}).Process(rotateFlip(newTestImage(120, 80), 90, true, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(img.Pix, want.Pix) {
+		t.Error("expected the source image to be rotated and flipped before the triangulation")
+	}
+}
+
+func TestTriangulator_CustomEdgeKernel(t *testing.T) {
+	edges := func(kernel []float64) []uint8 {
+		proc := newTestProcessor()
+		proc.CustomEdgeKernel = kernel
+		tr := &Triangulator{Processor: proc}
+		if _, _, _, err := tr.Process(newTestImage(120, 80)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return tr.Edges().Pix
+	}
+
+	laplacian := []float64{0, 1, 0, 1, -4, 1, 0, 1, 0}
+	if bytes.Equal(edges(nil), edges(laplacian)) {
+		t.Error("expected the custom kernel to change the edges the points are extracted from")
+	}
+	if laplacian[4] != -4 {
+		t.Error("expected the custom kernel to be left unaltered")
+	}
+}
+
+func TestTriangulator_MaxDimension(t *testing.T) {
+	proc := newTestProcessor()
+	proc.MaxDimension = 500
+	tr := &Triangulator{Processor: proc}
+	img, triangles, points, err := tr.Process(newTestImage(4000, 200))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The edges are detected on the reduced image, keeping the aspect ratio.
+	if b := tr.Edges().Bounds(); b.Dx() != 500 || b.Dy() != 25 {
+		t.Errorf("expected the edges to be detected on a 500x25 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	// The colors are sampled from the source image, the triangles being scaled back to it.
+	if b := img.Bounds(); b.Dx() != 4000 || b.Dy() != 200 {
+		t.Errorf("expected the colors to be sampled from a 4000x200 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	if len(triangles) == 0 || len(points) == 0 {
+		t.Fatal("expected the image to be triangulated")
+	}
+	var maxX, maxY float64
+	for _, tri := range triangles {
+		for _, n := range tri.Nodes {
+			maxX, maxY = math.Max(maxX, n.X), math.Max(maxY, n.Y)
+		}
+	}
+	if maxX != 4000 || maxY != 200 {
+		t.Errorf("expected the triangles to cover the 4000x200 image, got %vx%v", maxX, maxY)
+	}
+}
+
+func TestTriangulator_ColorEdges(t *testing.T) {
+	// The red and green halves have the same rec. 601 luminance.
+	src := image.NewNRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= 60 {
+				c = color.NRGBA{G: 130, A: 255}
+			}
+			src.SetNRGBA(x, y, c)
+		}
+	}
+
+	// The edges are compared along the border, away from the edges of the image.
+	process := func(colorEdges bool) (edges int, border int) {
+		proc := newTestProcessor()
+		proc.ColorEdges = colorEdges
+		tr := &Triangulator{Processor: proc}
+		_, _, points, err := tr.Process(src)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		e := tr.Edges()
+		for y := 10; y < 70; y++ {
+			for x := 50; x < 70; x++ {
+				if e.GrayAt(x, y).Y != 0 {
+					edges++
+				}
+			}
+		}
+		for _, p := range points {
+			if math.Abs(p.X-60) <= 4 && p.Y > 4 && p.Y < 76 {
+				border++
+			}
+		}
+		return edges, border
+	}
+
+	lumaEdges, lumaBorder := process(false)
+	if lumaEdges != 0 {
+		t.Errorf("expected no edges along the isoluminant border, got %d pixels", lumaEdges)
+	}
+	colorEdges, colorBorder := process(true)
+	if colorEdges == 0 {
+		t.Error("expected the color edges to detect the isoluminant border")
+	}
+	if colorBorder <= lumaBorder {
+		t.Errorf("expected more points along the border with the color edges, got %d <= %d", colorBorder, lumaBorder)
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/esimov/triangle/v2"
+)
+
+// Config defines a processing profile, holding the processor options together with the optional
+// source and destination paths. The options are named after the Processor fields, like in the
+// following profile: {"in": "portrait.jpg", "BlurRadius": 4, "MaxPoints": 5000, "Wireframe": 1}.
+type Config struct {
+	In  string `json:"in"`
+	Out string `json:"out"`
+	triangle.Processor
+}
+
+// LoadConfig loads the processing profile from the JSON file, returning its processor options.
+// The options missing from the file have their zero values.
+func LoadConfig(path string) (*triangle.Processor, error) {
+	var cfg Config
+	if err := ReadConfig(path, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg.Processor, nil
+}
+
+// ReadConfig reads the processing profile from the JSON file into cfg, so the options
+// missing from the file keep their values. The unknown options are reported as errors.
+func ReadConfig(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open the config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("unable to decode the config file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/esimov/triangle/v2"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.json")
+	profile := `{
+		"in": "input.jpg",
+		"out": "output.png",
+		"BlurRadius": 4,
+		"MaxPoints": 5000,
+		"Wireframe": 1,
+		"StrokeColor": "#ff0000",
+		"MinTriangleArea": 2.5,
+		"Output16Bit": true
+	}`
+	if err := os.WriteFile(path, []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unable to load the config: %v", err)
+	}
+	expected := triangle.Processor{
+		BlurRadius:      4,
+		MaxPoints:       5000,
+		Wireframe:       1,
+		StrokeColor:     "#ff0000",
+		MinTriangleArea: 2.5,
+		Output16Bit:     true,
+	}
+	if !reflect.DeepEqual(*p, expected) {
+		t.Errorf("expected the processor %+v, got %+v", expected, *p)
+	}
+
+	cfg := Config{Processor: triangle.Processor{BlurRadius: 2, PointRate: 0.075}}
+	if err := ReadConfig(path, &cfg); err != nil {
+		t.Fatalf("unable to read the config: %v", err)
+	}
+	if cfg.In != "input.jpg" || cfg.Out != "output.png" {
+		t.Errorf("expected the paths input.jpg and output.png, got %s and %s", cfg.In, cfg.Out)
+	}
+	if cfg.BlurRadius != 4 || cfg.PointRate != 0.075 {
+		t.Errorf("expected the BlurRadius 4 and the preserved PointRate 0.075, got %d and %v", cfg.BlurRadius, cfg.PointRate)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"Blur": 4}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected an error for the unknown option")
+	}
+}
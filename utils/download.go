@@ -1,39 +1,154 @@
 package utils
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 )
 
-// DownloadImage downloads the image from the internet and saves it into a temporary file.
-func DownloadImage(url string) (*os.File, error) {
-	// Retrieve the url and decode the response body.
-	res, err := http.Get(url)
+const (
+	// DefaultDownloadTimeout is the time limit of a download attempt in case no timeout is defined by the options.
+	DefaultDownloadTimeout = 30 * time.Second
+	// DefaultMaxDownloadSize is the size limit of the downloaded image in case no limit is defined by the options.
+	DefaultMaxDownloadSize = 50 << 20
+	// DefaultMaxRedirects is the number of the followed redirects in case no limit is defined by the options.
+	DefaultMaxRedirects = 5
+	// DefaultRetryBackoff is the delay before the first retry in case no delay is defined by the options.
+	DefaultRetryBackoff = 500 * time.Millisecond
+)
+
+// DownloadOptions defines the limits of the image download.
+type DownloadOptions struct {
+	// Timeout limits the time of each download attempt, including the connection and the reading of the body.
+	// The DefaultDownloadTimeout is used in case it's 0.
+	Timeout time.Duration
+	// MaxBytes limits the size of the downloaded image, the larger responses being rejected without reading
+	// them to the end. The DefaultMaxDownloadSize is used in case it's 0.
+	MaxBytes int64
+	// MaxRedirects limits the number of the followed redirects, which have to point to http or https URLs.
+	// The DefaultMaxRedirects is used in case it's 0, while a negative value disables the redirects.
+	MaxRedirects int
+	// Retries defines how many times the download is retried after a transient failure, like a network error,
+	// a timeout or a 429 or 5xx status. The other failures are not retried.
+	Retries int
+	// Backoff is the delay before the first retry, doubled before every following one.
+	// The DefaultRetryBackoff is used in case it's 0.
+	Backoff time.Duration
+}
+
+// transientError marks the download failures worth retrying.
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string { return e.err.Error() }
+func (e transientError) Unwrap() error { return e.err }
+
+// DownloadImage downloads the image from the internet and saves it into a temporary file created in the
+// directory returned by os.TempDir, which the caller has to remove. The file is positioned at its beginning.
+// Only the successful responses having an image content type and a size within the limits are accepted,
+// the transient failures being retried as many times as defined by the options.
+func DownloadImage(uri string, opts DownloadOptions) (*os.File, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultDownloadTimeout
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxDownloadSize
+	}
+	if opts.MaxRedirects == 0 {
+		opts.MaxRedirects = DefaultMaxRedirects
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultRetryBackoff
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if opts.MaxRedirects < 0 || len(via) > opts.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", len(via))
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to the unsupported URI %s", req.URL)
+			}
+			return nil
+		},
+	}
+
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		f, err := download(client, uri, opts)
+		var transient transientError
+		if err == nil || attempt >= opts.Retries || !errors.As(err, &transient) {
+			return f, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// download makes a single attempt to download the image into a temporary file, the failures worth retrying
+// being wrapped into a transientError.
+func download(client *http.Client, uri string, opts DownloadOptions) (*os.File, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download image file from URI: %s: %w", uri, err)
+	}
+	res, err := client.Do(req)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("unable to download image file from URI: %s, status %v", url, res.Status))
+		err = fmt.Errorf("unable to download image file from URI: %s: %w", uri, err)
+		// The response is returned together with the errors of the redirect policy only, the other ones
+		// being caused by the network or the timeout.
+		if res == nil {
+			return nil, transientError{err}
+		}
+		return nil, err
 	}
 	defer res.Body.Close()
 
-	data, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("unable to read response body: %s", err))
+	if res.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unable to download image file from URI: %s, status %v", uri, res.Status)
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+			return nil, transientError{err}
+		}
+		return nil, err
+	}
+	if mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("the URI %s is not an image, content type %q", uri, res.Header.Get("Content-Type"))
+	}
+	if res.ContentLength > opts.MaxBytes {
+		return nil, fmt.Errorf("the image size of %d bytes exceeds the limit of %d bytes", res.ContentLength, opts.MaxBytes)
 	}
 
-	tmpfile, err := ioutil.TempFile("/tmp", "image")
+	tmpfile, err := os.CreateTemp("", "image")
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("unable to create temporary file: %v", err))
+		return nil, fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	fail := func(err error) (*os.File, error) {
+		tmpfile.Close()
+		os.Remove(tmpfile.Name())
+		return nil, err
 	}
 
-	// Copy the image binary data into the temporary file.
-	_, err = io.Copy(tmpfile, bytes.NewBuffer(data))
+	// The body is read up to one byte over the limit, so the responses without a known length are rejected too.
+	n, err := io.Copy(tmpfile, io.LimitReader(res.Body, opts.MaxBytes+1))
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("unable to copy the source URI into the destination file"))
+		return fail(transientError{fmt.Errorf("unable to copy the source URI into the destination file: %w", err)})
+	}
+	if n > opts.MaxBytes {
+		return fail(fmt.Errorf("the image size exceeds the limit of %d bytes", opts.MaxBytes))
+	}
+	if _, err := tmpfile.Seek(0, io.SeekStart); err != nil {
+		return fail(fmt.Errorf("unable to rewind the temporary file: %w", err))
 	}
 	return tmpfile, nil
 }
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadImage(t *testing.T) {
+	image := bytes.Repeat([]byte{0x89}, 1024)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(image)
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/stream.png", func(w http.ResponseWriter, r *http.Request) {
+		// The flushed response has no content length, so the size is known only after reading it.
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(image[:512])
+		w.(http.Flusher).Flush()
+		w.Write(image[512:])
+	})
+	mux.HandleFunc("/slow.png", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f, err := DownloadImage(srv.URL+"/image.png", DownloadOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, image) {
+		t.Errorf("expected the downloaded file to hold the %d bytes of the image, got %d bytes", len(image), len(data))
+	}
+
+	for _, tt := range []struct {
+		name, path string
+		opts       DownloadOptions
+		err        string
+	}{
+		{"not found", "/missing.png", DownloadOptions{}, "404"},
+		{"not an image", "/page.html", DownloadOptions{}, "text/html"},
+		{"oversized", "/image.png", DownloadOptions{MaxBytes: 1000}, "exceeds the limit"},
+		{"oversized stream", "/stream.png", DownloadOptions{MaxBytes: 1000}, "exceeds the limit"},
+		{"timeout", "/slow.png", DownloadOptions{Timeout: 50 * time.Millisecond}, "deadline exceeded"},
+	} {
+		f, err := DownloadImage(srv.URL+tt.path, tt.opts)
+		if err == nil {
+			f.Close()
+			os.Remove(f.Name())
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected the error to contain %q, got: %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestDownloadImage_Retry(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first two requests fail with a transient error, like the ones of an overloaded CDN.
+		requests++
+		if requests <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer srv.Close()
+
+	if _, err := DownloadImage(srv.URL, DownloadOptions{Retries: 1, Backoff: time.Millisecond}); err == nil {
+		t.Fatal("expected an error after exhausting the retries")
+	}
+
+	requests = 0
+	f, err := DownloadImage(srv.URL, DownloadOptions{Retries: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	if requests != 3 {
+		t.Errorf("expected the download to succeed on the third request, got %d requests", requests)
+	}
+
+	// The permanent failures are not retried.
+	requests = 10
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer notFound.Close()
+	if _, err := DownloadImage(notFound.URL, DownloadOptions{Retries: 3, Backoff: time.Millisecond}); err == nil {
+		t.Fatal("expected an error for the missing image")
+	}
+	if requests != 11 {
+		t.Errorf("expected a single request for the missing image, got %d", requests-10)
+	}
+}
+
+func TestDownloadImage_Redirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/image.png", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f, err := DownloadImage(srv.URL+"/moved", DownloadOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	for _, tt := range []struct {
+		path string
+		opts DownloadOptions
+	}{
+		{"/moved", DownloadOptions{MaxRedirects: -1}},
+		{"/loop", DownloadOptions{Retries: 2, Backoff: time.Millisecond}},
+		{"/file", DownloadOptions{}},
+	} {
+		if _, err := DownloadImage(srv.URL+tt.path, tt.opts); err == nil {
+			t.Errorf("%s: expected the redirect to be rejected", tt.path)
+		}
+	}
+
+	// The error reports every redirect received, including the rejected one.
+	_, err = DownloadImage(srv.URL+"/loop", DownloadOptions{MaxRedirects: 2})
+	if err == nil || !strings.Contains(err.Error(), "stopped after 3 redirects") {
+		t.Errorf("expected the error to report 3 redirects, got %v", err)
+	}
+}
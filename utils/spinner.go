@@ -9,6 +9,8 @@ import (
 	"sync"
 	"time"
 	"unicode/utf8"
+
+	"golang.org/x/term"
 )
 
 // Spinner initializes the progress indicator.
@@ -17,26 +19,54 @@ type Spinner struct {
 	delay      time.Duration
 	writer     io.Writer
 	message    string
+	suffix     string
 	lastOutput string
 	StopMsg    string
 	hideCursor bool
 	stopChan   chan struct{}
+	// animate tells if the progress indicator is animated, which is the case only when it's written to a terminal.
+	animate bool
 }
 
-// NewSpinner instantiates a new progress indicator.
+// NewSpinner instantiates a new progress indicator writing to the stderr.
 func NewSpinner(msg string, d time.Duration, hideCursor bool) *Spinner {
-	return &Spinner{
+	s := &Spinner{
 		mu:         &sync.RWMutex{},
 		delay:      d,
-		writer:     os.Stderr,
 		message:    msg,
 		hideCursor: hideCursor,
 		stopChan:   make(chan struct{}, 1),
 	}
+	s.SetWriter(os.Stderr)
+	return s
+}
+
+// SetWriter sets the writer the progress indicator is written to. The progress indicator is animated only in case
+// the writer is a terminal, otherwise only the stop message is written, so the escape sequences of the animation
+// don't garble the logs of the non-interactive runs, like the CI builds or the redirected output.
+func (s *Spinner) SetWriter(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writer = w
+	s.animate = isTerminal(w)
+}
+
+// isTerminal checks if the writer is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
 }
 
-// Start starts the progress indicator.
+// Start starts the progress indicator. It does nothing in case the progress indicator is not animated.
 func (s *Spinner) Start() {
+	s.mu.RLock()
+	animate := s.animate
+	s.mu.RUnlock()
+	if !animate {
+		return
+	}
+
 	if s.hideCursor && runtime.GOOS != "windows" {
 		// hides the cursor
 		fmt.Fprintf(s.writer, "\033[?25l")
@@ -51,8 +81,8 @@ func (s *Spinner) Start() {
 				default:
 					s.mu.Lock()
 
-					output := fmt.Sprintf("\r%s%s %c%s", s.message, SuccessColor, r, DefaultColor)
-					fmt.Fprintf(s.writer, output)
+					output := fmt.Sprintf("\r%s%s %c%s%s", s.message, SuccessColor, r, DefaultColor, s.suffix)
+					fmt.Fprint(s.writer, output)
 					s.lastOutput = output
 
 					s.mu.Unlock()
@@ -63,22 +93,37 @@ func (s *Spinner) Start() {
 	}()
 }
 
-// Stop stops the progress indicator.
+// SetSuffix sets the text displayed after the progress indicator, like the completed percentage.
+func (s *Spinner) SetSuffix(suffix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if suffix != "" {
+		suffix = " " + suffix
+	}
+	s.suffix = suffix
+}
+
+// Stop stops the progress indicator, writing the stop message in case it's defined.
 func (s *Spinner) Stop() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.clear()
-	s.RestoreCursor()
+	if s.animate {
+		s.clear()
+		s.RestoreCursor()
+	}
 	if len(s.StopMsg) > 0 {
-		fmt.Fprintf(s.writer, s.StopMsg)
+		fmt.Fprint(s.writer, s.StopMsg)
+	}
+	if s.animate {
+		s.stopChan <- struct{}{}
 	}
-	s.stopChan <- struct{}{}
 }
 
-// RestoreCursor restores back the cursor visibility.
+// RestoreCursor restores back the cursor visibility. It does nothing in case the progress indicator is not animated.
 func (s *Spinner) RestoreCursor() {
-	if s.hideCursor && runtime.GOOS != "windows" {
+	if s.hideCursor && s.animate && runtime.GOOS != "windows" {
 		// makes the cursor visible
 		fmt.Fprint(s.writer, "\033[?25h")
 	}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSpinner_NotTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewSpinner("processing", time.Millisecond, true)
+	s.SetWriter(&buf)
+	s.StopMsg = "done"
+
+	// Stopping the progress indicator repeatedly doesn't block, even though it's not animated.
+	for i := 0; i < 2; i++ {
+		s.Start()
+		s.SetSuffix("50%")
+		time.Sleep(5 * time.Millisecond)
+		s.Stop()
+	}
+	s.RestoreCursor()
+
+	if got := buf.String(); got != "donedone" {
+		t.Errorf("expected only the stop messages to be written, got %q", got)
+	}
+}
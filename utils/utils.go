@@ -3,6 +3,8 @@ package utils
 import (
 	"fmt"
 	"math"
+	"os/exec"
+	"runtime"
 	"time"
 )
 
@@ -28,3 +30,17 @@ func FormatTime(d time.Duration) string {
 		int64(d.Hours()/24), int64(remainingHours),
 		int64(remainingMinutes), int64(remainingSeconds))
 }
+
+// OpenBrowser opens the url in the default web browser of the operating system.
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
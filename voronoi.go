@@ -0,0 +1,198 @@
+package triangle
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// VoronoiDiagram is the Voronoi diagram dual to the Delaunay triangulation. Its vertices are the circumcenters
+// of the triangles, connected by an edge in case their triangles are adjacent, while its cells hold the area
+// closer to a triangle node than to any other one.
+type VoronoiDiagram struct {
+	// Vertices holds the circumcenters of the non-degenerate triangles.
+	Vertices []Node
+	// Edges holds the index pairs of the vertices whose triangles share an edge.
+	Edges [][2]int
+	// Cells holds the cells of the triangle nodes, clipped to the bounding rectangle of the triangles.
+	Cells []Cell
+}
+
+// Cell defines a cell of the Voronoi diagram, being the convex polygon of the points closer to its site than to any other site.
+type Cell struct {
+	Site  Node
+	Nodes []Node
+}
+
+// NewVoronoiDiagram builds the Voronoi diagram of the triangles returned by the triangulation. Since the triangles cover
+// a rectangle, the cells of the nodes on its border are clipped to it, instead of being unbounded.
+func NewVoronoiDiagram(triangles []Triangle) *VoronoiDiagram {
+	var (
+		vd        = &VoronoiDiagram{}
+		sites     = make(map[Node]int)
+		neighbors [][]Node
+		shared    = make(map[[2]Node]int)
+	)
+	if len(triangles) == 0 {
+		return vd
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, t := range triangles {
+		vertex := -1
+		// The circumcenter of a degenerate triangle is at infinity, so it's not a vertex of the diagram.
+		if t.Area() > 0 && !math.IsInf(t.circle.x, 0) && !math.IsInf(t.circle.y, 0) {
+			vertex = len(vd.Vertices)
+			vd.Vertices = append(vd.Vertices, Node{t.circle.x, t.circle.y})
+		}
+
+		for i, n := range t.Nodes {
+			minX, minY = math.Min(minX, n.X), math.Min(minY, n.Y)
+			maxX, maxY = math.Max(maxX, n.X), math.Max(maxY, n.Y)
+
+			idx, ok := sites[n]
+			if !ok {
+				idx = len(neighbors)
+				sites[n] = idx
+				neighbors = append(neighbors, nil)
+				vd.Cells = append(vd.Cells, Cell{Site: n})
+			}
+			neighbors[idx] = appendNode(neighbors[idx], t.Nodes[(i+1)%3], t.Nodes[(i+2)%3])
+
+			// The triangles sharing an edge are found by the key of the edge, having its nodes in a fixed order.
+			key := edgeKey(n, t.Nodes[(i+1)%3])
+			if other, ok := shared[key]; ok {
+				if other >= 0 && vertex >= 0 {
+					vd.Edges = append(vd.Edges, [2]int{other, vertex})
+				}
+				delete(shared, key)
+			} else {
+				shared[key] = vertex
+			}
+		}
+	}
+
+	// Each cell is the bounding rectangle clipped by the perpendicular bisectors between its site and the neighboring sites.
+	bounds := []Node{{minX, minY}, {maxX, minY}, {maxX, maxY}, {minX, maxY}}
+	for i := range vd.Cells {
+		cell := append([]Node(nil), bounds...)
+		site := vd.Cells[i].Site
+		for _, n := range neighbors[i] {
+			cell = clipHalfPlane(cell, site, n)
+		}
+		vd.Cells[i].Nodes = cell
+	}
+	return vd
+}
+
+// appendNode appends the nodes to the slice, skipping the ones which are already present.
+func appendNode(nodes []Node, ns ...Node) []Node {
+next:
+	for _, n := range ns {
+		for _, m := range nodes {
+			if m == n {
+				continue next
+			}
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// clipHalfPlane clips the convex polygon to the half-plane of the points closer to the site than to the neighbor,
+// using the Sutherland-Hodgman algorithm.
+func clipHalfPlane(polygon []Node, site, neighbor Node) []Node {
+	// The signed distance of a point from the bisector is negative on the side of the site.
+	dx, dy := neighbor.X-site.X, neighbor.Y-site.Y
+	mx, my := (site.X+neighbor.X)/2, (site.Y+neighbor.Y)/2
+	dist := func(n Node) float64 {
+		return (n.X-mx)*dx + (n.Y-my)*dy
+	}
+
+	clipped := make([]Node, 0, len(polygon)+1)
+	for i, a := range polygon {
+		b := polygon[(i+1)%len(polygon)]
+		da, db := dist(a), dist(b)
+		if da <= 0 {
+			clipped = append(clipped, a)
+		}
+		if (da < 0 && db > 0) || (da > 0 && db < 0) {
+			t := da / (da - db)
+			clipped = append(clipped, Node{a.X + (b.X-a.X)*t, a.Y + (b.Y-a.Y)*t})
+		}
+	}
+	return clipped
+}
+
+// siteColor returns the color of the pixel found at the cell site, the sites on the border of the image
+// being moved to its closest pixel.
+func siteColor(img *image.NRGBA, site Node) color.NRGBA {
+	b := img.Bounds()
+	x := Min(Max(int(site.X), b.Min.X), b.Max.X-1)
+	y := Min(Max(int(site.Y), b.Min.Y), b.Max.Y-1)
+	return img.NRGBAAt(x, y)
+}
+
+// drawCells draws the cells, like the ones of the Voronoi diagram dual to the triangles, filled with the color
+// of their sites, in the same way as the triangles are drawn by the raster output.
+// In case the palette is not nil, the fill colors are replaced by the closest palette colors.
+func (im *Image) drawCells(dc *gg.Context, img *image.NRGBA, pal color.Palette, cells []Cell) {
+	for _, cell := range cells {
+		if len(cell.Nodes) < 3 {
+			continue
+		}
+		c := siteColor(img, cell.Site)
+		if pal != nil {
+			c = snapColor(pal, c)
+		}
+		a := c.A
+
+		// The transparent areas are left uncovered in case a background color is defined.
+		if a == 0 && im.BgColor != "" {
+			continue
+		}
+		fill := color.RGBAModel.Convert(c).(color.RGBA)
+		stroke := im.strokeFor(fill)
+
+		// Preserve the source image transparency in case no background color is defined.
+		if im.BgColor != "" {
+			c.A = 255
+		}
+		strokeColor := c
+		if im.hasStrokeColor() {
+			strokeColor = color.NRGBAModel.Convert(stroke).(color.NRGBA)
+		}
+
+		dc.Push()
+		dc.MoveTo(cell.Nodes[0].X, cell.Nodes[0].Y)
+		for _, n := range cell.Nodes[1:] {
+			dc.LineTo(n.X, n.Y)
+		}
+		dc.ClosePath()
+
+		switch im.Wireframe {
+		case WithoutWireframe:
+			dc.SetFillStyle(gg.NewSolidPattern(c))
+			dc.FillPreserve()
+			dc.Fill()
+		case WithWireframe:
+			dc.SetFillStyle(gg.NewSolidPattern(c))
+			dc.SetStrokeStyle(gg.NewSolidPattern(im.wireframeStroke(stroke)))
+			dc.SetLineWidth(im.StrokeWidth)
+			dc.FillPreserve()
+			// The stroke is drawn only once in case its opacity is defined, so it's the requested one.
+			if im.StrokeOpacity == 0 {
+				dc.StrokePreserve()
+			}
+			dc.Stroke()
+		case WireframeOnly:
+			dc.SetStrokeStyle(gg.NewSolidPattern(strokeColor))
+			dc.SetLineWidth(im.StrokeWidth)
+			dc.Stroke()
+		}
+		dc.Pop()
+	}
+}
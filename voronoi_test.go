@@ -0,0 +1,68 @@
+package triangle
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewVoronoiDiagram(t *testing.T) {
+	proc := newTestProcessor()
+	tri := &Image{Processor: proc}
+	_, triangles, _, err := tri.Draw(newTestImage(120, 80), proc, func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vd := NewVoronoiDiagram(triangles)
+
+	var valid int
+	for _, t := range triangles {
+		if t.Area() > 0 {
+			valid++
+		}
+	}
+	if len(vd.Vertices) != valid {
+		t.Errorf("expected %d vertices, one for each non-degenerate triangle, got %d", valid, len(vd.Vertices))
+	}
+	for _, e := range vd.Edges {
+		if e[0] == e[1] || e[0] >= len(vd.Vertices) || e[1] >= len(vd.Vertices) {
+			t.Fatalf("invalid edge %v", e)
+		}
+	}
+
+	// The cells contain their sites and they cover the image without overlapping.
+	var area float64
+	for _, c := range vd.Cells {
+		var a float64
+		for i, n := range c.Nodes {
+			m := c.Nodes[(i+1)%len(c.Nodes)]
+			a += n.X*m.Y - m.X*n.Y
+		}
+		area += math.Abs(a) / 2
+
+		if !polygonContains(c.Nodes, c.Site) {
+			t.Errorf("expected the cell %v to contain its site %v", c.Nodes, c.Site)
+		}
+	}
+	if math.Abs(area-120*80) > 1e-6 {
+		t.Errorf("expected the cells to cover the area %v, got %v", 120*80, area)
+	}
+}
+
+// polygonContains checks if the point is inside the convex polygon or on its border.
+func polygonContains(polygon []Node, p Node) bool {
+	var sign float64
+	for i, a := range polygon {
+		b := polygon[(i+1)%len(polygon)]
+		cross := (b.X-a.X)*(p.Y-a.Y) - (b.Y-a.Y)*(p.X-a.X)
+		if math.Abs(cross) < 1e-9 {
+			continue
+		}
+		if sign == 0 {
+			sign = cross
+		} else if sign*cross < 0 {
+			return false
+		}
+	}
+	return true
+}
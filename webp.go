@@ -0,0 +1,474 @@
+package triangle
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"sort"
+)
+
+// The WebP lossless (VP8L) bitstream constants.
+const (
+	vp8lSignature      = 0x2f
+	vp8lMaxDimension   = 1 << 14
+	vp8lMaxCodeLength  = 15
+	vp8lMaxCLCodeLen   = 7
+	vp8lNumLiterals    = 256
+	vp8lNumLengthCodes = 24
+	vp8lNumDistCodes   = 40
+	vp8lMaxCopyLength  = 4096
+	vp8lMinCopyLength  = 2
+	vp8lCacheBits      = 10
+	vp8lSubtractGreen  = 2
+)
+
+// webpDistances holds the pixel offsets of the neighbours searched for backward references,
+// indexed by their distance code from the VP8L distance map: above, left, above left and above right.
+var webpDistances = [...][2]int{{0, 1}, {1, 0}, {1, 1}, {-1, 1}}
+
+// clCodeOrder is the order in which the code length code lengths are stored in the bitstream.
+var clCodeOrder = [...]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// webpToken is either a literal ARGB pixel, a color cache index or a backward reference to already encoded pixels.
+type webpToken struct {
+	pixel  [4]uint8 // green, red, blue, alpha
+	cache  int      // the color cache index plus one, 0 if the pixel is not cached
+	length int      // the copy length, 0 for literal pixels
+	dist   int      // the distance code of the backward reference
+}
+
+// webpBitWriter writes the bits in the LSB first order required by VP8L.
+type webpBitWriter struct {
+	buf  []byte
+	acc  uint64
+	nacc uint
+}
+
+func (bw *webpBitWriter) write(v uint32, n uint) {
+	bw.acc |= uint64(v) << bw.nacc
+	bw.nacc += n
+	for bw.nacc >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nacc -= 8
+	}
+}
+
+func (bw *webpBitWriter) flush() []byte {
+	if bw.nacc > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc, bw.nacc = 0, 0
+	}
+	return bw.buf
+}
+
+// prefixCode holds the canonical code lengths and the bit reversed codes of an alphabet.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func (pc *prefixCode) write(bw *webpBitWriter, symbol int) {
+	bw.write(pc.codes[symbol], uint(pc.lengths[symbol]))
+}
+
+// EncodeWebP writes the image to w in the lossless WebP (VP8L) format.
+// The quality, between 1 and 100, controls the color precision of the encoded image:
+// values below 100 quantize the color channels before encoding, which results in smaller files.
+// The alpha channel is always preserved.
+func EncodeWebP(w io.Writer, img image.Image, quality int) error {
+	src := ImgToNRGBA(img)
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	if width < 1 || height < 1 || width > vp8lMaxDimension || height > vp8lMaxDimension {
+		return errors.New("webp: invalid image size")
+	}
+
+	if quality < 1 || quality > 100 {
+		quality = 100
+	}
+	shift := uint((100 - quality) / 20)
+
+	hasAlpha := false
+	pixels := make([][4]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*src.Stride + x*4
+			r, g, b, a := src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3]
+			if a != 0xff {
+				hasAlpha = true
+			}
+			// Apply the subtract green transform to decorrelate the color channels.
+			r, g, b = quantize(r, shift), quantize(g, shift), quantize(b, shift)
+			pixels[y*width+x] = [4]uint8{g, r - g, b - g, a}
+		}
+	}
+	tokens := webpTokens(pixels, width)
+
+	// Build the histograms of the five prefix code groups: green, red, blue, alpha and distance.
+	var (
+		green = make([]int, vp8lNumLiterals+vp8lNumLengthCodes+1<<vp8lCacheBits)
+		red   = make([]int, vp8lNumLiterals)
+		blue  = make([]int, vp8lNumLiterals)
+		alpha = make([]int, vp8lNumLiterals)
+		dist  = make([]int, vp8lNumDistCodes)
+	)
+	for _, t := range tokens {
+		if t.length > 0 {
+			lc, _, _ := prefixEncode(t.length)
+			dc, _, _ := prefixEncode(t.dist)
+			green[vp8lNumLiterals+lc]++
+			dist[dc]++
+			continue
+		}
+		if t.cache > 0 {
+			green[vp8lNumLiterals+vp8lNumLengthCodes+t.cache-1]++
+			continue
+		}
+		green[t.pixel[0]]++
+		red[t.pixel[1]]++
+		blue[t.pixel[2]]++
+		alpha[t.pixel[3]]++
+	}
+
+	bw := &webpBitWriter{}
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+	bw.write(1, 1) // transform present
+	bw.write(vp8lSubtractGreen, 2)
+	bw.write(0, 1) // no more transforms
+	bw.write(1, 1) // color cache
+	bw.write(vp8lCacheBits, 4)
+	bw.write(0, 1) // no meta prefix codes
+
+	codes := make([]*prefixCode, 0, 5)
+	for _, histo := range [][]int{green, red, blue, alpha, dist} {
+		codes = append(codes, writePrefixCode(bw, histo))
+	}
+
+	for _, t := range tokens {
+		if t.length > 0 {
+			lc, lbits, lextra := prefixEncode(t.length)
+			codes[0].write(bw, vp8lNumLiterals+lc)
+			bw.write(lextra, lbits)
+			dc, dbits, dextra := prefixEncode(t.dist)
+			codes[4].write(bw, dc)
+			bw.write(dextra, dbits)
+			continue
+		}
+		if t.cache > 0 {
+			codes[0].write(bw, vp8lNumLiterals+vp8lNumLengthCodes+t.cache-1)
+			continue
+		}
+		for c := 0; c < 4; c++ {
+			codes[c].write(bw, int(t.pixel[c]))
+		}
+	}
+	data := bw.flush()
+
+	size := len(data)
+	pad := size & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+size+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(size))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if pad > 0 {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// quantize reduces the precision of a color channel by rounding it to a multiple of 2^shift.
+func quantize(v uint8, shift uint) uint8 {
+	if shift == 0 {
+		return v
+	}
+	q := (int(v) + (1 << (shift - 1))) >> shift << shift
+	return uint8(Min(q, 0xff>>shift<<shift))
+}
+
+// webpTokens converts the pixels into a stream of literals, color cache hits and backward references.
+// Flat shaded images consist of long runs of identical pixels, so it's sufficient
+// to look for matches only with the neighbouring pixels on the left and in the row above.
+func webpTokens(pixels [][4]uint8, width int) []webpToken {
+	var cache [1 << vp8lCacheBits][4]uint8
+	var cached [1 << vp8lCacheBits]bool
+	cacheIndex := func(p [4]uint8) int {
+		argb := uint32(p[3])<<24 | uint32(p[1])<<16 | uint32(p[0])<<8 | uint32(p[2])
+		return int((0x1e35a7bd * argb) >> (32 - vp8lCacheBits))
+	}
+
+	tokens := make([]webpToken, 0, len(pixels)/4)
+	matchLen := func(i, dist int) int {
+		n := 0
+		for i+n < len(pixels) && n < vp8lMaxCopyLength && pixels[i+n] == pixels[i+n-dist] {
+			n++
+		}
+		return n
+	}
+
+	for i := 0; i < len(pixels); {
+		var length, code int
+		x := i % width
+		for c, d := range webpDistances {
+			dist := d[0] + d[1]*width
+			if x-d[0] < 0 || x-d[0] >= width || dist < 1 || dist > i {
+				continue
+			}
+			if n := matchLen(i, dist); n > length {
+				length, code = n, c+1
+			}
+		}
+
+		n := 1
+		if length >= vp8lMinCopyLength {
+			tokens = append(tokens, webpToken{length: length, dist: code})
+			n = length
+		} else {
+			idx := cacheIndex(pixels[i])
+			if cached[idx] && cache[idx] == pixels[i] {
+				tokens = append(tokens, webpToken{cache: idx + 1})
+			} else {
+				tokens = append(tokens, webpToken{pixel: pixels[i]})
+			}
+		}
+		for ; n > 0; n-- {
+			idx := cacheIndex(pixels[i])
+			cache[idx], cached[idx] = pixels[i], true
+			i++
+		}
+	}
+	return tokens
+}
+
+// prefixEncode returns the prefix code, the number of extra bits and
+// the extra bits value of a backward reference length or distance.
+func prefixEncode(v int) (int, uint, uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := 0
+	for (d >> (h + 1)) > 0 {
+		h++
+	}
+	second := (d >> (h - 1)) & 1
+	bits := uint(h - 1)
+	return 2*h + second, bits, uint32(d & (1<<bits - 1))
+}
+
+// writePrefixCode builds the prefix code of the histogram and writes it into the bitstream.
+func writePrefixCode(bw *webpBitWriter, histo []int) *prefixCode {
+	symbols := make([]int, 0, 2)
+	for s, f := range histo {
+		if f > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+
+	pc := &prefixCode{
+		lengths: make([]uint8, len(histo)),
+		codes:   make([]uint32, len(histo)),
+	}
+
+	// A single symbol is stored as a simple code and it's encoded with zero bits.
+	if len(symbols) == 0 || (len(symbols) == 1 && symbols[0] < vp8lNumLiterals) {
+		s := 0
+		if len(symbols) == 1 {
+			s = symbols[0]
+		}
+		bw.write(1, 1) // simple code
+		bw.write(0, 1) // one symbol
+		if s < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(s), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(s), 8)
+		}
+		return pc
+	}
+	if len(symbols) == 1 {
+		// A normal code requires at least two symbols to be complete.
+		histo = append([]int(nil), histo...)
+		histo[0]++
+	}
+
+	pc.lengths = huffmanLengths(histo, vp8lMaxCodeLength)
+	pc.codes = canonicalCodes(pc.lengths)
+
+	// Encode the code lengths using the repeat zero codes (17 and 18) for the unused symbols.
+	type clToken struct {
+		symbol int
+		extra  uint32
+		bits   uint
+	}
+	var (
+		clTokens []clToken
+		clHisto  = make([]int, len(clCodeOrder))
+	)
+	for i := 0; i < len(pc.lengths); {
+		if pc.lengths[i] != 0 {
+			clTokens = append(clTokens, clToken{symbol: int(pc.lengths[i])})
+			clHisto[pc.lengths[i]]++
+			i++
+			continue
+		}
+		run := 0
+		for i+run < len(pc.lengths) && pc.lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			clTokens = append(clTokens, clToken{symbol: 18, extra: uint32(run - 11), bits: 7})
+			clHisto[18]++
+		case run >= 3:
+			clTokens = append(clTokens, clToken{symbol: 17, extra: uint32(run - 3), bits: 3})
+			clHisto[17]++
+		default:
+			for j := 0; j < run; j++ {
+				clTokens = append(clTokens, clToken{symbol: 0})
+			}
+			clHisto[0] += run
+		}
+		i += run
+	}
+
+	clUsed := 0
+	for _, f := range clHisto {
+		if f > 0 {
+			clUsed++
+		}
+	}
+	if clUsed == 1 {
+		// Add a never used symbol to keep the code length code complete.
+		for s := range clHisto {
+			if clHisto[s] == 0 {
+				clHisto[s] = 1
+				break
+			}
+		}
+	}
+	clLengths := huffmanLengths(clHisto, vp8lMaxCLCodeLen)
+	clCodes := canonicalCodes(clLengths)
+
+	numCodes := 4
+	for i, s := range clCodeOrder {
+		if clLengths[s] > 0 && i+1 > numCodes {
+			numCodes = i + 1
+		}
+	}
+
+	bw.write(0, 1) // normal code
+	bw.write(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		bw.write(uint32(clLengths[clCodeOrder[i]]), 3)
+	}
+	bw.write(0, 1) // the code lengths are stored for the whole alphabet
+	for _, t := range clTokens {
+		bw.write(clCodes[t.symbol], uint(clLengths[t.symbol]))
+		bw.write(t.extra, t.bits)
+	}
+	return pc
+}
+
+// huffmanLengths computes the Huffman code lengths of the histogram limited to maxLen bits.
+// In case the tree is too deep, the small frequencies are raised until the code fits.
+func huffmanLengths(histo []int, maxLen int) []uint8 {
+	type node struct {
+		freq        int
+		symbol      int
+		left, right int
+	}
+
+	lengths := make([]uint8, len(histo))
+	for floor := 1; ; floor *= 2 {
+		nodes := make([]node, 0, 2*len(histo))
+		active := make([]int, 0, len(histo))
+		for s, f := range histo {
+			if f > 0 {
+				nodes = append(nodes, node{freq: Max(f, floor), symbol: s, left: -1, right: -1})
+				active = append(active, len(nodes)-1)
+			}
+		}
+		for len(active) > 1 {
+			sort.Slice(active, func(i, j int) bool {
+				a, b := nodes[active[i]], nodes[active[j]]
+				if a.freq != b.freq {
+					return a.freq < b.freq
+				}
+				return active[i] < active[j]
+			})
+			nodes = append(nodes, node{
+				freq:   nodes[active[0]].freq + nodes[active[1]].freq,
+				symbol: -1,
+				left:   active[0],
+				right:  active[1],
+			})
+			active = append(active[2:], len(nodes)-1)
+		}
+
+		depth := 0
+		var walk func(n, d int)
+		walk = func(n, d int) {
+			if nodes[n].symbol >= 0 {
+				lengths[nodes[n].symbol] = uint8(d)
+				depth = Max(depth, d)
+				return
+			}
+			walk(nodes[n].left, d+1)
+			walk(nodes[n].right, d+1)
+		}
+		walk(active[0], 0)
+
+		if depth <= maxLen {
+			return lengths
+		}
+	}
+}
+
+// canonicalCodes assigns the canonical prefix codes to the code lengths.
+// The codes are bit reversed, since VP8L reads them starting with the least significant bit.
+func canonicalCodes(lengths []uint8) []uint32 {
+	var count [vp8lMaxCodeLength + 1]int
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+
+	var next [vp8lMaxCodeLength + 1]uint32
+	code := uint32(0)
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		code = (code + uint32(count[l-1])) << 1
+		next[l] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+
+		rev := uint32(0)
+		for i := uint8(0); i < l; i++ {
+			rev = rev<<1 | (c>>i)&1
+		}
+		codes[s] = rev
+	}
+	return codes
+}
@@ -0,0 +1,105 @@
+package triangle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP_Header(t *testing.T) {
+	img := newTestImage(120, 80)
+
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, img, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := buf.Bytes()
+	if len(b) < 25 || string(b[0:4]) != "RIFF" || string(b[8:16]) != "WEBPVP8L" {
+		t.Fatalf("invalid WebP container header: %q", b[:Min(len(b), 16)])
+	}
+	if size := binary.LittleEndian.Uint32(b[4:]); int(size) != len(b)-8 {
+		t.Errorf("expected RIFF size %d, got %d", len(b)-8, size)
+	}
+	if b[20] != vp8lSignature {
+		t.Fatalf("expected the VP8L signature, got %#x", b[20])
+	}
+	bits := binary.LittleEndian.Uint32(b[21:])
+	w, h, alpha := int(bits&0x3fff)+1, int(bits>>14&0x3fff)+1, bits>>28&1
+	if w != 120 || h != 80 {
+		t.Errorf("expected 120x80 image, got %dx%d", w, h)
+	}
+	if alpha != 0 {
+		t.Errorf("expected the alpha hint to be unset for an opaque image")
+	}
+}
+
+func TestEncodeWebP_Quality(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+
+	var lossless, lossy bytes.Buffer
+	if err := EncodeWebP(&lossless, img, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := EncodeWebP(&lossy, img, 50); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lossy.Len() >= lossless.Len() {
+		t.Errorf("expected a smaller file on lower quality, got %d >= %d bytes", lossy.Len(), lossless.Len())
+	}
+}
+
+// decodeWebP decodes the WebP image with the reference decoder, returning it as an NRGBA image.
+func decodeWebP(t *testing.T, b []byte) *image.NRGBA {
+	t.Helper()
+	img, err := webp.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("unable to decode the WebP image: %v", err)
+	}
+	return ImgToNRGBA(img)
+}
+
+func TestEncodeWebP_Decode(t *testing.T) {
+	// The random pixels, including the semi-transparent ones, exercise every prefix code,
+	// while the repeated rows exercise the backward references.
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	rand.New(rand.NewSource(1)).Read(img.Pix[:len(img.Pix)/2])
+	copy(img.Pix[len(img.Pix)/2:], img.Pix)
+
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, img, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := decodeWebP(t, buf.Bytes())
+	if got.Bounds().Size() != img.Bounds().Size() {
+		t.Fatalf("expected %v size, got %v", img.Bounds().Size(), got.Bounds().Size())
+	}
+	// The lossless image keeps the exact colors, the fully transparent pixels included.
+	for i := 0; i < len(img.Pix); i += 4 {
+		if !bytes.Equal(got.Pix[i:i+4], img.Pix[i:i+4]) {
+			t.Fatalf("expected %v at pixel %d, got %v", img.Pix[i:i+4], i/4, got.Pix[i:i+4])
+		}
+	}
+
+	// The lower quality quantizes the color channels, keeping the alpha channel.
+	buf.Reset()
+	if err := EncodeWebP(&buf, img, 50); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = decodeWebP(t, buf.Bytes())
+	shift := uint((100 - 50) / 20)
+	for i := 0; i < len(img.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			if want := quantize(img.Pix[i+c], shift); got.Pix[i+c] != want {
+				t.Fatalf("expected the channel %d of pixel %d to be quantized to %d, got %d", c, i/4, want, got.Pix[i+c])
+			}
+		}
+		if got.Pix[i+3] != img.Pix[i+3] {
+			t.Fatalf("expected the alpha %d at pixel %d, got %d", img.Pix[i+3], i/4, got.Pix[i+3])
+		}
+	}
+}